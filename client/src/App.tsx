@@ -1,10 +1,51 @@
+import { useEffect, useState } from 'react';
 import { Dashboard } from './components/Dashboard';
+import { LoginForm } from './components/LoginForm';
 import { Toaster } from './components/ui/sonner';
+import { authService } from './services/authService';
+import type { User } from './services/api';
+import { RefreshCw } from 'lucide-react';
+import { toast } from 'sonner';
+
+type AuthState =
+  | { status: 'loading' }
+  | { status: 'signed-out' }
+  | { status: 'signed-in'; user?: User };
 
 export default function App() {
+  const [auth, setAuth] = useState<AuthState>({ status: 'loading' });
+
+  useEffect(() => {
+    authService
+      .currentUser()
+      .then((user) =>
+        setAuth(user === null ? { status: 'signed-out' } : { status: 'signed-in', user })
+      )
+      .catch(() => setAuth({ status: 'signed-out' }));
+  }, []);
+
+  const handleSignOut = async () => {
+    try {
+      await authService.logout();
+    } catch (error) {
+      toast.error('Failed to sign out');
+    }
+    setAuth({ status: 'signed-out' });
+  };
+
   return (
     <div className="min-h-screen bg-background">
-      <Dashboard />
+      {auth.status === 'loading' && (
+        <div className="flex items-center justify-center h-96">
+          <RefreshCw className="h-8 w-8 animate-spin text-muted-foreground" />
+        </div>
+      )}
+      {auth.status === 'signed-out' && (
+        <LoginForm onSignedIn={(user) => setAuth({ status: 'signed-in', user })} />
+      )}
+      {auth.status === 'signed-in' && (
+        <Dashboard user={auth.user} onSignOut={handleSignOut} />
+      )}
       <Toaster />
     </div>
   );
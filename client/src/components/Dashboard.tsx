@@ -8,12 +8,17 @@ import { CreateDirectoryDialog } from "./CreateDirectoryDialog";
 import { RenameDialog } from "./RenameDialog";
 import { DeleteConfirmDialog } from "./DeleteConfirmDialog";
 import { fileService } from "@/services/fileService";
-import type { ListFilesResponse } from "@/services/api";
-import { FolderPlus, RefreshCw, HardDrive } from "lucide-react";
+import type { ListFilesResponse, User } from "@/services/api";
+import { FolderPlus, RefreshCw, HardDrive, LogOut } from "lucide-react";
 import { toast } from "sonner";
 import { formatFileSize } from "@/lib/formatters";
 
-export const Dashboard: React.FC = () => {
+interface DashboardProps {
+  user?: User;
+  onSignOut?: () => void;
+}
+
+export const Dashboard: React.FC<DashboardProps> = ({ user, onSignOut }) => {
   const [currentPath, setCurrentPath] = useState("/");
   const [data, setData] = useState<ListFilesResponse | null>(null);
   const [isLoading, setIsLoading] = useState(true);
@@ -125,11 +130,22 @@ export const Dashboard: React.FC = () => {
 
   return (
     <div className="container mx-auto px-4 py-8 max-w-6xl">
-      <div className="mb-8">
-        <h1 className="text-3xl font-bold mb-2">☁️ Cloudlet</h1>
-        <p className="text-muted-foreground">
-          Simple, fast, and secure file storage
-        </p>
+      <div className="mb-8 flex items-start justify-between">
+        <div>
+          <h1 className="text-3xl font-bold mb-2">☁️ Cloudlet</h1>
+          <p className="text-muted-foreground">
+            Simple, fast, and secure file storage
+          </p>
+        </div>
+        {user && onSignOut && (
+          <div className="flex items-center gap-3">
+            <span className="text-sm text-muted-foreground">{user.username}</span>
+            <Button variant="outline" size="sm" onClick={onSignOut}>
+              <LogOut className="h-4 w-4 mr-2" />
+              Sign out
+            </Button>
+          </div>
+        )}
       </div>
 
       <div className="grid gap-6 lg:grid-cols-3">
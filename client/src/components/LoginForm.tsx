@@ -0,0 +1,67 @@
+import React, { useState } from 'react';
+import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { authService } from '@/services/authService';
+import type { User } from '@/services/api';
+import { toast } from 'sonner';
+
+interface LoginFormProps {
+  onSignedIn: (user: User) => void;
+}
+
+export const LoginForm: React.FC<LoginFormProps> = ({ onSignedIn }) => {
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [isSigningIn, setIsSigningIn] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!username.trim() || !password) {
+      toast.error('Please enter your username and password');
+      return;
+    }
+
+    setIsSigningIn(true);
+    try {
+      const user = await authService.login(username.trim(), password);
+      setPassword('');
+      onSignedIn(user);
+    } catch (error) {
+      toast.error('Invalid username or password');
+    } finally {
+      setIsSigningIn(false);
+    }
+  };
+
+  return (
+    <div className="flex min-h-screen items-center justify-center px-4">
+      <Card className="w-full max-w-sm">
+        <CardHeader>
+          <CardTitle className="text-2xl">☁️ Cloudlet</CardTitle>
+        </CardHeader>
+        <CardContent>
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <Input
+              placeholder="Username"
+              autoComplete="username"
+              value={username}
+              onChange={(e) => setUsername(e.target.value)}
+              autoFocus
+            />
+            <Input
+              type="password"
+              placeholder="Password"
+              autoComplete="current-password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+            />
+            <Button type="submit" className="w-full" disabled={isSigningIn}>
+              {isSigningIn ? 'Signing in...' : 'Sign in'}
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+    </div>
+  );
+};
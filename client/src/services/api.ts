@@ -16,6 +16,14 @@ export const fetcher = async (url: string, options?: RequestInit) => {
   return response.json();
 };
 
+export interface User {
+  id: number;
+  username: string;
+  is_admin: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
 export interface FileInfo {
   name: string;
   size: number;
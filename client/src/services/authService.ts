@@ -0,0 +1,31 @@
+import { fetcher } from './api';
+import type { User } from './api';
+
+export const authService = {
+  async login(username: string, password: string): Promise<User> {
+    const response = await fetcher('/auth/login', {
+      method: 'POST',
+      body: JSON.stringify({ username, password }),
+    });
+    return response.user;
+  },
+
+  async logout(): Promise<void> {
+    await fetcher('/auth/logout', { method: 'POST' });
+  },
+
+  // Resolves to null when signed out and to undefined when the server has authentication disabled
+  async currentUser(): Promise<User | null | undefined> {
+    const response = await fetch('/api/v1/auth/me');
+    if (response.status === 401) {
+      return null;
+    }
+    if (response.status === 404) {
+      return undefined;
+    }
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+    return response.json();
+  },
+};
@@ -3,49 +3,134 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/metrics"
 	"github.com/anddsdev/cloudlet/internal/repository"
 	"github.com/anddsdev/cloudlet/internal/server"
 	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/storage"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 )
 
 func main() {
 	// Load configuration from environment variables first, fallback to YAML
 	cfg, err := config.NewConfig("./config/config.yaml")
 	if err != nil {
-		log.Fatalf("error loading config: %v", err)
+		fatal("error loading config", err)
 	}
 
+	logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	if err != nil {
+		fatal("error configuring logging", err)
+	}
+	slog.SetDefault(logger)
+
 	// Log configuration source for debugging
-	log.Printf("Configuration loaded successfully")
-	log.Printf("Server will start on port: %s", cfg.Server.Port)
-	log.Printf("Storage path: %s", cfg.Server.Storage.Path)
-	log.Printf("Database DSN: %s", cfg.Database.DSN)
+	slog.Info("Configuration loaded",
+		"port", cfg.Server.Port,
+		"storage_path", cfg.Server.Storage.Path,
+		"database_dsn", cfg.Database.DSN,
+	)
+
+	if cfg.Tracing.Enabled {
+		exporter, err := tracing.NewExporter(cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.File)
+		if err != nil {
+			fatal("error configuring tracing", err)
+		}
+		tracer := tracing.NewTracer(cfg.Tracing.ServiceName, cfg.Tracing.SampleRatio, exporter)
+		tracing.SetDefault(tracer)
+		defer shutdownTracing(tracer)
+		slog.Info("Tracing enabled", "exporter", cfg.Tracing.Exporter, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
 
 	repo, err := repository.NewFileRepository(cfg.Database.DSN, cfg.Database.MaxConn)
 	if err != nil {
-		log.Fatalf("error creating repository: %v", err)
+		fatal("error creating repository", err)
 	}
 	defer repo.Close()
 
 	// Verify that the storage directory exists
 	if err := ensureStorageDirectory(cfg.Server.Storage.Path); err != nil {
-		log.Fatalf("error ensuring storage directory: %v", err)
+		fatal("error ensuring storage directory", err)
 	}
 
-	storageService := services.NewStorageService(cfg.Server.Storage.Path)
+	storageService, err := services.NewStorageServiceFromConfig(cfg)
+	if err != nil {
+		fatal("error creating storage backend", err)
+	}
 	defer storageService.Close()
+	if cfg.Server.Storage.Backend == storage.BackendS3 {
+		slog.Info("Storing files in S3", "bucket", cfg.Server.Storage.S3.Bucket, "endpoint", cfg.Server.Storage.S3.Endpoint)
+	}
 
 	fileService := services.NewFileService(repo, storageService, cfg.Server.Storage.Path)
+	if cfg.Server.Storage.Deduplicate {
+		fileService.EnableDeduplication()
+		slog.Info("Content deduplication enabled")
+	}
+	fileService.SetVersionRetention(
+		cfg.Server.Storage.Versions.Keep,
+		time.Duration(cfg.Server.Storage.Versions.MaxAgeDays)*24*time.Hour,
+	)
+	if cfg.Server.Storage.Trash.Enabled {
+		fileService.EnableTrash(time.Duration(cfg.Server.Storage.Trash.RetentionDays) * 24 * time.Hour)
+	}
+
+	// Blobs are collected even with deduplication off, since files stored while it was on may still be deleted
+	if cfg.Server.Storage.GCIntervalMinutes > 0 {
+		stopGC := fileService.StartGarbageCollector(time.Duration(cfg.Server.Storage.GCIntervalMinutes) * time.Minute)
+		defer stopGC()
+	}
+
+	// Usage is tracked by the repository either way, so quotas are always enforced
+	fileService.SetQuotas(services.NewQuotaService(repository.NewQuotaRepository(repo.DB())))
+	fileService.SetShares(services.NewShareService(repository.NewShareRepository(repo.DB())))
+	fileService.SetAudit(services.NewAuditService(repository.NewAuditRepository(repo.DB())))
+
+	authService := services.NewAuthService(
+		repository.NewUserRepository(repo.DB()),
+		time.Duration(cfg.Auth.SessionTTLHours)*time.Hour,
+	)
+	if cfg.Auth.Enabled {
+		fileService.SetAccessControl(services.NewAccessControlService(repository.NewACLRepository(repo.DB())))
+		if cfg.Auth.HomeDirectories {
+			if err := fileService.EnableHomeDirectories(cfg.Auth.HomesPath); err != nil {
+				fatal("error enabling home directories", err)
+			}
+			slog.Info("Users are confined to home directories", "homes_path", cfg.Auth.HomesPath)
+		}
+
+		generatedPassword, err := authService.EnsureAdmin(cfg.Auth.AdminUsername, cfg.Auth.AdminPassword)
+		if err != nil {
+			fatal("error creating admin user", err)
+		}
+		if generatedPassword != "" {
+			// The password is kept out of the logs, which are often shipped elsewhere
+			passwordFile := filepath.Join(filepath.Dir(cfg.Database.DSN), "admin-password")
+			if err := writeSecret(passwordFile, generatedPassword); err != nil {
+				fatal("error saving the generated admin password", err)
+			}
+			slog.Warn("Created admin user with a generated password, read it from the file, then change it after signing in and delete the file",
+				"username", cfg.Auth.AdminUsername, "password_file", passwordFile)
+		}
+	} else {
+		slog.Warn("Authentication is disabled, every route is open to anyone who can reach the server")
+	}
+
+	if cfg.Metrics.Enabled {
+		fileService.RegisterMetrics(metrics.Default)
+	}
 
-	httpServer := server.NewServer(cfg, fileService)
+	httpServer := server.NewServer(cfg, fileService, authService)
 
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%s", cfg.Server.Port),
@@ -55,12 +140,13 @@ func main() {
 		IdleTimeout:       time.Duration(cfg.Server.Timeout.IdleTimeout) * time.Second,
 		MaxHeaderBytes:    cfg.Server.Timeout.MaxHeaderBytes,
 		ReadHeaderTimeout: time.Duration(cfg.Server.Timeout.ReadHeaderTimeout) * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
 	go func() {
-		log.Printf("starting server on port %s", cfg.Server.Port)
+		slog.Info("Starting server", "port", cfg.Server.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+			fatal("server error", err)
 		}
 	}()
 
@@ -68,16 +154,16 @@ func main() {
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		fatal("server forced to shutdown", err)
 	}
 
-	log.Println("Server exited cleanly")
+	slog.Info("Server exited cleanly")
 }
 
 // Verify if the storage directory exists, and create it if not
@@ -86,7 +172,41 @@ func ensureStorageDirectory(storagePath string) error {
 		if err := os.MkdirAll(storagePath, 0755); err != nil {
 			return fmt.Errorf("failed to create storage directory %s: %w", storagePath, err)
 		}
-		log.Printf("Created storage directory: %s", storagePath)
+		slog.Info("Created storage directory", "path", storagePath)
 	}
 	return nil
 }
+
+// shutdownTracing exports the spans still queued when the server stops
+func shutdownTracing(tracer *tracing.Tracer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := tracer.Shutdown(ctx); err != nil {
+		slog.Warn("Failed to export the last spans", "error", err)
+	}
+}
+
+// writeSecret writes secret to a file only its owner can read
+func writeSecret(path, secret string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// A file left from an earlier install keeps its mode when truncated
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.WriteString(secret + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
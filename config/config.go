@@ -10,11 +10,32 @@ import (
 
 type Config struct {
 	Server struct {
-		Port        string `yaml:"port"`
-		MaxMemory   int    `yaml:"max_memory"`
-		MaxFileSize int64  `yaml:"max_file_size"`
-		Storage     struct {
-			Path string `yaml:"path"`
+		Port           string   `yaml:"port"`
+		MaxMemory      int      `yaml:"max_memory"`
+		MaxFileSize    int64    `yaml:"max_file_size"`
+		AllowedOrigins []string `yaml:"allowed_origins"`
+		Storage        struct {
+			Path              string `yaml:"path"`
+			Backend           string `yaml:"backend"`
+			Deduplicate       bool   `yaml:"deduplicate"`
+			GCIntervalMinutes int    `yaml:"gc_interval_minutes"`
+			Versions          struct {
+				Keep       int `yaml:"keep"`
+				MaxAgeDays int `yaml:"max_age_days"`
+			} `yaml:"versions"`
+			Trash struct {
+				Enabled       bool `yaml:"enabled"`
+				RetentionDays int  `yaml:"retention_days"`
+			} `yaml:"trash"`
+			S3 struct {
+				Endpoint        string `yaml:"endpoint"`
+				Region          string `yaml:"region"`
+				Bucket          string `yaml:"bucket"`
+				AccessKeyID     string `yaml:"access_key_id"`
+				SecretAccessKey string `yaml:"secret_access_key"`
+				Prefix          string `yaml:"prefix"`
+				UsePathStyle    bool   `yaml:"use_path_style"`
+			} `yaml:"s3"`
 		} `yaml:"storage"`
 		Timeout struct {
 			ReadTimeout       int `yaml:"read_timeout"`
@@ -35,6 +56,8 @@ type Config struct {
 			EnableProgressTracking bool  `yaml:"enable_progress_tracking"`
 			CleanupOnFailure       bool  `yaml:"cleanup_on_failure"`
 			RateLimitPerMinute     int   `yaml:"rate_limit_per_minute"`
+			ChunkSize              int64 `yaml:"chunk_size"`
+			SessionTTLHours        int   `yaml:"session_ttl_hours"`
 		} `yaml:"upload"`
 	} `yaml:"server"`
 
@@ -42,6 +65,47 @@ type Config struct {
 		DSN     string `yaml:"dsn"`
 		MaxConn int    `yaml:"max_conn"`
 	} `yaml:"database"`
+
+	Auth struct {
+		Enabled         bool   `yaml:"enabled"`
+		SessionTTLHours int    `yaml:"session_ttl_hours"`
+		SecureCookies   bool   `yaml:"secure_cookies"`
+		AdminUsername   string `yaml:"admin_username"`
+		AdminPassword   string `yaml:"admin_password"`
+		HomeDirectories bool   `yaml:"home_directories"`
+		HomesPath       string `yaml:"homes_path"`
+	} `yaml:"auth"`
+
+	RateLimit struct {
+		Enabled              bool  `yaml:"enabled"`
+		RequestsPerMinute    int64 `yaml:"requests_per_minute"`     // per client, 0 for no limit
+		UploadBytesPerMinute int64 `yaml:"upload_bytes_per_minute"` // per client, 0 for no limit
+		MaxClients           int   `yaml:"max_clients"`             // clients tracked at once
+		TrustProxyHeaders    bool  `yaml:"trust_proxy_headers"`     // key clients by X-Forwarded-For
+	} `yaml:"rate_limit"`
+
+	Health struct {
+		MinFreeDiskMB int64 `yaml:"min_free_disk_mb"` // readiness fails below this much free space
+	} `yaml:"health"`
+
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Token   string `yaml:"token"`
+	} `yaml:"metrics"`
+
+	Logging struct {
+		Level  string `yaml:"level"`
+		Format string `yaml:"format"`
+	} `yaml:"logging"`
+
+	Tracing struct {
+		Enabled     bool    `yaml:"enabled"`
+		Exporter    string  `yaml:"exporter"` // otlp, stdout or file
+		Endpoint    string  `yaml:"endpoint"` // OTLP/HTTP collector URL
+		File        string  `yaml:"file"`
+		SampleRatio float64 `yaml:"sample_ratio"`
+		ServiceName string  `yaml:"service_name"`
+	} `yaml:"tracing"`
 }
 
 // NewConfig creates a new configuration instance from environment variables
@@ -80,7 +144,24 @@ func loadFromEnv(config *Config) error {
 	config.Server.Port = getEnvString("PORT", "8080")
 	config.Server.MaxMemory = getEnvInt("MAX_MEMORY", 32000000)
 	config.Server.MaxFileSize = getEnvInt64("MAX_FILE_SIZE", 100000000)
+	config.Server.AllowedOrigins = getEnvStringSlice("CORS_ALLOWED_ORIGINS", nil)
 	config.Server.Storage.Path = getEnvString("STORAGE_PATH", "./data/storage")
+	config.Server.Storage.Backend = getEnvString("STORAGE_BACKEND", "local")
+	config.Server.Storage.Deduplicate = getEnvBool("STORAGE_DEDUPLICATE", false)
+	config.Server.Storage.GCIntervalMinutes = getEnvInt("STORAGE_GC_INTERVAL_MINUTES", 60)
+	config.Server.Storage.Versions.Keep = getEnvInt("STORAGE_VERSIONS_KEEP", 10)
+	config.Server.Storage.Versions.MaxAgeDays = getEnvInt("STORAGE_VERSIONS_MAX_AGE_DAYS", 0)
+	config.Server.Storage.Trash.Enabled = getEnvBool("STORAGE_TRASH_ENABLED", true)
+	config.Server.Storage.Trash.RetentionDays = getEnvInt("STORAGE_TRASH_RETENTION_DAYS", 30)
+
+	// S3-compatible backend configuration
+	config.Server.Storage.S3.Endpoint = getEnvString("S3_ENDPOINT", "")
+	config.Server.Storage.S3.Region = getEnvString("S3_REGION", "us-east-1")
+	config.Server.Storage.S3.Bucket = getEnvString("S3_BUCKET", "")
+	config.Server.Storage.S3.AccessKeyID = getEnvString("S3_ACCESS_KEY_ID", "")
+	config.Server.Storage.S3.SecretAccessKey = getEnvString("S3_SECRET_ACCESS_KEY", "")
+	config.Server.Storage.S3.Prefix = getEnvString("S3_PREFIX", "")
+	config.Server.Storage.S3.UsePathStyle = getEnvBool("S3_USE_PATH_STYLE", true)
 
 	// Timeout configuration
 	config.Server.Timeout.ReadTimeout = getEnvInt("READ_TIMEOUT", 30)
@@ -101,11 +182,48 @@ func loadFromEnv(config *Config) error {
 	config.Server.Upload.EnableProgressTracking = getEnvBool("ENABLE_PROGRESS_TRACKING", false)
 	config.Server.Upload.CleanupOnFailure = getEnvBool("CLEANUP_ON_FAILURE", false)
 	config.Server.Upload.RateLimitPerMinute = getEnvInt("RATE_LIMIT_PER_MINUTE", 100)
+	config.Server.Upload.ChunkSize = getEnvInt64("UPLOAD_CHUNK_SIZE", 5242880)
+	config.Server.Upload.SessionTTLHours = getEnvInt("UPLOAD_SESSION_TTL_HOURS", 24)
 
 	// Database configuration
 	config.Database.DSN = getEnvString("DB_DSN", "./data/cloudlet.db")
 	config.Database.MaxConn = getEnvInt("DB_MAX_CONN", 10)
 
+	// Authentication configuration
+	config.Auth.Enabled = getEnvBool("AUTH_ENABLED", true)
+	config.Auth.SessionTTLHours = getEnvInt("AUTH_SESSION_TTL_HOURS", 24)
+	config.Auth.SecureCookies = getEnvBool("AUTH_SECURE_COOKIES", false)
+	config.Auth.AdminUsername = getEnvString("AUTH_ADMIN_USERNAME", "admin")
+	config.Auth.AdminPassword = getEnvString("AUTH_ADMIN_PASSWORD", "")
+	config.Auth.HomeDirectories = getEnvBool("AUTH_HOME_DIRECTORIES", false)
+	config.Auth.HomesPath = getEnvString("AUTH_HOMES_PATH", "/home")
+
+	// Rate limiting configuration
+	config.RateLimit.Enabled = getEnvBool("RATE_LIMIT_ENABLED", true)
+	config.RateLimit.RequestsPerMinute = getEnvInt64("RATE_LIMIT_REQUESTS_PER_MINUTE", 600)
+	config.RateLimit.UploadBytesPerMinute = getEnvInt64("RATE_LIMIT_UPLOAD_BYTES_PER_MINUTE", 1073741824)
+	config.RateLimit.MaxClients = getEnvInt("RATE_LIMIT_MAX_CLIENTS", 10000)
+	config.RateLimit.TrustProxyHeaders = getEnvBool("RATE_LIMIT_TRUST_PROXY_HEADERS", false)
+
+	// Health check configuration
+	config.Health.MinFreeDiskMB = getEnvInt64("HEALTH_MIN_FREE_DISK_MB", 1024)
+
+	// Metrics configuration
+	config.Metrics.Enabled = getEnvBool("METRICS_ENABLED", true)
+	config.Metrics.Token = getEnvString("METRICS_TOKEN", "")
+
+	// Logging configuration
+	config.Logging.Level = getEnvString("LOG_LEVEL", "info")
+	config.Logging.Format = getEnvString("LOG_FORMAT", "json")
+
+	// Tracing configuration
+	config.Tracing.Enabled = getEnvBool("TRACING_ENABLED", false)
+	config.Tracing.Exporter = getEnvString("TRACING_EXPORTER", "otlp")
+	config.Tracing.Endpoint = getEnvString("TRACING_ENDPOINT", "http://localhost:4318")
+	config.Tracing.File = getEnvString("TRACING_FILE", "./traces.jsonl")
+	config.Tracing.SampleRatio = getEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	config.Tracing.ServiceName = getEnvString("TRACING_SERVICE_NAME", "cloudlet")
+
 	return nil
 }
 
@@ -129,6 +247,22 @@ func getEnvString(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvStringSlice returns the comma separated values of the environment variable or default if not set
+func getEnvStringSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
 // getEnvInt returns the environment variable as int or default if not set/invalid
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
@@ -149,6 +283,16 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// getEnvFloat returns the environment variable as float64 or default if not set/invalid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 // getEnvBool returns the environment variable as bool or default if not set/invalid
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
@@ -170,7 +314,22 @@ func hasAnyEnvVars() bool {
 		"PORT",
 		"MAX_MEMORY",
 		"MAX_FILE_SIZE",
+		"CORS_ALLOWED_ORIGINS",
 		"STORAGE_PATH",
+		"STORAGE_BACKEND",
+		"STORAGE_DEDUPLICATE",
+		"STORAGE_GC_INTERVAL_MINUTES",
+		"STORAGE_VERSIONS_KEEP",
+		"STORAGE_VERSIONS_MAX_AGE_DAYS",
+		"STORAGE_TRASH_ENABLED",
+		"STORAGE_TRASH_RETENTION_DAYS",
+		"S3_ENDPOINT",
+		"S3_REGION",
+		"S3_BUCKET",
+		"S3_ACCESS_KEY_ID",
+		"S3_SECRET_ACCESS_KEY",
+		"S3_PREFIX",
+		"S3_USE_PATH_STYLE",
 		"READ_TIMEOUT",
 		"WRITE_TIMEOUT",
 		"IDLE_TIMEOUT",
@@ -187,8 +346,33 @@ func hasAnyEnvVars() bool {
 		"ENABLE_PROGRESS_TRACKING",
 		"CLEANUP_ON_FAILURE",
 		"RATE_LIMIT_PER_MINUTE",
+		"UPLOAD_CHUNK_SIZE",
+		"UPLOAD_SESSION_TTL_HOURS",
 		"DB_DSN",
 		"DB_MAX_CONN",
+		"AUTH_ENABLED",
+		"AUTH_SESSION_TTL_HOURS",
+		"AUTH_SECURE_COOKIES",
+		"AUTH_ADMIN_USERNAME",
+		"AUTH_ADMIN_PASSWORD",
+		"AUTH_HOME_DIRECTORIES",
+		"AUTH_HOMES_PATH",
+		"RATE_LIMIT_ENABLED",
+		"RATE_LIMIT_REQUESTS_PER_MINUTE",
+		"RATE_LIMIT_UPLOAD_BYTES_PER_MINUTE",
+		"RATE_LIMIT_MAX_CLIENTS",
+		"RATE_LIMIT_TRUST_PROXY_HEADERS",
+		"HEALTH_MIN_FREE_DISK_MB",
+		"METRICS_ENABLED",
+		"METRICS_TOKEN",
+		"LOG_LEVEL",
+		"LOG_FORMAT",
+		"TRACING_ENABLED",
+		"TRACING_EXPORTER",
+		"TRACING_ENDPOINT",
+		"TRACING_FILE",
+		"TRACING_SAMPLE_RATIO",
+		"TRACING_SERVICE_NAME",
 	}
 
 	for _, envVar := range envVars {
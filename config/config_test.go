@@ -109,6 +109,21 @@ func TestGetEnvString(t *testing.T) {
 	}
 }
 
+func TestGetEnvStringSlice(t *testing.T) {
+	os.Setenv("TEST_SLICE", " https://a.example , ,https://b.example")
+	defer os.Unsetenv("TEST_SLICE")
+
+	result := getEnvStringSlice("TEST_SLICE", nil)
+	if len(result) != 2 || result[0] != "https://a.example" || result[1] != "https://b.example" {
+		t.Errorf("Expected two trimmed origins, got %v", result)
+	}
+
+	result = getEnvStringSlice("UNSET_VAR", []string{"default"})
+	if len(result) != 1 || result[0] != "default" {
+		t.Errorf("Expected default slice, got %v", result)
+	}
+}
+
 func TestGetEnvInt(t *testing.T) {
 	// Test with valid integer
 	os.Setenv("TEST_INT", "42")
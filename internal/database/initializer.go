@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -51,6 +52,10 @@ func (di *DatabaseInitializer) InitializeDatabase() error {
 		return fmt.Errorf("error running migrations: %w", err)
 	}
 
+	if err := di.setupSearchIndex(db); err != nil {
+		return fmt.Errorf("error setting up search index: %w", err)
+	}
+
 	return nil
 }
 
@@ -82,7 +87,7 @@ func (di *DatabaseInitializer) createDatabaseDirectory() error {
 		if err := os.MkdirAll(dbDir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dbDir, err)
 		}
-		fmt.Printf("Created database directory: %s\n", dbDir)
+		slog.Info("Created database directory", "path", dbDir)
 	}
 
 	return nil
@@ -114,7 +119,7 @@ func (di *DatabaseInitializer) createTables(db *sql.DB) error {
 		return fmt.Errorf("error creating tables and indexes: %w", err)
 	}
 
-	fmt.Println("Database tables and indexes created successfully")
+	slog.Info("Database tables and indexes created")
 	return nil
 }
 
@@ -143,6 +148,261 @@ func (di *DatabaseInitializer) runMigrations(db *sql.DB) error {
 			Version: 3,
 			SQL:     `ALTER TABLE files DROP COLUMN modified_at;`,
 		},
+		{
+			Version: 4,
+			SQL: `
+			ALTER TABLE files ADD COLUMN blob_ref TEXT NOT NULL DEFAULT '';
+			CREATE INDEX IF NOT EXISTS idx_files_blob_ref ON files(blob_ref);
+			CREATE TABLE IF NOT EXISTS blobs (
+				checksum TEXT PRIMARY KEY,
+				size INTEGER NOT NULL DEFAULT 0,
+				ref_count INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Version: 5,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				password_hash TEXT NOT NULL,
+				is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS sessions (
+				token_hash TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				expires_at DATETIME NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+			CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);`,
+		},
+		{
+			Version: 6,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				token_prefix TEXT NOT NULL,
+				scopes TEXT NOT NULL DEFAULT '',
+				path_prefix TEXT NOT NULL DEFAULT '',
+				expires_at DATETIME,
+				last_used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);`,
+		},
+		{
+			Version: 7,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS groups (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS group_members (
+				group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				PRIMARY KEY (group_id, user_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members(user_id);
+			CREATE TABLE IF NOT EXISTS acl_entries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL,
+				subject_type TEXT NOT NULL,
+				subject_id INTEGER NOT NULL,
+				permissions TEXT NOT NULL DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (path, subject_type, subject_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_acl_entries_path ON acl_entries(path);`,
+		},
+		{
+			Version: 8,
+			SQL: `
+			ALTER TABLE files ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX IF NOT EXISTS idx_files_owner_id ON files(owner_id);
+			CREATE TABLE IF NOT EXISTS quotas (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				subject_type TEXT NOT NULL,
+				user_id INTEGER NOT NULL DEFAULT 0,
+				path TEXT NOT NULL DEFAULT '',
+				max_bytes INTEGER NOT NULL DEFAULT 0,
+				max_files INTEGER NOT NULL DEFAULT 0,
+				used_bytes INTEGER NOT NULL DEFAULT 0,
+				used_files INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (subject_type, user_id, path)
+			);
+			CREATE INDEX IF NOT EXISTS idx_quotas_path ON quotas(path);`,
+		},
+		{
+			Version: 9,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS shares (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				token_hash TEXT NOT NULL UNIQUE,
+				token_prefix TEXT NOT NULL,
+				path TEXT NOT NULL,
+				created_by INTEGER NOT NULL DEFAULT 0,
+				password_hash TEXT NOT NULL DEFAULT '',
+				mode TEXT NOT NULL DEFAULT 'read',
+				max_downloads INTEGER NOT NULL DEFAULT 0,
+				download_count INTEGER NOT NULL DEFAULT 0,
+				expires_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_shares_path ON shares(path);
+			CREATE INDEX IF NOT EXISTS idx_shares_created_by ON shares(created_by);`,
+		},
+		{
+			Version: 10,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS file_versions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				size INTEGER NOT NULL DEFAULT 0,
+				checksum TEXT NOT NULL,
+				blob_ref TEXT NOT NULL,
+				mime_type TEXT NOT NULL DEFAULT '',
+				author_id INTEGER NOT NULL DEFAULT 0,
+				modified_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(path, version)
+			);
+			CREATE INDEX IF NOT EXISTS idx_file_versions_created_at ON file_versions(created_at);`,
+		},
+		{
+			Version: 11,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS trash_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL,
+				name TEXT NOT NULL,
+				is_directory BOOLEAN NOT NULL DEFAULT FALSE,
+				size INTEGER NOT NULL DEFAULT 0,
+				file_count INTEGER NOT NULL DEFAULT 0,
+				deleted_by INTEGER NOT NULL DEFAULT 0,
+				deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_items_deleted_by ON trash_items(deleted_by);
+			CREATE INDEX IF NOT EXISTS idx_trash_items_deleted_at ON trash_items(deleted_at);
+
+			CREATE TABLE IF NOT EXISTS trash_entries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				item_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				is_directory BOOLEAN NOT NULL DEFAULT FALSE,
+				size INTEGER NOT NULL DEFAULT 0,
+				mime_type TEXT NOT NULL DEFAULT '',
+				checksum TEXT NOT NULL DEFAULT '',
+				blob_ref TEXT NOT NULL DEFAULT '',
+				owner_id INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME,
+				updated_at DATETIME
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_entries_item_id ON trash_entries(item_id);`,
+		},
+		{
+			Version: 12,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				time DATETIME NOT NULL,
+				actor_id INTEGER NOT NULL DEFAULT 0,
+				actor TEXT NOT NULL DEFAULT '',
+				client_ip TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				path TEXT NOT NULL DEFAULT '',
+				target_path TEXT NOT NULL DEFAULT '',
+				size INTEGER NOT NULL DEFAULT 0,
+				details TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL,
+				error TEXT NOT NULL DEFAULT ''
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_path ON audit_log(path);
+
+			CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+			CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;`,
+		},
+		{
+			Version: 13,
+			SQL: `
+			CREATE TABLE IF NOT EXISTS file_tags (
+				file_id INTEGER NOT NULL,
+				tag TEXT NOT NULL COLLATE NOCASE,
+				PRIMARY KEY (file_id, tag)
+			);
+			CREATE INDEX IF NOT EXISTS idx_file_tags_tag ON file_tags(tag);
+			CREATE TABLE IF NOT EXISTS file_metadata (
+				file_id INTEGER NOT NULL,
+				key TEXT NOT NULL COLLATE NOCASE,
+				type TEXT NOT NULL,
+				value TEXT NOT NULL,
+				updated_at DATETIME NOT NULL,
+				PRIMARY KEY (file_id, key)
+			);
+
+			-- Tags and metadata follow the file through renames and moves, which keep its id
+			CREATE TRIGGER IF NOT EXISTS files_metadata_delete AFTER DELETE ON files BEGIN
+				DELETE FROM file_tags WHERE file_id = old.id;
+				DELETE FROM file_metadata WHERE file_id = old.id;
+			END;`,
+		},
+		{
+			Version: 14,
+			SQL: `
+			-- What belongs to the paths of a trash item and is put back when it is restored
+			CREATE TABLE IF NOT EXISTS trash_acl_entries (
+				item_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				subject_type TEXT NOT NULL,
+				subject_id INTEGER NOT NULL,
+				permissions TEXT NOT NULL DEFAULT '',
+				created_at DATETIME
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_acl_entries_item_id ON trash_acl_entries(item_id);
+			CREATE TABLE IF NOT EXISTS trash_versions (
+				item_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				size INTEGER NOT NULL DEFAULT 0,
+				checksum TEXT NOT NULL,
+				blob_ref TEXT NOT NULL,
+				mime_type TEXT NOT NULL DEFAULT '',
+				author_id INTEGER NOT NULL DEFAULT 0,
+				modified_at DATETIME,
+				created_at DATETIME
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_versions_item_id ON trash_versions(item_id);
+			CREATE TABLE IF NOT EXISTS trash_tags (
+				item_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				tag TEXT NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_tags_item_id ON trash_tags(item_id);
+			CREATE TABLE IF NOT EXISTS trash_metadata (
+				item_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				key TEXT NOT NULL,
+				type TEXT NOT NULL,
+				value TEXT NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_trash_metadata_item_id ON trash_metadata(item_id);`,
+		},
 	}
 
 	// Run pending migrations
@@ -202,6 +462,6 @@ func (di *DatabaseInitializer) applyMigration(db *sql.DB, migration Migration) e
 		return err
 	}
 
-	fmt.Printf("Applied migration version %d\n", migration.Version)
+	slog.Info("Applied migration", "version", migration.Version)
 	return nil
 }
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// The search index is an FTS5 table over the name and path of every file, kept in sync
+// with the files table by triggers. FTS5 is only compiled into SQLite with the
+// sqlite_fts5 build tag, so the index is optional: without it search falls back to
+// LIKE queries. The triggers exist exactly while the index is maintained, which tells
+// whether it can be queried.
+const searchIndexTrigger = "files_fts_insert"
+
+const createSearchIndexSQL = `
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+	name, path,
+	content = 'files', content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS files_fts_insert AFTER INSERT ON files BEGIN
+	INSERT INTO files_fts (rowid, name, path) VALUES (new.id, new.name, new.path);
+END;
+CREATE TRIGGER IF NOT EXISTS files_fts_delete AFTER DELETE ON files BEGIN
+	INSERT INTO files_fts (files_fts, rowid, name, path) VALUES ('delete', old.id, old.name, old.path);
+END;
+CREATE TRIGGER IF NOT EXISTS files_fts_update AFTER UPDATE OF name, path ON files BEGIN
+	INSERT INTO files_fts (files_fts, rowid, name, path) VALUES ('delete', old.id, old.name, old.path);
+	INSERT INTO files_fts (rowid, name, path) VALUES (new.id, new.name, new.path);
+END;
+
+INSERT INTO files_fts (files_fts) VALUES ('rebuild');`
+
+const dropSearchIndexTriggersSQL = `
+DROP TRIGGER IF EXISTS files_fts_insert;
+DROP TRIGGER IF EXISTS files_fts_delete;
+DROP TRIGGER IF EXISTS files_fts_update;`
+
+// setupSearchIndex creates and fills the search index when SQLite supports FTS5 and the
+// index is not maintained yet. Without FTS5 it drops the triggers a build with FTS5 may
+// have left, since writes to the files table would fail on them.
+func (di *DatabaseInitializer) setupSearchIndex(db *sql.DB) error {
+	available, err := fts5Available(db)
+	if err != nil {
+		return err
+	}
+	if !available {
+		_, err := db.Exec(dropSearchIndexTriggersSQL)
+		return err
+	}
+
+	maintained, err := SearchIndexAvailable(db)
+	if err != nil || maintained {
+		return err
+	}
+
+	// A rebuild catches up with the files written while the index was not maintained
+	if _, err := db.Exec(createSearchIndexSQL); err != nil {
+		return fmt.Errorf("error creating search index: %w", err)
+	}
+	slog.Info("Search index created")
+	return nil
+}
+
+// SearchIndexAvailable reports whether the FTS5 search index is maintained and can be queried
+func SearchIndexAvailable(db *sql.DB) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?",
+		searchIndexTrigger).Scan(&count)
+	return count > 0, err
+}
+
+func fts5Available(db *sql.DB) (bool, error) {
+	var used bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return used, err
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// GetDirectoryACL returns the entries set on a directory and those it inherits
+func (h *Handlers) GetDirectoryACL(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) {
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/"
+	}
+	if !h.allowPaths(w, r, path) {
+		return
+	}
+
+	acl, err := h.files(r).GetDirectoryACL(path)
+	if err != nil {
+		writeACLError(w, err, "Failed to load ACL: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, acl)
+}
+
+// SetACLEntry grants a user or group permissions on a directory, replacing an existing entry for the same subject
+func (h *Handlers) SetACLEntry(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) {
+		return
+	}
+
+	var req models.SetACLEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if !h.allowPaths(w, r, req.Path) {
+		return
+	}
+
+	entry, err := h.files(r).SetACLEntry(&req)
+	if err != nil {
+		writeACLError(w, err, "Failed to save ACL entry: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, entry)
+}
+
+func (h *Handlers) DeleteACLEntry(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid ACL entry ID")
+		return
+	}
+
+	if err := h.files(r).DeleteACLEntry(id); err != nil {
+		writeACLError(w, err, "Failed to delete ACL entry: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "ACL entry deleted",
+	})
+}
+
+// ListGroups is open to every signed-in user so that directories can be shared with groups
+func (h *Handlers) ListGroups(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) {
+		return
+	}
+
+	groups, err := h.fileService.AccessControl().ListGroups()
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list groups: "+err.Error())
+		return
+	}
+	if groups == nil {
+		groups = []*models.Group{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"groups": groups,
+	})
+}
+
+func (h *Handlers) GetGroup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	group, err := h.fileService.AccessControl().GetGroup(id)
+	if err != nil {
+		writeACLError(w, err, "Failed to load group: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, group)
+}
+
+func (h *Handlers) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req models.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	group, err := h.fileService.AccessControl().CreateGroup(req.Name)
+	if err != nil {
+		writeACLError(w, err, "Failed to create group: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, group)
+}
+
+func (h *Handlers) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	if err := h.fileService.AccessControl().DeleteGroup(id); err != nil {
+		writeACLError(w, err, "Failed to delete group: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Group deleted",
+	})
+}
+
+func (h *Handlers) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	groupID, userID, ok := groupMemberIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.fileService.AccessControl().AddGroupMember(groupID, userID); err != nil {
+		writeACLError(w, err, "Failed to add group member: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Member added",
+	})
+}
+
+func (h *Handlers) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAccessControl(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	groupID, userID, ok := groupMemberIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.fileService.AccessControl().RemoveGroupMember(groupID, userID); err != nil {
+		writeACLError(w, err, "Failed to remove group member: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Member removed",
+	})
+}
+
+// requireAccessControl writes an error response unless directory ACLs are in use, which needs user accounts
+func (h *Handlers) requireAccessControl(w http.ResponseWriter) bool {
+	if !h.authEnabled() || h.fileService.AccessControl() == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return false
+	}
+	return true
+}
+
+// writeAccessDenied writes a 403 response when err is an ACL denial and reports whether it did
+func writeAccessDenied(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, services.ErrAccessDenied) {
+		return false
+	}
+	utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	return true
+}
+
+func writeACLError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrInvalidACLEntry), errors.Is(err, services.ErrInvalidGroupName):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrACLEntryNotFound),
+		errors.Is(err, services.ErrSubjectNotFound), errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrGroupExists):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
+
+func groupMemberIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	groupID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid group ID")
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseInt(r.PathValue("userId"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, false
+	}
+	return groupID, userID, true
+}
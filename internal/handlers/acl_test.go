@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func TestDirectoryACL_EnforcedOnHandlers(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+
+	admin, err := authService.CreateUser("admin", "correct horse", true)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	alice, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	bob, err := authService.CreateUser("bob", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if _, err := h.fileService.CreateDirectory("private", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	body, _ := json.Marshal(models.SetACLEntryRequest{
+		Path:        "/private",
+		SubjectType: models.SubjectUser,
+		SubjectID:   alice.ID,
+		Permissions: []string{models.PermissionRead},
+	})
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/acl", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), admin))
+	w := httptest.NewRecorder()
+	h.SetACLEntry(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	list := func(user *models.User) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/private", nil)
+		req = req.WithContext(services.ContextWithUser(req.Context(), user))
+		w := httptest.NewRecorder()
+		h.ListFiles(w, req)
+		return w.Code
+	}
+	if code := list(alice); code != http.StatusOK {
+		t.Errorf("Expected alice to list the directory, got %d", code)
+	}
+	if code := list(bob); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for bob, got %d", code)
+	}
+
+	// Creating a directory needs write, which alice was not granted
+	body, _ = json.Marshal(models.CreateDirectoryRequest{Name: "sub", ParentPath: "/private"})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/directories", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), alice))
+	w = httptest.NewRecorder()
+	h.CreateDirectory(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 creating a directory without write, got %d", w.Code)
+	}
+}
+
+func TestGroups_AdminOnlyChanges(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+
+	alice, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.CreateGroupRequest{Name: "editors"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/groups", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), alice))
+	w := httptest.NewRecorder()
+	h.CreateGroup(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/groups", nil)
+	req = req.WithContext(services.ContextWithUser(req.Context(), alice))
+	w = httptest.NewRecorder()
+	h.ListGroups(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected users to list groups, got %d", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// ListAPIKeys returns the keys of the signed-in user. Admins can pass ?all=true to see every key.
+func (h *Handlers) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.requireKeyManagement(w, r)
+	if !ok {
+		return
+	}
+
+	userID := user.ID
+	if r.URL.Query().Get("all") == "true" {
+		if !user.IsAdmin {
+			utils.WriteErrorJSON(w, http.StatusForbidden, "Administrator privileges required")
+			return
+		}
+		userID = 0
+	}
+
+	keys, err := h.authService.ListAPIKeys(userID)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list API keys: "+err.Error())
+		return
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+	})
+}
+
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.requireKeyManagement(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	token, key, err := h.authService.CreateAPIKey(user, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrScopeNotGranted):
+			utils.WriteErrorJSON(w, http.StatusForbidden, "Only administrators can create keys with the admin scope")
+		case errors.Is(err, services.ErrInvalidAPIKeyName), errors.Is(err, services.ErrInvalidScope):
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		default:
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to create API key: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, models.CreateAPIKeyResponse{
+		Token:  token,
+		APIKey: key,
+	})
+}
+
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.requireKeyManagement(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(user, id); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+		} else {
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to revoke API key: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "API key revoked",
+	})
+}
+
+// requireKeyManagement returns the signed-in user unless authentication is disabled or the
+// request was made with an API key that lacks the admin scope, so keys cannot mint broader keys
+func (h *Handlers) requireKeyManagement(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user := services.UserFromContext(r.Context())
+	if !h.authEnabled() || user == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return nil, false
+	}
+
+	if err := services.CheckScope(r.Context(), models.ScopeAdmin); err != nil {
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Managing API keys requires a session or the admin scope")
+		return nil, false
+	}
+	return user, true
+}
+
+// allowPaths writes a 403 response unless the credentials of the request may access every path
+func (h *Handlers) allowPaths(w http.ResponseWriter, r *http.Request, paths ...string) bool {
+	if err := services.CheckPathAccess(r.Context(), paths...); err != nil {
+		utils.WriteErrorJSON(w, http.StatusForbidden, err.Error())
+		return false
+	}
+	return true
+}
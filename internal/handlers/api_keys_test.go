@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func TestCreateAPIKey_ReturnsTokenOnce(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+
+	user, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{models.ScopeWrite}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/api-keys", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), user))
+	w := httptest.NewRecorder()
+	h.CreateAPIKey(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created models.CreateAPIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Token == "" {
+		t.Fatal("Expected the token in the creation response")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/api-keys", nil)
+	req = req.WithContext(services.ContextWithUser(req.Context(), user))
+	w = httptest.NewRecorder()
+	h.ListAPIKeys(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte(created.Token)) {
+		t.Error("Expected listings not to contain the token")
+	}
+}
+
+func TestCreateAPIKey_RequiresAdminScopeForKeys(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+
+	user, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{models.ScopeWrite}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/api-keys", bytes.NewReader(body))
+	ctx := services.ContextWithUser(req.Context(), user)
+	ctx = services.ContextWithAPIKey(ctx, &models.APIKey{Scopes: []string{models.ScopeWrite}})
+	w := httptest.NewRecorder()
+	h.CreateAPIKey(w, req.WithContext(ctx))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a key without the admin scope, got %d", w.Code)
+	}
+}
+
+func TestDownload_APIKeyPathPrefix(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	if _, err := fileService.CreateDirectory("builds", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fileService.SaveFile("app.bin", "/builds", []byte("binary")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := fileService.SaveFile("secret.txt", "/", []byte("secret")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	key := &models.APIKey{Scopes: []string{models.ScopeRead}, PathPrefix: "/builds"}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/api/v1/download/builds/app.bin", http.StatusOK},
+		{"/api/v1/download/secret.txt", http.StatusForbidden},
+		{"/api/v1/download/builds/../secret.txt", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		h.Download(w, req.WithContext(services.ContextWithAPIKey(req.Context(), key)))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.target, tt.status, w.Code)
+		}
+	}
+}
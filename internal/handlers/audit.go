@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// QueryAuditLog returns the audit entries matching the query, newest first. Times are
+// RFC 3339; path matches the entries on that path and below it. Only admins can read
+// the log while authentication is enabled.
+func (h *Handlers) QueryAuditLog(w http.ResponseWriter, r *http.Request) {
+	audit := h.fileService.Audit()
+	if audit == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Audit log is disabled")
+		return
+	}
+	if h.authEnabled() && !h.requireAdmin(w, r) {
+		return
+	}
+
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := audit.Query(filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuditFilter) {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid audit filter")
+			return
+		}
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to query audit log: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+// auditFilter reads the filter of an audit query from its query string, or writes an error
+// response when it is malformed
+func auditFilter(w http.ResponseWriter, r *http.Request) (*models.AuditFilter, bool) {
+	query := r.URL.Query()
+	filter := &models.AuditFilter{
+		Actor:      query.Get("actor"),
+		Action:     query.Get("action"),
+		PathPrefix: query.Get("path"),
+	}
+
+	var err error
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid "+name+" time, expected RFC 3339")
+				return nil, false
+			}
+		}
+	}
+	if value := query.Get("actor_id"); value != "" {
+		if filter.ActorID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid actor_id")
+			return nil, false
+		}
+	}
+	var ok bool
+	filter.Limit, filter.Offset, ok = pageParams(w, r)
+	return filter, ok
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func TestAudit_RecordsClientAndRequiresAdmin(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+	admin, err := authService.CreateUser("admin", "correct horse", true)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	alice, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	as := func(user *models.User, req *http.Request) *http.Request {
+		return req.WithContext(services.ContextWithUser(req.Context(), user))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/directories", strings.NewReader(`{"name":"docs","parent_path":"/"}`))
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	w := httptest.NewRecorder()
+	h.CreateDirectory(w, as(admin, req))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.QueryAuditLog(w, as(alice, httptest.NewRequest(http.MethodGet, "/api/v1/audit", nil)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a non-admin, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.QueryAuditLog(w, as(admin, httptest.NewRequest(http.MethodGet, "/api/v1/audit?from=yesterday", nil)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed time, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.QueryAuditLog(w, as(admin, httptest.NewRequest(http.MethodGet, "/api/v1/audit?action=create_directory&actor=admin&path=/docs", nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Entries []*models.AuditEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Entries) != 1 {
+		t.Fatalf("Expected one entry, got %+v", response.Entries)
+	}
+	entry := response.Entries[0]
+	if entry.Path != "/docs" || entry.ActorID != admin.ID || entry.ClientIP != "203.0.113.9" || entry.Result != models.AuditSuccess {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// SessionCookieName is the cookie browsers keep the session token in
+const SessionCookieName = "cloudlet_session"
+
+// SessionToken returns the session token of a request, taken from a bearer
+// Authorization header or else from the session cookie
+func SessionToken(r *http.Request) string {
+	if scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+	if !h.authEnabled() {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return
+	}
+
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Username and password are required")
+		return
+	}
+
+	token, session, user, err := h.authService.Login(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			utils.WriteErrorJSON(w, http.StatusUnauthorized, err.Error())
+		} else {
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to sign in: "+err.Error())
+		}
+		return
+	}
+
+	http.SetCookie(w, h.sessionCookie(r, token, session.ExpiresAt))
+
+	utils.WriteJSON(w, http.StatusOK, models.LoginResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      user,
+	})
+}
+
+// Logout ends the current session. It succeeds without a valid session so clients can always clear their state.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	if !h.authEnabled() {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return
+	}
+
+	if token := SessionToken(r); token != "" {
+		if err := h.authService.Logout(token); err != nil {
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to sign out: "+err.Error())
+			return
+		}
+	}
+
+	http.SetCookie(w, h.sessionCookie(r, "", time.Unix(0, 0)))
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Signed out",
+	})
+}
+
+// CurrentUser returns the signed-in user
+func (h *Handlers) CurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := services.UserFromContext(r.Context())
+	if user == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := services.UserFromContext(r.Context())
+	if user == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	if err := h.authService.ChangePassword(user.ID, SessionToken(r), req.CurrentPassword, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			utils.WriteErrorJSON(w, http.StatusForbidden, "Current password is incorrect")
+		case errors.Is(err, services.ErrWeakPassword):
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		default:
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to change password: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Password changed",
+	})
+}
+
+func (h *Handlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	users, err := h.authService.ListUsers()
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list users: "+err.Error())
+		return
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+	})
+}
+
+func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	user, err := h.authService.CreateUser(req.Username, req.Password, req.IsAdmin)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidUsername), errors.Is(err, services.ErrWeakPassword):
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrUserExists):
+			utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+		default:
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to create user: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, user)
+}
+
+func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if id == services.UserFromContext(r.Context()).ID {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "You cannot delete your own account")
+		return
+	}
+
+	if err := h.authService.DeleteUser(id); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+		} else {
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to delete user: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "User deleted",
+	})
+}
+
+// requireAdmin writes an error response unless the request was made by an admin, with
+// a session or with an API key carrying the admin scope
+func (h *Handlers) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !h.authEnabled() {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Authentication is disabled")
+		return false
+	}
+
+	user := services.UserFromContext(r.Context())
+	if user == nil || !user.IsAdmin || services.CheckScope(r.Context(), models.ScopeAdmin) != nil {
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Administrator privileges required")
+		return false
+	}
+	return true
+}
+
+func (h *Handlers) authEnabled() bool {
+	return h.authService != nil && h.cfg.Auth.Enabled
+}
+
+// sessionCookie builds the session cookie. It is not readable from scripts and is not
+// sent along with cross-site requests, which keeps other sites from acting on the session.
+func (h *Handlers) sessionCookie(r *http.Request, token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.cfg.Auth.SecureCookies || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
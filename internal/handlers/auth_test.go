@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func setupAuthHandlers(t *testing.T) (*Handlers, *services.AuthService) {
+	tempDir := t.TempDir()
+	storagePath := filepath.Join(tempDir, "storage")
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	storage := services.NewStorageService(storagePath)
+	t.Cleanup(func() { storage.Close() })
+
+	fileService := services.NewFileService(repo, storage, storagePath)
+	fileService.SetAccessControl(services.NewAccessControlService(repository.NewACLRepository(repo.DB())))
+	fileService.SetQuotas(services.NewQuotaService(repository.NewQuotaRepository(repo.DB())))
+	fileService.SetShares(services.NewShareService(repository.NewShareRepository(repo.DB())))
+	fileService.SetAudit(services.NewAuditService(repository.NewAuditRepository(repo.DB())))
+	authService := services.NewAuthService(repository.NewUserRepository(repo.DB()), time.Hour)
+
+	cfg := &config.Config{}
+	cfg.Server.Storage.Path = storagePath
+	cfg.Auth.Enabled = true
+
+	return NewHandlers(fileService, authService, cfg), authService
+}
+
+func TestLogin_SetsSessionCookie(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+	if _, err := authService.CreateUser("alice", "correct horse", false); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.LoginRequest{Username: "alice", Password: "correct horse"})
+	w := httptest.NewRecorder()
+	h.Login(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookieName {
+		t.Fatalf("Expected a session cookie, got %v", cookies)
+	}
+	if cookies[0].Value != response.Token || !cookies[0].HttpOnly {
+		t.Error("Expected an HttpOnly cookie holding the session token")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req.AddCookie(cookies[0])
+	if got := SessionToken(req); got != response.Token {
+		t.Errorf("Expected token from cookie, got %q", got)
+	}
+
+	req.Header.Set("Authorization", "Bearer other-token")
+	if got := SessionToken(req); got != "other-token" {
+		t.Errorf("Expected bearer token to take precedence, got %q", got)
+	}
+}
+
+func TestLogin_InvalidCredentials(t *testing.T) {
+	h, _ := setupAuthHandlers(t)
+
+	body, _ := json.Marshal(models.LoginRequest{Username: "alice", Password: "wrong password"})
+	w := httptest.NewRecorder()
+	h.Login(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body)))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected no cookie for a failed login")
+	}
+}
+
+func TestUserManagement_RequiresAdmin(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+
+	user, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.CreateUserRequest{Username: "bob", Password: "correct horse"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), user))
+	w := httptest.NewRecorder()
+	h.CreateUser(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a non-admin, got %d", w.Code)
+	}
+
+	user.IsAdmin = true
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader(body))
+	req = req.WithContext(services.ContextWithUser(req.Context(), user))
+	w = httptest.NewRecorder()
+	h.CreateUser(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for an admin, got %d: %s", w.Code, w.Body.String())
+	}
+}
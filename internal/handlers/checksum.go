@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+var (
+	errUnsupportedDigest = errors.New("Content-Digest must include a sha-256 digest")
+	errInvalidDigest     = errors.New("invalid Content-Digest header")
+	errConflictingDigest = errors.New("Content-Digest and checksum field do not match")
+)
+
+// uploadChecksum returns the SHA-256 a multipart upload is expected to have, as hex.
+// It is taken from a Content-Digest header on the file part (RFC 9530) or from the
+// "checksum" form field, and is empty when the client sent neither.
+func uploadChecksum(r *http.Request, header *multipart.FileHeader) (string, error) {
+	fromField, err := services.NormalizeChecksum(r.FormValue("checksum"))
+	if err != nil {
+		return "", err
+	}
+
+	fromDigest, err := parseContentDigest(header.Header.Get("Content-Digest"))
+	if err != nil {
+		return "", err
+	}
+
+	if fromField != "" && fromDigest != "" && fromField != fromDigest {
+		return "", errConflictingDigest
+	}
+	if fromDigest != "" {
+		return fromDigest, nil
+	}
+	return fromField, nil
+}
+
+// parseContentDigest extracts the sha-256 member of a Content-Digest header such as
+// `sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:` and returns it as hex
+func parseContentDigest(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+
+	for _, member := range strings.Split(value, ",") {
+		algorithm, digest, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			return "", errInvalidDigest
+		}
+		if !strings.EqualFold(strings.TrimSpace(algorithm), "sha-256") {
+			continue
+		}
+
+		digest = strings.TrimSpace(digest)
+		if len(digest) < 2 || digest[0] != ':' || digest[len(digest)-1] != ':' {
+			return "", errInvalidDigest
+		}
+		decoded, err := base64.StdEncoding.DecodeString(digest[1 : len(digest)-1])
+		if err != nil || len(decoded) != 32 {
+			return "", errInvalidDigest
+		}
+		return hex.EncodeToString(decoded), nil
+	}
+
+	return "", errUnsupportedDigest
+}
+
+// formatReprDigest renders a stored hex SHA-256 as a Repr-Digest header value
+func formatReprDigest(info *models.FileInfo) string {
+	decoded, err := hex.DecodeString(info.Checksum)
+	if err != nil || len(decoded) != 32 {
+		return ""
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(decoded) + ":"
+}
+
+// saveErrorStatus maps a failed save to an HTTP status, separating checksum
+// problems caused by the client from server side failures
+func saveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrChecksumMismatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrInvalidChecksum):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, services.ErrPathIsDirectory):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
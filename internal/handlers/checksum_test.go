@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// sha-256 of "hello world" in Content-Digest form and as hex
+const (
+	helloWorldDigest = "sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:"
+	helloWorldHex    = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+)
+
+// newDigestUploadRequest builds a multipart upload whose file part carries a Content-Digest header
+func newDigestUploadRequest(t *testing.T, target, filename, digest string, content []byte) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	partHeader.Set("Content-Type", "application/octet-stream")
+	if digest != "" {
+		partHeader.Set("Content-Digest", digest)
+	}
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		t.Fatalf("Failed to create part: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", target, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUpload_ContentDigest(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.MaxMemory = 1024
+
+	w := httptest.NewRecorder()
+	h.Upload(w, newDigestUploadRequest(t, "/api/v1/upload", "hello.txt", helloWorldDigest, []byte("hello world")))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response models.UploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Checksum != helloWorldHex {
+		t.Errorf("Expected checksum %s, got %s", helloWorldHex, response.Checksum)
+	}
+
+	info, err := fileService.GetFileInfo("/hello.txt")
+	if err != nil {
+		t.Fatalf("GetFileInfo failed: %v", err)
+	}
+	if info.Checksum != helloWorldHex {
+		t.Errorf("Expected stored checksum %s, got %s", helloWorldHex, info.Checksum)
+	}
+
+	// Downloads advertise the stored digest so clients can verify what they received
+	dw := httptest.NewRecorder()
+	h.Download(dw, httptest.NewRequest("GET", "/api/v1/download/hello.txt", nil))
+	if got := dw.Header().Get("Repr-Digest"); got != helloWorldDigest {
+		t.Errorf("Expected Repr-Digest %s, got %s", helloWorldDigest, got)
+	}
+}
+
+func TestUpload_ContentDigestMismatch(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.MaxMemory = 1024
+
+	w := httptest.NewRecorder()
+	h.UploadStream(w, newDigestUploadRequest(t, "/api/v1/upload/stream", "hello.txt", helloWorldDigest, []byte("hello there")))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	}
+	if _, err := fileService.GetFileInfo("/hello.txt"); err == nil {
+		t.Error("Rejected upload must not be stored")
+	}
+
+	w = httptest.NewRecorder()
+	h.Upload(w, newDigestUploadRequest(t, "/api/v1/upload", "hello.txt", "sha-512=:AAAA:", []byte("hello world")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unsupported digest, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestParseContentDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: ""},
+		{name: "sha-256", value: helloWorldDigest, want: helloWorldHex},
+		{name: "several algorithms", value: "sha-512=:AAAA:, " + helloWorldDigest, want: helloWorldHex},
+		{name: "unsupported only", value: "sha-512=:AAAA:", wantErr: true},
+		{name: "missing colons", value: "sha-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=", wantErr: true},
+		{name: "wrong length", value: "sha-256=:AAAA:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseContentDigest(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
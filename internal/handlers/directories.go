@@ -30,8 +30,15 @@ func (h *Handlers) CreateDirectory(w http.ResponseWriter, r *http.Request) {
 		req.ParentPath = "/"
 	}
 
-	directory, err := h.fileService.CreateDirectory(req.Name, req.ParentPath)
+	if !h.allowPaths(w, r, req.ParentPath+"/"+req.Name) {
+		return
+	}
+
+	directory, err := h.files(r).CreateDirectory(req.Name, req.ParentPath)
 	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "already exists") {
 			utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
 		} else if strings.Contains(err.Error(), "does not exist") {
@@ -63,8 +70,15 @@ func (h *Handlers) MoveFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.fileService.MoveFile(req.SourcePath, req.DestinationPath)
+	if !h.allowPaths(w, r, req.SourcePath, req.DestinationPath) {
+		return
+	}
+
+	err := h.files(r).MoveFile(req.SourcePath, req.DestinationPath)
 	if err != nil {
+		if writeAccessDenied(w, err) || writeQuotaExceeded(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
 		} else if strings.Contains(err.Error(), "already exists") {
@@ -97,8 +111,16 @@ func (h *Handlers) RenameFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.fileService.RenameFile(req.Path, req.NewName)
+	// The renamed entry stays in its directory, so both names must be accessible
+	if !h.allowPaths(w, r, req.Path, req.Path+"/../"+req.NewName) {
+		return
+	}
+
+	err := h.files(r).RenameFile(req.Path, req.NewName)
 	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
 		} else if strings.Contains(err.Error(), "already exists") {
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/models"
 	"github.com/anddsdev/cloudlet/internal/services"
 	"github.com/anddsdev/cloudlet/internal/utils"
 )
@@ -18,8 +23,49 @@ func (h *Handlers) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, fileInfo, err := h.fileService.GetFileData(filePath)
+	if !h.allowPaths(w, r, filePath) {
+		return
+	}
+
+	info, err := h.files(r).GetFileInfo(filePath)
+	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
+		if err == services.ErrFileNotFound {
+			utils.WriteErrorJSON(w, http.StatusNotFound, "File not found")
+		} else {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	if info.IsDirectory {
+		downloadDirectory(w, r, h.files(r), info)
+		return
+	}
+
+	// ?version= downloads a previous content of the file
+	if number := r.URL.Query().Get("version"); number != "" {
+		version, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid version")
+			return
+		}
+		serveVersion(w, r, h.files(r), filePath, version)
+		return
+	}
+
+	serveFile(w, r, h.files(r), filePath)
+}
+
+// serveFile streams a file read through files, honouring range and conditional requests
+func serveFile(w http.ResponseWriter, r *http.Request, files *services.FileService, filePath string) {
+	file, fileInfo, err := files.OpenFileForRead(filePath)
 	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
 		if err == services.ErrFileNotFound {
 			utils.WriteErrorJSON(w, http.StatusNotFound, "File not found")
 		} else {
@@ -27,15 +73,98 @@ func (h *Handlers) Download(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	defer file.Close()
+
+	serveContent(w, r, file, fileInfo)
+}
 
-	// Header for download
-	filename := filepath.Base(filePath)
-	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+// serveVersion streams a previous content of a file like serveFile
+func serveVersion(w http.ResponseWriter, r *http.Request, files *services.FileService, filePath string, number int64) {
+	file, version, err := files.OpenVersionForRead(filePath, number)
+	if err != nil {
+		writeVersionError(w, err, "Failed to read version: ")
+		return
+	}
+	defer file.Close()
+
+	serveContent(w, r, file, &models.FileInfo{
+		ID:        version.ID,
+		Path:      version.Path,
+		Size:      version.Size,
+		MimeType:  version.MimeType,
+		Checksum:  version.Checksum,
+		UpdatedAt: version.ModifiedAt,
+	})
+}
+
+// serveContent sends the content of file described by fileInfo. Files are served from the
+// origin of the API, also to anyone holding a share link, so browsers are kept from running
+// scripts in them: types that could hold scripts are only sent as attachments, content is
+// never sniffed and a sandbox policy applies to whatever is opened anyway.
+func serveContent(w http.ResponseWriter, r *http.Request, file io.ReadSeeker, fileInfo *models.FileInfo) {
+	// Header for download. Inline disposition lets browsers play media directly
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" && inlineAllowed(fileInfo.MimeType) {
+		disposition = "inline"
+	}
+	filename := filepath.Base(fileInfo.Path)
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, filename))
 	w.Header().Set("Content-Type", fileInfo.MimeType)
-	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("ETag", fileETag(fileInfo))
+	if digest := formatReprDigest(fileInfo); digest != "" {
+		w.Header().Set("Repr-Digest", digest)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
 
-	// Write file data
+	// ServeContent streams from the file and handles Range, If-Range,
+	// If-None-Match and If-Modified-Since using the headers set above
+	http.ServeContent(w, r, filename, fileInfo.UpdatedAt, file)
+}
+
+// inlineAllowed reports whether browsers may display a file of mimeType inline. Only media
+// and plain text qualify: HTML, SVG images and the like can run scripts.
+func inlineAllowed(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	return mediaType == "application/pdf" || mediaType == "text/plain"
+}
+
+// contentDisposition formats a Content-Disposition header, quoting or encoding filename
+func contentDisposition(disposition, filename string) string {
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// fileETag builds a strong validator that changes whenever a file is rewritten
+func fileETag(info *models.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x-%x"`, info.ID, info.Size, info.UpdatedAt.UnixNano())
+}
+
+// downloadDirectory streams a directory as a zip or tar.gz archive selected by ?format=
+func downloadDirectory(w http.ResponseWriter, r *http.Request, files *services.FileService, dir *models.FileInfo) {
+	format, err := services.ParseArchiveFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Unsupported archive format. Use zip or tar.gz")
+		return
+	}
+
+	filename := dir.Name + services.ArchiveExtension(format)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	w.Header().Set("Content-Type", services.ArchiveContentType(format))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+
+	// Headers are already sent, so failures can only be logged and the stream cut short
+	if err := files.WriteDirectoryArchive(dir.Path, format, w); err != nil {
+		logging.FromContext(r.Context()).Error("Directory archive download failed", "path", dir.Path, "error", err)
+	}
 }
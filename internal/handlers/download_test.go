@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+// setupDownloadHandlers builds real handlers backed by a temporary database and storage directory
+func setupDownloadHandlers(t *testing.T) (*Handlers, *services.FileService) {
+	tempDir := t.TempDir()
+	storagePath := filepath.Join(tempDir, "storage")
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	storage := services.NewStorageService(storagePath)
+	t.Cleanup(func() { storage.Close() })
+
+	fileService := services.NewFileService(repo, storage, storagePath)
+
+	cfg := &config.Config{}
+	cfg.Server.Storage.Path = storagePath
+
+	return NewHandlers(fileService, nil, cfg), fileService
+}
+
+func TestDownload_RangeRequest(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	content := []byte("0123456789abcdefghij")
+	if err := fileService.SaveFile("video.mp4", "/", content); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/download/video.mp4", nil)
+	req.Header.Set("Range", "bytes=5-9")
+	w := httptest.NewRecorder()
+
+	h.Download(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusPartialContent, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Range"); got != "bytes 5-9/20" {
+		t.Errorf("Unexpected Content-Range: %s", got)
+	}
+	if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Expected Accept-Ranges bytes, got %s", got)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "56789" {
+		t.Errorf("Unexpected range body: %q", body)
+	}
+}
+
+func TestDownload_ConditionalRequests(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	if err := fileService.SaveFile("report.pdf", "/", []byte("pdf data")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest("GET", "/api/v1/download/report.pdf", nil))
+
+	resp := w.Result()
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("Expected ETag and Last-Modified headers, got %q and %q", etag, lastModified)
+	}
+
+	// Matching ETag returns 304
+	req := httptest.NewRequest("GET", "/api/v1/download/report.pdf", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.Download(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching If-None-Match, got %d", w.Code)
+	}
+
+	// Matching Last-Modified returns 304
+	req = httptest.NewRequest("GET", "/api/v1/download/report.pdf", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	h.Download(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for If-Modified-Since, got %d", w.Code)
+	}
+
+	// Stale If-Range falls back to the full body
+	req = httptest.NewRequest("GET", "/api/v1/download/report.pdf", nil)
+	req.Header.Set("Range", "bytes=0-2")
+	req.Header.Set("If-Range", `"stale"`)
+	w = httptest.NewRecorder()
+	h.Download(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "pdf data" {
+		t.Errorf("Expected full 200 response for stale If-Range, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Current If-Range honours the range
+	req = httptest.NewRequest("GET", "/api/v1/download/report.pdf", nil)
+	req.Header.Set("Range", "bytes=0-2")
+	req.Header.Set("If-Range", etag)
+	w = httptest.NewRecorder()
+	h.Download(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "pdf" {
+		t.Errorf("Expected 206 with partial body for current If-Range, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDownload_InlineOnlyForSafeTypes(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	for _, name := range []string{"photo.png", "page.html", "logo.svg", "café notes.txt"} {
+		if err := fileService.SaveFile(name, "/", []byte("content")); err != nil {
+			t.Fatalf("Failed to save %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		path        string
+		disposition string
+	}{
+		{"/photo.png", `inline; filename=photo.png`},
+		{"/page.html", `attachment; filename=page.html`},
+		{"/logo.svg", `attachment; filename=logo.svg`},
+		{"/caf%C3%A9%20notes.txt", `inline; filename*=utf-8''caf%C3%A9%20notes.txt`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.Download(w, httptest.NewRequest("GET", "/api/v1/download"+tt.path+"?inline=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", tt.path, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("Expected Content-Disposition %q for %s, got %q", tt.disposition, tt.path, got)
+		}
+		if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Security-Policy") != "sandbox" {
+			t.Errorf("Expected nosniff and sandbox headers for %s, got %v", tt.path, w.Header())
+		}
+	}
+}
+
+func TestDownload_DirectoryArchive(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	if _, err := fileService.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fileService.SaveFile("a.txt", "/docs", []byte("hello")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest("GET", "/api/v1/download/docs", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/zip" {
+		t.Errorf("Expected application/zip, got %s", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a valid zip: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Errorf("Expected 2 zip entries, got %d", len(zr.File))
+	}
+
+	w = httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest("GET", "/api/v1/download/docs?format=rar", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unsupported format, got %d", w.Code)
+	}
+}
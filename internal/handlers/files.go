@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -25,8 +26,19 @@ func (h *Handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
 		path = "/"
 	}
 
-	listing, err := h.fileService.GetDirectoryListing(path)
+	if !h.allowPaths(w, r, path) {
+		return
+	}
+
+	listing, err := h.files(r).GetDirectoryListing(path, tagsParam(r)...)
 	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidTag) {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list files: "+err.Error())
 		return
 	}
@@ -46,11 +58,26 @@ func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.allowPaths(w, r, path) {
+		return
+	}
+
 	// Check for recursive parameter
 	recursive := r.URL.Query().Get("recursive") == "true"
 
-	err := h.fileService.DeleteFile(path, recursive)
+	// Deleted files go to the trash unless it is disabled or skipped with ?permanent=true
+	permanent := r.URL.Query().Get("permanent") == "true" || !h.fileService.TrashEnabled()
+
+	var err error
+	if permanent {
+		err = h.files(r).DeleteFilePermanently(path, recursive)
+	} else {
+		err = h.files(r).DeleteFile(path, recursive)
+	}
 	if err != nil {
+		if writeAccessDenied(w, err) {
+			return
+		}
 		if err == services.ErrFileNotFound {
 			utils.WriteErrorJSON(w, http.StatusNotFound, "File not found")
 		} else if strings.Contains(err.Error(), "not empty") {
@@ -61,9 +88,14 @@ func (h *Handlers) DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	message := "File moved to trash"
+	if permanent {
+		message = "File deleted successfully"
+	}
+
 	response := map[string]interface{}{
 		"success": true,
-		"message": "File deleted successfully",
+		"message": message,
 		"path":    path,
 	}
 
@@ -1,18 +1,85 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/models"
 	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
 )
 
 type Handlers struct {
-	fileService *services.FileService
-	cfg         *config.Config
+	fileService     *services.FileService
+	authService     *services.AuthService
+	multipleUploads *services.MultipleUploadService
+	chunkedUploads  *services.ChunkedUploadService
+	tusUploads      *services.TusService
+	uploadEvents    *services.UploadEventBroker
+	cfg             *config.Config
 }
 
-func NewHandlers(fileService *services.FileService, cfg *config.Config) *Handlers {
+func NewHandlers(fileService *services.FileService, authService *services.AuthService, cfg *config.Config) *Handlers {
 	return &Handlers{
-		fileService: fileService,
-		cfg:         cfg,
+		fileService:     fileService,
+		authService:     authService,
+		multipleUploads: services.NewMultipleUploadService(fileService, cfg, cfg.Server.Storage.Path),
+		chunkedUploads:  services.NewChunkedUploadService(fileService, cfg),
+		tusUploads:      services.NewTusService(fileService, cfg),
+		uploadEvents:    services.NewUploadEventBroker(),
+		cfg:             cfg,
+	}
+}
+
+// files returns the file service acting for the user of the request, so every operation
+// is checked against the directory ACLs, confined to the home directory of the user,
+// audited with the address of the client, logged with the request ID and traced in the
+// span of the request
+func (h *Handlers) files(r *http.Request) *services.FileService {
+	return h.fileService.ForUser(services.UserFromContext(r.Context())).
+		WithClientIP(getClientIP(r)).
+		WithLogger(logging.FromContext(r.Context())).
+		WithContext(r.Context())
+}
+
+// uploads returns the multiple upload service saving on behalf of the user of the request.
+// It expects target paths already resolved by uploadTarget.
+func (h *Handlers) uploads(r *http.Request) *services.MultipleUploadService {
+	view := h.fileService.OwnedBy(h.files(r).Owner()).
+		WithAuditActor(services.UserFromContext(r.Context())).
+		WithClientIP(getClientIP(r)).
+		WithLogger(logging.FromContext(r.Context())).
+		WithContext(r.Context())
+	return h.multipleUploads.WithFileService(view)
+}
+
+// ownsUpload tells whether the user of the request may follow or change an upload started
+// by ownerID: its owner or an admin, or anyone when authentication is disabled. Uploads of
+// other users are answered as missing, so their IDs cannot be probed.
+func ownsUpload(r *http.Request, ownerID int64) bool {
+	user := services.UserFromContext(r.Context())
+	return user == nil || user.IsAdmin || user.ID == ownerID
+}
+
+// uploadTarget writes an error response unless the request may add files to targetPath,
+// and otherwise returns the storage path it names for the user of the request. Uploads
+// assembled in the background are checked here, before any data is accepted.
+func (h *Handlers) uploadTarget(w http.ResponseWriter, r *http.Request, targetPath string) (string, bool) {
+	if !h.allowPaths(w, r, targetPath) {
+		return "", false
+	}
+
+	files := h.files(r)
+	resolved, err := files.ResolvePath(targetPath)
+	if err == nil {
+		err = files.CheckAccess(models.PermissionWrite, targetPath)
+	}
+	if err != nil {
+		if !writeAccessDenied(w, err) {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid path: "+err.Error())
+		}
+		return "", false
 	}
+	return resolved, true
 }
@@ -3,9 +3,11 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/anddsdev/cloudlet/internal/models"
 	"github.com/anddsdev/cloudlet/internal/utils"
 )
 
+// HealthCheck answers as long as the server is running, for liveness probes
 func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"status": "ok",
@@ -13,3 +15,17 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusOK, response)
 }
+
+// HealthReady reports whether the server can take requests, for readiness probes. It
+// answers 503 with the result of every check when one of them failed.
+func (h *Handlers) HealthReady(w http.ResponseWriter, r *http.Request) {
+	minFreeBytes := uint64(max(h.cfg.Health.MinFreeDiskMB, 0)) * 1024 * 1024
+	report := h.fileService.CheckReadiness(r.Context(), minFreeBytes)
+
+	status := http.StatusOK
+	if report.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, status, report)
+}
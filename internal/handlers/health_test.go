@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestHealthReady_AnswersUnavailableWhenDegraded(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+
+	w := httptest.NewRecorder()
+	h.HealthReady(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from a ready server, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// No disk has this much free space
+	h.cfg.Health.MinFreeDiskMB = 1 << 40
+	w = httptest.NewRecorder()
+	h.HealthReady(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 below the free space threshold, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var report models.ReadinessReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Status != models.HealthDegraded || report.Checks["disk"].Status != models.HealthFailed {
+		t.Errorf("Expected the failed disk check in the report, got %+v", report.Checks)
+	}
+}
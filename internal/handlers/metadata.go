@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// GetMetadata returns the tags and metadata entries of a file or directory
+func (h *Handlers) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	filePath, ok := h.metadataPath(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.files(r).GetMetadata(filePath)
+	if err != nil {
+		writeMetadataError(w, err, "Failed to load metadata: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, metadata)
+}
+
+// SetMetadata sets metadata entries on a file or directory, replacing those with the same keys
+func (h *Handlers) SetMetadata(w http.ResponseWriter, r *http.Request) {
+	filePath, ok := h.metadataPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	entries, err := h.files(r).SetMetadata(filePath, req.Metadata)
+	if err != nil {
+		writeMetadataError(w, err, "Failed to save metadata: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Metadata saved",
+		Data:    entries,
+	})
+}
+
+// DeleteMetadata removes the metadata entry named by the key query parameter
+func (h *Handlers) DeleteMetadata(w http.ResponseWriter, r *http.Request) {
+	filePath, ok := h.metadataPath(w, r)
+	if !ok {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Metadata key required")
+		return
+	}
+
+	if err := h.files(r).DeleteMetadata(filePath, key); err != nil {
+		writeMetadataError(w, err, "Failed to delete metadata: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Metadata entry deleted",
+	})
+}
+
+// SetTags replaces the tags of a file or directory
+func (h *Handlers) SetTags(w http.ResponseWriter, r *http.Request) {
+	filePath, ok := h.metadataPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	tags, err := h.files(r).SetTags(filePath, req.Tags)
+	if err != nil {
+		writeMetadataError(w, err, "Failed to save tags: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Tags saved",
+		Data:    tags,
+	})
+}
+
+// BulkTag adds and removes tags on several files and directories at once
+func (h *Handlers) BulkTag(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if !h.allowPaths(w, r, req.Paths...) {
+		return
+	}
+
+	updated, err := h.files(r).UpdateTags(&req)
+	if err != nil {
+		writeMetadataError(w, err, "Failed to update tags: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Updated tags of " + strconv.Itoa(updated) + " items",
+	})
+}
+
+// ListTags returns the tags in use with how many files and directories carry each
+func (h *Handlers) ListTags(w http.ResponseWriter, r *http.Request) {
+	if !h.allowPaths(w, r, "/") {
+		return
+	}
+
+	tags, err := h.files(r).ListTags()
+	if err != nil {
+		writeMetadataError(w, err, "Failed to list tags: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// metadataPath returns the path of a metadata or tags request, or writes an error response
+func (h *Handlers) metadataPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	filePath := "/" + strings.TrimPrefix(r.PathValue("path"), "/")
+	if filePath == "/" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "File path required")
+		return "", false
+	}
+	return filePath, h.allowPaths(w, r, filePath)
+}
+
+// tagsParam returns the comma-separated tags of the tags query parameter
+func tagsParam(r *http.Request) []string {
+	value := r.URL.Query().Get("tags")
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func writeMetadataError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrMetadataNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidTag), errors.Is(err, services.ErrInvalidMetadata):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestMetadata_TagAndFilterListing(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	for _, name := range []string{"logo.svg", "notes.txt"} {
+		if err := fileService.SaveFile(name, "/", []byte(name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/tags/logo.svg", strings.NewReader(`{"tags":["final","client:acme"]}`))
+	req.SetPathValue("path", "logo.svg")
+	w := httptest.NewRecorder()
+	h.SetTags(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/metadata/logo.svg",
+		strings.NewReader(`{"metadata":[{"key":"width","type":"number","value":512}]}`))
+	req.SetPathValue("path", "logo.svg")
+	w = httptest.NewRecorder()
+	h.SetMetadata(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ListFiles(w, httptest.NewRequest(http.MethodGet, "/api/v1/files/?tags=FINAL", nil))
+	var listing models.DirectoryListing
+	if err := json.NewDecoder(w.Body).Decode(&listing); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].Name != "logo.svg" || len(listing.Files[0].Tags) != 2 {
+		t.Errorf("Expected only the tagged file, got %+v", listing.Files)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/metadata/logo.svg", nil)
+	req.SetPathValue("path", "logo.svg")
+	w = httptest.NewRecorder()
+	h.GetMetadata(w, req)
+	var metadata models.FileMetadata
+	if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(metadata.Metadata) != 1 || metadata.Metadata[0].Value != float64(512) {
+		t.Errorf("Expected the width entry, got %+v", metadata.Metadata)
+	}
+
+	for _, body := range []string{`{"tags":["a,b"]}`, `{"tags":`} {
+		req = httptest.NewRequest(http.MethodPut, "/api/v1/tags/notes.txt", strings.NewReader(body))
+		req.SetPathValue("path", "notes.txt")
+		w = httptest.NewRecorder()
+		h.SetTags(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/metadata/logo.svg?key=height", nil)
+	req.SetPathValue("path", "logo.svg")
+	w = httptest.NewRecorder()
+	h.DeleteMetadata(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", w.Code)
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/anddsdev/cloudlet/internal/metrics"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// Metrics serves the server metrics in the Prometheus text format. When a metrics token
+// is configured, scrapes must send it as bearer token.
+func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
+	if token := h.cfg.Metrics.Token; token != "" {
+		if subtle.ConstantTimeCompare([]byte(SessionToken(r)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cloudlet metrics"`)
+			utils.WriteErrorJSON(w, http.StatusUnauthorized, "Metrics token required")
+			return
+		}
+	}
+
+	metrics.Default.Handler().ServeHTTP(w, r)
+}
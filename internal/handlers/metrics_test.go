@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/metrics"
+)
+
+func TestMetrics_CountsUploadsAndRequiresToken(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Metrics.Token = "scrape-secret"
+
+	uploaded := metrics.UploadedBytes.WithLabelValues(metrics.UploadSingle).Value()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "report.txt")
+	part.Write([]byte("quarterly numbers"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.Upload(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := metrics.UploadedBytes.WithLabelValues(metrics.UploadSingle).Value() - uploaded; got != 17 {
+		t.Errorf("Expected 17 uploaded bytes to be counted, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.Metrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	w = httptest.NewRecorder()
+	h.Metrics(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Expected the metrics, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), `cloudlet_upload_files_total{strategy="single"}`) {
+		t.Errorf("Expected the upload counter in the scrape, got:\n%s", w.Body.String())
+	}
+}
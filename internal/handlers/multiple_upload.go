@@ -1,24 +1,36 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/metrics"
 	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/ratelimit"
 	"github.com/anddsdev/cloudlet/internal/services"
 	"github.com/anddsdev/cloudlet/internal/utils"
+	"github.com/google/uuid"
 )
 
 // UploadMultiple handles multiple file uploads using hybrid strategy
 func (h *Handlers) UploadMultiple(w http.ResponseWriter, r *http.Request) {
+	uploadID, err := h.uploadEventID(r)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Parse multipart form with configured memory limit
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err = parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
 		return
 	}
 
@@ -28,6 +40,11 @@ func (h *Handlers) UploadMultiple(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
+	targetPath, ok := h.uploadTarget(w, r, targetPath)
+	if !ok {
+		return
+	}
+
 	// Get upload strategy preference
 	strategy := r.FormValue("strategy")
 	if strategy == "" {
@@ -37,29 +54,32 @@ func (h *Handlers) UploadMultiple(w http.ResponseWriter, r *http.Request) {
 	// Get files from form
 	files := r.MultipartForm.File["files"]
 	if len(files) == 0 {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "No files provided")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "No files provided")
 		return
 	}
 
 	// Check basic limits
 	if len(files) > h.cfg.Server.Upload.MaxFilesPerRequest {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, 
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, 
 			fmt.Sprintf("Too many files: %d exceeds limit of %d", len(files), h.cfg.Server.Upload.MaxFilesPerRequest))
 		return
 	}
 
-	// Check rate limiting (basic IP-based check)
-	clientIP := getClientIP(r)
-	if err := h.checkUploadRateLimit(clientIP, len(files)); err != nil {
-		utils.WriteErrorJSON(w, http.StatusTooManyRequests, err.Error())
+	// Check the files the client may still upload this minute
+	if err := h.checkUploadRateLimit(w, r, len(files)); err != nil {
+		h.writeUploadError(w, uploadID, uploadRateLimitStatus(err), err.Error())
 		return
 	}
 
-	// Create multiple upload service
-	multipleUploadService := services.NewMultipleUploadService(h.fileService, h.cfg, h.cfg.Server.Storage.Path)
-
-	// Process multiple uploads
-	response := multipleUploadService.UploadMultipleFiles(files, targetPath)
+	// Process multiple uploads, publishing per-file events when requested
+	var tracker *services.BatchTracker
+	if uploadID != "" {
+		tracker = services.NewBatchTracker()
+		h.publishFileEvents(tracker, uploadID, files)
+	}
+	response := h.uploads(r).UploadMultipleFilesTracked(files, targetPath, tracker)
+	recordMultipleUpload(metrics.UploadMultiple, response)
+	h.publishMultipleUploadComplete(uploadID, response)
 
 	// Set appropriate HTTP status based on results
 	status := http.StatusCreated
@@ -77,7 +97,7 @@ func (h *Handlers) UploadMultiple(w http.ResponseWriter, r *http.Request) {
 // UploadMultipleValidate validates multiple files without actually uploading them
 func (h *Handlers) UploadMultipleValidate(w http.ResponseWriter, r *http.Request) {
 	// Parse multipart form
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err := parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
 		return
@@ -89,6 +109,11 @@ func (h *Handlers) UploadMultipleValidate(w http.ResponseWriter, r *http.Request
 		targetPath = "/"
 	}
 
+	targetPath, ok := h.uploadTarget(w, r, targetPath)
+	if !ok {
+		return
+	}
+
 	// Get files from form
 	files := r.MultipartForm.File["files"]
 	if len(files) == 0 {
@@ -112,10 +137,16 @@ func (h *Handlers) UploadBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	uploadID, err := h.uploadEventID(r)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Parse multipart form
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err = parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
 		return
 	}
 
@@ -125,6 +156,11 @@ func (h *Handlers) UploadBatch(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
+	targetPath, ok := h.uploadTarget(w, r, targetPath)
+	if !ok {
+		return
+	}
+
 	// Get batch size
 	batchSizeStr := r.FormValue("batch_size")
 	batchSize := h.cfg.Server.Upload.BatchSize
@@ -134,16 +170,39 @@ func (h *Handlers) UploadBatch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Clients may pick the batch ID so they can poll progress while the request is running
+	batchID := r.FormValue("batch_id")
+	if batchID == "" {
+		batchID = uuid.New().String()
+	} else if _, err := uuid.Parse(batchID); err != nil {
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Invalid batch ID")
+		return
+	}
+
 	// Get files from form
 	files := r.MultipartForm.File["files"]
 	if len(files) == 0 {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "No files provided")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "No files provided")
+		return
+	}
+	if err := h.checkUploadRateLimit(w, r, len(files)); err != nil {
+		h.writeUploadError(w, uploadID, uploadRateLimitStatus(err), err.Error())
 		return
 	}
 
 	// Process in batches
-	response := h.processBatchUpload(files, targetPath, batchSize)
-	
+	response, err := h.processBatchUpload(r.Context(), h.uploads(r), files, targetPath, batchSize, batchID, uploadID)
+	if err != nil {
+		if errors.Is(err, services.ErrBatchAlreadyExists) {
+			h.writeUploadError(w, uploadID, http.StatusConflict, err.Error())
+		} else {
+			h.writeUploadError(w, uploadID, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	recordMultipleUpload(metrics.UploadBatch, response)
+	h.publishMultipleUploadComplete(uploadID, response)
+
 	status := http.StatusCreated
 	if !response.Success {
 		if response.SuccessfulFiles == 0 {
@@ -158,11 +217,17 @@ func (h *Handlers) UploadBatch(w http.ResponseWriter, r *http.Request) {
 
 // UploadMultipleStream handles multiple file uploads using streaming for all files
 func (h *Handlers) UploadMultipleStream(w http.ResponseWriter, r *http.Request) {
+	uploadID, err := h.uploadEventID(r)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Parse multipart form with smaller memory limit for streaming
 	streamingMemory := h.cfg.Server.MaxMemory / 4 // Use less memory for streaming
-	err := r.ParseMultipartForm(int64(streamingMemory))
+	err = parseMultipartForm(r, int64(streamingMemory))
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Failed to parse multipart form: "+err.Error())
 		return
 	}
 
@@ -172,10 +237,19 @@ func (h *Handlers) UploadMultipleStream(w http.ResponseWriter, r *http.Request)
 		targetPath = "/"
 	}
 
+	targetPath, ok := h.uploadTarget(w, r, targetPath)
+	if !ok {
+		return
+	}
+
 	// Get files from form
 	files := r.MultipartForm.File["files"]
 	if len(files) == 0 {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "No files provided")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "No files provided")
+		return
+	}
+	if err := h.checkUploadRateLimit(w, r, len(files)); err != nil {
+		h.writeUploadError(w, uploadID, uploadRateLimitStatus(err), err.Error())
 		return
 	}
 
@@ -183,15 +257,19 @@ func (h *Handlers) UploadMultipleStream(w http.ResponseWriter, r *http.Request)
 	originalThreshold := h.cfg.Server.Upload.StreamingThreshold
 	h.cfg.Server.Upload.StreamingThreshold = 1 // Force streaming for all files
 
-	// Create multiple upload service
-	multipleUploadService := services.NewMultipleUploadService(h.fileService, h.cfg, h.cfg.Server.Storage.Path)
-
-	// Process uploads
-	response := multipleUploadService.UploadMultipleFiles(files, targetPath)
+	// Process uploads, publishing per-file events when requested
+	var tracker *services.BatchTracker
+	if uploadID != "" {
+		tracker = services.NewBatchTracker()
+		h.publishFileEvents(tracker, uploadID, files)
+	}
+	response := h.uploads(r).UploadMultipleFilesTracked(files, targetPath, tracker)
 	response.Strategy = "streaming"
+	recordMultipleUpload(metrics.UploadMultiple, response)
 
 	// Restore original threshold
 	h.cfg.Server.Upload.StreamingThreshold = originalThreshold
+	h.publishMultipleUploadComplete(uploadID, response)
 
 	status := http.StatusCreated
 	if !response.Success {
@@ -205,16 +283,32 @@ func (h *Handlers) UploadMultipleStream(w http.ResponseWriter, r *http.Request)
 	utils.WriteJSON(w, status, response)
 }
 
-// processBatchUpload processes files in batches
-func (h *Handlers) processBatchUpload(files []*multipart.FileHeader, targetPath string, batchSize int) *models.MultipleUploadResponse {
+// recordMultipleUpload counts the files of response that were stored in the upload metrics
+func recordMultipleUpload(strategy string, response *models.MultipleUploadResponse) {
+	var files int
+	var size int64
+	for _, result := range response.Files {
+		if result.Success {
+			files++
+			size += result.Size
+		}
+	}
+	metrics.RecordUpload(strategy, files, size)
+}
+
+// processBatchUpload processes files in batches, reporting progress under batchID
+// and per-file events to the uploadID event stream.
+// A cancelled batch stops before the next file and, when CleanupOnFailure is set,
+// removes the files it already stored.
+func (h *Handlers) processBatchUpload(ctx context.Context, uploads *services.MultipleUploadService, files []*multipart.FileHeader, targetPath string, batchSize int, batchID, uploadID string) (*models.MultipleUploadResponse, error) {
 	totalFiles := len(files)
 	allResults := make([]models.FileUploadResult, 0, totalFiles)
-	totalSuccessful := 0
-	totalFailed := 0
-	var totalProcessedSize int64
 
-	// Create multiple upload service
-	multipleUploadService := services.NewMultipleUploadService(h.fileService, h.cfg, h.cfg.Server.Storage.Path)
+	tracker, err := uploads.RegisterBatch(batchID, files)
+	if err != nil {
+		return nil, err
+	}
+	h.publishFileEvents(tracker, uploadID, files)
 
 	// Process in batches
 	for i := 0; i < totalFiles; i += batchSize {
@@ -223,8 +317,16 @@ func (h *Handlers) processBatchUpload(files []*multipart.FileHeader, targetPath
 			end = totalFiles
 		}
 
+		if tracker.Cancelled() {
+			for j := i; j < totalFiles; j++ {
+				allResults = append(allResults, services.CancelledFileResult(files[j], targetPath, j))
+			}
+			break
+		}
+
 		batch := files[i:end]
-		batchResponse := multipleUploadService.UploadMultipleFiles(batch, targetPath)
+		tracker.SetIndexOffset(i)
+		batchResponse := uploads.UploadMultipleFilesTracked(batch, targetPath, tracker)
 
 		// Adjust indices for global context
 		for j := range batchResponse.Files {
@@ -232,51 +334,123 @@ func (h *Handlers) processBatchUpload(files []*multipart.FileHeader, targetPath
 		}
 
 		allResults = append(allResults, batchResponse.Files...)
-		totalSuccessful += batchResponse.SuccessfulFiles
-		totalFailed += batchResponse.FailedFiles
-		totalProcessedSize += batchResponse.ProcessedSize
 
-		log.Printf("Processed batch %d-%d: %d successful, %d failed", 
-			i, end-1, batchResponse.SuccessfulFiles, batchResponse.FailedFiles)
+		logging.FromContext(ctx).Info("Processed upload batch", "batch_id", batchID, "first", i, "last", end-1,
+			"successful", batchResponse.SuccessfulFiles, "failed", batchResponse.FailedFiles)
 	}
 
-	// Calculate total size
-	var totalSize int64
-	for _, file := range files {
-		totalSize += file.Size
+	cancelled := tracker.Cancelled()
+	if cancelled && h.cfg.Server.Upload.CleanupOnFailure {
+		rolledBack := uploads.RollbackUploadedFiles(allResults)
+		tracker.FilesRolledBack(rolledBack)
+		logging.FromContext(ctx).Info("Upload batch cancelled", "batch_id", batchID, "rolled_back", rolledBack)
+	}
+
+	// Totals are derived from the final results so rolled back files are not counted
+	var totalSize, totalProcessedSize int64
+	totalSuccessful := 0
+	for _, result := range allResults {
+		totalSize += result.Size
+		if result.Success {
+			totalSuccessful++
+			totalProcessedSize += result.Size
+		}
 	}
 
 	response := &models.MultipleUploadResponse{
-		Success:         totalSuccessful > 0,
+		Success:         totalSuccessful > 0 && !cancelled,
 		TotalFiles:      totalFiles,
 		SuccessfulFiles: totalSuccessful,
-		FailedFiles:     totalFailed,
+		FailedFiles:     totalFiles - totalSuccessful,
 		TotalSize:       totalSize,
 		ProcessedSize:   totalProcessedSize,
 		Files:           allResults,
 		Strategy:        "batch",
+		BatchID:         batchID,
 	}
 
-	if totalSuccessful == totalFiles {
+	switch {
+	case cancelled:
+		response.Message = fmt.Sprintf("Batch upload cancelled: %d/%d files kept", totalSuccessful, totalFiles)
+		tracker.Finish(services.BatchStatusCancelled)
+	case totalSuccessful == totalFiles:
 		response.Message = fmt.Sprintf("Successfully uploaded all %d files in batches", totalFiles)
-	} else if totalSuccessful > 0 {
+		tracker.Finish(services.BatchStatusCompleted)
+	case totalSuccessful > 0:
 		response.Message = fmt.Sprintf("Batch upload completed: %d/%d files successful", totalSuccessful, totalFiles)
-	} else {
+		tracker.Finish(services.BatchStatusCompleted)
+	default:
 		response.Message = "All batch uploads failed"
+		tracker.Finish(services.BatchStatusFailed)
+	}
+
+	return response, nil
+}
+
+// errUploadExceedsRateLimit is returned for uploads larger than a whole budget of the rate
+// limit, which are refused with 413 as no wait would let them through
+var errUploadExceedsRateLimit = errors.New("upload exceeds the rate limit")
+
+// checkUploadRateLimit takes fileCount files from the upload budget of the client of the
+// request, and fails once the client uploaded more files per minute than allowed, telling
+// it in the RateLimit headers when to retry
+func (h *Handlers) checkUploadRateLimit(w http.ResponseWriter, r *http.Request, fileCount int) error {
+	result := ratelimit.UploadFilesFromContext(r.Context()).Take(int64(fileCount))
+	if result.Allowed {
+		return nil
 	}
 
-	return response
+	ratelimit.SetHeaders(w.Header(), result)
+	metrics.RateLimitedRequests.WithLabelValues(metrics.RateLimitUploadFiles).Inc()
+	if result.TooLarge {
+		return fmt.Errorf("%w: %d files with a limit of %d files per minute", errUploadExceedsRateLimit, fileCount, result.Limit)
+	}
+	return fmt.Errorf("rate limit exceeded: %d files with %d of %d files per minute left, retry in %s",
+		fileCount, result.Remaining, result.Limit, result.RetryAfter.Round(time.Second))
 }
 
-// checkUploadRateLimit performs basic rate limiting check
-func (h *Handlers) checkUploadRateLimit(clientIP string, fileCount int) error {
-	// In a production environment, this would use Redis or another cache
-	// For now, we'll do a simple check against configuration
-	if fileCount > h.cfg.Server.Upload.RateLimitPerMinute {
-		return fmt.Errorf("rate limit exceeded: %d files exceeds limit of %d per minute", 
-			fileCount, h.cfg.Server.Upload.RateLimitPerMinute)
+// allowUploadFiles writes a 429 or 413 response unless the client of the request may upload
+// fileCount more files
+func (h *Handlers) allowUploadFiles(w http.ResponseWriter, r *http.Request, fileCount int) bool {
+	if err := h.checkUploadRateLimit(w, r, fileCount); err != nil {
+		utils.WriteErrorJSON(w, uploadRateLimitStatus(err), err.Error())
+		return false
 	}
-	return nil
+	return true
+}
+
+// allowUploadBytes writes a 429 or 413 response unless the client of the request may upload the
+// bytes of its body. Only requests the rate limiting middleware left to their handler to
+// authorize, such as uploads to a share, are charged here.
+func (h *Handlers) allowUploadBytes(w http.ResponseWriter, r *http.Request) bool {
+	budget, ok := ratelimit.UploadBytesFromContext(r.Context())
+	if !ok {
+		return true
+	}
+
+	result := budget.TakeBody(r)
+	if result.Allowed {
+		return true
+	}
+
+	ratelimit.SetHeaders(w.Header(), result)
+	metrics.RateLimitedRequests.WithLabelValues(metrics.RateLimitUploadBytes).Inc()
+	if result.TooLarge {
+		utils.WriteErrorJSON(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s: %d bytes with a limit of %d bytes per minute",
+			errUploadExceedsRateLimit, r.ContentLength, result.Limit))
+		return false
+	}
+	utils.WriteErrorJSON(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded: %d bytes with %d of %d bytes per minute left, retry in %s",
+		r.ContentLength, result.Remaining, result.Limit, result.RetryAfter.Round(time.Second)))
+	return false
+}
+
+// uploadRateLimitStatus returns the status answering an upload refused by a rate limit
+func uploadRateLimitStatus(err error) int {
+	if errors.Is(err, errUploadExceedsRateLimit) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
 }
 
 // getClientIP extracts client IP from request
@@ -300,7 +474,7 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
-// GetBatchProgress returns progress for a batch upload (placeholder)
+// GetBatchProgress returns progress for a running or recently finished batch upload
 func (h *Handlers) GetBatchProgress(w http.ResponseWriter, r *http.Request) {
 	batchID := r.PathValue("batchId")
 	if batchID == "" {
@@ -308,19 +482,21 @@ func (h *Handlers) GetBatchProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// This would be implemented with actual progress tracking
-	progress := &models.BatchUploadProgress{
-		BatchID:         batchID,
-		Status:          "not_implemented",
-		TotalFiles:      0,
-		ProcessedFiles:  0,
-		PercentComplete: 0,
+	if !h.ownsBatch(w, r, batchID) {
+		return
+	}
+
+	progress, err := h.multipleUploads.GetUploadProgress(batchID)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, progress)
 }
 
-// CancelBatchUpload cancels a batch upload (placeholder)
+// CancelBatchUpload requests cancellation of a running batch upload.
+// The batch stops before its next file; the final state is reported by GetBatchProgress.
 func (h *Handlers) CancelBatchUpload(w http.ResponseWriter, r *http.Request) {
 	batchID := r.PathValue("batchId")
 	if batchID == "" {
@@ -328,12 +504,37 @@ func (h *Handlers) CancelBatchUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// This would be implemented with actual cancellation logic
+	if !h.ownsBatch(w, r, batchID) {
+		return
+	}
+
+	if err := h.multipleUploads.CancelBatchUpload(batchID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrBatchNotFound):
+			utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, services.ErrBatchNotActive):
+			utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+		default:
+			utils.WriteErrorJSON(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
 	response := map[string]string{
-		"status":  "not_implemented",
-		"message": "Batch cancellation not implemented yet",
+		"status":  "cancelling",
+		"message": "Batch cancellation requested",
 		"batchId": batchID,
 	}
 
-	utils.WriteJSON(w, http.StatusOK, response)
-}
\ No newline at end of file
+	utils.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// ownsBatch writes a 404 response unless the batch exists and the user of the request owns it
+func (h *Handlers) ownsBatch(w http.ResponseWriter, r *http.Request, batchID string) bool {
+	owner, err := h.multipleUploads.BatchOwner(batchID)
+	if err != nil || !ownsUpload(r, owner) {
+		utils.WriteErrorJSON(w, http.StatusNotFound, services.ErrBatchNotFound.Error())
+		return false
+	}
+	return true
+}
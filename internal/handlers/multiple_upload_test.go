@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/ratelimit"
+)
+
+func TestUploadMultiple_SpendsTheFilesBudget(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.Upload.MaxFilesPerRequest = 10
+	h.cfg.Server.Upload.MaxTotalSizePerRequest = 1 << 20
+	h.cfg.Server.Upload.AllowPartialSuccess = true
+
+	budget := ratelimit.New(3, time.Minute, 10).Budget("user:1")
+	upload := func(count int) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for i := 0; i < count; i++ {
+			part, _ := writer.CreateFormFile("files", fmt.Sprintf("notes-%d-%d.txt", count, i))
+			part.Write([]byte("some notes"))
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/multiple", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req = req.WithContext(ratelimit.ContextWithUploadFiles(req.Context(), budget))
+		w := httptest.NewRecorder()
+		h.UploadMultiple(w, req)
+		return w
+	}
+
+	if w := upload(2); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w := upload(2)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 2 more files than the 1 left to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "20" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("Expected when to retry in the headers, got %v", w.Header())
+	}
+	if w := upload(1); w.Code != http.StatusCreated {
+		t.Errorf("Expected the file left in the budget to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchUpload_OtherUsersGetNotFound(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	alice := &models.User{ID: 1, Username: "alice"}
+	bob := &models.User{ID: 2, Username: "bob"}
+
+	batchID := "batch-alice"
+	req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/upload/multiple", nil), alice)
+	if _, err := h.uploads(req).RegisterBatch(batchID, nil); err != nil {
+		t.Fatalf("Failed to register batch: %v", err)
+	}
+
+	for _, handler := range []http.HandlerFunc{h.GetBatchProgress, h.CancelBatchUpload} {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/api/v1/upload/batch/"+batchID, nil), bob)
+		req.SetPathValue("batchId", batchID)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected another user to get 404, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	req = withUser(httptest.NewRequest(http.MethodGet, "/api/v1/upload/batch/"+batchID, nil), &models.User{ID: 3, IsAdmin: true})
+	req.SetPathValue("batchId", batchID)
+	w := httptest.NewRecorder()
+	h.GetBatchProgress(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to see the batch, got %d: %s", w.Code, w.Body.String())
+	}
+}
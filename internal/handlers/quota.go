@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// GetQuotaUsage returns the storage used by the signed-in user and the quotas that limit
+// uploads to ?path=, the root by default
+func (h *Handlers) GetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/"
+	}
+	if !h.allowPaths(w, r, path) {
+		return
+	}
+
+	usage, err := h.files(r).GetQuotaUsage(path)
+	if err != nil {
+		writeQuotaError(w, err, "Failed to load quota usage: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, usage)
+}
+
+func (h *Handlers) ListQuotas(w http.ResponseWriter, r *http.Request) {
+	if !h.requireQuotas(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	quotas, err := h.fileService.Quotas().ListQuotas()
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list quotas: "+err.Error())
+		return
+	}
+	if quotas == nil {
+		quotas = []*models.Quota{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"quotas": quotas,
+	})
+}
+
+// SetQuota limits a user or directory, replacing the limits of an existing quota for the same subject
+func (h *Handlers) SetQuota(w http.ResponseWriter, r *http.Request) {
+	if !h.requireQuotas(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req models.SetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.SubjectType == models.QuotaSubjectDirectory {
+		if req.Path == "" {
+			req.Path = "/"
+		}
+		if !h.allowPaths(w, r, req.Path) {
+			return
+		}
+	}
+
+	quota, err := h.files(r).SetQuota(&req)
+	if err != nil {
+		writeQuotaError(w, err, "Failed to save quota: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, quota)
+}
+
+func (h *Handlers) DeleteQuota(w http.ResponseWriter, r *http.Request) {
+	if !h.requireQuotas(w) || !h.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid quota ID")
+		return
+	}
+
+	if err := h.files(r).DeleteQuota(id); err != nil {
+		writeQuotaError(w, err, "Failed to delete quota: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Quota deleted",
+	})
+}
+
+func (h *Handlers) requireQuotas(w http.ResponseWriter) bool {
+	if h.fileService.Quotas() == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Quotas are disabled")
+		return false
+	}
+	return true
+}
+
+// writeQuotaExceeded writes a 507 response when err is a quota rejection and reports whether it did
+func writeQuotaExceeded(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, services.ErrQuotaExceeded) {
+		return false
+	}
+	utils.WriteErrorJSON(w, http.StatusInsufficientStorage, err.Error())
+	return true
+}
+
+func writeQuotaError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrInvalidQuota):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrQuotaNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func TestQuota_UploadOverQuotaRejected(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.MaxMemory = 1024
+
+	admin, err := authService.CreateUser("admin", "correct horse", true)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	alice, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	body, _ := json.Marshal(models.SetQuotaRequest{SubjectType: models.QuotaSubjectUser, UserID: alice.ID, MaxBytes: 8})
+	setQuota := func(user *models.User) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/quotas", bytes.NewReader(body))
+		req = req.WithContext(services.ContextWithUser(req.Context(), user))
+		w := httptest.NewRecorder()
+		h.SetQuota(w, req)
+		return w.Code
+	}
+	if code := setQuota(alice); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d", code)
+	}
+	if code := setQuota(admin); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+
+	req := newDigestUploadRequest(t, "/api/v1/upload", "hello.txt", "", []byte("hello world"))
+	req = req.WithContext(services.ContextWithUser(req.Context(), alice))
+	w := httptest.NewRecorder()
+	h.Upload(w, req)
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInsufficientStorage, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/quota", nil)
+	req = req.WithContext(services.ContextWithUser(req.Context(), alice))
+	w = httptest.NewRecorder()
+	h.GetQuotaUsage(w, req)
+
+	var usage models.QuotaUsage
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if usage.UsedBytes != 0 || len(usage.Quotas) != 1 || *usage.Quotas[0].RemainingBytes != 8 {
+		t.Errorf("Expected nothing used and 8 bytes left, got %+v", usage)
+	}
+}
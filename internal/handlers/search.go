@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// Search finds files and directories by name or path. q is required unless tags is set;
+// path limits the search to a directory, type to a MIME type or a prefix such as
+// "image/", min_size and max_size to a size range in bytes, modified_after and
+// modified_before (RFC 3339) to a modification time range, and tags to the entries
+// carrying all the comma-separated tags.
+func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &models.SearchFilter{
+		Query:    query.Get("q"),
+		Scope:    query.Get("path"),
+		MimeType: query.Get("type"),
+		Tags:     tagsParam(r),
+	}
+	if filter.Scope == "" {
+		filter.Scope = "/"
+	}
+	if filter.Query == "" && len(filter.Tags) == 0 {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Search query or tags required")
+		return
+	}
+	if !h.allowPaths(w, r, filter.Scope) {
+		return
+	}
+
+	for name, target := range map[string]**int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if value := query.Get(name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid "+name)
+				return
+			}
+			*target = &size
+		}
+	}
+	for name, target := range map[string]*time.Time{"modified_after": &filter.ModifiedAfter, "modified_before": &filter.ModifiedBefore} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid "+name+" time, expected RFC 3339")
+				return
+			}
+			*target = parsed
+		}
+	}
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.files(r).Search(filter, limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSearch) {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Search failed: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, results)
+}
+
+// pageParams reads the limit and offset of a paginated request, 0 when absent, or writes
+// an error response when they are malformed
+func pageParams(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	query := r.URL.Query()
+	for name, target := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid "+name)
+				return 0, 0, false
+			}
+			*target = parsed
+		}
+	}
+	return limit, offset, true
+}
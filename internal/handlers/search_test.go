@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestSearch_ReturnsRankedResults(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+
+	for _, name := range []string{"budget.xlsx", "budget-notes.txt", "logo.png"} {
+		if err := fileService.SaveFile(name, "/", []byte(name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=budg&type=text/&limit=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results models.SearchResults
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(results.Results) != 1 || results.Results[0].Path != "/budget-notes.txt" || results.Limit != 5 {
+		t.Errorf("Expected only the text file, got %+v", results)
+	}
+	if len(results.Results) == 1 && len(results.Results[0].Breadcrumbs) != 1 {
+		t.Errorf("Expected the root breadcrumb, got %+v", results.Results[0].Breadcrumbs)
+	}
+
+	for _, query := range []string{"", "?q=budget&min_size=big", "?q=budget&modified_after=yesterday"} {
+		w = httptest.NewRecorder()
+		h.Search(w, httptest.NewRequest(http.MethodGet, "/api/v1/search"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// ListShares returns the share links created by the signed-in user. Admins can pass ?all=true
+// to see every link.
+func (h *Handlers) ListShares(w http.ResponseWriter, r *http.Request) {
+	if !h.requireShares(w) {
+		return
+	}
+
+	all := r.URL.Query().Get("all") == "true"
+	if user := services.UserFromContext(r.Context()); all && user != nil && !user.IsAdmin {
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Administrator privileges required")
+		return
+	}
+
+	shares, err := h.files(r).ListShares(all)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to list shares: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"shares": shares,
+	})
+}
+
+func (h *Handlers) CreateShare(w http.ResponseWriter, r *http.Request) {
+	if !h.requireShares(w) {
+		return
+	}
+
+	var req models.CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if !h.allowPaths(w, r, req.Path) {
+		return
+	}
+
+	token, share, err := h.files(r).CreateShare(&req)
+	if err != nil {
+		writeShareError(w, err, "Failed to create share: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, models.CreateShareResponse{
+		Token: token,
+		URL:   "/s/" + token,
+		Share: share,
+	})
+}
+
+func (h *Handlers) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	if !h.requireShares(w) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid share ID")
+		return
+	}
+
+	if err := h.files(r).RevokeShare(id); err != nil {
+		writeShareError(w, err, "Failed to revoke share: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Share revoked",
+	})
+}
+
+// OpenShare serves a shared file, or lists a shared directory and serves the files below it.
+// Directories are downloaded as an archive with ?format=. It needs no account, only the token
+// and the password of the share, if it has one.
+func (h *Handlers) OpenShare(w http.ResponseWriter, r *http.Request) {
+	share, files, info, ok := h.openShare(w, r)
+	if !ok {
+		return
+	}
+
+	if sub := r.PathValue("path"); sub != "" {
+		if !info.IsDirectory {
+			utils.WriteErrorJSON(w, http.StatusNotFound, "File not found")
+			return
+		}
+
+		var err error
+		info, err = files.GetFileInfo("/" + sub)
+		if err != nil {
+			utils.WriteErrorJSON(w, http.StatusNotFound, "File not found")
+			return
+		}
+	}
+
+	if info.IsDirectory && !r.URL.Query().Has("format") {
+		listing, err := files.GetDirectoryListing(info.Path)
+		if err != nil {
+			writeShareError(w, err, "Failed to list directory: ")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, listing)
+		return
+	}
+
+	// Resumed downloads and requests for headers only do not count against the limit. The
+	// download is counted before anything is sent, so once the limit is reached nothing is.
+	if countsAsDownload(r, info) {
+		if err := h.fileService.Shares().RecordDownload(share); err != nil {
+			writeShareError(w, err, "Failed to open share: ")
+			return
+		}
+	}
+
+	if info.IsDirectory {
+		downloadDirectory(w, r, files, info)
+		return
+	}
+	serveFile(w, r, files, info.Path)
+}
+
+// countsAsDownload reports whether serving r sends the first byte of info, which is what
+// counts against the download limit of a share. Directory archives ignore Range, and so do
+// If-Range requests whose validator changed and Range headers asking for more bytes than
+// the file has, so these count like Range headers that cannot be parsed.
+func countsAsDownload(r *http.Request, info *models.FileInfo) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || info.IsDirectory || r.Header.Get("If-Range") != "" {
+		return true
+	}
+	specs, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return true
+	}
+
+	size := info.Size
+	var total int64
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return true
+		}
+
+		var start, end int64
+		if first == "" {
+			// A suffix range sends the last bytes, the whole file when it asks for as many
+			length, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || length < 0 {
+				return true
+			}
+			start = max(size-length, 0)
+			end = size - 1
+		} else {
+			var err error
+			if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+				return true
+			}
+			end = size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return true
+				}
+				end = min(end, size-1)
+			}
+		}
+
+		if start >= size {
+			continue
+		}
+		if start == 0 {
+			return true
+		}
+		total += end - start + 1
+	}
+	return total > size
+}
+
+// UploadToShare stores a file in a directory shared in upload mode, or in a directory below it
+func (h *Handlers) UploadToShare(w http.ResponseWriter, r *http.Request) {
+	share, files, info, ok := h.openShare(w, r)
+	if !ok {
+		return
+	}
+	if share.Mode != models.ShareModeUpload || !info.IsDirectory {
+		utils.WriteErrorJSON(w, http.StatusForbidden, "This share does not accept uploads")
+		return
+	}
+	if !h.allowUploadBytes(w, r) || !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
+	if err := parseMultipartForm(r, int64(h.cfg.Server.MaxMemory)); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > h.cfg.Server.MaxFileSize {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "File too large. Max size: "+strconv.FormatInt(h.cfg.Server.MaxFileSize, 10)+" bytes")
+		return
+	}
+
+	saveUpload(w, r, files, file, header, "/"+r.PathValue("path"))
+}
+
+// openShare resolves the token of a share request to the share, the view serving it and
+// the shared file or directory, writing an error response when it cannot be used
+func (h *Handlers) openShare(w http.ResponseWriter, r *http.Request) (*models.Share, *services.FileService, *models.FileInfo, bool) {
+	if !h.requireShares(w) {
+		return nil, nil, nil, false
+	}
+
+	share, err := h.fileService.Shares().Open(r.PathValue("token"), sharePassword(r))
+	if err == nil {
+		var files *services.FileService
+		var info *models.FileInfo
+		if files, info, err = h.fileService.ForShare(share); err == nil {
+			return share, files.WithClientIP(getClientIP(r)), info, true
+		}
+	}
+
+	writeShareError(w, err, "Failed to open share: ")
+	return nil, nil, nil, false
+}
+
+// sharePassword returns the password sent with a share request in the X-Share-Password
+// header or as the password of basic authentication, so browsers can prompt for it
+func sharePassword(r *http.Request) string {
+	if password := r.Header.Get("X-Share-Password"); password != "" {
+		return password
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+func (h *Handlers) requireShares(w http.ResponseWriter) bool {
+	if h.fileService.Shares() == nil {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Share links are disabled")
+		return false
+	}
+	return true
+}
+
+func writeShareError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrInvalidShare):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrSharePasswordRequired):
+		w.Header().Set("WWW-Authenticate", `Basic realm="cloudlet share"`)
+		utils.WriteErrorJSON(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrShareExpired):
+		utils.WriteErrorJSON(w, http.StatusGone, err.Error())
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrShareNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/ratelimit"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func TestShare_PublicDownload(t *testing.T) {
+	h, authService := setupAuthHandlers(t)
+	alice, err := authService.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := h.fileService.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := h.fileService.SetACLEntry(&models.SetACLEntryRequest{
+		Path: "/team", SubjectType: models.SubjectUser, SubjectID: alice.ID, Permissions: []string{models.PermissionRead},
+	}); err != nil {
+		t.Fatalf("Failed to grant read: %v", err)
+	}
+	if err := h.fileService.SaveFile("report.txt", "/team", []byte("quarterly numbers")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	body, _ := json.Marshal(models.CreateShareRequest{Path: "/team/report.txt", Password: "hunter2", MaxDownloads: 1})
+	createShare := func(user *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shares", bytes.NewReader(body))
+		req = req.WithContext(services.ContextWithUser(req.Context(), user))
+		w := httptest.NewRecorder()
+		h.CreateShare(w, req)
+		return w
+	}
+	if w := createShare(alice); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without the share permission, got %d", w.Code)
+	}
+
+	w := createShare(nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.CreateShareResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.URL != "/s/"+created.Token || !created.Share.HasPassword {
+		t.Errorf("Unexpected response: %+v", created)
+	}
+
+	open := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, created.URL, nil)
+		req.SetPathValue("token", created.Token)
+		if password != "" {
+			req.SetBasicAuth("", password)
+		}
+		w := httptest.NewRecorder()
+		h.OpenShare(w, req)
+		return w
+	}
+
+	w = open("")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("Expected a password challenge, got %d", w.Code)
+	}
+
+	w = open("hunter2")
+	if w.Code != http.StatusOK || w.Body.String() != "quarterly numbers" {
+		t.Fatalf("Expected the file, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("Expected the download to be served with an ETag")
+	}
+
+	if w = open("hunter2"); w.Code != http.StatusGone {
+		t.Errorf("Expected the download limit to be reached, got %d", w.Code)
+	}
+}
+
+func TestShare_CountsDownloadsCoveringTheFirstByte(t *testing.T) {
+	file := &models.FileInfo{Size: 100}
+	tests := []struct {
+		method  string
+		header  map[string]string
+		counted bool
+	}{
+		{http.MethodGet, nil, true},
+		{http.MethodHead, nil, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-9"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=50-"}, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=50-59, 0-1"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes= 00-10"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=-10"}, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=-100"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=200-"}, false},
+		// More bytes than the file has are answered with the whole file
+		{http.MethodGet, map[string]string{"Range": "bytes=1-,1-"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=1-", "If-Range": `"stale"`}, true},
+		{http.MethodGet, map[string]string{"Range": "items=1-"}, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=x-"}, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/s/token", nil)
+		for name, value := range tt.header {
+			req.Header.Set(name, value)
+		}
+		if got := countsAsDownload(req, file); got != tt.counted {
+			t.Errorf("%s with %v: counted %v, want %v", tt.method, tt.header, got, tt.counted)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/s/token?format=zip", nil)
+	req.Header.Set("Range", "bytes=50-")
+	if !countsAsDownload(req, &models.FileInfo{IsDirectory: true}) {
+		t.Error("Expected directory archives to count")
+	}
+}
+
+func TestShare_UploadsSpendBytesOnceAuthorized(t *testing.T) {
+	h, _ := setupAuthHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	if _, err := h.fileService.CreateDirectory("drop", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	token, _, err := h.fileService.CreateShare(&models.CreateShareRequest{Path: "/drop", Mode: models.ShareModeUpload})
+	if err != nil {
+		t.Fatalf("Failed to create share: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("some notes"))
+	writer.Close()
+
+	budget := ratelimit.New(int64(body.Len()), time.Minute, 10).Budget("ip:192.0.2.1")
+	upload := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/s/"+token, bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.SetPathValue("token", token)
+		req = req.WithContext(ratelimit.ContextWithUploadBytes(req.Context(), budget))
+		w := httptest.NewRecorder()
+		h.UploadToShare(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := upload("not-a-share-token"); w.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404 for an unknown share, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := upload(token); w.Code != http.StatusCreated {
+		t.Fatalf("Expected uploads with a bad token to spend nothing, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := upload(token); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the upload to have spent the byte budget, got %d: %s", w.Code, w.Body.String())
+	}
+}
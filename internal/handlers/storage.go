@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// StorageStats reports how much space content deduplication saves
+func (h *Handlers) StorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.fileService.GetDeduplicationStats()
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to read storage statistics: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// ListTrash returns the deleted files and directories of the user, every one for admins
+func (h *Handlers) ListTrash(w http.ResponseWriter, r *http.Request) {
+	items, err := h.files(r).ListTrash()
+	if err != nil {
+		writeTrashError(w, err, "Failed to list trash: ")
+		return
+	}
+
+	// Keys limited to some paths only see the items deleted from those
+	visible := []*models.TrashItem{}
+	for _, item := range items {
+		if services.CheckPathAccess(r.Context(), item.Path) == nil {
+			visible = append(visible, item)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": h.fileService.TrashEnabled(),
+		"items":   visible,
+	})
+}
+
+// RestoreTrashItem puts a trash item back at its original path
+func (h *Handlers) RestoreTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.trashItem(w, r)
+	if !ok {
+		return
+	}
+
+	restored, err := h.files(r).RestoreFromTrash(item.ID)
+	if err != nil {
+		writeTrashError(w, err, "Failed to restore: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Restored " + restored.Path,
+		Data:    restored,
+	})
+}
+
+// PurgeTrashItem deletes a trash item for good
+func (h *Handlers) PurgeTrashItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.trashItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.files(r).PurgeTrashItem(item.ID); err != nil {
+		writeTrashError(w, err, "Failed to purge: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Trash item purged",
+	})
+}
+
+// EmptyTrash deletes for good every trash item ListTrash returns
+func (h *Handlers) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	if !h.allowPaths(w, r, "/") {
+		return
+	}
+
+	purged, err := h.files(r).EmptyTrash()
+	if err != nil {
+		writeTrashError(w, err, "Failed to empty trash: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "Trash emptied",
+		Data:    map[string]int64{"purged": purged},
+	})
+}
+
+// trashItem looks up the trash item named by the request and checks the credentials may access its path
+func (h *Handlers) trashItem(w http.ResponseWriter, r *http.Request) (*models.TrashItem, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid trash item ID")
+		return nil, false
+	}
+
+	item, err := h.files(r).GetTrashItem(id)
+	if err != nil {
+		writeTrashError(w, err, "Failed to find trash item: ")
+		return nil, false
+	}
+	if !h.allowPaths(w, r, item.Path) {
+		return nil, false
+	}
+	return item, true
+}
+
+func writeTrashError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrTrashItemNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrRestoreConflict):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrQuotaExceeded):
+		utils.WriteErrorJSON(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
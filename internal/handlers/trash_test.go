@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestTrash_DeleteListAndRestore(t *testing.T) {
+	h, fileService := setupDownloadHandlers(t)
+	fileService.EnableTrash(time.Hour)
+
+	for _, name := range []string{"keep.txt", "gone.txt"} {
+		if err := fileService.SaveFile(name, "/", []byte(name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.DeleteFile(w, httptest.NewRequest(http.MethodDelete, "/api/v1/files/keep.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.DeleteFile(w, httptest.NewRequest(http.MethodDelete, "/api/v1/files/gone.txt?permanent=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ListTrash(w, httptest.NewRequest(http.MethodGet, "/api/v1/trash", nil))
+	var listed struct {
+		Enabled bool                `json:"enabled"`
+		Items   []*models.TrashItem `json:"items"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !listed.Enabled || len(listed.Items) != 1 || listed.Items[0].Path != "/keep.txt" {
+		t.Fatalf("Expected only keep.txt in the trash, got %+v", listed)
+	}
+
+	id := strconv.FormatInt(listed.Items[0].ID, 10)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/trash/"+id+"/restore", nil)
+	req.SetPathValue("id", id)
+	w = httptest.NewRecorder()
+	h.RestoreTrashItem(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/trash/"+id+"/restore", nil)
+	req.SetPathValue("id", id)
+	w = httptest.NewRecorder()
+	h.RestoreTrashItem(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a restored item, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest(http.MethodGet, "/api/v1/download/keep.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "keep.txt" {
+		t.Errorf("Expected the restored file, got %d: %s", w.Code, w.Body.String())
+	}
+}
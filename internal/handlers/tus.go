@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/metrics"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+const (
+	tusBasePath               = "/api/v1/tus/"
+	tusOffsetContentType      = "application/offset+octet-stream"
+	statusTusChecksumMismatch = 460
+)
+
+// TusOptions answers tus discovery requests with the supported version and extensions
+func (h *Handlers) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", services.TusVersion)
+	w.Header().Set("Tus-Version", services.TusVersion)
+	w.Header().Set("Tus-Extension", strings.Join(services.TusExtensions, ","))
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.tusUploads.MaxSize(), 10))
+	w.Header().Set("Tus-Checksum-Algorithm", strings.Join(services.TusChecksumAlgorithms, ","))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate implements the creation extension. The target filename and directory
+// are read from the "filename" and "path" keys of Upload-Metadata.
+func (h *Handlers) TusCreate(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid Upload-Length")
+		return
+	}
+
+	// Malformed metadata is rejected by CreateUpload below
+	if metadata, err := services.ParseTusMetadata(r.Header.Get("Upload-Metadata")); err == nil {
+		targetPath := metadata["path"]
+		if targetPath == "" {
+			targetPath = "/"
+		}
+		if _, ok := h.uploadTarget(w, r, targetPath); !ok {
+			return
+		}
+	}
+	if !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
+	upload, err := h.tusUploads.CreateUploadFor(h.files(r), length, r.Header.Get("Upload-Metadata"))
+	if err != nil && upload == nil {
+		if errors.Is(err, services.ErrTusUploadTooLarge) {
+			utils.WriteErrorJSON(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if writeQuotaExceeded(w, err) {
+			return
+		}
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", tusBasePath+upload.ID)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHead reports the current offset of an upload so clients can resume it
+func (h *Handlers) TusHead(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := h.tusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatch appends the request body to an upload at Upload-Offset
+func (h *Handlers) TusPatch(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		utils.WriteErrorJSON(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusOffsetContentType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid Upload-Offset")
+		return
+	}
+	if _, ok := h.tusUpload(w, r); !ok {
+		return
+	}
+
+	upload, err := h.tusUploads.WriteChunk(r.PathValue("id"), offset, r.Header.Get("Upload-Checksum"), r.Body)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	if upload.Completed {
+		metrics.RecordUpload(metrics.UploadChunked, 1, upload.Length)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDelete implements the termination extension
+func (h *Handlers) TusDelete(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if _, ok := h.tusUpload(w, r); !ok {
+		return
+	}
+
+	if err := h.tusUploads.TerminateUpload(r.PathValue("id")); err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusUpload returns the upload named in the request, writing a 404 response unless it
+// exists and the user of the request owns it
+func (h *Handlers) tusUpload(w http.ResponseWriter, r *http.Request) (*services.TusUpload, bool) {
+	upload, err := h.tusUploads.GetUpload(r.PathValue("id"))
+	if err == nil && !ownsUpload(r, upload.OwnerID) {
+		err = services.ErrTusUploadNotFound
+	}
+	if err != nil {
+		writeTusError(w, err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// TusMethodOverride lets clients behind proxies that block PATCH and DELETE
+// send them as POST with X-HTTP-Method-Override
+func (h *Handlers) TusMethodOverride(w http.ResponseWriter, r *http.Request) {
+	switch strings.ToUpper(r.Header.Get("X-HTTP-Method-Override")) {
+	case http.MethodPatch:
+		h.TusPatch(w, r)
+	case http.MethodDelete:
+		h.TusDelete(w, r)
+	default:
+		w.Header().Set("Tus-Resumable", services.TusVersion)
+		utils.WriteErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// checkTusResumable rejects requests for protocol versions other than the one we implement
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", services.TusVersion)
+
+	if r.Header.Get("Tus-Resumable") != services.TusVersion {
+		w.Header().Set("Tus-Version", services.TusVersion)
+		utils.WriteErrorJSON(w, http.StatusPreconditionFailed, "Unsupported tus version")
+		return false
+	}
+	return true
+}
+
+func writeTusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrTusUploadNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrTusOffsetMismatch):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrTusUploadAlreadyFinal):
+		utils.WriteErrorJSON(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrTusUploadLocked):
+		utils.WriteErrorJSON(w, http.StatusLocked, err.Error())
+	case errors.Is(err, services.ErrTusChecksumMismatch):
+		utils.WriteErrorJSON(w, statusTusChecksumMismatch, err.Error())
+	case errors.Is(err, services.ErrTusUnsupportedAlgo),
+		errors.Is(err, services.ErrTusInvalidChecksum):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrQuotaExceeded):
+		utils.WriteErrorJSON(w, http.StatusInsufficientStorage, err.Error())
+	case errors.Is(err, services.ErrPathIsDirectory):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "UNIQUE constraint"):
+		utils.WriteErrorJSON(w, http.StatusConflict, "File already exists")
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Upload failed: "+err.Error())
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+)
+
+func setupTusHandlers(t *testing.T) (*Handlers, *services.FileService) {
+	h, fileService := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024 * 1024
+	return h, fileService
+}
+
+func newTusRequest(method, target string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", services.TusVersion)
+	return req
+}
+
+// withUser returns req as sent by user
+func withUser(req *http.Request, user *models.User) *http.Request {
+	return req.WithContext(services.ContextWithUser(req.Context(), user))
+}
+
+func tusMetadata(pairs ...string) string {
+	var encoded []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func createTusUpload(t *testing.T, h *Handlers, length int, metadata string) string {
+	req := newTusRequest("POST", "/api/v1/tus/", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", metadata)
+	w := httptest.NewRecorder()
+
+	h.TusCreate(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/tus/") {
+		t.Fatalf("Unexpected Location header: %q", location)
+	}
+	return strings.TrimPrefix(location, "/api/v1/tus/")
+}
+
+func patchTusUpload(h *Handlers, id string, offset int, data []byte, checksum string) *httptest.ResponseRecorder {
+	req := newTusRequest("PATCH", "/api/v1/tus/"+id, data)
+	req.SetPathValue("id", id)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	if checksum != "" {
+		req.Header.Set("Upload-Checksum", checksum)
+	}
+	w := httptest.NewRecorder()
+	h.TusPatch(w, req)
+	return w
+}
+
+func headTusUpload(h *Handlers, id string) *httptest.ResponseRecorder {
+	req := newTusRequest("HEAD", "/api/v1/tus/"+id, nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	h.TusHead(w, req)
+	return w
+}
+
+func sha1Checksum(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestTus_ResumableUpload(t *testing.T) {
+	h, fileService := setupTusHandlers(t)
+
+	if _, err := fileService.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	content := []byte("hello tus protocol, resumable world")
+	id := createTusUpload(t, h, len(content), tusMetadata("filename", "notes.txt", "path", "/docs"))
+
+	w := headTusUpload(h, id)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("Expected offset 0, got status %d offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Errorf("Unexpected Upload-Length: %q", w.Header().Get("Upload-Length"))
+	}
+
+	first := content[:10]
+	w = patchTusUpload(h, id, 0, first, sha1Checksum(first))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("Expected offset 10, got %q", w.Header().Get("Upload-Offset"))
+	}
+
+	// Resuming from the wrong offset is rejected
+	w = patchTusUpload(h, id, 5, content[5:], "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for offset mismatch, got %d", http.StatusConflict, w.Code)
+	}
+
+	// A corrupted chunk is discarded and the offset stays put
+	w = patchTusUpload(h, id, 10, []byte("corrupted!"), sha1Checksum(content[10:20]))
+	if w.Code != 460 {
+		t.Errorf("Expected status 460 for checksum mismatch, got %d", w.Code)
+	}
+	if got := headTusUpload(h, id).Header().Get("Upload-Offset"); got != "10" {
+		t.Fatalf("Expected offset to remain 10 after checksum mismatch, got %q", got)
+	}
+
+	w = patchTusUpload(h, id, 10, content[10:], "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	data, _, err := fileService.GetFileData("/docs/notes.txt")
+	if err != nil {
+		t.Fatalf("Expected uploaded file to be stored: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("Stored content mismatch: %q", data)
+	}
+
+	// Completed uploads still report their final offset
+	if got := headTusUpload(h, id).Header().Get("Upload-Offset"); got != strconv.Itoa(len(content)) {
+		t.Errorf("Expected final offset %d, got %q", len(content), got)
+	}
+}
+
+func TestTus_Termination(t *testing.T) {
+	h, _ := setupTusHandlers(t)
+
+	id := createTusUpload(t, h, 100, tusMetadata("filename", "big.bin"))
+
+	req := newTusRequest("DELETE", "/api/v1/tus/"+id, nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	h.TusDelete(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := headTusUpload(h, id); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after termination, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTus_ProtocolChecks(t *testing.T) {
+	h, _ := setupTusHandlers(t)
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/tus/", nil)
+	w := httptest.NewRecorder()
+	h.TusOptions(w, req)
+	if w.Header().Get("Tus-Version") != services.TusVersion {
+		t.Errorf("Expected Tus-Version %s, got %q", services.TusVersion, w.Header().Get("Tus-Version"))
+	}
+	if ext := w.Header().Get("Tus-Extension"); !strings.Contains(ext, "creation") || !strings.Contains(ext, "checksum") {
+		t.Errorf("Unexpected Tus-Extension: %q", ext)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/tus/", nil)
+	req.Header.Set("Upload-Length", "10")
+	w = httptest.NewRecorder()
+	h.TusCreate(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d without Tus-Resumable, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+
+	req = newTusRequest("POST", "/api/v1/tus/", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(2*1024*1024))
+	req.Header.Set("Upload-Metadata", tusMetadata("filename", "huge.bin"))
+	w = httptest.NewRecorder()
+	h.TusCreate(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for oversized upload, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	req = newTusRequest("POST", "/api/v1/tus/", nil)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", tusMetadata("filename", "../escape.txt"))
+	w = httptest.NewRecorder()
+	h.TusCreate(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid filename, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestTus_OtherUsersGetNotFound(t *testing.T) {
+	h, _ := setupTusHandlers(t)
+	alice := &models.User{ID: 1, Username: "alice"}
+	bob := &models.User{ID: 2, Username: "bob"}
+
+	req := withUser(newTusRequest("POST", "/api/v1/tus/", nil), alice)
+	req.Header.Set("Upload-Length", "5")
+	req.Header.Set("Upload-Metadata", tusMetadata("filename", "a.txt"))
+	w := httptest.NewRecorder()
+	h.TusCreate(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/api/v1/tus/")
+
+	for _, method := range []string{"HEAD", "PATCH", "DELETE"} {
+		req := withUser(newTusRequest(method, "/api/v1/tus/"+id, []byte("hello")), bob)
+		req.SetPathValue("id", id)
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		w := httptest.NewRecorder()
+		switch method {
+		case "HEAD":
+			h.TusHead(w, req)
+		case "PATCH":
+			h.TusPatch(w, req)
+		case "DELETE":
+			h.TusDelete(w, req)
+		}
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s by another user to answer 404, got %d", method, w.Code)
+		}
+	}
+
+	req = withUser(newTusRequest("HEAD", "/api/v1/tus/"+id, nil), alice)
+	req.SetPathValue("id", id)
+	w = httptest.NewRecorder()
+	h.TusHead(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "0" {
+		t.Errorf("Expected the owner to see the untouched upload, got %d offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+}
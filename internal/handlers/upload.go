@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 
+	"github.com/anddsdev/cloudlet/internal/metrics"
 	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 	"github.com/anddsdev/cloudlet/internal/utils"
 )
 
 func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err := parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
@@ -33,19 +37,47 @@ func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
+	if !h.allowPaths(w, r, targetPath) || !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
+	saveUpload(w, r, h.files(r), file, header, targetPath)
+}
+
+// parseMultipartForm parses the multipart body of r, keeping up to maxMemory bytes of files
+// in memory, in a span of its own so traces tell receiving an upload from storing it
+func parseMultipartForm(r *http.Request, maxMemory int64) error {
+	_, span := tracing.Start(r.Context(), "Handlers.ParseMultipartForm",
+		tracing.Int64("http.request.body.size", r.ContentLength))
+	defer span.End()
+
+	err := r.ParseMultipartForm(maxMemory)
+	span.RecordError(err)
+	return err
+}
+
+// saveUpload stores a file received in a multipart form in targetPath through files
+func saveUpload(w http.ResponseWriter, r *http.Request, files *services.FileService, file multipart.File, header *multipart.FileHeader, targetPath string) {
 	if !utils.IsValidFilename(header.Filename) {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid filename")
 		return
 	}
 
+	checksum, err := uploadChecksum(r, header)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Use streaming for files larger than 10MB to prevent memory leaks
 	const streamingThreshold = 10 * 1024 * 1024 // 10MB
 	
+	var saved *models.FileInfo
 	if header.Size > streamingThreshold {
 		// Use streaming upload for large files
-		err = h.fileService.SaveFileStream(header.Filename, targetPath, file, header.Size)
+		saved, err = files.SaveFileStreamWithChecksum(header.Filename, targetPath, file, header.Size, checksum)
 		if err != nil {
-			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+			utils.WriteErrorJSON(w, saveErrorStatus(err), "Failed to save file: "+err.Error())
 			return
 		}
 	} else {
@@ -56,18 +88,21 @@ func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = h.fileService.SaveFile(header.Filename, targetPath, data)
+		saved, err = files.SaveFileWithChecksum(header.Filename, targetPath, data, checksum)
 		if err != nil {
-			utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+			utils.WriteErrorJSON(w, saveErrorStatus(err), "Failed to save file: "+err.Error())
 			return
 		}
 	}
 
+	metrics.RecordUpload(metrics.UploadSingle, 1, header.Size)
+
 	response := &models.UploadResponse{
 		Success:  true,
 		Filename: header.Filename,
 		Size:     header.Size,
 		Path:     targetPath,
+		Checksum: saved.Checksum,
 		Message:  "File uploaded successfully",
 	}
 
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+	"github.com/google/uuid"
+)
+
+// uploadEventKeepAlive is how often a comment is sent on idle streams so proxies keep them open
+const uploadEventKeepAlive = 15 * time.Second
+
+var (
+	errInvalidUploadID = errors.New("invalid upload ID")
+	errUploadIDTaken   = errors.New("upload ID already used by another user")
+)
+
+// UploadEvents streams the progress of an upload as Server-Sent Events. Uploads publish
+// to the stream when they are started with the same ID in ?upload_id= or X-Upload-ID.
+func (h *Handlers) UploadEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.Server.Upload.EnableProgressTracking {
+		utils.WriteErrorJSON(w, http.StatusNotImplemented, "Progress tracking is disabled")
+		return
+	}
+
+	uploadID := r.PathValue("uploadId")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, errInvalidUploadID.Error())
+		return
+	}
+
+	if !ownsUpload(r, h.uploadEvents.Claim(uploadID, h.files(r).Owner())) {
+		utils.WriteErrorJSON(w, http.StatusNotFound, "Upload not found")
+		return
+	}
+
+	// Reconnecting EventSource clients send the last event they saw
+	lastEventID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	events, unsubscribe := h.uploadEvents.Subscribe(uploadID)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	// The stream lives as long as the upload, which may exceed the server write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(uploadEventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.ID <= lastEventID {
+				continue
+			}
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event models.UploadEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// uploadEventID returns the event stream ID an upload should publish to, or "" when the
+// client did not ask for events or progress tracking is disabled
+func (h *Handlers) uploadEventID(r *http.Request) (string, error) {
+	if !h.cfg.Server.Upload.EnableProgressTracking {
+		return "", nil
+	}
+
+	uploadID := r.URL.Query().Get("upload_id")
+	if uploadID == "" {
+		uploadID = r.Header.Get("X-Upload-ID")
+	}
+	if uploadID == "" {
+		return "", nil
+	}
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", errInvalidUploadID
+	}
+	if !ownsUpload(r, h.uploadEvents.Claim(uploadID, h.files(r).Owner())) {
+		return "", errUploadIDTaken
+	}
+	return uploadID, nil
+}
+
+// publishUploadEvent sends an event to the upload's stream, if the client asked for one
+func (h *Handlers) publishUploadEvent(uploadID string, event models.UploadEvent) {
+	if uploadID == "" {
+		return
+	}
+	h.uploadEvents.Publish(uploadID, event)
+}
+
+// writeUploadError reports a failed upload to the event stream and the HTTP response
+func (h *Handlers) writeUploadError(w http.ResponseWriter, uploadID string, status int, message string) {
+	h.publishUploadEvent(uploadID, models.UploadEvent{
+		Type:    models.UploadEventError,
+		Message: message,
+	})
+	utils.WriteErrorJSON(w, status, message)
+}
+
+// byteProgressPublisher returns a ProgressTrackingReader callback that publishes
+// a progress event each time another whole percent of the file has been processed
+func (h *Handlers) byteProgressPublisher(uploadID, filename string) func(bytesRead, total int64) {
+	lastPercent := int64(-1)
+
+	return func(bytesRead, total int64) {
+		if uploadID == "" || total <= 0 {
+			return
+		}
+
+		percent := bytesRead * 100 / total
+		if percent == lastPercent {
+			return
+		}
+		lastPercent = percent
+
+		h.publishUploadEvent(uploadID, models.UploadEvent{
+			Type:           models.UploadEventProgress,
+			Filename:       filename,
+			BytesProcessed: bytesRead,
+			TotalBytes:     total,
+			Percent:        float64(bytesRead) / float64(total) * 100,
+		})
+	}
+}
+
+// publishFileEvents makes tracker publish a file event, with the overall byte progress,
+// for every file of a multi-file upload
+func (h *Handlers) publishFileEvents(tracker *services.BatchTracker, uploadID string, files []*multipart.FileHeader) {
+	if uploadID == "" {
+		return
+	}
+
+	var totalBytes int64
+	for _, file := range files {
+		totalBytes += file.Size
+	}
+
+	var mu sync.Mutex
+	var processedBytes int64
+
+	tracker.OnFileDone(func(result models.FileUploadResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		processedBytes += result.Size
+		event := models.UploadEvent{
+			Type:           models.UploadEventFile,
+			Filename:       result.Filename,
+			BytesProcessed: processedBytes,
+			TotalBytes:     totalBytes,
+			Result:         &result,
+		}
+		if totalBytes > 0 {
+			event.Percent = float64(processedBytes) / float64(totalBytes) * 100
+		}
+
+		// Publishing under the lock keeps file events in processing order
+		h.publishUploadEvent(uploadID, event)
+	})
+}
+
+// publishMultipleUploadComplete ends the event stream of a multi-file upload
+func (h *Handlers) publishMultipleUploadComplete(uploadID string, response *models.MultipleUploadResponse) {
+	event := models.UploadEvent{
+		Type:           models.UploadEventComplete,
+		BytesProcessed: response.ProcessedSize,
+		TotalBytes:     response.TotalSize,
+		Percent:        100,
+		Message:        response.Message,
+	}
+	if response.SuccessfulFiles == 0 {
+		event.Type = models.UploadEventError
+		event.Percent = 0
+	}
+
+	h.publishUploadEvent(uploadID, event)
+}
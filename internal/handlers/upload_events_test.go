@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestUploadEvents_ProgressUpload(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxMemory = 1 << 20
+	h.cfg.Server.MaxFileSize = 1 << 20
+	h.cfg.Server.Upload.EnableProgressTracking = true
+
+	uploadID := "9b2f6c1e-3a4d-4e5f-8a7b-0c1d2e3f4a5b"
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "report.bin")
+	part.Write(bytes.Repeat([]byte("x"), 200*1024))
+	writer.WriteField("path", "/")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/v1/upload/progress?upload_id="+uploadID, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.UploadWithProgressTracking(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// The upload has finished, so the stream replays its events and ends
+	req = httptest.NewRequest("GET", "/api/v1/upload/events/"+uploadID, nil)
+	req.SetPathValue("uploadId", uploadID)
+	w = httptest.NewRecorder()
+	h.UploadEvents(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+
+	stream := w.Body.String()
+	if !strings.Contains(stream, "event: progress\n") {
+		t.Errorf("Expected a progress event, got:\n%s", stream)
+	}
+	if !strings.Contains(stream, `"bytesProcessed":204800`) {
+		t.Errorf("Expected progress to reach the full file size, got:\n%s", stream)
+	}
+	if !strings.HasSuffix(stream, "\n\n") || !strings.Contains(stream, "event: complete\n") {
+		t.Errorf("Expected the stream to end with a complete event, got:\n%s", stream)
+	}
+
+	// Reconnecting clients only receive events after Last-Event-ID
+	req = httptest.NewRequest("GET", "/api/v1/upload/events/"+uploadID, nil)
+	req.SetPathValue("uploadId", uploadID)
+	req.Header.Set("Last-Event-ID", "1000")
+	w = httptest.NewRecorder()
+	h.UploadEvents(w, req)
+	if strings.Contains(w.Body.String(), "event:") {
+		t.Errorf("Expected no replayed events, got:\n%s", w.Body.String())
+	}
+}
+
+func TestUploadEvents_Disabled(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/upload/events/9b2f6c1e-3a4d-4e5f-8a7b-0c1d2e3f4a5b", nil)
+	req.SetPathValue("uploadId", "9b2f6c1e-3a4d-4e5f-8a7b-0c1d2e3f4a5b")
+	w := httptest.NewRecorder()
+	h.UploadEvents(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status %d, got %d", http.StatusNotImplemented, w.Code)
+	}
+}
+
+func TestUploadEvents_OtherUsersGetNotFound(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxMemory = 1 << 20
+	h.cfg.Server.MaxFileSize = 1 << 20
+	h.cfg.Server.Upload.EnableProgressTracking = true
+	alice := &models.User{ID: 1, Username: "alice"}
+	bob := &models.User{ID: 2, Username: "bob"}
+
+	uploadID := "9b2f6c1e-3a4d-4e5f-8a7b-0c1d2e3f4a5b"
+	upload := func(user *models.User) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", user.Username+".txt")
+		part.Write([]byte("notes"))
+		writer.WriteField("path", "/")
+		writer.Close()
+
+		req := withUser(httptest.NewRequest("POST", "/api/v1/upload/progress?upload_id="+uploadID, body), user)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.UploadWithProgressTracking(w, req)
+		return w
+	}
+
+	if w := upload(alice); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	req := withUser(httptest.NewRequest("GET", "/api/v1/upload/events/"+uploadID, nil), bob)
+	req.SetPathValue("uploadId", uploadID)
+	w := httptest.NewRecorder()
+	h.UploadEvents(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected another user to get 404, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := upload(bob); w.Code == http.StatusCreated {
+		t.Errorf("Expected another user to be refused the upload ID, got %d", w.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/metrics"
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// CreateUploadSession starts a resumable upload and returns the session with its chunk layout
+func (h *Handlers) CreateUploadSession(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUploadSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	if req.Filename == "" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Filename is required")
+		return
+	}
+
+	if !utils.IsValidFilename(req.Filename) {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid filename")
+		return
+	}
+
+	targetPath := req.Path
+	if targetPath == "" {
+		targetPath = "/"
+	}
+	if _, ok := h.uploadTarget(w, r, targetPath); !ok || !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
+	session, err := h.chunkedUploads.CreateSessionFor(h.files(r), &req)
+	if err != nil {
+		if writeQuotaExceeded(w, err) {
+			return
+		}
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, session)
+}
+
+// GetUploadSession reports which chunks the server already holds
+func (h *Handlers) GetUploadSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.uploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, session)
+}
+
+// UploadSessionChunk stores one chunk sent as the raw request body.
+// The byte offset may be given with ?offset= and is checked against the chunk index.
+func (h *Handlers) UploadSessionChunk(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+
+	offset := int64(-1)
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid chunk offset")
+			return
+		}
+	}
+	if _, ok := h.uploadSession(w, r); !ok {
+		return
+	}
+
+	session, err := h.chunkedUploads.WriteChunk(r.PathValue("sessionId"), index, offset, r.Body)
+	if err != nil {
+		writeUploadSessionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, session)
+}
+
+// CompleteUploadSession assembles the chunks into the final file
+func (h *Handlers) CompleteUploadSession(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.uploadSession(w, r); !ok {
+		return
+	}
+
+	session, err := h.chunkedUploads.CompleteSession(r.PathValue("sessionId"))
+	if err != nil {
+		if errors.Is(err, services.ErrUploadIncomplete) && session != nil {
+			response := map[string]interface{}{
+				"error":   true,
+				"message": err.Error(),
+				"status":  http.StatusConflict,
+				"session": session,
+			}
+			utils.WriteJSON(w, http.StatusConflict, response)
+			return
+		}
+		writeUploadSessionError(w, err)
+		return
+	}
+	metrics.RecordUpload(metrics.UploadChunked, 1, session.TotalSize)
+
+	response := &models.UploadResponse{
+		Success:  true,
+		Filename: session.Filename,
+		Size:     session.TotalSize,
+		Path:     session.Path,
+		Checksum: session.Checksum,
+		Message:  "File uploaded successfully using resumable chunks",
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, response)
+}
+
+// AbortUploadSession discards a session and its staged chunks
+func (h *Handlers) AbortUploadSession(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.uploadSession(w, r); !ok {
+		return
+	}
+
+	sessionID := r.PathValue("sessionId")
+	if err := h.chunkedUploads.AbortSession(sessionID); err != nil {
+		writeUploadSessionError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":   true,
+		"message":   "Upload session aborted",
+		"sessionId": sessionID,
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// uploadSession returns the session named in the request, writing a 404 response unless
+// it exists and the user of the request owns it
+func (h *Handlers) uploadSession(w http.ResponseWriter, r *http.Request) (*models.UploadSession, bool) {
+	session, err := h.chunkedUploads.GetSession(r.PathValue("sessionId"))
+	if err == nil && !ownsUpload(r, session.OwnerID) {
+		err = services.ErrUploadSessionNotFound
+	}
+	if err != nil {
+		writeUploadSessionError(w, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func writeUploadSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrUploadSessionExpired):
+		utils.WriteErrorJSON(w, http.StatusGone, err.Error())
+	case errors.Is(err, services.ErrChunkOutOfRange),
+		errors.Is(err, services.ErrChunkSizeMismatch):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrChunkOffsetMismatch):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrChecksumMismatch):
+		utils.WriteErrorJSON(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrQuotaExceeded):
+		utils.WriteErrorJSON(w, http.StatusInsufficientStorage, err.Error())
+	case errors.Is(err, services.ErrPathIsDirectory):
+		utils.WriteErrorJSON(w, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "UNIQUE constraint"):
+		utils.WriteErrorJSON(w, http.StatusConflict, "File already exists")
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Upload failed: "+err.Error())
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestUploadSession_OtherUsersGetNotFound(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.Upload.ChunkSize = 1024
+	h.cfg.Server.Upload.SessionTTLHours = 1
+	alice := &models.User{ID: 1, Username: "alice"}
+	bob := &models.User{ID: 2, Username: "bob"}
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/upload/sessions",
+		strings.NewReader(`{"filename": "a.txt", "path": "/", "totalSize": 5}`)), alice)
+	w := httptest.NewRecorder()
+	h.CreateUploadSession(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var session models.UploadSession
+	json.Unmarshal(w.Body.Bytes(), &session)
+
+	tests := []struct {
+		method  string
+		handler http.HandlerFunc
+	}{
+		{http.MethodGet, h.GetUploadSession},
+		{http.MethodPut, h.UploadSessionChunk},
+		{http.MethodPost, h.CompleteUploadSession},
+		{http.MethodDelete, h.AbortUploadSession},
+	}
+	for _, tt := range tests {
+		req := withUser(httptest.NewRequest(tt.method, "/api/v1/upload/sessions/"+session.ID, strings.NewReader("hello")), bob)
+		req.SetPathValue("sessionId", session.ID)
+		req.SetPathValue("index", "0")
+		w := httptest.NewRecorder()
+		tt.handler(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s by another user to answer 404, got %d: %s", tt.method, w.Code, w.Body.String())
+		}
+	}
+
+	req = withUser(httptest.NewRequest(http.MethodGet, "/api/v1/upload/sessions/"+session.ID, nil), alice)
+	req.SetPathValue("sessionId", session.ID)
+	w = httptest.NewRecorder()
+	h.GetUploadSession(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the owner to see the session, got %d: %s", w.Code, w.Body.String())
+	}
+}
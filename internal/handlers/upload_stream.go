@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/anddsdev/cloudlet/internal/metrics"
 	"github.com/anddsdev/cloudlet/internal/models"
 	"github.com/anddsdev/cloudlet/internal/utils"
 )
@@ -13,7 +14,7 @@ import (
 // UploadStream handles file uploads using streaming to prevent memory leaks
 // This handler should be used for large files or when memory conservation is important
 func (h *Handlers) UploadStream(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err := parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
@@ -36,24 +37,36 @@ func (h *Handlers) UploadStream(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
+	if !h.allowPaths(w, r, targetPath) || !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
 	// Validate filename using security module
 	if !utils.IsValidFilename(header.Filename) {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid filename")
 		return
 	}
 
+	checksum, err := uploadChecksum(r, header)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Use streaming upload to prevent memory leaks
-	err = h.fileService.SaveFileStream(header.Filename, targetPath, file, header.Size)
+	saved, err := h.files(r).SaveFileStreamWithChecksum(header.Filename, targetPath, file, header.Size, checksum)
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+		utils.WriteErrorJSON(w, saveErrorStatus(err), "Failed to save file: "+err.Error())
 		return
 	}
+	metrics.RecordUpload(metrics.UploadStream, 1, header.Size)
 
 	response := &models.UploadResponse{
 		Success:  true,
 		Filename: header.Filename,
 		Size:     header.Size,
 		Path:     targetPath,
+		Checksum: saved.Checksum,
 		Message:  "File uploaded successfully using streaming",
 	}
 
@@ -63,7 +76,7 @@ func (h *Handlers) UploadStream(w http.ResponseWriter, r *http.Request) {
 // UploadChunked handles chunked file uploads for very large files
 // This allows uploading files larger than available memory by processing them in chunks
 func (h *Handlers) UploadChunked(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	err := parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
 	if err != nil {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
@@ -86,12 +99,22 @@ func (h *Handlers) UploadChunked(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/"
 	}
 
+	if !h.allowPaths(w, r, targetPath) || !h.allowUploadFiles(w, r, 1) {
+		return
+	}
+
 	// Validate filename
 	if !utils.IsValidFilename(header.Filename) {
 		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid filename")
 		return
 	}
 
+	checksum, err := uploadChecksum(r, header)
+	if err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Create a chunked reader that processes the file in small chunks
 	chunkSize := 64 * 1024 // 64KB chunks
 	chunkedReader := &ChunkedReader{
@@ -100,17 +123,19 @@ func (h *Handlers) UploadChunked(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use streaming upload with chunked processing
-	err = h.fileService.SaveFileStream(header.Filename, targetPath, chunkedReader, header.Size)
+	saved, err := h.files(r).SaveFileStreamWithChecksum(header.Filename, targetPath, chunkedReader, header.Size, checksum)
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+		utils.WriteErrorJSON(w, saveErrorStatus(err), "Failed to save file: "+err.Error())
 		return
 	}
+	metrics.RecordUpload(metrics.UploadChunked, 1, header.Size)
 
 	response := &models.UploadResponse{
 		Success:  true,
 		Filename: header.Filename,
 		Size:     header.Size,
 		Path:     targetPath,
+		Checksum: saved.Checksum,
 		Message:  fmt.Sprintf("File uploaded successfully using %d KB chunks", chunkSize/1024),
 	}
 
@@ -143,23 +168,30 @@ func (cr *ChunkedReader) Read(p []byte) (n int, err error) {
 }
 
 // UploadWithProgressTracking handles uploads with progress tracking
-// This is useful for large files where clients need progress feedback
+// This is useful for large files where clients need progress feedback.
+// Progress is published to GET /api/v1/upload/events/{uploadId} when ?upload_id= is given.
 func (h *Handlers) UploadWithProgressTracking(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(int64(h.cfg.Server.MaxMemory))
+	uploadID, err := h.uploadEventID(r)
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+		utils.WriteErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = parseMultipartForm(r, int64(h.cfg.Server.MaxMemory))
+	if err != nil {
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Failed to parse form: "+err.Error())
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "No file provided")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "No file provided")
 		return
 	}
 	defer file.Close()
 
 	if header.Size > h.cfg.Server.MaxFileSize {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "File too large. Max size: "+strconv.FormatInt(h.cfg.Server.MaxFileSize, 10)+" bytes")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "File too large. Max size: "+strconv.FormatInt(h.cfg.Server.MaxFileSize, 10)+" bytes")
 		return
 	}
 
@@ -168,41 +200,60 @@ func (h *Handlers) UploadWithProgressTracking(w http.ResponseWriter, r *http.Req
 		targetPath = "/"
 	}
 
+	if !h.allowPaths(w, r, targetPath) {
+		return
+	}
+	if err := h.checkUploadRateLimit(w, r, 1); err != nil {
+		h.writeUploadError(w, uploadID, uploadRateLimitStatus(err), err.Error())
+		return
+	}
+
 	// Validate filename
 	if !utils.IsValidFilename(header.Filename) {
-		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid filename")
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, "Invalid filename")
+		return
+	}
+
+	checksum, err := uploadChecksum(r, header)
+	if err != nil {
+		h.writeUploadError(w, uploadID, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Create a progress tracking reader
 	progressReader := &ProgressTrackingReader{
-		reader:   file,
-		total:    header.Size,
-		progress: 0,
-		onProgress: func(bytesRead, total int64) {
-			// In a real implementation, this could send progress updates
-			// via WebSocket, Server-Sent Events, or store progress in a cache
-			percentage := float64(bytesRead) / float64(total) * 100
-			_ = percentage // For now, just calculate but don't send
-			// TODO: Send progress update to client
-		},
+		reader:     file,
+		total:      header.Size,
+		progress:   0,
+		onProgress: h.byteProgressPublisher(uploadID, header.Filename),
 	}
 
 	// Use streaming upload with progress tracking
-	err = h.fileService.SaveFileStream(header.Filename, targetPath, progressReader, header.Size)
+	saved, err := h.files(r).SaveFileStreamWithChecksum(header.Filename, targetPath, progressReader, header.Size, checksum)
 	if err != nil {
-		utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+		h.writeUploadError(w, uploadID, saveErrorStatus(err), "Failed to save file: "+err.Error())
 		return
 	}
+	metrics.RecordUpload(metrics.UploadStream, 1, header.Size)
 
 	response := &models.UploadResponse{
 		Success:  true,
 		Filename: header.Filename,
 		Size:     header.Size,
 		Path:     targetPath,
+		Checksum: saved.Checksum,
 		Message:  "File uploaded successfully with progress tracking",
 	}
 
+	h.publishUploadEvent(uploadID, models.UploadEvent{
+		Type:           models.UploadEventComplete,
+		Filename:       header.Filename,
+		BytesProcessed: header.Size,
+		TotalBytes:     header.Size,
+		Percent:        100,
+		Message:        response.Message,
+	})
+
 	utils.WriteJSON(w, http.StatusCreated, response)
 }
 
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/utils"
+)
+
+// ListVersions returns the previous contents of a file, newest first. A version is
+// downloaded with GET /api/v1/download/{path}?version=N.
+func (h *Handlers) ListVersions(w http.ResponseWriter, r *http.Request) {
+	filePath := "/" + strings.TrimPrefix(r.PathValue("path"), "/")
+	if filePath == "/" {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "File path required")
+		return
+	}
+	if !h.allowPaths(w, r, filePath) {
+		return
+	}
+
+	versions, err := h.files(r).ListVersions(filePath)
+	if err != nil {
+		writeVersionError(w, err, "Failed to list versions: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"path":     filePath,
+		"versions": versions,
+	})
+}
+
+// RestoreVersion makes a previous content of a file current again, keeping the replaced content as a version
+func (h *Handlers) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	var req models.RestoreVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Path == "" || req.Version <= 0 {
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Path and version required")
+		return
+	}
+	if !h.allowPaths(w, r, req.Path) {
+		return
+	}
+
+	file, err := h.files(r).RestoreVersion(req.Path, req.Version)
+	if err != nil {
+		writeVersionError(w, err, "Failed to restore version: ")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, file)
+}
+
+func writeVersionError(w http.ResponseWriter, err error, prefix string) {
+	switch {
+	case errors.Is(err, services.ErrAccessDenied):
+		utils.WriteErrorJSON(w, http.StatusForbidden, "Permission denied")
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrVersionNotFound):
+		utils.WriteErrorJSON(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrPathIsDirectory):
+		utils.WriteErrorJSON(w, http.StatusBadRequest, "Directories have no versions")
+	case errors.Is(err, services.ErrQuotaExceeded):
+		utils.WriteErrorJSON(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		utils.WriteErrorJSON(w, http.StatusInternalServerError, prefix+err.Error())
+	}
+}
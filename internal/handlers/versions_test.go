@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestVersions_UploadOverwriteAndRestore(t *testing.T) {
+	h, _ := setupDownloadHandlers(t)
+	h.cfg.Server.MaxFileSize = 1024
+	h.cfg.Server.MaxMemory = 1024
+
+	for _, content := range []string{"draft", "final"} {
+		w := httptest.NewRecorder()
+		h.Upload(w, newDigestUploadRequest(t, "/api/v1/upload", "report.txt", "", []byte(content)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/versions/report.txt", nil)
+	req.SetPathValue("path", "report.txt")
+	w := httptest.NewRecorder()
+	h.ListVersions(w, req)
+
+	var listed struct {
+		Versions []*models.FileVersion `json:"versions"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listed.Versions) != 1 || listed.Versions[0].Version != 1 || listed.Versions[0].Size != 5 {
+		t.Fatalf("Expected the draft as version 1, got %+v", listed.Versions)
+	}
+
+	w = httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest(http.MethodGet, "/api/v1/download/report.txt?version=1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "draft" {
+		t.Fatalf("Expected the draft, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Repr-Digest") == "" {
+		t.Error("Expected the version to be served with its digest")
+	}
+
+	w = httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest(http.MethodGet, "/api/v1/download/report.txt?version=7", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown version, got %d", w.Code)
+	}
+
+	body, _ := json.Marshal(models.RestoreVersionRequest{Path: "/report.txt", Version: 1})
+	w = httptest.NewRecorder()
+	h.RestoreVersion(w, httptest.NewRequest(http.MethodPost, "/api/v1/versions/restore", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.Download(w, httptest.NewRequest(http.MethodGet, "/api/v1/download/report.txt", nil))
+	if w.Body.String() != "draft" {
+		t.Errorf("Expected the restored draft, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_FiltersByLevelAndFormats(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "warn", "json")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	ctx := WithRequest(context.Background(), "req-42")
+	FromContext(ctx).Info("Not logged")
+	FromContext(ctx).Warn("Disk almost full", "free_bytes", 1024)
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", out.String(), err)
+	}
+	if record["msg"] != "Disk almost full" || record["level"] != "WARN" || record["request_id"] != "req-42" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+
+	out.Reset()
+	logger, err = New(&out, "", "text")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	logger.Info("Started", "port", "8080")
+	if !strings.Contains(out.String(), "level=INFO msg=Started port=8080") {
+		t.Errorf("Expected a text record at info level, got %q", out.String())
+	}
+
+	for _, invalid := range [][2]string{{"verbose", "json"}, {"info", "xml"}} {
+		if _, err := New(&out, invalid[0], invalid[1]); err == nil {
+			t.Errorf("Expected an error for level %q and format %q", invalid[0], invalid[1])
+		}
+	}
+}
+
+func TestFromContext_FallsBackToDefault(t *testing.T) {
+	if RequestID(context.Background()) != "" {
+		t.Error("Expected no request ID outside of requests")
+	}
+	if FromContext(context.Background()) == nil {
+		t.Error("Expected the default logger outside of requests")
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+// Upload strategies told apart by the upload metrics
+const (
+	UploadSingle   = "single"
+	UploadStream   = "stream"
+	UploadChunked  = "chunked"
+	UploadMultiple = "multiple"
+	UploadBatch    = "batch"
+)
+
+// Budgets a client can run out of, told apart by the rate limiting metrics
+const (
+	RateLimitRequests    = "requests"
+	RateLimitUploadBytes = "upload_bytes"
+	RateLimitUploadFiles = "upload_files"
+)
+
+// Metrics recorded by the server. Gauges that read the state of a running server, such as
+// storage usage, are registered when the server starts.
+var (
+	HTTPRequests = Default.NewCounterVec("cloudlet_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "status")
+	HTTPRequestDuration = Default.NewHistogramVec("cloudlet_http_request_duration_seconds",
+		"Time to answer HTTP requests by route, method and status code.", DefaultBuckets, "route", "method", "status")
+
+	UploadedBytes = Default.NewCounterVec("cloudlet_upload_bytes_total",
+		"Bytes of files uploaded, by upload strategy.", "strategy")
+	UploadedFiles = Default.NewCounterVec("cloudlet_upload_files_total",
+		"Files uploaded, by upload strategy.", "strategy")
+
+	RateLimitedRequests = Default.NewCounterVec("cloudlet_rate_limited_requests_total",
+		"Requests refused with 429 because the client spent its budget, by budget.", "budget")
+
+	TransactionRollbacks = Default.NewCounter("cloudlet_transaction_rollbacks_total",
+		"File operations rolled back after one of their steps failed.")
+	OrphanedTempFilesRemoved = Default.NewCounter("cloudlet_orphaned_temp_files_removed_total",
+		"Abandoned temporary files removed from the staging directory.")
+
+	DBQueryDuration = Default.NewHistogramVec("cloudlet_db_query_duration_seconds",
+		"Time to run database statements, by operation (exec or query).",
+		[]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}, "operation")
+)
+
+// RecordUpload counts files totalling size bytes uploaded with strategy
+func RecordUpload(strategy string, files int, size int64) {
+	if files <= 0 {
+		return
+	}
+	UploadedFiles.WithLabelValues(strategy).Add(float64(files))
+	UploadedBytes.WithLabelValues(strategy).Add(float64(size))
+}
@@ -0,0 +1,333 @@
+// Package metrics keeps counters, gauges and histograms and exposes them in the
+// Prometheus text exposition format, without depending on the Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of histograms timing requests
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is a metric family that writes its samples in the text format
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them for a scrape
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry of the metrics the server exposes
+var Default = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: " + c.name() + " registered twice")
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText writes every metric in the Prometheus text format, families sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	buffered := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// Handler serves the metrics of the registry to Prometheus scrapes
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// family holds what every metric family has: a name, a help text, a type and label names
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.kind)
+}
+
+// series holds the children of a vector, one per combination of label values
+type series[T any] struct {
+	mu       sync.Mutex
+	children map[string]*child[T]
+	create   func() *T
+}
+
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+func (s *series[T]) get(f *family, values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.children == nil {
+		s.children = make(map[string]*child[T])
+	}
+	c, ok := s.children[key]
+	if !ok {
+		c = &child[T]{values: slices.Clone(values), metric: s.create()}
+		s.children[key] = c
+	}
+	return c.metric
+}
+
+// sorted returns the children ordered by their label values, so scrapes are stable
+func (s *series[T]) sorted() []*child[T] {
+	s.mu.Lock()
+	children := make([]*child[T], 0, len(s.children))
+	for _, c := range s.children {
+		children = append(children, c)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		return slices.Compare(children[i].values, children[j].values) < 0
+	})
+	return children
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Add increases the counter by delta, which must not be negative
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	addFloat(&c.bits, delta)
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a family of counters told apart by label values
+type CounterVec struct {
+	family
+	series series[Counter]
+}
+
+// NewCounterVec registers a counter family with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{
+		family: family{metricName: name, help: help, kind: "counter", labels: labels},
+		series: series[Counter]{create: func() *Counter { return &Counter{} }},
+	}
+	r.register(v)
+	return v
+}
+
+// NewCounter registers a counter without labels
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+// WithLabelValues returns the counter of the given label values, in the order of the label names
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.series.get(&v.family, values)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, c := range v.series.sorted() {
+		writeSample(w, v.metricName, v.labels, c.values, "", "", c.metric.Value())
+	}
+}
+
+// Histogram counts observations in buckets and keeps their sum
+type Histogram struct {
+	upperBounds []float64
+	buckets     []atomic.Uint64 // Observations per bucket, not cumulative
+	count       atomic.Uint64
+	sumBits     atomic.Uint64
+}
+
+// Observe adds one observation to the histogram
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.upperBounds, value)
+	if i < len(h.buckets) {
+		h.buckets[i].Add(1)
+	}
+	addFloat(&h.sumBits, value)
+	h.count.Add(1)
+}
+
+// HistogramVec is a family of histograms told apart by label values
+type HistogramVec struct {
+	family
+	series series[Histogram]
+}
+
+// NewHistogramVec registers a histogram family with the given bucket upper bounds and label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	upperBounds := slices.Clone(buckets)
+	slices.Sort(upperBounds)
+
+	v := &HistogramVec{
+		family: family{metricName: name, help: help, kind: "histogram", labels: labels},
+		series: series[Histogram]{create: func() *Histogram {
+			return &Histogram{upperBounds: upperBounds, buckets: make([]atomic.Uint64, len(upperBounds))}
+		}},
+	}
+	r.register(v)
+	return v
+}
+
+// WithLabelValues returns the histogram of the given label values, in the order of the label names
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.series.get(&v.family, values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, c := range v.series.sorted() {
+		h := c.metric
+		// Read the count first so the buckets never add up to less than it
+		count := h.count.Load()
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += h.buckets[i].Load()
+			writeSample(w, v.metricName+"_bucket", v.labels, c.values, "le", formatFloat(bound), float64(min(cumulative, count)))
+		}
+		writeSample(w, v.metricName+"_bucket", v.labels, c.values, "le", "+Inf", float64(count))
+		writeSample(w, v.metricName+"_sum", v.labels, c.values, "", "", math.Float64frombits(h.sumBits.Load()))
+		writeSample(w, v.metricName+"_count", v.labels, c.values, "", "", float64(count))
+	}
+}
+
+// gaugeFunc is a gauge whose value is read when scraped
+type gaugeFunc struct {
+	family
+	value func() (float64, error)
+}
+
+// NewGaugeFunc registers a gauge whose value is read from value on every scrape.
+// The gauge is left out of scrapes for which value fails.
+func (r *Registry) NewGaugeFunc(name, help string, value func() (float64, error)) {
+	r.register(&gaugeFunc{family: family{metricName: name, help: help, kind: "gauge"}, value: value})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	value, err := g.value()
+	if err != nil {
+		return
+	}
+	g.writeHeader(w)
+	writeSample(w, g.metricName, nil, nil, "", "", value)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabelValue(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// addFloat atomically adds delta to the float64 stored as bits
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
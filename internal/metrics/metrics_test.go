@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WritesTextFormat(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := registry.NewCounterVec("test_requests_total", "Requests by route.", "route", "status")
+	requests.WithLabelValues("/b", "200").Inc()
+	requests.WithLabelValues("/a", "500").Add(2)
+	requests.WithLabelValues("/a\"\n", "200").Inc()
+
+	duration := registry.NewHistogramVec("test_duration_seconds", "Durations.", []float64{1, 0.1}, "route")
+	for _, value := range []float64{0.05, 0.5, 0.5, 3} {
+		duration.WithLabelValues("/a").Observe(value)
+	}
+
+	registry.NewGaugeFunc("test_files", "Stored files.", func() (float64, error) { return 42, nil })
+	registry.NewGaugeFunc("test_broken", "Fails to read.", func() (float64, error) { return 0, errors.New("unavailable") })
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 1
+test_duration_seconds_bucket{route="/a",le="1"} 3
+test_duration_seconds_bucket{route="/a",le="+Inf"} 4
+test_duration_seconds_sum{route="/a"} 4.05
+test_duration_seconds_count{route="/a"} 4
+# HELP test_files Stored files.
+# TYPE test_files gauge
+test_files 42
+# HELP test_requests_total Requests by route.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="500"} 2
+test_requests_total{route="/a\"\n",status="200"} 1
+test_requests_total{route="/b",status="200"} 1
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestRegistry_RejectsMisuse(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_total", "Test.", "label")
+
+	for name, misuse := range map[string]func(){
+		"duplicate name":     func() { registry.NewCounter("test_total", "Again.") },
+		"missing label":      func() { counter.WithLabelValues() },
+		"decreasing counter": func() { counter.WithLabelValues("x").Add(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %s to panic", name)
+				}
+			}()
+			misuse()
+		}()
+	}
+}
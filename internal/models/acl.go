@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Permissions an ACL entry can grant on a directory and everything below it
+const (
+	PermissionRead   = "read"
+	PermissionWrite  = "write"
+	PermissionDelete = "delete"
+	PermissionShare  = "share"
+)
+
+// Kinds of subject an ACL entry applies to
+const (
+	SubjectUser  = "user"
+	SubjectGroup = "group"
+)
+
+// ACLEntry grants permissions on a directory to a user or a group. Entries are inherited
+// by everything below the directory.
+type ACLEntry struct {
+	ID          int64     `json:"id" db:"id"`
+	Path        string    `json:"path" db:"path"`
+	SubjectType string    `json:"subject_type" db:"subject_type"`
+	SubjectID   int64     `json:"subject_id" db:"subject_id"`
+	SubjectName string    `json:"subject_name,omitempty"`
+	Permissions []string  `json:"permissions" db:"permissions"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// DirectoryACL lists the entries set on a directory and those it inherits from its ancestors
+type DirectoryACL struct {
+	Path      string      `json:"path"`
+	Entries   []*ACLEntry `json:"entries"`
+	Inherited []*ACLEntry `json:"inherited"`
+}
+
+type SetACLEntryRequest struct {
+	Path        string   `json:"path"`
+	SubjectType string   `json:"subject_type"`
+	SubjectID   int64    `json:"subject_id"`
+	Permissions []string `json:"permissions"`
+}
+
+type Group struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Members   []*User   `json:"members,omitempty"`
+}
+
+type CreateGroupRequest struct {
+	Name string `json:"name"`
+}
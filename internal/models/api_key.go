@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Scopes an API key can be granted. The admin scope includes all others.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// APIKey is a personal access token for scripts and CI pipelines. Only a hash of
+// the token is stored; TokenPrefix helps owners recognise their keys.
+type APIKey struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"`
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	PathPrefix  string     `json:"path_prefix" db:"path_prefix"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	PathPrefix    string   `json:"path_prefix,omitempty"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 creates a key that does not expire
+}
+
+// CreateAPIKeyResponse is the only response that contains the token itself
+type CreateAPIKeyResponse struct {
+	Token  string  `json:"token"`
+	APIKey *APIKey `json:"api_key"`
+}
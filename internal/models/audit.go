@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Actions recorded in the audit log
+const (
+	AuditUpload          = "upload"
+	AuditCreateDirectory = "create_directory"
+	AuditRename          = "rename"
+	AuditMove            = "move"
+	AuditDelete          = "delete"
+	AuditTrash           = "trash"
+	AuditRestore         = "restore"
+	AuditPurge           = "purge"
+	AuditRestoreVersion  = "restore_version"
+	AuditCreateShare     = "create_share"
+	AuditRevokeShare     = "revoke_share"
+	AuditSetACL          = "set_acl"
+	AuditDeleteACL       = "delete_acl"
+	AuditSetQuota        = "set_quota"
+	AuditDeleteQuota     = "delete_quota"
+	AuditSetTags         = "set_tags"
+	AuditSetMetadata     = "set_metadata"
+	AuditDeleteMetadata  = "delete_metadata"
+)
+
+// Results of an audited operation
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEntry records one operation that changed files or their settings. Entries are
+// never updated or deleted. Paths are storage paths, home directories included.
+type AuditEntry struct {
+	ID         int64     `json:"id" db:"id"`
+	Time       time.Time `json:"time" db:"time"`
+	ActorID    int64     `json:"actor_id,omitempty" db:"actor_id"` // 0 when authentication is disabled
+	Actor      string    `json:"actor,omitempty" db:"actor"`       // Username at the time of the operation
+	ClientIP   string    `json:"client_ip,omitempty" db:"client_ip"`
+	Action     string    `json:"action" db:"action"`
+	Path       string    `json:"path" db:"path"`
+	TargetPath string    `json:"target_path,omitempty" db:"target_path"` // Destination of moves and renames
+	Size       int64     `json:"size" db:"size"`
+	Details    string    `json:"details,omitempty" db:"details"` // Subject of ACL entries, quotas and shares
+	Result     string    `json:"result" db:"result"`
+	Error      string    `json:"error,omitempty" db:"error"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	From       time.Time
+	To         time.Time
+	ActorID    int64
+	Actor      string
+	Action     string
+	PathPrefix string // Matches the path or target path of an entry, and everything below it
+	Limit      int
+	Offset     int
+}
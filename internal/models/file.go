@@ -12,11 +12,16 @@ type FileInfo struct {
 	MimeType    string    `json:"mime_type" db:"mime_type"`
 	IsDirectory bool      `json:"is_directory" db:"is_directory"`
 	ParentPath  string    `json:"parent_path" db:"parent_path"`
+	Checksum    string    `json:"checksum,omitempty" db:"checksum"`
+	BlobRef     string    `json:"-" db:"blob_ref"`                  // Set when the content lives in the deduplicating blob store
+	OwnerID     int64     `json:"owner_id,omitempty" db:"owner_id"` // User the file counts against, 0 when stored without one
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 
 	ItemCount int64 `json:"item_count,omitempty"`
 	TotalSize int64 `json:"total_size,omitempty"`
+
+	Tags []string `json:"tags,omitempty"` // Set in listings and search results
 }
 
 type DirectoryListing struct {
@@ -28,6 +33,7 @@ type DirectoryListing struct {
 	TotalDirs   int          `json:"total_directories"`
 	TotalSize   int64        `json:"total_size"`
 	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+	Quotas      []*Quota     `json:"quotas,omitempty"`
 }
 
 type Breadcrumb struct {
@@ -50,3 +56,18 @@ type RenameRequest struct {
 	Path    string `json:"path"`
 	NewName string `json:"new_name"`
 }
+
+// GarbageCollectionResult summarizes a blob store garbage collection run
+type GarbageCollectionResult struct {
+	RemovedBlobs int   `json:"removed_blobs"`
+	FreedBytes   int64 `json:"freed_bytes"`
+}
+
+// DeduplicationStats describes the space used by the deduplicating blob store
+type DeduplicationStats struct {
+	Enabled     bool  `json:"enabled"`
+	Blobs       int64 `json:"blobs"`
+	StoredBytes int64 `json:"stored_bytes"`
+	LogicalSize int64 `json:"logical_size"`
+	SavedBytes  int64 `json:"saved_bytes"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FileVersion is a previous content of a file, kept when the file was overwritten.
+// Versions are numbered per path, starting at 1 for the oldest.
+type FileVersion struct {
+	ID         int64     `json:"id" db:"id"`
+	Path       string    `json:"path" db:"path"`
+	Version    int64     `json:"version" db:"version"`
+	Size       int64     `json:"size" db:"size"`
+	Checksum   string    `json:"checksum" db:"checksum"`
+	BlobRef    string    `json:"-" db:"blob_ref"`
+	MimeType   string    `json:"mime_type" db:"mime_type"`
+	AuthorID   int64     `json:"author_id,omitempty" db:"author_id"` // User who wrote the content, 0 when unknown
+	ModifiedAt time.Time `json:"modified_at" db:"modified_at"`       // When the content was written
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`         // When the content was replaced and became a version
+}
+
+type RestoreVersionRequest struct {
+	Path    string `json:"path"`
+	Version int64  `json:"version"`
+}
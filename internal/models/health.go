@@ -0,0 +1,35 @@
+package models
+
+// Statuses of the readiness report and of its checks
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+	HealthSkipped  = "skipped"
+)
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS float64                `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// BuildInfo identifies the running build of the server
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// ReadinessReport tells whether the server can take requests. Its status is degraded
+// when any check failed.
+type ReadinessReport struct {
+	Status        string                  `json:"status"`
+	Checks        map[string]*HealthCheck `json:"checks"`
+	SchemaVersion int                     `json:"schema_version"`
+	Build         BuildInfo               `json:"build"`
+}
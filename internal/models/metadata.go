@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Types of metadata values
+const (
+	MetadataString  = "string"
+	MetadataNumber  = "number"
+	MetadataBoolean = "boolean"
+	MetadataDate    = "date" // RFC 3339 time or YYYY-MM-DD date
+)
+
+// MetadataEntry is a typed key/value pair attached to a file or directory. Value holds a
+// string, a float64 or a bool according to Type, dates being strings.
+type MetadataEntry struct {
+	Key       string    `json:"key" db:"key"`
+	Type      string    `json:"type" db:"type"`
+	Value     any       `json:"value" db:"value"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// FileMetadata is everything attached to a file or directory besides its content
+type FileMetadata struct {
+	Path     string           `json:"path"`
+	Tags     []string         `json:"tags"`
+	Metadata []*MetadataEntry `json:"metadata"`
+}
+
+// TagCount is a tag and the number of files and directories carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type SetTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// BulkTagRequest adds and removes tags on several files and directories at once
+type BulkTagRequest struct {
+	Paths  []string `json:"paths"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// SetMetadataRequest sets metadata entries, replacing the entries with the same keys
+type SetMetadataRequest struct {
+	Metadata []*MetadataEntry `json:"metadata"`
+}
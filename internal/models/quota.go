@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Kinds of subject a quota limits
+const (
+	QuotaSubjectUser      = "user"
+	QuotaSubjectDirectory = "directory"
+)
+
+// Quota limits the bytes and number of files stored by a user or below a directory.
+// A limit of 0 means unlimited. Usage is kept up to date as files are added, moved and removed.
+type Quota struct {
+	ID             int64     `json:"id" db:"id"`
+	SubjectType    string    `json:"subject_type" db:"subject_type"`
+	UserID         int64     `json:"user_id,omitempty" db:"user_id"`
+	Path           string    `json:"path,omitempty" db:"path"`
+	MaxBytes       int64     `json:"max_bytes" db:"max_bytes"`
+	MaxFiles       int64     `json:"max_files" db:"max_files"`
+	UsedBytes      int64     `json:"used_bytes" db:"used_bytes"`
+	UsedFiles      int64     `json:"used_files" db:"used_files"`
+	RemainingBytes *int64    `json:"remaining_bytes,omitempty"`
+	RemainingFiles *int64    `json:"remaining_files,omitempty"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type SetQuotaRequest struct {
+	SubjectType string `json:"subject_type"`
+	UserID      int64  `json:"user_id,omitempty"`
+	Path        string `json:"path,omitempty"`
+	MaxBytes    int64  `json:"max_bytes"`
+	MaxFiles    int64  `json:"max_files"`
+}
+
+// QuotaUsage is the storage used by the signed-in user and the quotas that apply to it
+type QuotaUsage struct {
+	UsedBytes int64    `json:"used_bytes"`
+	UsedFiles int64    `json:"used_files"`
+	Quotas    []*Quota `json:"quotas"`
+}
@@ -17,6 +17,7 @@ type UploadResponse struct {
 	Filename string `json:"filename"`
 	Size     int64  `json:"size"`
 	Path     string `json:"path"`
+	Checksum string `json:"checksum,omitempty"`
 	Message  string `json:"message"`
 }
 
@@ -29,6 +30,8 @@ type FileUploadResult struct {
 	Success     bool   `json:"success"`
 	Error       string `json:"error,omitempty"`
 	MimeType    string `json:"mimeType"`
+	Checksum    string `json:"checksum,omitempty"`
+	Replaced    bool   `json:"replaced,omitempty"` // Replaced an existing file, restored when the batch is rolled back
 	Index       int    `json:"index"` // Original index in the request
 }
 
@@ -44,6 +47,7 @@ type MultipleUploadResponse struct {
 	Message           string             `json:"message"`
 	ProcessingTimeMs  int64              `json:"processingTimeMs"`
 	Strategy          string             `json:"strategy"` // "hybrid", "sequential", "parallel"
+	BatchID           string             `json:"batchId,omitempty"`
 }
 
 // UploadValidationResult contains validation results for multiple files
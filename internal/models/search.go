@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// SearchFilter selects the files a search returns. Zero values match everything.
+type SearchFilter struct {
+	Query          string    // Terms the name or path must contain, each matched as a prefix
+	Scope          string    // Directory the results must be below
+	MimeType       string    // Exact MIME type, or a prefix such as "image/"
+	MinSize        *int64    // Smallest size in bytes, inclusive
+	MaxSize        *int64    // Largest size in bytes, inclusive
+	ModifiedAfter  time.Time // Earliest modification time, inclusive
+	ModifiedBefore time.Time // Latest modification time, exclusive
+	Tags           []string  // Tags the results must all carry
+}
+
+// SearchResult is a file or directory found by a search with the path leading to it
+type SearchResult struct {
+	*FileInfo
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
+
+// SearchResults is a page of search results, best matches first
+type SearchResults struct {
+	Query   string          `json:"query"`
+	Results []*SearchResult `json:"results"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	HasMore bool            `json:"has_more"`
+}
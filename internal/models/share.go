@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Modes of a share link
+const (
+	ShareModeRead   = "read"
+	ShareModeUpload = "upload"
+)
+
+// Share is a public link to a file or directory that works without an account. Only a
+// hash of its token and of its optional password is stored.
+type Share struct {
+	ID            int64      `json:"id" db:"id"`
+	TokenHash     string     `json:"-" db:"token_hash"`
+	TokenPrefix   string     `json:"token_prefix" db:"token_prefix"`
+	Path          string     `json:"path" db:"path"`
+	CreatedBy     int64      `json:"created_by,omitempty" db:"created_by"`
+	PasswordHash  string     `json:"-" db:"password_hash"`
+	HasPassword   bool       `json:"has_password"`
+	Mode          string     `json:"mode" db:"mode"`
+	MaxDownloads  int64      `json:"max_downloads" db:"max_downloads"`
+	DownloadCount int64      `json:"download_count" db:"download_count"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateShareRequest struct {
+	Path           string `json:"path"`
+	Password       string `json:"password,omitempty"`
+	Mode           string `json:"mode,omitempty"`             // read by default; upload is only allowed for directories
+	MaxDownloads   int64  `json:"max_downloads,omitempty"`    // 0 allows any number of downloads
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"` // 0 creates a link that does not expire
+}
+
+// CreateShareResponse is the only response that contains the token itself
+type CreateShareResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+	Share *Share `json:"share"`
+}
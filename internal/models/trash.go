@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TrashItem is a deleted file or directory, kept until it is restored to its original
+// path or purged. A directory is trashed with everything that was below it.
+type TrashItem struct {
+	ID          int64      `json:"id" db:"id"`
+	Path        string     `json:"path" db:"path"` // Original path, where the item is restored
+	Name        string     `json:"name" db:"name"`
+	IsDirectory bool       `json:"is_directory" db:"is_directory"`
+	Size        int64      `json:"size" db:"size"`             // Total size of the files in the item
+	FileCount   int64      `json:"file_count" db:"file_count"` // Number of files in the item
+	DeletedBy   int64      `json:"deleted_by,omitempty" db:"deleted_by"`
+	DeletedAt   time.Time  `json:"deleted_at" db:"deleted_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // When the item is purged automatically, unset when kept until emptied
+}
@@ -0,0 +1,23 @@
+package models
+
+// Upload event types published on the upload event stream
+const (
+	UploadEventProgress = "progress"
+	UploadEventFile     = "file"
+	UploadEventComplete = "complete"
+	UploadEventError    = "error"
+)
+
+// UploadEvent is a single server-side progress update for an upload
+type UploadEvent struct {
+	ID             int64             `json:"id"`
+	Type           string            `json:"type"`
+	UploadID       string            `json:"uploadId"`
+	Filename       string            `json:"filename,omitempty"`
+	BytesProcessed int64             `json:"bytesProcessed"`
+	TotalBytes     int64             `json:"totalBytes"`
+	Percent        float64           `json:"percent"`
+	Result         *FileUploadResult `json:"result,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Timestamp      int64             `json:"timestamp"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// CreateUploadSessionRequest starts a resumable chunked upload
+type CreateUploadSessionRequest struct {
+	Filename  string `json:"filename"`
+	Path      string `json:"path"`
+	TotalSize int64  `json:"totalSize"`
+	ChunkSize int64  `json:"chunkSize,omitempty"`
+	Checksum  string `json:"checksum,omitempty"` // Expected SHA-256 of the whole file, hex encoded
+}
+
+// UploadSession describes a resumable upload and which chunks the server already holds
+type UploadSession struct {
+	ID             string    `json:"id"`
+	Filename       string    `json:"filename"`
+	Path           string    `json:"path"`
+	TotalSize      int64     `json:"totalSize"`
+	ChunkSize      int64     `json:"chunkSize"`
+	TotalChunks    int       `json:"totalChunks"`
+	ReceivedChunks []int     `json:"receivedChunks"`
+	MissingChunks  []int     `json:"missingChunks"`
+	BytesReceived  int64     `json:"bytesReceived"`
+	Complete       bool      `json:"complete"`
+	Checksum       string    `json:"checksum,omitempty"`
+	OwnerID        int64     `json:"ownerId,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
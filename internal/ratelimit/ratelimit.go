@@ -0,0 +1,286 @@
+// Package ratelimit keeps a token bucket per client, so each client may spend a budget of
+// requests, bytes or files per window and is told how long to wait once it runs out.
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter gives every key a bucket holding up to limit tokens, refilled at limit tokens per
+// window. Buckets of clients that stopped calling are evicted once full again, as a full
+// bucket is what a new client gets, and the least recently used ones are evicted beyond
+// maxKeys, so memory stays bounded however many clients call.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int64
+	window  time.Duration
+	maxKeys int
+	buckets map[string]*list.Element
+	lru     *list.List // of *bucket, most recently used first
+	now     func() time.Time
+}
+
+type bucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// Result tells how a client stands against a limiter after a request took from its budget
+type Result struct {
+	Allowed bool
+	// Limit is the budget per window and Remaining what is left of it
+	Limit     int64
+	Remaining int64
+	Window    time.Duration
+	// Reset is the time until the budget is full again
+	Reset time.Duration
+	// RetryAfter is the time to wait before a denied request would be allowed
+	RetryAfter time.Duration
+	// TooLarge tells a request was denied for asking more than the whole budget, which no
+	// wait would allow
+	TooLarge bool
+}
+
+// New returns a limiter allowing limit tokens per window to each of up to maxKeys keys.
+// It returns nil, a limiter allowing everything, when limit is not positive.
+func New(limit int64, window time.Duration, maxKeys int) *Limiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		maxKeys: max(maxKeys, 1),
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Take takes n tokens from the bucket of key when it holds them. Requests larger than the
+// whole budget are denied with TooLarge set, as they could never be taken from a full bucket.
+func (l *Limiter) Take(key string, n int64) Result {
+	if l == nil {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key)
+	if n > l.limit {
+		result := l.result(b)
+		result.TooLarge = true
+		return result
+	}
+	if b.tokens < float64(n) {
+		result := l.result(b)
+		result.RetryAfter = l.refillTime(float64(n) - b.tokens)
+		return result
+	}
+
+	b.tokens -= float64(n)
+	result := l.result(b)
+	result.Allowed = true
+	return result
+}
+
+// Charge takes n tokens from the bucket of key even when it does not hold them, for usage
+// only known once it happened, such as the bytes of a body of unknown length
+func (l *Limiter) Charge(key string, n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bucket(key).tokens -= float64(n)
+}
+
+// Len returns the number of clients tracked
+func (l *Limiter) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// bucket returns the bucket of key refilled up to now, marked as the most recently used
+func (l *Limiter) bucket(key string) *bucket {
+	now := l.now()
+	l.evict(now)
+
+	if elem, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(elem)
+		b := elem.Value.(*bucket)
+		b.tokens = l.refilled(b, now)
+		b.updated = now
+		return b
+	}
+
+	b := &bucket{key: key, tokens: float64(l.limit), updated: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	for l.lru.Len() > l.maxKeys {
+		l.remove(l.lru.Back())
+	}
+	return b
+}
+
+// evict removes the least recently used buckets that are full again
+func (l *Limiter) evict(now time.Time) {
+	for elem := l.lru.Back(); elem != nil; elem = l.lru.Back() {
+		if l.refilled(elem.Value.(*bucket), now) < float64(l.limit) {
+			return
+		}
+		l.remove(elem)
+	}
+}
+
+func (l *Limiter) remove(elem *list.Element) {
+	delete(l.buckets, elem.Value.(*bucket).key)
+	l.lru.Remove(elem)
+}
+
+// refilled returns the tokens of b at now
+func (l *Limiter) refilled(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.limit), b.tokens+elapsed.Seconds()*l.rate())
+}
+
+// rate returns the tokens added per second
+func (l *Limiter) rate() float64 {
+	return float64(l.limit) / l.window.Seconds()
+}
+
+// refillTime returns the time taken to add tokens to a bucket
+func (l *Limiter) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / l.rate() * float64(time.Second)))
+}
+
+func (l *Limiter) result(b *bucket) Result {
+	return Result{
+		Limit:     l.limit,
+		Remaining: max(int64(b.tokens), 0),
+		Window:    l.window,
+		Reset:     l.refillTime(float64(l.limit) - b.tokens),
+	}
+}
+
+// SetHeaders describes result in the RateLimit header fields of the IETF draft, adding
+// Retry-After when the request was denied and may be retried
+func SetHeaders(header http.Header, result Result) {
+	if result.Limit == 0 {
+		return
+	}
+
+	header.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	header.Set("RateLimit-Reset", strconv.FormatInt(seconds(result.Reset), 10))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit, seconds(result.Window)))
+	if !result.Allowed && !result.TooLarge {
+		header.Set("Retry-After", strconv.FormatInt(max(seconds(result.RetryAfter), 1), 10))
+	}
+}
+
+// seconds rounds d up to whole seconds, so clients waiting that long are not denied again
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// Budget is the share of one client in a limiter
+type Budget struct {
+	limiter *Limiter
+	key     string
+}
+
+// Budget returns the budget of the client identified by key
+func (l *Limiter) Budget(key string) Budget {
+	return Budget{limiter: l, key: key}
+}
+
+// Take takes n tokens from the budget, as Limiter.Take does
+func (b Budget) Take(n int64) Result {
+	return b.limiter.Take(b.key, n)
+}
+
+// Charge takes n tokens from the budget, as Limiter.Charge does
+func (b Budget) Charge(n int64) {
+	b.limiter.Charge(b.key, n)
+}
+
+// TakeBody takes the bytes of the body of req from the budget. A body of unknown length is
+// let through and charged as it is read.
+func (b Budget) TakeBody(req *http.Request) Result {
+	if req.ContentLength < 0 {
+		req.Body = &chargedBody{ReadCloser: req.Body, budget: b}
+		return Result{Allowed: true}
+	}
+	if req.ContentLength == 0 {
+		return Result{Allowed: true}
+	}
+	return b.Take(req.ContentLength)
+}
+
+// chargedBody takes the bytes read from a request body from a budget
+type chargedBody struct {
+	io.ReadCloser
+	budget Budget
+}
+
+func (b *chargedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.budget.Charge(int64(n))
+	return n, err
+}
+
+type contextKey int
+
+const (
+	uploadFilesKey contextKey = iota
+	uploadBytesKey
+)
+
+// ContextWithUploadFiles returns a context carrying the budget of files the client of the
+// request may still upload, for handlers that only learn the number of files from the body
+func ContextWithUploadFiles(ctx context.Context, budget Budget) context.Context {
+	return context.WithValue(ctx, uploadFilesKey, budget)
+}
+
+// UploadFilesFromContext returns the upload files budget of the client of the request.
+// Without one, when rate limiting is disabled, every upload is allowed.
+func UploadFilesFromContext(ctx context.Context) Budget {
+	budget, _ := ctx.Value(uploadFilesKey).(Budget)
+	return budget
+}
+
+// ContextWithUploadBytes returns a context carrying the budget of bytes the client of the
+// request may still upload, for requests only their handler can authorize, which takes the
+// bytes of the body once it did so that refused requests spend nothing
+func ContextWithUploadBytes(ctx context.Context, budget Budget) context.Context {
+	return context.WithValue(ctx, uploadBytesKey, budget)
+}
+
+// UploadBytesFromContext returns the upload bytes budget left for the handler of the
+// request to take from, if any
+func UploadBytesFromContext(ctx context.Context) (Budget, bool) {
+	budget, ok := ctx.Value(uploadBytesKey).(Budget)
+	return budget, ok
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter reading the time from the returned clock
+func newTestLimiter(limit int64, maxKeys int) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(limit, time.Minute, maxKeys)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiter_RefillsOverTheWindow(t *testing.T) {
+	limiter, now := newTestLimiter(60, 10)
+
+	for i := 0; i < 60; i++ {
+		if result := limiter.Take("client", 1); !result.Allowed {
+			t.Fatalf("request %d denied within the budget", i+1)
+		}
+	}
+	result := limiter.Take("client", 1)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("request beyond the budget allowed: %+v", result)
+	}
+	if result.RetryAfter != time.Second || result.Reset != time.Minute {
+		t.Errorf("retry after %s and reset in %s, want 1s and 1m", result.RetryAfter, result.Reset)
+	}
+
+	if !limiter.Take("other", 1).Allowed {
+		t.Errorf("a client was limited by the requests of another")
+	}
+
+	*now = now.Add(time.Second)
+	if !limiter.Take("client", 1).Allowed {
+		t.Errorf("request denied after a token was added")
+	}
+	if limiter.Take("client", 1).Allowed {
+		t.Errorf("more than one token added per second")
+	}
+}
+
+func TestLimiter_RefusesRequestsLargerThanTheBudget(t *testing.T) {
+	limiter, now := newTestLimiter(60, 10)
+
+	result := limiter.Take("client", 61)
+	if result.Allowed || !result.TooLarge || result.Remaining != 60 {
+		t.Fatalf("a request larger than the budget should be refused without taking tokens, got %+v", result)
+	}
+	header := http.Header{}
+	SetHeaders(header, result)
+	if header.Get("Retry-After") != "" {
+		t.Errorf("a request no wait would allow was told to retry after %s", header.Get("Retry-After"))
+	}
+	if result := limiter.Take("client", 60); !result.Allowed || result.TooLarge {
+		t.Fatalf("a request of the whole budget should pass with a full bucket, got %+v", result)
+	}
+
+	// Usage charged once it happened can still leave a bucket in debt
+	limiter.Charge("client", 30)
+	result = limiter.Take("client", 1)
+	if result.Allowed || result.TooLarge || result.RetryAfter != 31*time.Second {
+		t.Fatalf("expected a wait for the debt of 30 tokens to be paid, got %+v", result)
+	}
+
+	*now = now.Add(31 * time.Second)
+	if !limiter.Take("client", 1).Allowed {
+		t.Errorf("request denied once the debt was paid")
+	}
+}
+
+func TestLimiter_EvictsIdleAndLeastRecentlyUsedClients(t *testing.T) {
+	limiter, now := newTestLimiter(10, 3)
+
+	for i := 0; i < 5; i++ {
+		limiter.Take(fmt.Sprintf("client-%d", i), 5)
+	}
+	if limiter.Len() != 3 {
+		t.Fatalf("tracking %d clients, want at most 3", limiter.Len())
+	}
+	if result := limiter.Take("client-4", 1); result.Remaining != 4 {
+		t.Errorf("the most recent client lost its bucket: %+v", result)
+	}
+
+	// Buckets full again are dropped once their clients stop calling
+	*now = now.Add(time.Minute)
+	limiter.Take("client-9", 1)
+	if limiter.Len() != 1 {
+		t.Errorf("tracking %d clients after they went idle, want 1", limiter.Len())
+	}
+}
+
+func TestNilLimiter_AllowsEverything(t *testing.T) {
+	var limiter *Limiter
+	if New(0, time.Minute, 10) != nil {
+		t.Fatalf("a limit of 0 should disable the limiter")
+	}
+	limiter.Charge("client", 1)
+	if !limiter.Take("client", 1<<40).Allowed || !UploadFilesFromContext(context.Background()).Take(1).Allowed {
+		t.Errorf("a disabled limiter denied a request")
+	}
+}
+
+func TestBudget_TakeBody(t *testing.T) {
+	limiter, _ := newTestLimiter(10, 10)
+	budget := limiter.Budget("client")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345678"))
+	if result := budget.TakeBody(req); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("expected the declared length to be taken, got %+v", result)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345"))
+	req.ContentLength = -1
+	if result := budget.TakeBody(req); !result.Allowed {
+		t.Fatalf("expected a body of unknown length to be let through, got %+v", result)
+	}
+	io.Copy(io.Discard, req.Body)
+	if result := budget.Take(1); result.Allowed || result.RetryAfter != 24*time.Second {
+		t.Errorf("expected the bytes read to be charged, got %+v", result)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	limiter, _ := newTestLimiter(2, 10)
+	limiter.Take("client", 2)
+
+	header := http.Header{}
+	SetHeaders(header, limiter.Take("client", 1))
+
+	want := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "2;w=60",
+		"Retry-After":         "30",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/database"
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// ACLRepository stores directory ACL entries and the groups they can refer to
+type ACLRepository struct {
+	db          *sql.DB
+	safeQueries *database.SafeQueryBuilder
+}
+
+func NewACLRepository(db *sql.DB) *ACLRepository {
+	return &ACLRepository{db: db, safeQueries: database.NewSafeQueryBuilder()}
+}
+
+const aclEntryColumns = `e.id, e.path, e.subject_type, e.subject_id,
+	COALESCE(u.username, g.name, ''), e.permissions, e.created_at`
+
+const aclEntryJoins = `FROM acl_entries e
+	LEFT JOIN users u ON e.subject_type = 'user' AND u.id = e.subject_id
+	LEFT JOIN groups g ON e.subject_type = 'group' AND g.id = e.subject_id`
+
+// ListEntriesForPaths returns the entries set on any of paths
+func (r *ACLRepository) ListEntriesForPaths(paths []string) ([]*models.ACLEntry, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	placeholders, args := pathArgs(paths)
+	return r.queryEntries("SELECT "+aclEntryColumns+" "+aclEntryJoins+
+		" WHERE e.path IN ("+placeholders+") ORDER BY e.path, e.id", args...)
+}
+
+// ListEntriesForTree returns the entries set on any of paths or below dirPath
+func (r *ACLRepository) ListEntriesForTree(paths []string, dirPath string) ([]*models.ACLEntry, error) {
+	pattern := "/%"
+	if dirPath != "/" {
+		pattern = r.safeQueries.BuildSafeLikePattern(dirPath, "/%")
+	}
+
+	placeholders, args := pathArgs(paths)
+	where := "e.path LIKE ? ESCAPE '\\'"
+	if len(paths) > 0 {
+		where = "e.path IN (" + placeholders + ") OR " + where
+	}
+	return r.queryEntries("SELECT "+aclEntryColumns+" "+aclEntryJoins+
+		" WHERE "+where+" ORDER BY e.path, e.id", append(args, pattern)...)
+}
+
+// pathArgs returns the placeholders and arguments of an IN clause matching paths
+func pathArgs(paths []string) (string, []any) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(paths)), ",")
+	args := make([]any, len(paths))
+	for i, p := range paths {
+		args[i] = p
+	}
+	return placeholders, args
+}
+
+func (r *ACLRepository) GetEntry(id int64) (*models.ACLEntry, error) {
+	return scanACLEntry(r.db.QueryRow("SELECT "+aclEntryColumns+" "+aclEntryJoins+" WHERE e.id = ?", id))
+}
+
+// SetEntry creates the entry of a subject on a path, or replaces its permissions
+func (r *ACLRepository) SetEntry(entry *models.ACLEntry) error {
+	entry.CreatedAt = time.Now()
+	return r.db.QueryRow(`
+	INSERT INTO acl_entries (path, subject_type, subject_id, permissions, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(path, subject_type, subject_id) DO UPDATE SET permissions = excluded.permissions
+	RETURNING id, created_at
+	`, entry.Path, entry.SubjectType, entry.SubjectID, strings.Join(entry.Permissions, ","), entry.CreatedAt,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// DeleteEntry removes an entry. It returns sql.ErrNoRows for unknown entries.
+func (r *ACLRepository) DeleteEntry(id int64) error {
+	result, err := r.db.Exec("DELETE FROM acl_entries WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SubjectExists reports whether the user or group an entry would refer to exists
+func (r *ACLRepository) SubjectExists(subjectType string, subjectID int64) (bool, error) {
+	table := "users"
+	if subjectType == models.SubjectGroup {
+		table = "groups"
+	}
+
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", subjectID).Scan(&count)
+	return count > 0, err
+}
+
+func (r *ACLRepository) CreateGroup(group *models.Group) error {
+	group.CreatedAt = time.Now()
+	result, err := r.db.Exec("INSERT INTO groups (name, created_at) VALUES (?, ?)", group.Name, group.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	group.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *ACLRepository) ListGroups() ([]*models.Group, error) {
+	rows, err := r.db.Query("SELECT id, name, created_at FROM groups ORDER BY LOWER(name) ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		group := &models.Group{}
+		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (r *ACLRepository) GetGroup(id int64) (*models.Group, error) {
+	group := &models.Group{}
+	err := r.db.QueryRow("SELECT id, name, created_at FROM groups WHERE id = ?", id).
+		Scan(&group.ID, &group.Name, &group.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteGroup removes a group with its memberships and ACL entries. It returns sql.ErrNoRows for unknown groups.
+func (r *ACLRepository) DeleteGroup(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM acl_entries WHERE subject_type = 'group' AND subject_id = ?", id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM groups WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (r *ACLRepository) AddGroupMember(groupID, userID int64) error {
+	_, err := r.db.Exec("INSERT OR IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)", groupID, userID)
+	return err
+}
+
+// RemoveGroupMember removes a user from a group. It returns sql.ErrNoRows when the user was not a member.
+func (r *ACLRepository) RemoveGroupMember(groupID, userID int64) error {
+	result, err := r.db.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *ACLRepository) ListGroupMembers(groupID int64) ([]*models.User, error) {
+	rows, err := r.db.Query(`
+	SELECT u.id, u.username, u.password_hash, u.is_admin, u.created_at, u.updated_at
+	FROM users u JOIN group_members m ON m.user_id = u.id
+	WHERE m.group_id = ? ORDER BY LOWER(u.username) ASC
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetUserGroupIDs returns the groups a user belongs to
+func (r *ACLRepository) GetUserGroupIDs(userID int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT group_id FROM group_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *ACLRepository) queryEntries(query string, args ...any) ([]*models.ACLEntry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ACLEntry
+	for rows.Next() {
+		entry, err := scanACLEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanACLEntry(row rowScanner) (*models.ACLEntry, error) {
+	entry := &models.ACLEntry{}
+	var permissions string
+	err := row.Scan(&entry.ID, &entry.Path, &entry.SubjectType, &entry.SubjectID,
+		&entry.SubjectName, &permissions, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Permissions = []string{}
+	if permissions != "" {
+		entry.Permissions = strings.Split(permissions, ",")
+	}
+	return entry, nil
+}
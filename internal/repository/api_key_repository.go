@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+const apiKeyColumns = `k.id, k.user_id, k.name, k.token_hash, k.token_prefix, k.scopes, k.path_prefix,
+	k.expires_at, k.last_used_at, k.created_at`
+
+func (r *UserRepository) CreateAPIKey(key *models.APIKey) error {
+	key.CreatedAt = time.Now().UTC()
+
+	var expiresAt sql.NullTime
+	if key.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: key.ExpiresAt.UTC(), Valid: true}
+	}
+
+	result, err := r.db.Exec(`
+	INSERT INTO api_keys (user_id, name, token_hash, token_prefix, scopes, path_prefix, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.UserID, key.Name, key.TokenHash, key.TokenPrefix, strings.Join(key.Scopes, ","),
+		key.PathPrefix, expiresAt, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	key.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListAPIKeys returns the keys of a user, or the keys of all users when userID is 0
+func (r *UserRepository) ListAPIKeys(userID int64) ([]*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys k"
+	var args []any
+	if userID != 0 {
+		query += " WHERE k.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY k.created_at DESC, k.id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *UserRepository) GetAPIKeyByID(id int64) (*models.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys k WHERE k.id = ?", id))
+}
+
+// GetAPIKeyUser returns a key by the hash of its token together with its owner. Expiry is left to the caller.
+func (r *UserRepository) GetAPIKeyUser(tokenHash string) (*models.APIKey, *models.User, error) {
+	row := r.db.QueryRow(`
+	SELECT `+apiKeyColumns+`,
+		u.id, u.username, u.password_hash, u.is_admin, u.created_at, u.updated_at
+	FROM api_keys k JOIN users u ON u.id = k.user_id
+	WHERE k.token_hash = ?
+	`, tokenHash)
+
+	user := &models.User{}
+	key, err := scanAPIKey(row,
+		&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, user, nil
+}
+
+// TouchAPIKey records when a key was last used
+func (r *UserRepository) TouchAPIKey(id int64, usedAt time.Time) error {
+	_, err := r.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+	return err
+}
+
+// DeleteAPIKey revokes a key. It returns sql.ErrNoRows for unknown keys.
+func (r *UserRepository) DeleteAPIKey(id int64) error {
+	result, err := r.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanAPIKey scans the columns of apiKeyColumns followed by any extra destinations
+func scanAPIKey(row rowScanner, extra ...any) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	dest := []any{
+		&key.ID, &key.UserID, &key.Name, &key.TokenHash, &key.TokenPrefix, &scopes, &key.PathPrefix,
+		&expiresAt, &lastUsedAt, &key.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
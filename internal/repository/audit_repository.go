@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/database"
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// AuditRepository appends to and queries the audit log. The table refuses updates and
+// deletes, so the repository offers neither.
+type AuditRepository struct {
+	db          *sql.DB
+	safeQueries *database.SafeQueryBuilder
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db, safeQueries: database.NewSafeQueryBuilder()}
+}
+
+const auditColumns = `id, time, actor_id, actor, client_ip, action, path, target_path, size, details, result, error`
+
+func (r *AuditRepository) Append(entry *models.AuditEntry) error {
+	result, err := r.db.Exec(`
+	INSERT INTO audit_log (time, actor_id, actor, client_ip, action, path, target_path, size, details, result, error)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Time.UTC(), entry.ActorID, entry.Actor, entry.ClientIP, entry.Action, entry.Path,
+		entry.TargetPath, entry.Size, entry.Details, entry.Result, entry.Error)
+	if err != nil {
+		return err
+	}
+
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// Query returns the entries matching filter, newest first
+func (r *AuditRepository) Query(filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	var conditions []string
+	var args []any
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.PathPrefix != "" && filter.PathPrefix != "/" {
+		pattern := r.safeQueries.BuildSafeLikePattern(filter.PathPrefix, "/%")
+		conditions = append(conditions,
+			`(path = ? OR path LIKE ? ESCAPE '\' OR target_path = ? OR target_path LIKE ? ESCAPE '\')`)
+		args = append(args, filter.PathPrefix, pattern, filter.PathPrefix, pattern)
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		err := rows.Scan(&entry.ID, &entry.Time, &entry.ActorID, &entry.Actor, &entry.ClientIP, &entry.Action,
+			&entry.Path, &entry.TargetPath, &entry.Size, &entry.Details, &entry.Result, &entry.Error)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -1,18 +1,23 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/anddsdev/cloudlet/internal/database"
 	"github.com/anddsdev/cloudlet/internal/models"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 )
 
 type FileRepository struct {
 	db          *sql.DB
 	safeQueries *database.SafeQueryBuilder
+	searchIndex bool            // Whether the FTS5 search index is maintained
+	ctx         context.Context // Carries the span the queries of the view are traced under
 }
 
 func NewFileRepository(dsn string, maxConn int) (*FileRepository, error) {
@@ -21,7 +26,7 @@ func NewFileRepository(dsn string, maxConn int) (*FileRepository, error) {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := sql.Open(database.DriverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -34,16 +39,56 @@ func NewFileRepository(dsn string, maxConn int) (*FileRepository, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	fmt.Printf("Database connection established successfully: %s\n", dsn)
+	searchIndex, err := database.SearchIndexAvailable(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check search index: %w", err)
+	}
+
+	slog.Info("Database connection established", "dsn", dsn)
 
 	return &FileRepository{
-		db: db,
+		db:          db,
+		searchIndex: searchIndex,
 	}, nil
 }
 
-func (r *FileRepository) GetFilesByPath(parentPath string) ([]*models.FileInfo, error) {
+// WithContext returns a view tracing its queries as children of the span in ctx
+func (r *FileRepository) WithContext(ctx context.Context) *FileRepository {
+	view := *r
+	view.ctx = ctx
+	return &view
+}
+
+// startSpan starts a span for operation under the span of the view. It returns a view
+// tracing the queries the operation delegates to other methods under the new span.
+func (r *FileRepository) startSpan(operation string, attrs ...tracing.Attribute) (*FileRepository, *tracing.Span) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attrs = append(attrs, tracing.String("db.system", "sqlite"))
+	ctx, span := tracing.Start(ctx, "FileRepository."+operation, attrs...)
+	if span == nil {
+		return r, nil
+	}
+	return r.WithContext(ctx), span
+}
+
+// endSpan ends a span started by startSpan, failed by err unless err only reports a missing row
+func endSpan(span *tracing.Span, err error) {
+	if !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (r *FileRepository) GetFilesByPath(parentPath string) (_ []*models.FileInfo, err error) {
+	r, span := r.startSpan("GetFilesByPath", tracing.String("file.path", parentPath))
+	defer func() { endSpan(span, err) }()
+
 	query := `
-	SELECT id, name, path, size, mime_type, is_directory, parent_path, created_at, updated_at
+	SELECT id, name, path, size, mime_type, is_directory, parent_path, checksum, blob_ref, owner_id, created_at, updated_at
 	FROM files 
 	WHERE parent_path = ? 
 	ORDER BY is_directory DESC, LOWER(name) ASC
@@ -61,7 +106,7 @@ func (r *FileRepository) GetFilesByPath(parentPath string) ([]*models.FileInfo,
 		err := rows.Scan(
 			&file.ID, &file.Name, &file.Path, &file.Size,
 			&file.MimeType, &file.IsDirectory, &file.ParentPath,
-			&file.CreatedAt, &file.UpdatedAt,
+			&file.Checksum, &file.BlobRef, &file.OwnerID, &file.CreatedAt, &file.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -78,17 +123,20 @@ func (r *FileRepository) GetFilesByPath(parentPath string) ([]*models.FileInfo,
 	return files, nil
 }
 
-func (r *FileRepository) GetFileByPath(path string) (*models.FileInfo, error) {
+func (r *FileRepository) GetFileByPath(path string) (_ *models.FileInfo, err error) {
+	r, span := r.startSpan("GetFileByPath", tracing.String("file.path", path))
+	defer func() { endSpan(span, err) }()
+
 	query := `
-	SELECT id, name, path, size, mime_type, is_directory, parent_path, created_at, updated_at
+	SELECT id, name, path, size, mime_type, is_directory, parent_path, checksum, blob_ref, owner_id, created_at, updated_at
 	FROM files WHERE path = ?
 	`
 
 	file := &models.FileInfo{}
-	err := r.db.QueryRow(query, path).Scan(
+	err = r.db.QueryRow(query, path).Scan(
 		&file.ID, &file.Name, &file.Path, &file.Size,
 		&file.MimeType, &file.IsDirectory, &file.ParentPath,
-		&file.CreatedAt, &file.UpdatedAt,
+		&file.Checksum, &file.BlobRef, &file.OwnerID, &file.CreatedAt, &file.UpdatedAt,
 	)
 
 	if err != nil {
@@ -103,16 +151,74 @@ func (r *FileRepository) GetFileByPath(path string) (*models.FileInfo, error) {
 	return file, nil
 }
 
-func (r *FileRepository) InsertFile(file *models.FileInfo) error {
+// GetFilesUnderPath returns every file and directory below the given path,
+// ordered so that parents always come before their children
+func (r *FileRepository) GetFilesUnderPath(path string) (_ []*models.FileInfo, err error) {
+	r, span := r.startSpan("GetFilesUnderPath", tracing.String("file.path", path))
+	defer func() { endSpan(span, err) }()
+
+	query := `
+	SELECT id, name, path, size, mime_type, is_directory, parent_path, checksum, blob_ref, owner_id, created_at, updated_at
+	FROM files
+	WHERE path LIKE ? ESCAPE '\'
+	ORDER BY path ASC
+	`
+
+	pattern := "/%"
+	if path != "/" {
+		pattern = r.safeQueries.BuildSafeLikePattern(path, "/%")
+	}
+
+	rows, err := r.db.Query(query, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.FileInfo
+	for rows.Next() {
+		file := &models.FileInfo{}
+		err := rows.Scan(
+			&file.ID, &file.Name, &file.Path, &file.Size,
+			&file.MimeType, &file.IsDirectory, &file.ParentPath,
+			&file.Checksum, &file.BlobRef, &file.OwnerID, &file.CreatedAt, &file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (r *FileRepository) InsertFile(file *models.FileInfo) (err error) {
+	r, span := r.startSpan("InsertFile", tracing.String("file.path", file.Path))
+	defer func() { endSpan(span, err) }()
+
 	now := time.Now()
 	query := `
-	INSERT INTO files (name, path, size, mime_type, is_directory, parent_path, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO files (name, path, size, mime_type, is_directory, parent_path, checksum, blob_ref, owner_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.Exec(query,
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The blob reference is counted in the same transaction that records the file
+	if file.BlobRef != "" {
+		if err := r.retainBlob(tx, file.BlobRef, file.Size); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(query,
 		file.Name, file.Path, file.Size, file.MimeType,
-		file.IsDirectory, file.ParentPath, now, now,
+		file.IsDirectory, file.ParentPath, file.Checksum, file.BlobRef, file.OwnerID, now, now,
 	)
 	if err != nil {
 		return err
@@ -123,13 +229,26 @@ func (r *FileRepository) InsertFile(file *models.FileInfo) error {
 		return err
 	}
 
+	if !file.IsDirectory {
+		if err := r.addQuotaUsage(tx, file.Path, file.OwnerID, file.Size, 1); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
 	file.ID = id
 	file.CreatedAt = now
 	file.UpdatedAt = now
 	return nil
 }
 
-func (r *FileRepository) CreateDirectory(name, parentPath string) (*models.FileInfo, error) {
+func (r *FileRepository) CreateDirectory(name, parentPath string) (_ *models.FileInfo, err error) {
+	r, span := r.startSpan("CreateDirectory", tracing.String("file.path", r.buildPath(parentPath, name)))
+	defer func() { endSpan(span, err) }()
+
 	fullPath := r.buildPath(parentPath, name)
 
 	if r.pathExists(fullPath) {
@@ -149,7 +268,7 @@ func (r *FileRepository) CreateDirectory(name, parentPath string) (*models.FileI
 		ParentPath:  parentPath,
 	}
 
-	err := r.InsertFile(dir)
+	err = r.InsertFile(dir)
 	if err != nil {
 		return nil, err
 	}
@@ -157,7 +276,10 @@ func (r *FileRepository) CreateDirectory(name, parentPath string) (*models.FileI
 	return dir, nil
 }
 
-func (r *FileRepository) RenameFile(oldPath, newName string) error {
+func (r *FileRepository) RenameFile(oldPath, newName string) (err error) {
+	r, span := r.startSpan("RenameFile", tracing.String("file.path", oldPath))
+	defer func() { endSpan(span, err) }()
+
 	file, err := r.GetFileByPath(oldPath)
 	if err != nil {
 		return err
@@ -181,18 +303,33 @@ func (r *FileRepository) RenameFile(oldPath, newName string) error {
 		return err
 	}
 
+	if err := r.moveShares(tx, oldPath, newPath); err != nil {
+		return err
+	}
+	if err := r.moveVersions(tx, oldPath, newPath); err != nil {
+		return err
+	}
+
 	// If it's a directory, update all children recursively
 	if file.IsDirectory {
 		err = r.updateChildrenPaths(tx, oldPath, newPath)
 		if err != nil {
 			return err
 		}
+		if err := r.moveACLEntries(tx, oldPath, newPath); err != nil {
+			return err
+		}
+		if err := r.moveDirectoryQuotas(tx, oldPath, newPath); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
 }
 
-func (r *FileRepository) MoveFile(sourcePath, destinationPath string) error {
+func (r *FileRepository) MoveFile(sourcePath, destinationPath string) (err error) {
+	r, span := r.startSpan("MoveFile", tracing.String("file.path", sourcePath))
+	defer func() { endSpan(span, err) }()
 
 	sourceFile, err := r.GetFileByPath(sourcePath)
 	if err != nil {
@@ -215,23 +352,50 @@ func (r *FileRepository) MoveFile(sourcePath, destinationPath string) error {
 	}
 	defer tx.Rollback()
 
+	// The moved files stop counting against the directory quotas above the source
+	// and start counting against those above the destination
+	size, count, err := r.usageUnder(tx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if err := r.addDirectoryQuotaUsage(tx, sourcePath, -size, -count); err != nil {
+		return err
+	}
+	if err := r.addDirectoryQuotaUsage(tx, newPath, size, count); err != nil {
+		return err
+	}
+
 	_, err = tx.Exec("UPDATE files SET path = ?, parent_path = ?, updated_at = ? WHERE path = ?",
 		newPath, destinationPath, time.Now(), sourcePath)
 	if err != nil {
 		return err
 	}
+	if err := r.moveShares(tx, sourcePath, newPath); err != nil {
+		return err
+	}
+	if err := r.moveVersions(tx, sourcePath, newPath); err != nil {
+		return err
+	}
 
 	if sourceFile.IsDirectory {
 		err = r.updateChildrenPaths(tx, sourcePath, newPath)
 		if err != nil {
 			return err
 		}
+		if err := r.moveACLEntries(tx, sourcePath, newPath); err != nil {
+			return err
+		}
+		if err := r.moveDirectoryQuotas(tx, sourcePath, newPath); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
 }
 
-func (r *FileRepository) DeleteFile(path string) error {
+func (r *FileRepository) DeleteFile(path string) (err error) {
+	r, span := r.startSpan("DeleteFile", tracing.String("file.path", path))
+	defer func() { endSpan(span, err) }()
 
 	file, err := r.GetFileByPath(path)
 	if err != nil {
@@ -258,6 +422,23 @@ func (r *FileRepository) DeleteFile(path string) error {
 		if count > 0 {
 			return fmt.Errorf("directory not empty: %s", path)
 		}
+
+		if _, err := tx.Exec("DELETE FROM acl_entries WHERE path = ?", path); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM quotas WHERE subject_type = 'directory' AND path = ?", path); err != nil {
+			return err
+		}
+	} else if err := r.addQuotaUsage(tx, path, file.OwnerID, -file.Size, -1); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM shares WHERE path = ?", path); err != nil {
+		return err
+	}
+	if !file.IsDirectory {
+		if err := r.deleteVersionsUnder(tx, path); err != nil {
+			return err
+		}
 	}
 
 	_, err = tx.Exec("DELETE FROM files WHERE path = ?", path)
@@ -265,10 +446,19 @@ func (r *FileRepository) DeleteFile(path string) error {
 		return err
 	}
 
+	if file.BlobRef != "" {
+		if err := r.releaseBlob(tx, file.BlobRef); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
-func (r *FileRepository) DeleteDirectoryRecursive(path string) error {
+func (r *FileRepository) DeleteDirectoryRecursive(path string) (err error) {
+	r, span := r.startSpan("DeleteDirectoryRecursive", tracing.String("file.path", path))
+	defer func() { endSpan(span, err) }()
+
 	// Validate path for SQL safety
 	if err := r.safeQueries.ValidatePathForSQL(path); err != nil {
 		return fmt.Errorf("invalid path for SQL operation: %w", err)
@@ -276,10 +466,132 @@ func (r *FileRepository) DeleteDirectoryRecursive(path string) error {
 
 	// Use safe transaction execution
 	return r.safeQueries.ExecuteInTransaction(r.db, func(tx *sql.Tx) error {
+		if err := r.releaseBlobsUnder(tx, path); err != nil {
+			return err
+		}
+		if err := r.deleteACLEntriesUnder(tx, path); err != nil {
+			return err
+		}
+		if err := r.releaseQuotaUsageUnder(tx, path); err != nil {
+			return err
+		}
+		if err := r.deleteSharesUnder(tx, path); err != nil {
+			return err
+		}
+		if err := r.deleteVersionsUnder(tx, path); err != nil {
+			return err
+		}
 		return r.safeQueries.DeleteDirectoryRecursive(tx, path)
 	})
 }
 
+// retainBlob records one more file referencing a blob
+func (r *FileRepository) retainBlob(tx *sql.Tx, checksum string, size int64) error {
+	_, err := tx.Exec(`
+	INSERT INTO blobs (checksum, size, ref_count) VALUES (?, ?, 1)
+	ON CONFLICT(checksum) DO UPDATE SET ref_count = ref_count + 1
+	`, checksum, size)
+	return err
+}
+
+// releaseBlob drops one reference to a blob. Blobs left without references are
+// removed by garbage collection, not here.
+func (r *FileRepository) releaseBlob(tx *sql.Tx, checksum string) error {
+	_, err := tx.Exec("UPDATE blobs SET ref_count = ref_count - 1 WHERE checksum = ? AND ref_count > 0", checksum)
+	return err
+}
+
+// releaseBlobsUnder drops the blob references of a path and everything below it
+func (r *FileRepository) releaseBlobsUnder(tx *sql.Tx, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+
+	rows, err := tx.Query(`
+	SELECT blob_ref FROM files
+	WHERE blob_ref != '' AND (path = ? OR path LIKE ? ESCAPE '\')
+	`, path, pattern)
+	if err != nil {
+		return err
+	}
+
+	var refs []string
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			rows.Close()
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if err := r.releaseBlob(tx, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnreferencedBlobs returns the blobs no file refers to anymore
+func (r *FileRepository) GetUnreferencedBlobs() ([]string, error) {
+	rows, err := r.db.Query("SELECT checksum FROM blobs WHERE ref_count <= 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checksums []string
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+
+	return checksums, rows.Err()
+}
+
+// DeleteUnreferencedBlob removes a blob record if it is still unreferenced,
+// and reports whether it was removed
+func (r *FileRepository) DeleteUnreferencedBlob(checksum string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM blobs WHERE checksum = ? AND ref_count <= 0", checksum)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// BlobExists reports whether a blob is recorded, referenced or not
+func (r *FileRepository) BlobExists(checksum string) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM blobs WHERE checksum = ?", checksum).Scan(&count)
+	return count > 0, err
+}
+
+// GetBlobStats returns the number of stored blobs, their total size, and the size the
+// files referencing them would take up without deduplication
+func (r *FileRepository) GetBlobStats() (blobCount, storedSize, logicalSize int64, err error) {
+	err = r.db.QueryRow(`
+	SELECT COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(size * ref_count), 0)
+	FROM blobs WHERE ref_count > 0
+	`).Scan(&blobCount, &storedSize, &logicalSize)
+	return blobCount, storedSize, logicalSize, err
+}
+
+// GetStorageTotals returns the size and number of all regular files
+func (r *FileRepository) GetStorageTotals() (size, count int64, err error) {
+	err = r.db.QueryRow(`
+	SELECT COALESCE(SUM(size), 0), COUNT(*) FROM files WHERE is_directory = 0
+	`).Scan(&size, &count)
+	return size, count, err
+}
+
 func (r *FileRepository) buildPath(parent, name string) string {
 	if parent == "/" {
 		return "/" + name
@@ -323,6 +635,164 @@ func (r *FileRepository) updateChildrenPaths(tx *sql.Tx, oldParentPath, newParen
 	return r.safeQueries.UpdateChildrenPaths(tx, oldParentPath, newParentPath)
 }
 
+// moveACLEntries keeps the ACL entries of a directory and its subdirectories attached when it is moved or renamed
+func (r *FileRepository) moveACLEntries(tx *sql.Tx, oldPath, newPath string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(oldPath, "/%")
+	_, err := tx.Exec(`
+	UPDATE acl_entries SET path = ? || SUBSTR(path, ?)
+	WHERE path = ? OR path LIKE ? ESCAPE '\'
+	`, newPath, len(oldPath)+1, oldPath, pattern)
+	return err
+}
+
+// deleteACLEntriesUnder removes the ACL entries of a directory and everything below it
+func (r *FileRepository) deleteACLEntriesUnder(tx *sql.Tx, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+	_, err := tx.Exec("DELETE FROM acl_entries WHERE path = ? OR path LIKE ? ESCAPE '\\'", path, pattern)
+	return err
+}
+
+// moveShares keeps the share links of a file or directory and of everything below it working when it is moved or renamed
+func (r *FileRepository) moveShares(tx *sql.Tx, oldPath, newPath string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(oldPath, "/%")
+	_, err := tx.Exec(`
+	UPDATE shares SET path = ? || SUBSTR(path, ?)
+	WHERE path = ? OR path LIKE ? ESCAPE '\'
+	`, newPath, len(oldPath)+1, oldPath, pattern)
+	return err
+}
+
+// deleteSharesUnder revokes the share links of a directory and everything below it
+func (r *FileRepository) deleteSharesUnder(tx *sql.Tx, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+	_, err := tx.Exec("DELETE FROM shares WHERE path = ? OR path LIKE ? ESCAPE '\\'", path, pattern)
+	return err
+}
+
+// quotaAncestorCondition matches the directory quotas set on a directory strictly above the path bound to it
+const quotaAncestorCondition = `subject_type = 'directory' AND path != ?1
+	AND (path = '/' OR SUBSTR(?1, 1, LENGTH(path) + 1) = path || '/')`
+
+// addQuotaUsage counts bytes and files against the quota of their owner and the
+// directory quotas above path. Negative values release usage.
+func (r *FileRepository) addQuotaUsage(tx *sql.Tx, path string, ownerID, bytes, files int64) error {
+	if err := r.addDirectoryQuotaUsage(tx, path, bytes, files); err != nil {
+		return err
+	}
+	return r.addUserQuotaUsage(tx, ownerID, bytes, files)
+}
+
+func (r *FileRepository) addDirectoryQuotaUsage(tx *sql.Tx, path string, bytes, files int64) error {
+	if bytes == 0 && files == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+	UPDATE quotas SET used_bytes = MAX(used_bytes + ?2, 0), used_files = MAX(used_files + ?3, 0)
+	WHERE `+quotaAncestorCondition, path, bytes, files)
+	return err
+}
+
+func (r *FileRepository) addUserQuotaUsage(tx *sql.Tx, ownerID, bytes, files int64) error {
+	if ownerID == 0 || (bytes == 0 && files == 0) {
+		return nil
+	}
+	_, err := tx.Exec(`
+	UPDATE quotas SET used_bytes = MAX(used_bytes + ?, 0), used_files = MAX(used_files + ?, 0)
+	WHERE subject_type = 'user' AND user_id = ?
+	`, bytes, files, ownerID)
+	return err
+}
+
+// GetUsageUnder returns the size and number of the regular files at or below path
+func (r *FileRepository) GetUsageUnder(path string) (int64, int64, error) {
+	return r.usageUnder(r.db, path)
+}
+
+func (r *FileRepository) usageUnder(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, path string) (int64, int64, error) {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+
+	var size, count int64
+	err := q.QueryRow(`
+	SELECT COALESCE(SUM(size), 0), COUNT(*) FROM files
+	WHERE is_directory = 0 AND (path = ? OR path LIKE ? ESCAPE '\')
+	`, path, pattern).Scan(&size, &count)
+	return size, count, err
+}
+
+// releaseQuotaUsageUnder releases the usage of everything below a directory that is
+// about to be removed, and drops the directory quotas set inside it
+func (r *FileRepository) releaseQuotaUsageUnder(tx *sql.Tx, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+
+	rows, err := tx.Query(`
+	SELECT owner_id, COALESCE(SUM(size), 0), COUNT(*) FROM files
+	WHERE is_directory = 0 AND (path = ? OR path LIKE ? ESCAPE '\')
+	GROUP BY owner_id
+	`, path, pattern)
+	if err != nil {
+		return err
+	}
+
+	type ownerUsage struct{ owner, size, count int64 }
+	var usage []ownerUsage
+	var totalSize, totalCount int64
+	for rows.Next() {
+		var u ownerUsage
+		if err := rows.Scan(&u.owner, &u.size, &u.count); err != nil {
+			rows.Close()
+			return err
+		}
+		usage = append(usage, u)
+		totalSize += u.size
+		totalCount += u.count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range usage {
+		if err := r.addUserQuotaUsage(tx, u.owner, -u.size, -u.count); err != nil {
+			return err
+		}
+	}
+	if err := r.addDirectoryQuotaUsage(tx, path, -totalSize, -totalCount); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM quotas WHERE subject_type = 'directory' AND (path = ? OR path LIKE ? ESCAPE '\\')", path, pattern)
+	return err
+}
+
+// moveDirectoryQuotas keeps the quotas of a directory and its subdirectories attached when it is moved or renamed
+func (r *FileRepository) moveDirectoryQuotas(tx *sql.Tx, oldPath, newPath string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(oldPath, "/%")
+	_, err := tx.Exec(`
+	UPDATE quotas SET path = ? || SUBSTR(path, ?)
+	WHERE subject_type = 'directory' AND (path = ? OR path LIKE ? ESCAPE '\')
+	`, newPath, len(oldPath)+1, oldPath, pattern)
+	return err
+}
+
+// Ping checks that the database can be reached
+func (r *FileRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// SchemaVersion returns the version of the latest migration applied to the database
+func (r *FileRepository) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// DB returns the underlying connection pool so other repositories can share the database
+func (r *FileRepository) DB() *sql.DB {
+	return r.db
+}
+
 func (r *FileRepository) Close() error {
 	return r.db.Close()
 }
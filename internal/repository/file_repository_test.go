@@ -220,6 +220,48 @@ func TestFileRepository_GetFilesByPath(t *testing.T) {
 	}
 }
 
+func TestFileRepository_GetFilesUnderPath(t *testing.T) {
+	repo := setupTestRepository(t)
+	defer repo.Close()
+
+	entries := []*models.FileInfo{
+		{Name: "project", Path: "/project", MimeType: "inode/directory", IsDirectory: true, ParentPath: "/"},
+		{Name: "readme.md", Path: "/project/readme.md", Size: 10, MimeType: "text/markdown", ParentPath: "/project"},
+		{Name: "src", Path: "/project/src", MimeType: "inode/directory", IsDirectory: true, ParentPath: "/project"},
+		{Name: "main.go", Path: "/project/src/main.go", Size: 20, MimeType: "text/x-go", ParentPath: "/project/src"},
+		{Name: "project_old", Path: "/project_old", MimeType: "inode/directory", IsDirectory: true, ParentPath: "/"},
+		{Name: "notes.txt", Path: "/project_old/notes.txt", Size: 5, MimeType: "text/plain", ParentPath: "/project_old"},
+	}
+	for _, entry := range entries {
+		if err := repo.InsertFile(entry); err != nil {
+			t.Fatalf("Failed to insert %s: %v", entry.Path, err)
+		}
+	}
+
+	files, err := repo.GetFilesUnderPath("/project")
+	if err != nil {
+		t.Fatalf("GetFilesUnderPath failed: %v", err)
+	}
+
+	expected := []string{"/project/readme.md", "/project/src", "/project/src/main.go"}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(files))
+	}
+	for i, path := range expected {
+		if files[i].Path != path {
+			t.Errorf("Entry %d: expected %s, got %s", i, path, files[i].Path)
+		}
+	}
+
+	all, err := repo.GetFilesUnderPath("/")
+	if err != nil {
+		t.Fatalf("GetFilesUnderPath for root failed: %v", err)
+	}
+	if len(all) != len(entries) {
+		t.Errorf("Expected %d entries under root, got %d", len(entries), len(all))
+	}
+}
+
 func TestFileRepository_CreateDirectory(t *testing.T) {
 	repo := setupTestRepository(t)
 	defer repo.Close()
@@ -880,4 +922,4 @@ func BenchmarkFileRepository_GetFilesByPath(b *testing.B) {
 			b.Fatalf("Failed to get files: %v", err)
 		}
 	}
-}
\ No newline at end of file
+}
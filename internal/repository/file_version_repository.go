@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// ErrFileChanged is returned when a file was modified while its content was being replaced
+var ErrFileChanged = errors.New("file was modified concurrently")
+
+const versionColumns = `id, path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at`
+
+// ReplaceFile records file as the new content of previous and keeps the previous content
+// as the next version of the path. archivedRef is the blob holding the previous content:
+// the blob the file already referenced, or the blob its verbatim copy was moved to. The
+// blob of file must already be stored.
+func (r *FileRepository) ReplaceFile(previous, file *models.FileInfo, archivedRef string) (*models.FileVersion, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	version := &models.FileVersion{
+		Path:       previous.Path,
+		Size:       previous.Size,
+		Checksum:   archivedRef,
+		BlobRef:    archivedRef,
+		MimeType:   previous.MimeType,
+		AuthorID:   previous.OwnerID,
+		ModifiedAt: previous.UpdatedAt.UTC(),
+		CreatedAt:  now,
+	}
+
+	err = tx.QueryRow(`
+	INSERT INTO file_versions (path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at)
+	VALUES (?1, (SELECT COALESCE(MAX(version), 0) + 1 FROM file_versions WHERE path = ?1), ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+	RETURNING id, version
+	`, version.Path, version.Size, version.Checksum, version.BlobRef, version.MimeType, version.AuthorID,
+		version.ModifiedAt, version.CreatedAt).Scan(&version.ID, &version.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// A verbatim copy moved to the blob store gains its first reference here. A blob the
+	// file already referenced passes its reference on to the version.
+	if previous.BlobRef == "" {
+		if err := r.retainBlob(tx, archivedRef, previous.Size); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.retainBlob(tx, file.BlobRef, file.Size); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+	UPDATE files SET size = ?, mime_type = ?, checksum = ?, blob_ref = ?, owner_id = ?, updated_at = ?
+	WHERE id = ? AND size = ? AND checksum = ? AND blob_ref = ?
+	`, file.Size, file.MimeType, file.Checksum, file.BlobRef, file.OwnerID, now,
+		previous.ID, previous.Size, previous.Checksum, previous.BlobRef)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrFileChanged
+	}
+
+	if err := r.addQuotaUsage(tx, previous.Path, previous.OwnerID, -previous.Size, -1); err != nil {
+		return nil, err
+	}
+	if err := r.addQuotaUsage(tx, previous.Path, file.OwnerID, file.Size, 1); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	file.ID = previous.ID
+	file.CreatedAt = previous.CreatedAt
+	file.UpdatedAt = now
+	return version, nil
+}
+
+// RevertReplace undoes the ReplaceFile that recorded file as the new content of previous
+// and kept the previous content as version: the version becomes the content of the file
+// again and is removed. It returns ErrFileChanged when the file or the version changed since.
+func (r *FileRepository) RevertReplace(previous, file *models.FileInfo, version *models.FileVersion) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The previous content is read from the blob of the version, which passes its reference on
+	result, err := tx.Exec(`
+	UPDATE files SET size = ?, mime_type = ?, checksum = ?, blob_ref = ?, owner_id = ?, updated_at = ?
+	WHERE id = ? AND size = ? AND checksum = ? AND blob_ref = ?
+	`, previous.Size, previous.MimeType, previous.Checksum, version.BlobRef, previous.OwnerID, previous.UpdatedAt.UTC(),
+		file.ID, file.Size, file.Checksum, file.BlobRef)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrFileChanged
+	}
+
+	result, err = tx.Exec("DELETE FROM file_versions WHERE id = ?", version.ID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrFileChanged
+	}
+
+	if err := r.releaseBlob(tx, file.BlobRef); err != nil {
+		return err
+	}
+	if err := r.addQuotaUsage(tx, previous.Path, file.OwnerID, -file.Size, -1); err != nil {
+		return err
+	}
+	if err := r.addQuotaUsage(tx, previous.Path, previous.OwnerID, previous.Size, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListVersions returns the versions of a path, newest first
+func (r *FileRepository) ListVersions(path string) ([]*models.FileVersion, error) {
+	rows, err := r.db.Query("SELECT "+versionColumns+" FROM file_versions WHERE path = ? ORDER BY version DESC", path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*models.FileVersion
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (r *FileRepository) GetVersion(path string, number int64) (*models.FileVersion, error) {
+	return scanVersion(r.db.QueryRow("SELECT "+versionColumns+" FROM file_versions WHERE path = ? AND version = ?", path, number))
+}
+
+// PruneVersions deletes the versions of path, or of every path when path is empty, beyond
+// the keep newest or created before olderThan. Zero values disable either limit. The blobs
+// of deleted versions are left to garbage collection.
+func (r *FileRepository) PruneVersions(path string, keep int, olderThan time.Time) (int64, error) {
+	var cutoff sql.NullTime
+	if !olderThan.IsZero() {
+		cutoff = sql.NullTime{Time: olderThan.UTC(), Valid: true}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT id, blob_ref FROM (
+		SELECT id, blob_ref, created_at, ROW_NUMBER() OVER (PARTITION BY path ORDER BY version DESC) AS position
+		FROM file_versions WHERE ?1 = '' OR path = ?1
+	)
+	WHERE (?2 > 0 AND position > ?2) OR (?3 IS NOT NULL AND created_at < ?3)
+	`, path, keep, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	var refs []string
+	for rows.Next() {
+		var id int64
+		var ref string
+		if err := rows.Scan(&id, &ref); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if _, err := tx.Exec("DELETE FROM file_versions WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+		if err := r.releaseBlob(tx, refs[i]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), tx.Commit()
+}
+
+// moveVersions keeps the versions of a file, or of the files below a directory, attached when it is moved or renamed
+func (r *FileRepository) moveVersions(tx *sql.Tx, oldPath, newPath string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(oldPath, "/%")
+	_, err := tx.Exec(`
+	UPDATE file_versions SET path = ? || SUBSTR(path, ?)
+	WHERE path = ? OR path LIKE ? ESCAPE '\'
+	`, newPath, len(oldPath)+1, oldPath, pattern)
+	return err
+}
+
+// deleteVersionsUnder deletes the versions of a file, or of the files below a directory, and releases their blobs
+func (r *FileRepository) deleteVersionsUnder(tx *sql.Tx, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+	if _, err := tx.Exec(`
+	UPDATE blobs SET ref_count = ref_count - (
+		SELECT COUNT(*) FROM file_versions v
+		WHERE v.blob_ref = blobs.checksum AND (v.path = ?1 OR v.path LIKE ?2 ESCAPE '\')
+	)
+	WHERE checksum IN (SELECT blob_ref FROM file_versions WHERE path = ?1 OR path LIKE ?2 ESCAPE '\')
+	`, path, pattern); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("DELETE FROM file_versions WHERE path = ? OR path LIKE ? ESCAPE '\\'", path, pattern)
+	return err
+}
+
+func scanVersion(row rowScanner) (*models.FileVersion, error) {
+	version := &models.FileVersion{}
+	var modifiedAt sql.NullTime
+	err := row.Scan(&version.ID, &version.Path, &version.Version, &version.Size, &version.Checksum,
+		&version.BlobRef, &version.MimeType, &version.AuthorID, &modifiedAt, &version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	version.ModifiedAt = modifiedAt.Time
+	return version, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// tagBatchSize keeps the ids of a tag lookup well below the SQLite variable limit
+const tagBatchSize = 500
+
+// GetTags returns the tags of the given files by file id, in alphabetical order
+func (r *FileRepository) GetTags(fileIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string, len(fileIDs))
+	for start := 0; start < len(fileIDs); start += tagBatchSize {
+		batch := fileIDs[start:min(start+tagBatchSize, len(fileIDs))]
+		if err := r.getTags(batch, tags); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func (r *FileRepository) getTags(fileIDs []int64, tags map[int64][]string) error {
+	args := make([]any, len(fileIDs))
+	for i, id := range fileIDs {
+		args[i] = id
+	}
+	rows, err := r.db.Query(`
+	SELECT file_id, tag FROM file_tags
+	WHERE file_id IN (?`+strings.Repeat(", ?", len(fileIDs)-1)+`)
+	ORDER BY tag COLLATE NOCASE`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return rows.Err()
+}
+
+// SetTags replaces the tags of a file
+func (r *FileRepository) SetTags(fileID int64, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM file_tags WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	if err := insertTags(tx, fileID, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateTags adds and removes tags on several files in one transaction
+func (r *FileRepository) UpdateTags(fileIDs []int64, add, remove []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range fileIDs {
+		for _, tag := range remove {
+			if _, err := tx.Exec("DELETE FROM file_tags WHERE file_id = ? AND tag = ?", id, tag); err != nil {
+				return err
+			}
+		}
+		if err := insertTags(tx, id, add); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertTags(tx *sql.Tx, fileID int64, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO file_tags (file_id, tag) VALUES (?, ?)", fileID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTaggedPathsUnder returns the tags used below path with the paths carrying them
+func (r *FileRepository) GetTaggedPathsUnder(path string) (map[string][]string, error) {
+	pattern := "/%"
+	if path != "/" {
+		pattern = r.safeQueries.BuildSafeLikePattern(path, "/%")
+	}
+
+	rows, err := r.db.Query(`
+	SELECT t.tag, f.path FROM file_tags t JOIN files f ON f.id = t.file_id
+	WHERE f.path LIKE ? ESCAPE '\'
+	ORDER BY t.tag COLLATE NOCASE`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string][]string)
+	for rows.Next() {
+		var tag, filePath string
+		if err := rows.Scan(&tag, &filePath); err != nil {
+			return nil, err
+		}
+		paths[tag] = append(paths[tag], filePath)
+	}
+	return paths, rows.Err()
+}
+
+// GetMetadata returns the metadata entries of a file ordered by key, with their values
+// as stored
+func (r *FileRepository) GetMetadata(fileID int64) ([]*models.MetadataEntry, error) {
+	rows, err := r.db.Query(`
+	SELECT key, type, value, updated_at FROM file_metadata
+	WHERE file_id = ?
+	ORDER BY key`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.MetadataEntry
+	for rows.Next() {
+		entry := &models.MetadataEntry{}
+		var value string
+		if err := rows.Scan(&entry.Key, &entry.Type, &value, &entry.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entry.Value = value
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SetMetadata inserts or replaces metadata entries of a file. Values must be strings
+// holding the stored form of their type.
+func (r *FileRepository) SetMetadata(fileID int64, entries []*models.MetadataEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, entry := range entries {
+		_, err := tx.Exec(`
+		INSERT INTO file_metadata (file_id, key, type, value, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (file_id, key) DO UPDATE SET
+			key = excluded.key, type = excluded.type, value = excluded.value, updated_at = excluded.updated_at
+		`, fileID, entry.Key, entry.Type, entry.Value, now)
+		if err != nil {
+			return err
+		}
+		entry.UpdatedAt = now
+	}
+	return tx.Commit()
+}
+
+// DeleteMetadata removes a metadata entry, returning sql.ErrNoRows when the file has none with key
+func (r *FileRepository) DeleteMetadata(fileID int64, key string) error {
+	result, err := r.db.Exec("DELETE FROM file_metadata WHERE file_id = ? AND key = ?", fileID, key)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/database"
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// QuotaRepository stores user and directory quotas. Their usage is kept up to date by
+// FileRepository as files are inserted, moved and deleted.
+type QuotaRepository struct {
+	db          *sql.DB
+	safeQueries *database.SafeQueryBuilder
+}
+
+func NewQuotaRepository(db *sql.DB) *QuotaRepository {
+	return &QuotaRepository{db: db, safeQueries: database.NewSafeQueryBuilder()}
+}
+
+const quotaColumns = `id, subject_type, user_id, path, max_bytes, max_files, used_bytes, used_files, created_at, updated_at`
+
+// SetQuota creates the quota of a user or directory, or replaces its limits. Usage is
+// computed from the files already stored.
+func (r *QuotaRepository) SetQuota(quota *models.Quota) error {
+	usage := `SELECT COALESCE(SUM(size), 0) FROM files WHERE is_directory = 0 AND owner_id = ?`
+	count := `SELECT COUNT(*) FROM files WHERE is_directory = 0 AND owner_id = ?`
+	args := []any{quota.UserID, quota.UserID}
+	if quota.SubjectType == models.QuotaSubjectDirectory {
+		usage = `SELECT COALESCE(SUM(size), 0) FROM files WHERE is_directory = 0 AND path LIKE ? ESCAPE '\'`
+		count = `SELECT COUNT(*) FROM files WHERE is_directory = 0 AND path LIKE ? ESCAPE '\'`
+		pattern := r.safeQueries.BuildSafeLikePattern(quota.Path, "/%")
+		if quota.Path == "/" {
+			pattern = "/%"
+		}
+		args = []any{pattern, pattern}
+	}
+
+	now := time.Now()
+	return r.db.QueryRow(`
+	INSERT INTO quotas (subject_type, user_id, path, max_bytes, max_files, used_bytes, used_files, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, (`+usage+`), (`+count+`), ?, ?)
+	ON CONFLICT(subject_type, user_id, path) DO UPDATE SET
+		max_bytes = excluded.max_bytes, max_files = excluded.max_files,
+		used_bytes = excluded.used_bytes, used_files = excluded.used_files, updated_at = excluded.updated_at
+	RETURNING `+quotaColumns,
+		append(append([]any{quota.SubjectType, quota.UserID, quota.Path, quota.MaxBytes, quota.MaxFiles}, args...), now, now)...,
+	).Scan(quotaFields(quota)...)
+}
+
+func (r *QuotaRepository) ListQuotas() ([]*models.Quota, error) {
+	return r.queryQuotas("SELECT " + quotaColumns + " FROM quotas ORDER BY subject_type, user_id, path")
+}
+
+func (r *QuotaRepository) GetQuota(id int64) (*models.Quota, error) {
+	quota := &models.Quota{}
+	if err := r.db.QueryRow("SELECT "+quotaColumns+" FROM quotas WHERE id = ?", id).Scan(quotaFields(quota)...); err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// QuotasFor returns the quota of a user and the directory quotas set on path or above it,
+// which together limit what can be stored at path
+func (r *QuotaRepository) QuotasFor(path string, userID int64) ([]*models.Quota, error) {
+	return r.queryQuotas(`
+	SELECT `+quotaColumns+` FROM quotas
+	WHERE (subject_type = 'user' AND user_id = ?2 AND ?2 != 0)
+		OR (subject_type = 'directory' AND (path = '/' OR path = ?1 OR SUBSTR(?1, 1, LENGTH(path) + 1) = path || '/'))
+	ORDER BY subject_type DESC, LENGTH(path) ASC
+	`, path, userID)
+}
+
+// DeleteQuota removes a quota. It returns sql.ErrNoRows for unknown quotas.
+func (r *QuotaRepository) DeleteQuota(id int64) error {
+	result, err := r.db.Exec("DELETE FROM quotas WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *QuotaRepository) UserExists(userID int64) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&count)
+	return count > 0, err
+}
+
+// GetUserUsage returns the size and number of the files owned by a user
+func (r *QuotaRepository) GetUserUsage(userID int64) (int64, int64, error) {
+	var size, count int64
+	err := r.db.QueryRow(
+		"SELECT COALESCE(SUM(size), 0), COUNT(*) FROM files WHERE is_directory = 0 AND owner_id = ?", userID,
+	).Scan(&size, &count)
+	return size, count, err
+}
+
+func (r *QuotaRepository) queryQuotas(query string, args ...any) ([]*models.Quota, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotas []*models.Quota
+	for rows.Next() {
+		quota := &models.Quota{}
+		if err := rows.Scan(quotaFields(quota)...); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, rows.Err()
+}
+
+func quotaFields(quota *models.Quota) []any {
+	return []any{&quota.ID, &quota.SubjectType, &quota.UserID, &quota.Path, &quota.MaxBytes, &quota.MaxFiles,
+		&quota.UsedBytes, &quota.UsedFiles, &quota.CreatedAt, &quota.UpdatedAt}
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// SearchIndexed reports whether searches use the FTS5 index rather than LIKE queries
+func (r *FileRepository) SearchIndexed() bool {
+	return r.searchIndex
+}
+
+// SearchFiles returns the files and directories matching filter, best matches first.
+// Through the FTS5 index every term of the query must be a prefix of a word of the name or
+// path, and matches in the name rank above matches in the path. Without the index every
+// term must be a substring of the name or path, and names starting with the first term
+// come first. The tags of filter must be distinct regardless of case.
+func (r *FileRepository) SearchFiles(filter *models.SearchFilter, limit, offset int) ([]*models.FileInfo, error) {
+	terms := strings.Fields(filter.Query)
+	from := "files f"
+	var conditions []string
+	var args []any
+	var order []string
+	var orderArgs []any
+
+	if r.searchIndex && len(terms) > 0 {
+		from = "files_fts JOIN files f ON f.id = files_fts.rowid"
+		conditions = append(conditions, "files_fts MATCH ?")
+		args = append(args, ftsQuery(terms))
+		order = append(order, "bm25(files_fts, 10.0, 1.0)")
+	} else if len(terms) > 0 {
+		for _, term := range terms {
+			pattern := "%" + r.safeQueries.EscapeLikePattern(term) + "%"
+			conditions = append(conditions, `(f.name LIKE ? ESCAPE '\' OR f.path LIKE ? ESCAPE '\')`)
+			args = append(args, pattern, pattern)
+		}
+		order = append(order, `CASE WHEN f.name LIKE ? ESCAPE '\' THEN 0 ELSE 1 END`)
+		orderArgs = append(orderArgs, r.safeQueries.EscapeLikePattern(terms[0])+"%")
+	}
+
+	if filter.Scope != "" && filter.Scope != "/" {
+		conditions = append(conditions, `f.path LIKE ? ESCAPE '\'`)
+		args = append(args, r.safeQueries.BuildSafeLikePattern(filter.Scope, "/%"))
+	}
+	if strings.HasSuffix(filter.MimeType, "/") {
+		conditions = append(conditions, `f.mime_type LIKE ? ESCAPE '\'`)
+		args = append(args, r.safeQueries.BuildSafeLikePattern(filter.MimeType, "%"))
+	} else if filter.MimeType != "" {
+		conditions = append(conditions, "f.mime_type = ?")
+		args = append(args, filter.MimeType)
+	}
+	if filter.MinSize != nil {
+		conditions = append(conditions, "f.size >= ?")
+		args = append(args, *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		conditions = append(conditions, "f.size <= ?")
+		args = append(args, *filter.MaxSize)
+	}
+	if len(filter.Tags) > 0 {
+		conditions = append(conditions, `f.id IN (
+			SELECT file_id FROM file_tags WHERE tag IN (?`+strings.Repeat(", ?", len(filter.Tags)-1)+`)
+			GROUP BY file_id HAVING COUNT(*) = ?)`)
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(filter.Tags))
+	}
+	// Times are compared as julian days, since they are stored with the offset of the server
+	if !filter.ModifiedAfter.IsZero() {
+		conditions = append(conditions, "julianday(f.updated_at) >= julianday(?)")
+		args = append(args, filter.ModifiedAfter)
+	}
+	if !filter.ModifiedBefore.IsZero() {
+		conditions = append(conditions, "julianday(f.updated_at) < julianday(?)")
+		args = append(args, filter.ModifiedBefore)
+	}
+
+	query := `SELECT f.id, f.name, f.path, f.size, f.mime_type, f.is_directory, f.parent_path,
+		f.checksum, f.blob_ref, f.owner_id, f.created_at, f.updated_at
+	FROM ` + from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	order = append(order, "f.name COLLATE NOCASE", "f.path")
+	query += " ORDER BY " + strings.Join(order, ", ") + " LIMIT ? OFFSET ?"
+	args = append(append(args, orderArgs...), limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.FileInfo
+	for rows.Next() {
+		file := &models.FileInfo{}
+		err := rows.Scan(
+			&file.ID, &file.Name, &file.Path, &file.Size,
+			&file.MimeType, &file.IsDirectory, &file.ParentPath,
+			&file.Checksum, &file.BlobRef, &file.OwnerID, &file.CreatedAt, &file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// ftsQuery builds an FTS5 query requiring every term as a prefix. Terms are quoted, so
+// the query syntax of FTS5 is never interpreted, and a term such as "report.pdf" becomes
+// the phrase of its words.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// ShareRepository stores public share links. FileRepository keeps their paths up to date
+// as files are moved and revokes them when the shared files are deleted.
+type ShareRepository struct {
+	db *sql.DB
+}
+
+func NewShareRepository(db *sql.DB) *ShareRepository {
+	return &ShareRepository{db: db}
+}
+
+const shareColumns = `id, token_hash, token_prefix, path, created_by, password_hash, mode,
+	max_downloads, download_count, expires_at, created_at`
+
+func (r *ShareRepository) CreateShare(share *models.Share) error {
+	share.CreatedAt = time.Now().UTC()
+
+	var expiresAt sql.NullTime
+	if share.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: share.ExpiresAt.UTC(), Valid: true}
+	}
+
+	result, err := r.db.Exec(`
+	INSERT INTO shares (token_hash, token_prefix, path, created_by, password_hash, mode, max_downloads, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, share.TokenHash, share.TokenPrefix, share.Path, share.CreatedBy, share.PasswordHash, share.Mode,
+		share.MaxDownloads, expiresAt, share.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	share.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListShares returns the shares created by a user, or every share when userID is 0
+func (r *ShareRepository) ListShares(userID int64) ([]*models.Share, error) {
+	query := "SELECT " + shareColumns + " FROM shares"
+	var args []any
+	if userID != 0 {
+		query += " WHERE created_by = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*models.Share
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (r *ShareRepository) GetShare(id int64) (*models.Share, error) {
+	return scanShare(r.db.QueryRow("SELECT "+shareColumns+" FROM shares WHERE id = ?", id))
+}
+
+// GetShareByToken returns a share by the hash of its token. Expiry is left to the caller.
+func (r *ShareRepository) GetShareByToken(tokenHash string) (*models.Share, error) {
+	return scanShare(r.db.QueryRow("SELECT "+shareColumns+" FROM shares WHERE token_hash = ?", tokenHash))
+}
+
+// RecordDownload counts a download of a share and reports whether its download limit
+// still allowed one. Concurrent downloads cannot exceed the limit.
+func (r *ShareRepository) RecordDownload(id int64) (bool, error) {
+	result, err := r.db.Exec(`
+	UPDATE shares SET download_count = download_count + 1
+	WHERE id = ? AND (max_downloads = 0 OR download_count < max_downloads)
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// DeleteShare revokes a share. It returns sql.ErrNoRows for unknown shares.
+func (r *ShareRepository) DeleteShare(id int64) error {
+	result, err := r.db.Exec("DELETE FROM shares WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanShare(row rowScanner) (*models.Share, error) {
+	share := &models.Share{}
+	var expiresAt sql.NullTime
+
+	err := row.Scan(&share.ID, &share.TokenHash, &share.TokenPrefix, &share.Path, &share.CreatedBy,
+		&share.PasswordHash, &share.Mode, &share.MaxDownloads, &share.DownloadCount, &expiresAt, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	share.HasPassword = share.PasswordHash != ""
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	return share, nil
+}
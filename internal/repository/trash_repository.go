@@ -0,0 +1,370 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// ErrPathExists is returned when a trashed item cannot be restored because its original path is taken
+var ErrPathExists = errors.New("path already exists")
+
+const trashItemColumns = `id, path, name, is_directory, size, file_count, deleted_by, deleted_at`
+
+const trashEntryColumns = `path, is_directory, size, mime_type, checksum, blob_ref, owner_id, created_at, updated_at`
+
+// MoveToTrash removes a file or directory and keeps it as a trash item. entries holds the
+// file or directory itself followed by everything below it, as GetFilesUnderPath returns
+// them. archived maps the ids of files stored verbatim to the blob their content was
+// copied to, files already stored as blobs pass their reference on to the trash. The ACL
+// entries, versions, tags and metadata of the removed paths are kept with the item, while
+// their shares and directory quotas are deleted.
+func (r *FileRepository) MoveToTrash(entries []*models.FileInfo, archived map[int64]string, deletedBy int64) (*models.TrashItem, error) {
+	root := entries[0]
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.releaseQuotaUsageUnder(tx, root.Path); err != nil {
+		return nil, err
+	}
+	if err := r.deleteSharesUnder(tx, root.Path); err != nil {
+		return nil, err
+	}
+
+	item := &models.TrashItem{
+		Path:        root.Path,
+		Name:        root.Name,
+		IsDirectory: root.IsDirectory,
+		DeletedBy:   deletedBy,
+		DeletedAt:   time.Now().UTC(),
+	}
+	for _, entry := range entries {
+		if !entry.IsDirectory {
+			item.Size += entry.Size
+			item.FileCount++
+		}
+	}
+
+	err = tx.QueryRow(`
+	INSERT INTO trash_items (path, name, is_directory, size, file_count, deleted_by, deleted_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`, item.Path, item.Name, item.IsDirectory, item.Size, item.FileCount, item.DeletedBy, item.DeletedAt).Scan(&item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tags and metadata go with the files, so they are kept before the files are deleted
+	if err := r.keepInTrash(tx, item.ID, root.Path); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		ref := entry.BlobRef
+		if !entry.IsDirectory && ref == "" {
+			ref = archived[entry.ID]
+			if err := r.retainBlob(tx, ref, entry.Size); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO trash_entries (item_id, `+trashEntryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, item.ID, entry.Path, entry.IsDirectory, entry.Size, entry.MimeType, entry.Checksum, ref,
+			entry.OwnerID, entry.CreatedAt, entry.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		// Only the content that was copied may be removed
+		result, err := tx.Exec(`
+		DELETE FROM files WHERE id = ? AND size = ? AND checksum = ? AND blob_ref = ?
+		`, entry.ID, entry.Size, entry.Checksum, entry.BlobRef)
+		if err != nil {
+			return nil, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return nil, ErrFileChanged
+		}
+	}
+
+	// Files added below a directory while it was being copied would be lost with it
+	var remaining int
+	pattern := r.safeQueries.BuildSafeLikePattern(root.Path, "/%")
+	if err := tx.QueryRow("SELECT COUNT(*) FROM files WHERE path LIKE ? ESCAPE '\\'", pattern).Scan(&remaining); err != nil {
+		return nil, err
+	}
+	if remaining > 0 {
+		return nil, ErrFileChanged
+	}
+
+	return item, tx.Commit()
+}
+
+// keepInTrash moves the ACL entries, versions, tags and metadata of path and of everything
+// below it to the trash item itemID. The versions pass their blob references on to the item.
+func (r *FileRepository) keepInTrash(tx *sql.Tx, itemID int64, path string) error {
+	pattern := r.safeQueries.BuildSafeLikePattern(path, "/%")
+	statements := []string{
+		`INSERT INTO trash_acl_entries (item_id, path, subject_type, subject_id, permissions, created_at)
+		SELECT ?1, path, subject_type, subject_id, permissions, created_at FROM acl_entries
+		WHERE path = ?2 OR path LIKE ?3 ESCAPE '\'`,
+		`DELETE FROM acl_entries WHERE path = ?2 OR path LIKE ?3 ESCAPE '\'`,
+		`INSERT INTO trash_versions (item_id, path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at)
+		SELECT ?1, path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at FROM file_versions
+		WHERE path = ?2 OR path LIKE ?3 ESCAPE '\'`,
+		`DELETE FROM file_versions WHERE path = ?2 OR path LIKE ?3 ESCAPE '\'`,
+		`INSERT INTO trash_tags (item_id, path, tag)
+		SELECT ?1, f.path, t.tag FROM file_tags t JOIN files f ON f.id = t.file_id
+		WHERE f.path = ?2 OR f.path LIKE ?3 ESCAPE '\'`,
+		`INSERT INTO trash_metadata (item_id, path, key, type, value, updated_at)
+		SELECT ?1, f.path, m.key, m.type, m.value, m.updated_at FROM file_metadata m JOIN files f ON f.id = m.file_id
+		WHERE f.path = ?2 OR f.path LIKE ?3 ESCAPE '\'`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, itemID, path, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTrashKept puts back the ACL entries, versions, tags and metadata kept with the
+// trash item itemID, once its files are recorded again
+func (r *FileRepository) restoreTrashKept(tx *sql.Tx, itemID int64) error {
+	statements := []string{
+		// Entries granted on the path while the item was in the trash take precedence
+		`INSERT OR IGNORE INTO acl_entries (path, subject_type, subject_id, permissions, created_at)
+		SELECT path, subject_type, subject_id, permissions, created_at FROM trash_acl_entries WHERE item_id = ?`,
+		`INSERT INTO file_versions (path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at)
+		SELECT path, version, size, checksum, blob_ref, mime_type, author_id, modified_at, created_at FROM trash_versions
+		WHERE item_id = ?`,
+		`INSERT OR IGNORE INTO file_tags (file_id, tag)
+		SELECT f.id, t.tag FROM trash_tags t JOIN files f ON f.path = t.path WHERE t.item_id = ?`,
+		`INSERT OR IGNORE INTO file_metadata (file_id, key, type, value, updated_at)
+		SELECT f.id, m.key, m.type, m.value, m.updated_at FROM trash_metadata m JOIN files f ON f.path = m.path
+		WHERE m.item_id = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, itemID); err != nil {
+			return err
+		}
+	}
+	return r.deleteTrashKept(tx, itemID)
+}
+
+// deleteTrashKept deletes what was kept with the trash item itemID besides its entries
+func (r *FileRepository) deleteTrashKept(tx *sql.Tx, itemID int64) error {
+	for _, table := range []string{"trash_acl_entries", "trash_versions", "trash_tags", "trash_metadata"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE item_id = ?", itemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTrash returns the trash items deleted by a user, or every item when userID is 0, newest first
+func (r *FileRepository) ListTrash(userID int64) ([]*models.TrashItem, error) {
+	query := "SELECT " + trashItemColumns + " FROM trash_items"
+	var args []any
+	if userID != 0 {
+		query += " WHERE deleted_by = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY deleted_at DESC, id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *FileRepository) GetTrashItem(id int64) (*models.TrashItem, error) {
+	return scanTrashItem(r.db.QueryRow("SELECT "+trashItemColumns+" FROM trash_items WHERE id = ?", id))
+}
+
+// GetTrashEntries returns the files and directories of a trash item, parents before their children
+func (r *FileRepository) GetTrashEntries(itemID int64) ([]*models.FileInfo, error) {
+	rows, err := r.db.Query("SELECT "+trashEntryColumns+" FROM trash_entries WHERE item_id = ? ORDER BY path ASC", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.FileInfo
+	for rows.Next() {
+		entry := &models.FileInfo{}
+		var createdAt, updatedAt sql.NullTime
+		err := rows.Scan(&entry.Path, &entry.IsDirectory, &entry.Size, &entry.MimeType, &entry.Checksum,
+			&entry.BlobRef, &entry.OwnerID, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Name = path.Base(entry.Path)
+		entry.ParentPath = path.Dir(entry.Path)
+		entry.CreatedAt = createdAt.Time
+		entry.UpdatedAt = updatedAt.Time
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RestoreFromTrash records the entries of a trash item, as GetTrashEntries returns them, at
+// their original paths again, with the ACL entries, versions, tags and metadata kept along,
+// and removes the item. The parent of the item must exist. Restored files and versions
+// reference the blobs their content was kept in.
+func (r *FileRepository) RestoreFromTrash(itemID int64, entries []*models.FileInfo) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM files WHERE path = ?)", entry.Path).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrPathExists
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO files (name, path, size, mime_type, is_directory, parent_path, checksum, blob_ref, owner_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, entry.Name, entry.Path, entry.Size, entry.MimeType, entry.IsDirectory, entry.ParentPath,
+			entry.Checksum, entry.BlobRef, entry.OwnerID, entry.CreatedAt, entry.UpdatedAt); err != nil {
+			return err
+		}
+
+		if !entry.IsDirectory {
+			if err := r.addQuotaUsage(tx, entry.Path, entry.OwnerID, entry.Size, 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.restoreTrashKept(tx, itemID); err != nil {
+		return err
+	}
+
+	// The blob references now belong to the restored files
+	if _, err := tx.Exec("DELETE FROM trash_entries WHERE item_id = ?", itemID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM trash_items WHERE id = ?", itemID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// PurgeTrashItem deletes a trash item for good. Its blobs are left to garbage collection.
+func (r *FileRepository) PurgeTrashItem(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	purged, err := r.purgeTrashItem(tx, id)
+	if err != nil {
+		return err
+	}
+	if !purged {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// PurgeTrashBefore deletes the trash items deleted before cutoff and returns how many there were
+func (r *FileRepository) PurgeTrashBefore(cutoff time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM trash_items WHERE deleted_at < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if _, err := r.purgeTrashItem(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), tx.Commit()
+}
+
+// purgeTrashItem deletes a trash item with its entries and versions and releases their blobs
+func (r *FileRepository) purgeTrashItem(tx *sql.Tx, id int64) (bool, error) {
+	for _, table := range []string{"trash_entries", "trash_versions"} {
+		if _, err := tx.Exec(`
+		UPDATE blobs SET ref_count = ref_count - (
+			SELECT COUNT(*) FROM `+table+` e WHERE e.blob_ref = blobs.checksum AND e.item_id = ?1
+		)
+		WHERE checksum IN (SELECT blob_ref FROM `+table+` WHERE item_id = ?1)
+		`, id); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.deleteTrashKept(tx, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM trash_entries WHERE item_id = ?", id); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec("DELETE FROM trash_items WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+func scanTrashItem(row rowScanner) (*models.TrashItem, error) {
+	item := &models.TrashItem{}
+	err := row.Scan(&item.ID, &item.Path, &item.Name, &item.IsDirectory, &item.Size, &item.FileCount,
+		&item.DeletedBy, &item.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
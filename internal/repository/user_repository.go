@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// UserRepository stores users and their sessions in the database opened by a FileRepository
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+func (r *UserRepository) CreateUser(user *models.User) error {
+	now := time.Now()
+	result, err := r.db.Exec(`
+	INSERT INTO users (username, password_hash, is_admin, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	`, user.Username, user.PasswordHash, user.IsAdmin, now, now)
+	if err != nil {
+		return err
+	}
+
+	user.ID, err = result.LastInsertId()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return err
+}
+
+func (r *UserRepository) GetUserByUsername(username string) (*models.User, error) {
+	return r.scanUser(r.db.QueryRow(`
+	SELECT id, username, password_hash, is_admin, created_at, updated_at
+	FROM users WHERE username = ?
+	`, username))
+}
+
+func (r *UserRepository) GetUserByID(id int64) (*models.User, error) {
+	return r.scanUser(r.db.QueryRow(`
+	SELECT id, username, password_hash, is_admin, created_at, updated_at
+	FROM users WHERE id = ?
+	`, id))
+}
+
+func (r *UserRepository) ListUsers() ([]*models.User, error) {
+	rows, err := r.db.Query(`
+	SELECT id, username, password_hash, is_admin, created_at, updated_at
+	FROM users ORDER BY LOWER(username) ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := r.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// UpdatePassword replaces the password hash of a user and ends every session of the user
+// but the one whose token hashes to keepTokenHash, so a stolen session does not outlive
+// the password it was signed in with
+func (r *UserRepository) UpdatePassword(id int64, passwordHash, keepTokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+		passwordHash, time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ? AND token_hash != ?", id, keepTokenHash); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) CountUsers() (int64, error) {
+	var count int64
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+// DeleteUser removes a user together with its sessions, API keys, group memberships, ACL entries and quota. It returns sql.ErrNoRows for unknown users.
+func (r *UserRepository) DeleteUser(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced on every connection, so credentials are removed explicitly
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM api_keys WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM acl_entries WHERE subject_type = 'user' AND subject_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM quotas WHERE subject_type = 'user' AND user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM shares WHERE created_by = ?", id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) CreateSession(session *models.Session) error {
+	_, err := r.db.Exec(`
+	INSERT INTO sessions (token_hash, user_id, created_at, expires_at)
+	VALUES (?, ?, ?, ?)
+	`, session.TokenHash, session.UserID, session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+	return err
+}
+
+// GetSessionUser returns an unexpired session and its user. Session times are stored
+// in UTC so that they compare correctly as text.
+func (r *UserRepository) GetSessionUser(tokenHash string, now time.Time) (*models.Session, *models.User, error) {
+	session := &models.Session{}
+	user := &models.User{}
+
+	err := r.db.QueryRow(`
+	SELECT s.token_hash, s.user_id, s.created_at, s.expires_at,
+		u.id, u.username, u.password_hash, u.is_admin, u.created_at, u.updated_at
+	FROM sessions s JOIN users u ON u.id = s.user_id
+	WHERE s.token_hash = ? AND s.expires_at > ?
+	`, tokenHash, now.UTC()).Scan(
+		&session.TokenHash, &session.UserID, &session.CreatedAt, &session.ExpiresAt,
+		&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, user, nil
+}
+
+func (r *UserRepository) DeleteSession(tokenHash string) error {
+	_, err := r.db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions that expired before now and returns how many were removed
+func (r *UserRepository) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *UserRepository) scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,54 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPassword_RoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+
+	ok, err := VerifyPassword("correct horse battery staple", hash)
+	if err != nil || !ok {
+		t.Errorf("Expected the password to verify, got %v, %v", ok, err)
+	}
+
+	ok, err = VerifyPassword("wrong password", hash)
+	if err != nil || ok {
+		t.Errorf("Expected a wrong password to be rejected, got %v, %v", ok, err)
+	}
+}
+
+func TestHashPassword_UsesRandomSalt(t *testing.T) {
+	first, _ := HashPassword("secret-password")
+	second, _ := HashPassword("secret-password")
+
+	if first == second {
+		t.Error("Expected hashes of the same password to differ")
+	}
+}
+
+func TestVerifyPassword_InvalidHash(t *testing.T) {
+	invalid := []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA",
+		"$argon2id$v=18$m=65536,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$!!!$aGFzaA",
+	}
+
+	for _, hash := range invalid {
+		if _, err := VerifyPassword("password", hash); err != ErrInvalidPasswordHash {
+			t.Errorf("VerifyPassword(%q): expected ErrInvalidPasswordHash, got %v", hash, err)
+		}
+	}
+}
@@ -13,24 +13,75 @@ var (
 	ErrEmptyPath         = errors.New("path cannot be empty")
 	ErrPathTooLong       = errors.New("path exceeds maximum length")
 	ErrInvalidCharacters = errors.New("path contains invalid characters")
+	ErrReservedName      = errors.New("names starting with " + ReservedNamePrefix + " are reserved")
 )
 
 const (
 	MaxPathLength = 4096
+
+	// ReservedNamePrefix starts the names of the directories cloudlet keeps inside the
+	// storage tree, such as the blob store and the staging directory
+	ReservedNamePrefix = ".cloudlet-"
 )
 
 // PathValidator provides secure path validation to prevent directory traversal attacks
 type PathValidator struct {
 	basePath string
+	// root is the virtual directory validated paths are confined to, "/" for the whole tree
+	root string
+	// internal allows paths through the reserved directories, for storage backends
+	internal bool
 }
 
-// NewPathValidator creates a new path validator with the given base path
+// NewPathValidator creates a new path validator with the given base path. It rejects
+// paths through reserved names, so clients cannot reach the internal directories.
 func NewPathValidator(basePath string) *PathValidator {
 	return &PathValidator{
 		basePath: filepath.Clean(basePath),
+		root:     "/",
+	}
+}
+
+// AllowingReservedNames returns a validator that lets paths through reserved names, for
+// code that stores the internal directories itself
+func (pv *PathValidator) AllowingReservedNames() *PathValidator {
+	return &PathValidator{
+		basePath: pv.basePath,
+		root:     pv.root,
+		internal: true,
+	}
+}
+
+// WithRoot returns a validator that treats root as "/". Every path it returns lies inside
+// root, so clients confined to it can never name anything outside. A root of "/" lifts the confinement.
+func (pv *PathValidator) WithRoot(root string) *PathValidator {
+	return &PathValidator{
+		basePath: pv.basePath,
+		root:     pv.normalizePath(root),
+		internal: pv.internal,
 	}
 }
 
+// Root returns the virtual directory paths are confined to
+func (pv *PathValidator) Root() string {
+	return pv.root
+}
+
+// ToVirtual maps a path returned by ValidateAndNormalizePath back to the path the client
+// sees. It reports false for paths outside the root.
+func (pv *PathValidator) ToVirtual(path string) (string, bool) {
+	if pv.root == "/" {
+		return path, true
+	}
+	if path == pv.root {
+		return "/", true
+	}
+	if rest, found := strings.CutPrefix(path, pv.root+"/"); found {
+		return "/" + rest, true
+	}
+	return "", false
+}
+
 // ValidateAndNormalizePath validates and normalizes a path to prevent directory traversal
 // This is the main function that should be used for all path validation
 func (pv *PathValidator) ValidateAndNormalizePath(inputPath string) (string, error) {
@@ -57,6 +108,23 @@ func (pv *PathValidator) ValidateAndNormalizePath(inputPath string) (string, err
 		return "", err
 	}
 
+	// Step 6: Keep clients out of the internal directories
+	if !pv.internal {
+		for _, component := range strings.Split(normalized, "/") {
+			if IsReservedName(component) {
+				return "", ErrReservedName
+			}
+		}
+	}
+
+	// Step 7: Place the path below the root. It cannot climb out, traversal was rejected above.
+	if pv.root != "/" {
+		if normalized == "/" {
+			return pv.root, nil
+		}
+		return pv.root + normalized, nil
+	}
+
 	return normalized, nil
 }
 
@@ -276,9 +344,19 @@ func IsValidFilename(filename string) error {
 		return ErrInvalidCharacters
 	}
 
+	if IsReservedName(filename) {
+		return ErrReservedName
+	}
+
 	return nil
 }
 
+// IsReservedName reports whether a file name is kept for the internal directories. Names
+// are compared ignoring case, as some file systems do.
+func IsReservedName(name string) bool {
+	return len(name) >= len(ReservedNamePrefix) && strings.EqualFold(name[:len(ReservedNamePrefix)], ReservedNamePrefix)
+}
+
 // SanitizePath removes or replaces dangerous characters from a path
 func SanitizePath(path string) string {
 	// Replace dangerous characters
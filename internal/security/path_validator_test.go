@@ -1,6 +1,7 @@
 package security
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -564,4 +565,70 @@ func TestLegitimatePathsStillWork(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPathValidator_WithRoot(t *testing.T) {
+	validator := NewPathValidator(t.TempDir()).WithRoot("/home/alice")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/", "/home/alice"},
+		{"/docs/report.pdf", "/home/alice/docs/report.pdf"},
+		{"docs", "/home/alice/docs"},
+		{"/home/bob", "/home/alice/home/bob"},
+	}
+
+	for _, tt := range tests {
+		got, err := validator.ValidateAndNormalizePath(tt.input)
+		if err != nil {
+			t.Errorf("ValidateAndNormalizePath(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ValidateAndNormalizePath(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+
+		virtual, inside := validator.ToVirtual(got)
+		if !inside || virtual != validator.normalizePath(tt.input) {
+			t.Errorf("ToVirtual(%q) = %q, %v", got, virtual, inside)
+		}
+	}
+
+	for _, escape := range []string{"/../bob", "/docs/../../bob", "..", "/%2e%2e/bob"} {
+		if _, err := validator.ValidateAndNormalizePath(escape); err == nil {
+			t.Errorf("Expected %q to be rejected", escape)
+		}
+	}
+
+	if _, inside := validator.ToVirtual("/home/alicia/file"); inside {
+		t.Error("Expected a sibling directory sharing the prefix to be outside the root")
+	}
+	if root := validator.WithRoot("/").Root(); root != "/" {
+		t.Errorf("Expected WithRoot(\"/\") to lift the confinement, got root %q", root)
+	}
+}
+
+func TestPathValidator_ReservedNames(t *testing.T) {
+	validator := NewPathValidator(t.TempDir())
+
+	for _, reserved := range []string{"/.cloudlet-blobs", "/docs/.cloudlet-tmp/x", ".CLOUDLET-BLOBS"} {
+		if _, err := validator.ValidateAndNormalizePath(reserved); !errors.Is(err, ErrReservedName) {
+			t.Errorf("Expected %q to be reserved, got %v", reserved, err)
+		}
+		if _, err := validator.WithRoot("/home/alice").ValidateAndNormalizePath(reserved); !errors.Is(err, ErrReservedName) {
+			t.Errorf("Expected %q to be reserved below a root, got %v", reserved, err)
+		}
+	}
+	if err := IsValidFilename(".cloudlet-blobs"); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Expected the blob store name to be an invalid file name, got %v", err)
+	}
+
+	if _, err := validator.ValidateAndNormalizePath("/.cloudlet"); err != nil {
+		t.Errorf("Expected names only sharing part of the prefix to be allowed, got %v", err)
+	}
+	if _, err := validator.AllowingReservedNames().ValidateAndNormalizePath("/.cloudlet-blobs/ab/abcd"); err != nil {
+		t.Errorf("Expected storage backends to reach the blob store, got %v", err)
+	}
+}
@@ -1,15 +1,67 @@
 package server
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/handlers"
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/metrics"
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/ratelimit"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/tracing"
+	"github.com/anddsdev/cloudlet/internal/utils"
+	"github.com/google/uuid"
 )
 
+// RequestIDHeader carries the ID of a request, taken from the client when it sends a valid one
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// requestID tags the request with an ID, echoed in the response and added to every
+// log line written while serving it
+func (r *Router) requestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next(w, req.WithContext(logging.WithRequest(req.Context(), id)))
+	}
+}
+
+// validRequestID accepts IDs short enough to log, made of characters that cannot forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *Router) recovery(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				logging.FromContext(req.Context()).Error("Handler panicked",
+					"method", req.Method, "path", req.URL.Path, "panic", err, "stack", string(debug.Stack()))
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 		}()
@@ -18,14 +70,38 @@ func (r *Router) recovery(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// cors allows the configured origins to call the API. Credentials are only allowed for
+// origins listed explicitly, since browsers reject them together with a wildcard.
 func (r *Router) cors(next http.HandlerFunc) http.HandlerFunc {
+	allowedOrigins := r.server.Config().Server.AllowedOrigins
+
 	return func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Accept")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		origin := req.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
 
-		if req.Method == "OPTIONS" {
+		allowed := true
+		switch {
+		case origin != "" && slices.Contains(allowedOrigins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		case slices.Contains(allowedOrigins, "*"):
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		default:
+			allowed = false
+		}
+
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, HEAD, OPTIONS, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Accept, "+
+				"Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum, X-HTTP-Method-Override, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, "+
+				"Tus-Max-Size, Tus-Checksum-Algorithm, Upload-Length, Upload-Offset, Upload-Metadata, Repr-Digest, X-Request-ID, "+
+				"Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy")
+		}
+
+		// Only CORS preflights are answered here; plain OPTIONS requests reach
+		// the handler so tus clients can discover the server capabilities
+		if req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != "" {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -33,11 +109,284 @@ func (r *Router) cors(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// apiKeyAuth authenticates requests carrying an API key as bearer token and rejects them
+// when the key lacks the scope the request needs. Other requests are left to authenticate.
+func (r *Router) apiKeyAuth(next http.HandlerFunc) http.HandlerFunc {
+	authService := r.server.AuthService()
+	if authService == nil || !r.server.Config().Auth.Enabled {
+		return next
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := handlers.SessionToken(req)
+		if !strings.HasPrefix(token, services.APIKeyTokenPrefix) {
+			next(w, req)
+			return
+		}
+
+		key, user, err := authService.AuthenticateAPIKey(token)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cloudlet", error="invalid_token"`)
+				utils.WriteErrorJSON(w, http.StatusUnauthorized, err.Error())
+			} else {
+				utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to check API key")
+			}
+			return
+		}
+
+		if scope := requiredScope(req); !services.HasScope(key, scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cloudlet", error="insufficient_scope", scope="`+scope+`"`)
+			utils.WriteErrorJSON(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+			return
+		}
+
+		ctx := services.ContextWithUser(req.Context(), user)
+		next(w, req.WithContext(services.ContextWithAPIKey(ctx, key)))
+	}
+}
+
+// requiredScope maps a request to the API key scope it needs. Cancelling an upload only
+// discards data that was never stored, so it counts as writing rather than deleting.
+func requiredScope(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return models.ScopeRead
+	case http.MethodDelete:
+		if strings.HasPrefix(req.URL.Path, "/api/v1/upload/") || strings.HasPrefix(req.URL.Path, "/api/v1/tus/") {
+			return models.ScopeWrite
+		}
+		return models.ScopeDelete
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// authenticate rejects requests without a valid session when authentication is enabled,
+// and makes the signed-in user available to handlers through the request context
+func (r *Router) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	authService := r.server.AuthService()
+	if authService == nil || !r.server.Config().Auth.Enabled {
+		return next
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		// Already authenticated with an API key
+		if services.UserFromContext(req.Context()) != nil {
+			next(w, req)
+			return
+		}
+
+		user, err := authService.Authenticate(handlers.SessionToken(req))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidSession) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cloudlet"`)
+				utils.WriteErrorJSON(w, http.StatusUnauthorized, "Authentication required")
+			} else {
+				utils.WriteErrorJSON(w, http.StatusInternalServerError, "Failed to check session")
+			}
+			return
+		}
+
+		next(w, req.WithContext(services.ContextWithUser(req.Context(), user)))
+	}
+}
+
+// rateLimits are the budgets each client spends per minute: requests to any route, and
+// bytes and files sent to the upload routes
+type rateLimits struct {
+	requests          *ratelimit.Limiter
+	uploadBytes       *ratelimit.Limiter
+	uploadFiles       *ratelimit.Limiter
+	trustProxyHeaders bool
+	// authEnabled means anonymous uploads are only let through by their handler, as uploads to a share are
+	authEnabled bool
+}
+
+// newRateLimits returns the budgets set in cfg, or nil when rate limiting is disabled
+func newRateLimits(cfg *config.Config) *rateLimits {
+	if !cfg.RateLimit.Enabled {
+		return nil
+	}
+
+	maxClients := cfg.RateLimit.MaxClients
+	return &rateLimits{
+		requests:          ratelimit.New(cfg.RateLimit.RequestsPerMinute, time.Minute, maxClients),
+		uploadBytes:       ratelimit.New(cfg.RateLimit.UploadBytesPerMinute, time.Minute, maxClients),
+		uploadFiles:       ratelimit.New(int64(cfg.Server.Upload.RateLimitPerMinute), time.Minute, maxClients),
+		trustProxyHeaders: cfg.RateLimit.TrustProxyHeaders,
+		authEnabled:       cfg.Auth.Enabled,
+	}
+}
+
+// rateLimit answers 429 once the client of a request spent its budget of requests, or of
+// bytes on the upload routes, and hands its budget of files to the upload handlers, which
+// only learn how many files a request holds once they read its body. Bytes of anonymous
+// uploads are left to their handler to take once it authorized them, so requests failing
+// to authenticate do not spend the budget of everyone sharing their address.
+func (r *Router) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	limits := r.limits
+	if limits == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		client := limits.clientKey(req)
+
+		result := limits.requests.Take(client, 1)
+		ratelimit.SetHeaders(w.Header(), result)
+		if !result.Allowed {
+			tooManyRequests(w, metrics.RateLimitRequests, result)
+			return
+		}
+
+		if isUploadRequest(req) {
+			bytes := limits.uploadBytes.Budget(client)
+			if limits.authEnabled && services.UserFromContext(req.Context()) == nil {
+				req = req.WithContext(ratelimit.ContextWithUploadBytes(req.Context(), bytes))
+			} else if result := bytes.TakeBody(req); !result.Allowed {
+				ratelimit.SetHeaders(w.Header(), result)
+				tooManyRequests(w, metrics.RateLimitUploadBytes, result)
+				return
+			}
+
+			req = req.WithContext(ratelimit.ContextWithUploadFiles(req.Context(), limits.uploadFiles.Budget(client)))
+		}
+
+		next(w, req)
+	}
+}
+
+// clientKey identifies the client of a request by its API key or user when authenticated,
+// and otherwise by the address it connects from, or the one its proxy forwards
+func (l *rateLimits) clientKey(req *http.Request) string {
+	if key := services.APIKeyFromContext(req.Context()); key != nil {
+		return fmt.Sprintf("key:%d", key.ID)
+	}
+	if user := services.UserFromContext(req.Context()); user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	if l.trustProxyHeaders {
+		// The last address was added by the proxy, the ones before come from the client
+		if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			addresses := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(addresses[len(addresses)-1]); ip != "" {
+				return "ip:" + ip
+			}
+		}
+		if ip := req.Header.Get("X-Real-IP"); ip != "" {
+			return "ip:" + ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// isUploadRequest tells requests sending file contents, which spend the upload budgets
+func isUploadRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return false
+	}
+	path := req.URL.Path
+	return strings.HasPrefix(path, "/api/v1/upload") || strings.HasPrefix(path, "/api/v1/tus") ||
+		strings.HasPrefix(path, "/s/")
+}
+
+// tooManyRequests answers a request denied because its client spent budget, or with 413
+// when it asked more than the whole budget
+func tooManyRequests(w http.ResponseWriter, budget string, result ratelimit.Result) {
+	metrics.RateLimitedRequests.WithLabelValues(budget).Inc()
+	if result.TooLarge {
+		utils.WriteErrorJSON(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"Request exceeds the rate limit of %d %s per minute", result.Limit, strings.ReplaceAll(budget, "_", " ")))
+		return
+	}
+	utils.WriteErrorJSON(w, http.StatusTooManyRequests, fmt.Sprintf(
+		"Rate limit exceeded: %d %s per minute, retry in %s",
+		result.Limit, strings.ReplaceAll(budget, "_", " "), result.RetryAfter.Round(time.Second)))
+}
+
+// instrument counts and times requests in the HTTP metrics. Requests are labelled with the
+// pattern of the route that served them rather than their path, to keep the series bounded.
+func (r *Router) instrument(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(ww, req)
+
+		route := requestRoute(req)
+		method := metricsMethod(req.Method)
+		status := strconv.Itoa(ww.statusCode)
+		metrics.HTTPRequests.WithLabelValues(route, method, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsMethod returns the method of a request as metrics label. Routes without a method,
+// such as the web UI, accept any, so unknown methods share one label.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 }
 
+// trace records a server span for every request, continuing the trace of the client when it
+// sends a W3C traceparent header, and tags the log lines of the request with the trace ID
+func (r *Router) trace(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		route := requestRoute(req)
+		ctx, span := tracing.StartServer(req.Context(), req.Header, req.Method+" "+route,
+			tracing.String("http.request.method", req.Method),
+			tracing.String("http.route", route),
+			tracing.String("url.path", req.URL.Path),
+			tracing.String("request.id", logging.RequestID(req.Context())),
+		)
+		if span == nil {
+			next(w, req)
+			return
+		}
+		defer span.End()
+
+		ctx = logging.With(ctx, "trace_id", span.SpanContext().TraceID.String())
+		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(ww, req.WithContext(ctx))
+
+		span.SetAttributes(tracing.Int("http.response.status_code", ww.statusCode))
+		if ww.statusCode >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(ww.statusCode)))
+		}
+	}
+}
+
+// requestRoute returns the path pattern of the route serving req, without its method
+func requestRoute(req *http.Request) string {
+	route := req.Pattern
+	if _, path, found := strings.Cut(route, " "); found {
+		route = path
+	}
+	return route
+}
+
+// logging logs every request once answered, at warning level for client errors and at
+// error level for server errors
 func (r *Router) logging(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		start := time.Now()
@@ -45,11 +394,20 @@ func (r *Router) logging(next http.HandlerFunc) http.HandlerFunc {
 
 		next(ww, req)
 
-		if ww.statusCode >= http.StatusBadRequest || req.Method != http.MethodGet {
-			duration := time.Since(start)
-			log.Printf("%s %s %s %s", req.RemoteAddr, req.Method, req.URL.Path, duration)
+		level := slog.LevelInfo
+		switch {
+		case ww.statusCode >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case ww.statusCode >= http.StatusBadRequest:
+			level = slog.LevelWarn
 		}
-
+		logging.FromContext(req.Context()).LogAttrs(req.Context(), level, "Request served",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", ww.statusCode),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", req.RemoteAddr),
+		)
 	}
 }
 
@@ -57,3 +415,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap exposes the underlying writer so http.ResponseController can flush streamed responses
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
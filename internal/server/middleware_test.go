@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/logging"
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/ratelimit"
+	"github.com/anddsdev/cloudlet/internal/services"
+	"github.com/anddsdev/cloudlet/internal/tracing"
+)
+
+func TestRequestID_TakenFromClientOrGenerated(t *testing.T) {
+	var seen string
+	handler := (&Router{}).requestID(func(w http.ResponseWriter, req *http.Request) {
+		seen = logging.RequestID(req.Context())
+	})
+
+	for _, tc := range []struct {
+		header string
+		kept   bool
+	}{
+		{"trace-1f2e:3", true},
+		{"", false},
+		{"forged\nlevel=ERROR", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if tc.header != "" {
+			req.Header.Set(RequestIDHeader, tc.header)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		echoed := w.Header().Get(RequestIDHeader)
+		if echoed == "" || echoed != seen {
+			t.Errorf("Expected the request ID %q to be echoed, got %q", seen, echoed)
+		}
+		if (echoed == tc.header) != tc.kept {
+			t.Errorf("For header %q got request ID %q", tc.header, echoed)
+		}
+	}
+}
+
+func TestTrace_ContinuesClientTraceAndTagsLogs(t *testing.T) {
+	var exported bytes.Buffer
+	tracer := tracing.NewTracer("cloudlet", 1, tracing.NewWriterExporter(&exported))
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(nil)
+
+	var logs bytes.Buffer
+	var span *tracing.Span
+	handler := (&Router{}).trace(func(w http.ResponseWriter, req *http.Request) {
+		span = tracing.SpanFromContext(req.Context())
+		logging.FromContext(req.Context()).Info("Handled")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+	req.Pattern = "GET /api/v1/files"
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), req)
+	tracer.Shutdown(context.Background())
+
+	if span == nil || span.SpanContext().TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Expected the handler to run in the trace of the client, got %+v", span.SpanContext())
+	}
+	if !strings.Contains(logs.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("Expected the trace ID in the request logs, got %s", logs.String())
+	}
+	for _, want := range []string{`"name":"GET /api/v1/files"`, `"parentSpanId":"00f067aa0ba902b7"`, `"code":2`} {
+		if !strings.Contains(exported.String(), want) {
+			t.Errorf("Expected %s in the exported span, got %s", want, exported.String())
+		}
+	}
+}
+
+func TestRateLimit_SpendsBudgetsPerClient(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.RequestsPerMinute = 3
+	cfg.RateLimit.UploadBytesPerMinute = 100
+	cfg.RateLimit.MaxClients = 10
+	cfg.Server.Upload.RateLimitPerMinute = 5
+
+	var files ratelimit.Budget
+	handler := (&Router{limits: newRateLimits(cfg)}).rateLimit(func(w http.ResponseWriter, req *http.Request) {
+		files = ratelimit.UploadFilesFromContext(req.Context())
+		io.Copy(io.Discard, req.Body)
+	})
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// Requests
+	for i := 0; i < 3; i++ {
+		if w := serve(httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the budget answered %d", i+1, w.Code)
+		}
+	}
+	w := serve(httptest.NewRequest(http.MethodGet, "/api/v1/files", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "20" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("Expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	// Signed-in users have budgets of their own, whatever address they call from
+	user := httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader(strings.Repeat("x", 60)))
+	user = user.WithContext(services.ContextWithUser(user.Context(), &models.User{ID: 7}))
+	if w := serve(user); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "3" {
+		t.Fatalf("Expected the user to have a budget apart from its address, got %d", w.Code)
+	}
+	if !files.Take(5).Allowed || files.Take(1).Allowed {
+		t.Errorf("Expected the upload handler to get a budget of 5 files")
+	}
+
+	// Upload bytes, declared or counted as the body is read
+	user = httptest.NewRequest(http.MethodPost, "/api/v1/upload", io.MultiReader(strings.NewReader(strings.Repeat("x", 60))))
+	user = user.WithContext(services.ContextWithUser(user.Context(), &models.User{ID: 7}))
+	user.ContentLength = -1
+	if w := serve(user); w.Code != http.StatusOK {
+		t.Fatalf("Expected a body of unknown length to be let through, got %d", w.Code)
+	}
+	upload := httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader("x"))
+	upload.RemoteAddr = "192.0.2.10:5000"
+	if w := serve(upload); w.Code != http.StatusOK {
+		t.Fatalf("Expected another client to upload, got %d", w.Code)
+	}
+	upload = httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader("x"))
+	upload = upload.WithContext(services.ContextWithUser(upload.Context(), &models.User{ID: 8}))
+	upload.ContentLength = 101
+	if w := serve(upload); w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("Expected an upload larger than the budget to be refused for good, got %d %v", w.Code, w.Header())
+	}
+	upload = httptest.NewRequest(http.MethodPut, "/api/v1/upload/sessions/s/chunks/0", strings.NewReader("x"))
+	upload = upload.WithContext(services.ContextWithUser(upload.Context(), &models.User{ID: 7}))
+	w = serve(upload)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("RateLimit-Limit") != "100" {
+		t.Fatalf("Expected the counted bytes to spend the upload budget, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRateLimit_LeavesAnonymousUploadBytesToTheirHandler(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Enabled = true
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.RequestsPerMinute = 100
+	cfg.RateLimit.UploadBytesPerMinute = 10
+	cfg.RateLimit.MaxClients = 10
+
+	var budget ratelimit.Budget
+	var handed bool
+	handler := (&Router{limits: newRateLimits(cfg)}).rateLimit(func(w http.ResponseWriter, req *http.Request) {
+		budget, handed = ratelimit.UploadBytesFromContext(req.Context())
+	})
+
+	// Uploads to a share are only authorized by their handler
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/s/token", strings.NewReader("12345678")))
+		if w.Code != http.StatusOK || !handed {
+			t.Fatalf("Expected the bytes to be left to the handler, got %d", w.Code)
+		}
+	}
+	if result := budget.Take(10); !result.Allowed {
+		t.Errorf("Expected anonymous uploads to spend nothing before their handler took the bytes, got %+v", result)
+	}
+
+	upload := httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader("12345678"))
+	upload = upload.WithContext(services.ContextWithUser(upload.Context(), &models.User{ID: 7}))
+	w := httptest.NewRecorder()
+	handler(w, upload)
+	if w.Code != http.StatusOK || handed {
+		t.Errorf("Expected the middleware to take the bytes of authenticated uploads, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_ClientKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[2001:db8::1]:443"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.5")
+
+	if got := (&rateLimits{}).clientKey(req); got != "ip:2001:db8::1" {
+		t.Errorf("Expected forwarded addresses to be ignored, got %s", got)
+	}
+	if got := (&rateLimits{trustProxyHeaders: true}).clientKey(req); got != "ip:203.0.113.5" {
+		t.Errorf("Expected the address added by the proxy, got %s", got)
+	}
+
+	ctx := services.ContextWithAPIKey(services.ContextWithUser(req.Context(), &models.User{ID: 3}), &models.APIKey{ID: 9})
+	if got := (&rateLimits{}).clientKey(req.WithContext(ctx)); got != "key:9" {
+		t.Errorf("Expected API keys to have budgets of their own, got %s", got)
+	}
+}
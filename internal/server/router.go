@@ -9,11 +9,13 @@ import (
 type Router struct {
 	server  *Server
 	handler http.Handler
+	limits  *rateLimits
 }
 
 func NewRouter(server *Server) *Router {
 	r := &Router{
 		server: server,
+		limits: newRateLimits(server.Config()),
 	}
 
 	r.setupRoutes()
@@ -24,9 +26,60 @@ func NewRouter(server *Server) *Router {
 func (r *Router) setupRoutes() {
 	mux := http.NewServeMux()
 
-	h := handlers.NewHandlers(r.server.FileService(), r.server.Config())
+	h := handlers.NewHandlers(r.server.FileService(), r.server.AuthService(), r.server.Config())
 
-	mux.HandleFunc("GET /health", r.withMiddleware(h.HealthCheck))
+	mux.HandleFunc("GET /health", r.withProbeMiddleware(h.HealthCheck))
+	mux.HandleFunc("GET /health/live", r.withProbeMiddleware(h.HealthCheck))
+	mux.HandleFunc("GET /health/ready", r.withProbeMiddleware(h.HealthReady))
+
+	// Prometheus scrapes, protected by their own token rather than a session
+	if r.server.Config().Metrics.Enabled {
+		mux.HandleFunc("GET /metrics", r.withProbeMiddleware(h.Metrics))
+	}
+
+	// Authentication
+	mux.HandleFunc("POST /api/v1/auth/login", r.withPublicMiddleware(h.Login))
+	mux.HandleFunc("POST /api/v1/auth/logout", r.withPublicMiddleware(h.Logout))
+	mux.HandleFunc("GET /api/v1/auth/me", r.withMiddleware(h.CurrentUser))
+	mux.HandleFunc("POST /api/v1/auth/password", r.withMiddleware(h.ChangePassword))
+
+	// User management, restricted to admins
+	mux.HandleFunc("GET /api/v1/users", r.withMiddleware(h.ListUsers))
+	mux.HandleFunc("POST /api/v1/users", r.withMiddleware(h.CreateUser))
+	mux.HandleFunc("DELETE /api/v1/users/{id}", r.withMiddleware(h.DeleteUser))
+
+	// Personal API keys
+	mux.HandleFunc("GET /api/v1/api-keys", r.withMiddleware(h.ListAPIKeys))
+	mux.HandleFunc("POST /api/v1/api-keys", r.withMiddleware(h.CreateAPIKey))
+	mux.HandleFunc("DELETE /api/v1/api-keys/{id}", r.withMiddleware(h.RevokeAPIKey))
+
+	// Directory ACLs and the groups they grant permissions to
+	mux.HandleFunc("GET /api/v1/acl", r.withMiddleware(h.GetDirectoryACL))
+	mux.HandleFunc("PUT /api/v1/acl", r.withMiddleware(h.SetACLEntry))
+	mux.HandleFunc("DELETE /api/v1/acl/{id}", r.withMiddleware(h.DeleteACLEntry))
+	mux.HandleFunc("GET /api/v1/groups", r.withMiddleware(h.ListGroups))
+	mux.HandleFunc("POST /api/v1/groups", r.withMiddleware(h.CreateGroup))
+	mux.HandleFunc("GET /api/v1/groups/{id}", r.withMiddleware(h.GetGroup))
+	mux.HandleFunc("DELETE /api/v1/groups/{id}", r.withMiddleware(h.DeleteGroup))
+	mux.HandleFunc("PUT /api/v1/groups/{id}/members/{userId}", r.withMiddleware(h.AddGroupMember))
+	mux.HandleFunc("DELETE /api/v1/groups/{id}/members/{userId}", r.withMiddleware(h.RemoveGroupMember))
+
+	// Storage quotas
+	mux.HandleFunc("GET /api/v1/quota", r.withMiddleware(h.GetQuotaUsage))
+	mux.HandleFunc("GET /api/v1/quotas", r.withMiddleware(h.ListQuotas))
+	mux.HandleFunc("PUT /api/v1/quotas", r.withMiddleware(h.SetQuota))
+	mux.HandleFunc("DELETE /api/v1/quotas/{id}", r.withMiddleware(h.DeleteQuota))
+
+	// Share links
+	mux.HandleFunc("GET /api/v1/shares", r.withMiddleware(h.ListShares))
+	mux.HandleFunc("POST /api/v1/shares", r.withMiddleware(h.CreateShare))
+	mux.HandleFunc("DELETE /api/v1/shares/{id}", r.withMiddleware(h.RevokeShare))
+
+	// Share links are opened without an account, by anyone who knows the token
+	mux.HandleFunc("GET /s/{token}", r.withPublicMiddleware(h.OpenShare))
+	mux.HandleFunc("GET /s/{token}/{path...}", r.withPublicMiddleware(h.OpenShare))
+	mux.HandleFunc("POST /s/{token}", r.withPublicMiddleware(h.UploadToShare))
+	mux.HandleFunc("POST /s/{token}/{path...}", r.withPublicMiddleware(h.UploadToShare))
 
 	mux.HandleFunc("GET /api/v1/files", r.withMiddleware(h.ListFiles))
 	mux.HandleFunc("GET /api/v1/files/{path}", r.withMiddleware(h.ListFiles))
@@ -35,7 +88,26 @@ func (r *Router) setupRoutes() {
 	mux.HandleFunc("POST /api/v1/upload/stream", r.withMiddleware(h.UploadStream))
 	mux.HandleFunc("POST /api/v1/upload/chunked", r.withMiddleware(h.UploadChunked))
 	mux.HandleFunc("POST /api/v1/upload/progress", r.withMiddleware(h.UploadWithProgressTracking))
+	mux.HandleFunc("GET /api/v1/upload/events/{uploadId}", r.withMiddleware(h.UploadEvents))
 	
+	// Resumable chunked upload sessions
+	mux.HandleFunc("POST /api/v1/upload/sessions", r.withMiddleware(h.CreateUploadSession))
+	mux.HandleFunc("GET /api/v1/upload/sessions/{sessionId}", r.withMiddleware(h.GetUploadSession))
+	mux.HandleFunc("PUT /api/v1/upload/sessions/{sessionId}/chunks/{index}", r.withMiddleware(h.UploadSessionChunk))
+	mux.HandleFunc("POST /api/v1/upload/sessions/{sessionId}/complete", r.withMiddleware(h.CompleteUploadSession))
+	mux.HandleFunc("DELETE /api/v1/upload/sessions/{sessionId}", r.withMiddleware(h.AbortUploadSession))
+
+	// tus 1.0 resumable uploads. Capability discovery is public, as tus clients expect
+	mux.HandleFunc("OPTIONS /api/v1/tus", r.withPublicMiddleware(h.TusOptions))
+	mux.HandleFunc("OPTIONS /api/v1/tus/{$}", r.withPublicMiddleware(h.TusOptions))
+	mux.HandleFunc("POST /api/v1/tus", r.withMiddleware(h.TusCreate))
+	mux.HandleFunc("POST /api/v1/tus/{$}", r.withMiddleware(h.TusCreate))
+	mux.HandleFunc("OPTIONS /api/v1/tus/{id}", r.withPublicMiddleware(h.TusOptions))
+	mux.HandleFunc("HEAD /api/v1/tus/{id}", r.withMiddleware(h.TusHead))
+	mux.HandleFunc("PATCH /api/v1/tus/{id}", r.withMiddleware(h.TusPatch))
+	mux.HandleFunc("DELETE /api/v1/tus/{id}", r.withMiddleware(h.TusDelete))
+	mux.HandleFunc("POST /api/v1/tus/{id}", r.withMiddleware(h.TusMethodOverride))
+
 	// Multiple file upload endpoints
 	mux.HandleFunc("POST /api/v1/upload/multiple", r.withMiddleware(h.UploadMultiple))
 	mux.HandleFunc("POST /api/v1/upload/multiple/validate", r.withMiddleware(h.UploadMultipleValidate))
@@ -45,7 +117,31 @@ func (r *Router) setupRoutes() {
 	// Batch progress and control endpoints
 	mux.HandleFunc("GET /api/v1/upload/batch/{batchId}/progress", r.withMiddleware(h.GetBatchProgress))
 	mux.HandleFunc("DELETE /api/v1/upload/batch/{batchId}", r.withMiddleware(h.CancelBatchUpload))
-	mux.HandleFunc("GET /api/v1/download/{path}", r.withMiddleware(h.Download))
+	mux.HandleFunc("GET /api/v1/download/{path...}", r.withMiddleware(h.Download))
+
+	// Previous contents of overwritten files
+	mux.HandleFunc("GET /api/v1/versions/{path...}", r.withMiddleware(h.ListVersions))
+	mux.HandleFunc("POST /api/v1/versions/restore", r.withMiddleware(h.RestoreVersion))
+
+	// Deleted files and directories, kept until restored or purged
+	mux.HandleFunc("GET /api/v1/trash", r.withMiddleware(h.ListTrash))
+	mux.HandleFunc("DELETE /api/v1/trash", r.withMiddleware(h.EmptyTrash))
+	mux.HandleFunc("POST /api/v1/trash/{id}/restore", r.withMiddleware(h.RestoreTrashItem))
+	mux.HandleFunc("DELETE /api/v1/trash/{id}", r.withMiddleware(h.PurgeTrashItem))
+
+	// Tags and key/value metadata of files and directories
+	mux.HandleFunc("GET /api/v1/tags", r.withMiddleware(h.ListTags))
+	mux.HandleFunc("POST /api/v1/tags", r.withMiddleware(h.BulkTag))
+	mux.HandleFunc("PUT /api/v1/tags/{path...}", r.withMiddleware(h.SetTags))
+	mux.HandleFunc("GET /api/v1/metadata/{path...}", r.withMiddleware(h.GetMetadata))
+	mux.HandleFunc("PUT /api/v1/metadata/{path...}", r.withMiddleware(h.SetMetadata))
+	mux.HandleFunc("DELETE /api/v1/metadata/{path...}", r.withMiddleware(h.DeleteMetadata))
+
+	// Search by name and path
+	mux.HandleFunc("GET /api/v1/search", r.withMiddleware(h.Search))
+
+	// Append-only record of the operations that changed files or their settings
+	mux.HandleFunc("GET /api/v1/audit", r.withMiddleware(h.QueryAuditLog))
 
 	// Directories operations
 	mux.HandleFunc("POST /api/v1/directories", r.withMiddleware(h.CreateDirectory))
@@ -55,12 +151,30 @@ func (r *Router) setupRoutes() {
 	mux.HandleFunc("POST /api/v1/move", r.withMiddleware(h.MoveFile))
 	mux.HandleFunc("POST /api/v1/rename", r.withMiddleware(h.RenameFile))
 
+	// Storage
+	mux.HandleFunc("GET /api/v1/storage/stats", r.withMiddleware(h.StorageStats))
+
 	fs := http.FileServer(http.Dir("./web/"))
-	mux.Handle("/", r.withMiddleware(http.StripPrefix("/", fs).ServeHTTP))
+	// The web UI is public so it can show the sign-in form
+	mux.Handle("/", r.withPublicMiddleware(http.StripPrefix("/", fs).ServeHTTP))
 
 	r.handler = mux
 }
 
+// withMiddleware wraps handlers of routes that require a session or an API key. Requests
+// are rate limited once authenticated, so clients are told apart by user or API key.
 func (r *Router) withMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return r.cors(r.logging(r.recovery(next)))
+	return r.withProbeMiddleware(r.apiKeyAuth(r.authenticate(r.rateLimit(next))))
+}
+
+// withPublicMiddleware wraps handlers of routes that are reachable without signing in
+func (r *Router) withPublicMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return r.withProbeMiddleware(r.rateLimit(next))
+}
+
+// withProbeMiddleware wraps handlers of routes polled by the infrastructure, such as health
+// checks and metrics scrapes, which are not rate limited so a busy client sharing the
+// address of a prober cannot get the server restarted
+func (r *Router) withProbeMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return r.requestID(r.trace(r.instrument(r.cors(r.logging(r.recovery(next))))))
 }
@@ -11,12 +11,14 @@ type Server struct {
 	cfg         *config.Config
 	router      *Router
 	fileService *services.FileService
+	authService *services.AuthService
 }
 
-func NewServer(cfg *config.Config, fileService *services.FileService) *Server {
+func NewServer(cfg *config.Config, fileService *services.FileService, authService *services.AuthService) *Server {
 	s := &Server{
 		cfg:         cfg,
 		fileService: fileService,
+		authService: authService,
 	}
 
 	s.router = NewRouter(s)
@@ -35,3 +37,7 @@ func (s *Server) Config() *config.Config {
 func (s *Server) FileService() *services.FileService {
 	return s.fileService
 }
+
+func (s *Server) AuthService() *services.AuthService {
+	return s.authService
+}
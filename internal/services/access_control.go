@@ -0,0 +1,368 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+var (
+	ErrAccessDenied     = errors.New("permission denied")
+	ErrInvalidACLEntry  = errors.New("ACL entries need a user or group subject and read, write, delete or share permissions")
+	ErrACLEntryNotFound = errors.New("ACL entry not found")
+	ErrSubjectNotFound  = errors.New("user or group not found")
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupExists      = errors.New("group name is already taken")
+	ErrInvalidGroupName = errors.New("group name must be 1-64 characters")
+)
+
+var validPermissions = []string{
+	models.PermissionRead, models.PermissionWrite, models.PermissionDelete, models.PermissionShare,
+}
+
+// AccessControlService evaluates directory ACLs and manages the groups they refer to.
+//
+// A directory without entries on itself or any ancestor is open to every signed-in user.
+// Once an entry exists on a directory, it and everything below it are only accessible to
+// the subjects granted a permission there or on an ancestor. Admins bypass ACLs.
+type AccessControlService struct {
+	acl *repository.ACLRepository
+}
+
+func NewAccessControlService(acl *repository.ACLRepository) *AccessControlService {
+	return &AccessControlService{acl: acl}
+}
+
+// accessPolicy holds the ACL entries relevant to one user for the duration of a call
+type accessPolicy struct {
+	user    *models.User
+	groups  map[int64]bool
+	entries map[string][]*models.ACLEntry
+}
+
+// policyFor returns the policy of user over paths, holding the entries set on them and on
+// their ancestors, which are the only ones allows looks at
+func (a *AccessControlService) policyFor(user *models.User, paths ...string) (*accessPolicy, error) {
+	entries, err := a.acl.ListEntriesForPaths(ancestorsOf(paths))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACL entries: %w", err)
+	}
+	return a.newPolicy(user, entries)
+}
+
+// treePolicyFor returns the policy of user over dirPath and everything below it, for calls
+// checking many paths of a tree at once
+func (a *AccessControlService) treePolicyFor(user *models.User, dirPath string) (*accessPolicy, error) {
+	entries, err := a.acl.ListEntriesForTree(pathAncestors(dirPath), dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACL entries: %w", err)
+	}
+	return a.newPolicy(user, entries)
+}
+
+func (a *AccessControlService) newPolicy(user *models.User, entries []*models.ACLEntry) (*accessPolicy, error) {
+	groupIDs, err := a.acl.GetUserGroupIDs(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group memberships: %w", err)
+	}
+
+	policy := &accessPolicy{
+		user:    user,
+		groups:  make(map[int64]bool, len(groupIDs)),
+		entries: make(map[string][]*models.ACLEntry),
+	}
+	for _, id := range groupIDs {
+		policy.groups[id] = true
+	}
+	for _, entry := range entries {
+		policy.entries[entry.Path] = append(policy.entries[entry.Path], entry)
+	}
+	return policy, nil
+}
+
+// allows reports whether the user holds permission on p through an entry on p or an ancestor
+func (p *accessPolicy) allows(filePath, permission string) bool {
+	if p.user.IsAdmin {
+		return true
+	}
+
+	protected := false
+	for _, dir := range pathAncestors(filePath) {
+		for _, entry := range p.entries[dir] {
+			protected = true
+			if p.matches(entry) && slices.Contains(entry.Permissions, permission) {
+				return true
+			}
+		}
+	}
+	return !protected
+}
+
+// allowsTree is like allows but also requires permission on every directory below p
+// that has entries of its own. The policy must hold the entries of the tree of p.
+func (p *accessPolicy) allowsTree(filePath, permission string) bool {
+	if !p.allows(filePath, permission) {
+		return false
+	}
+
+	for dir := range p.entries {
+		if isBelowPath(dir, filePath) && !p.allows(dir, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *accessPolicy) matches(entry *models.ACLEntry) bool {
+	switch entry.SubjectType {
+	case models.SubjectUser:
+		return entry.SubjectID == p.user.ID
+	case models.SubjectGroup:
+		return p.groups[entry.SubjectID]
+	}
+	return false
+}
+
+// Check returns ErrAccessDenied unless user holds permission on every one of paths
+func (a *AccessControlService) Check(user *models.User, permission string, paths ...string) error {
+	if user == nil || user.IsAdmin {
+		return nil
+	}
+
+	policy, err := a.policyFor(user, paths...)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if !policy.allows(p, permission) {
+			return ErrAccessDenied
+		}
+	}
+	return nil
+}
+
+// GetDirectoryACL returns the entries set on a directory and those inherited from its ancestors
+func (a *AccessControlService) GetDirectoryACL(dirPath string) (*models.DirectoryACL, error) {
+	ancestors := pathAncestors(dirPath)
+	entries, err := a.acl.ListEntriesForPaths(ancestors)
+	if err != nil {
+		return nil, err
+	}
+
+	acl := &models.DirectoryACL{
+		Path:      dirPath,
+		Entries:   []*models.ACLEntry{},
+		Inherited: []*models.ACLEntry{},
+	}
+	for _, entry := range entries {
+		if entry.Path == dirPath {
+			acl.Entries = append(acl.Entries, entry)
+		} else {
+			acl.Inherited = append(acl.Inherited, entry)
+		}
+	}
+	return acl, nil
+}
+
+// SetEntry grants permissions on a directory. Users who are not admins need the share
+// permission there and can only grant permissions they hold themselves.
+func (a *AccessControlService) SetEntry(user *models.User, req *models.SetACLEntryRequest) (*models.ACLEntry, error) {
+	if req.SubjectType != models.SubjectUser && req.SubjectType != models.SubjectGroup {
+		return nil, ErrInvalidACLEntry
+	}
+	if len(req.Permissions) == 0 {
+		return nil, ErrInvalidACLEntry
+	}
+
+	var permissions []string
+	for _, permission := range req.Permissions {
+		if !slices.Contains(validPermissions, permission) {
+			return nil, ErrInvalidACLEntry
+		}
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	if user != nil && !user.IsAdmin {
+		policy, err := a.policyFor(user, req.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !policy.allows(req.Path, models.PermissionShare) {
+			return nil, ErrAccessDenied
+		}
+		for _, permission := range permissions {
+			if !policy.allows(req.Path, permission) {
+				return nil, ErrAccessDenied
+			}
+		}
+	}
+
+	exists, err := a.acl.SubjectExists(req.SubjectType, req.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrSubjectNotFound
+	}
+
+	entry := &models.ACLEntry{
+		Path:        req.Path,
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Permissions: permissions,
+	}
+	if err := a.acl.SetEntry(entry); err != nil {
+		return nil, fmt.Errorf("failed to save ACL entry: %w", err)
+	}
+	return a.acl.GetEntry(entry.ID)
+}
+
+func (a *AccessControlService) GetEntry(id int64) (*models.ACLEntry, error) {
+	entry, err := a.acl.GetEntry(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrACLEntryNotFound
+	}
+	return entry, err
+}
+
+// DeleteEntry removes an entry. Users who are not admins need the share permission on its directory.
+func (a *AccessControlService) DeleteEntry(user *models.User, id int64) error {
+	entry, err := a.acl.GetEntry(id)
+	if err == sql.ErrNoRows {
+		return ErrACLEntryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := a.Check(user, models.PermissionShare, entry.Path); err != nil {
+		return err
+	}
+
+	if err := a.acl.DeleteEntry(id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrACLEntryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *AccessControlService) CreateGroup(name string) (*models.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, ErrInvalidGroupName
+	}
+
+	group := &models.Group{Name: name}
+	if err := a.acl.CreateGroup(group); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			return nil, ErrGroupExists
+		}
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+	return group, nil
+}
+
+func (a *AccessControlService) ListGroups() ([]*models.Group, error) {
+	return a.acl.ListGroups()
+}
+
+// GetGroup returns a group with its members
+func (a *AccessControlService) GetGroup(id int64) (*models.Group, error) {
+	group, err := a.acl.GetGroup(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	group.Members, err = a.acl.ListGroupMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	if group.Members == nil {
+		group.Members = []*models.User{}
+	}
+	return group, nil
+}
+
+func (a *AccessControlService) DeleteGroup(id int64) error {
+	if err := a.acl.DeleteGroup(id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrGroupNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *AccessControlService) AddGroupMember(groupID, userID int64) error {
+	if _, err := a.acl.GetGroup(groupID); err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	} else if err != nil {
+		return err
+	}
+
+	exists, err := a.acl.SubjectExists(models.SubjectUser, userID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	return a.acl.AddGroupMember(groupID, userID)
+}
+
+func (a *AccessControlService) RemoveGroupMember(groupID, userID int64) error {
+	if err := a.acl.RemoveGroupMember(groupID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// pathAncestors returns a virtual path followed by each of its ancestors up to the root
+func pathAncestors(filePath string) []string {
+	filePath = path.Clean("/" + filePath)
+
+	ancestors := []string{filePath}
+	for filePath != "/" {
+		filePath = path.Dir(filePath)
+		ancestors = append(ancestors, filePath)
+	}
+	return ancestors
+}
+
+// ancestorsOf returns each of paths and their ancestors once
+func ancestorsOf(paths []string) []string {
+	var ancestors []string
+	for _, p := range paths {
+		for _, dir := range pathAncestors(p) {
+			if !slices.Contains(ancestors, dir) {
+				ancestors = append(ancestors, dir)
+			}
+		}
+	}
+	return ancestors
+}
+
+// isBelowPath reports whether p lies strictly inside dir
+func isBelowPath(p, dir string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
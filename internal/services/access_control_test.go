@@ -0,0 +1,325 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+// setupAccessControl builds a file service enforcing ACLs and quotas along with an admin and two regular users
+func setupAccessControl(t *testing.T) (*FileService, *AuthService, map[string]*models.User) {
+	tempDir := t.TempDir()
+	storagePath := filepath.Join(tempDir, "storage")
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	storage := NewStorageService(storagePath)
+	t.Cleanup(func() { storage.Close() })
+
+	fileService := NewFileService(repo, storage, storagePath)
+	fileService.SetAccessControl(NewAccessControlService(repository.NewACLRepository(repo.DB())))
+	fileService.SetQuotas(NewQuotaService(repository.NewQuotaRepository(repo.DB())))
+	fileService.SetShares(NewShareService(repository.NewShareRepository(repo.DB())))
+	auth := NewAuthService(repository.NewUserRepository(repo.DB()), time.Hour)
+
+	users := make(map[string]*models.User)
+	for _, name := range []string{"admin", "alice", "bob"} {
+		user, err := auth.CreateUser(name, "correct horse", name == "admin")
+		if err != nil {
+			t.Fatalf("Failed to create user %s: %v", name, err)
+		}
+		users[name] = user
+	}
+	return fileService, auth, users
+}
+
+func grant(t *testing.T, fs *FileService, path, subjectType string, subjectID int64, permissions ...string) {
+	t.Helper()
+	_, err := fs.SetACLEntry(&models.SetACLEntryRequest{
+		Path:        path,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		Permissions: permissions,
+	})
+	if err != nil {
+		t.Fatalf("Failed to grant %v on %s: %v", permissions, path, err)
+	}
+}
+
+func TestAccessControl_InheritedGrants(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	if _, err := admin.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := admin.CreateDirectory("reports", "/team"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := admin.SaveFile("q1.txt", "/team/reports", []byte("numbers")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	// Without entries every signed-in user has access
+	if _, _, err := fs.ForUser(users["bob"]).GetFileData("/team/reports/q1.txt"); err != nil {
+		t.Fatalf("Expected open access before any ACL entry, got %v", err)
+	}
+
+	grant(t, admin, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+
+	alice := fs.ForUser(users["alice"])
+	if _, _, err := alice.GetFileData("/team/reports/q1.txt"); err != nil {
+		t.Errorf("Expected alice to inherit read access, got %v", err)
+	}
+	if err := alice.SaveFile("q2.txt", "/team/reports", []byte("more")); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected write to be denied without the write permission, got %v", err)
+	}
+
+	bob := fs.ForUser(users["bob"])
+	if _, _, err := bob.GetFileData("/team/reports/q1.txt"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected bob to be denied once the directory has entries, got %v", err)
+	}
+	if _, err := bob.GetDirectoryListing("/team"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected listing to be denied, got %v", err)
+	}
+}
+
+func TestAccessControl_GroupGrants(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+	access := fs.AccessControl()
+
+	if _, err := admin.CreateDirectory("shared", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	group, err := access.CreateGroup("editors")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	if _, err := access.CreateGroup("Editors"); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("Expected ErrGroupExists for a duplicate name, got %v", err)
+	}
+	if err := access.AddGroupMember(group.ID, users["bob"].ID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+
+	grant(t, admin, "/shared", models.SubjectGroup, group.ID, models.PermissionRead, models.PermissionWrite)
+
+	bob := fs.ForUser(users["bob"])
+	if err := bob.SaveFile("notes.txt", "/shared", []byte("hi")); err != nil {
+		t.Errorf("Expected group member to write, got %v", err)
+	}
+	if err := fs.ForUser(users["alice"]).SaveFile("notes2.txt", "/shared", []byte("hi")); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected non-member to be denied, got %v", err)
+	}
+
+	if err := access.RemoveGroupMember(group.ID, users["bob"].ID); err != nil {
+		t.Fatalf("Failed to remove member: %v", err)
+	}
+	if _, _, err := bob.GetFileData("/shared/notes.txt"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected access to end with the membership, got %v", err)
+	}
+}
+
+func TestAccessControl_MoveChecksSourceAndDestination(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	for _, dir := range []string{"inbox", "archive", "locked"} {
+		if _, err := admin.CreateDirectory(dir, "/"); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := admin.SaveFile("a.txt", "/inbox", []byte("a")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	alice := users["alice"].ID
+	grant(t, admin, "/inbox", models.SubjectUser, alice, models.PermissionRead, models.PermissionDelete)
+	grant(t, admin, "/archive", models.SubjectUser, alice, models.PermissionRead, models.PermissionWrite)
+	grant(t, admin, "/locked", models.SubjectUser, alice, models.PermissionRead)
+
+	view := fs.ForUser(users["alice"])
+	if err := view.MoveFile("/inbox/a.txt", "/locked"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected move into a read-only directory to be denied, got %v", err)
+	}
+	if err := view.MoveFile("/archive", "/inbox"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected move without delete on the source to be denied, got %v", err)
+	}
+	if err := view.MoveFile("/inbox/a.txt", "/archive"); err != nil {
+		t.Errorf("Expected move to succeed, got %v", err)
+	}
+}
+
+func TestAccessControl_ListingHidesProtectedEntries(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	for _, dir := range []string{"public", "private"} {
+		if _, err := admin.CreateDirectory(dir, "/"); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	grant(t, admin, "/private", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+
+	listing, err := fs.ForUser(users["bob"]).GetDirectoryListing("/")
+	if err != nil {
+		t.Fatalf("Failed to list root: %v", err)
+	}
+	if len(listing.Directories) != 1 || listing.Directories[0].Name != "public" {
+		t.Errorf("Expected only the public directory, got %d entries", len(listing.Directories))
+	}
+
+	listing, err = fs.ForUser(users["alice"]).GetDirectoryListing("/")
+	if err != nil {
+		t.Fatalf("Failed to list root: %v", err)
+	}
+	if len(listing.Directories) != 2 {
+		t.Errorf("Expected both directories for alice, got %d", len(listing.Directories))
+	}
+}
+
+func TestAccessControl_RecursiveDeleteChecksTree(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	if _, err := admin.CreateDirectory("projects", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := admin.CreateDirectory("secret", "/projects"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	grant(t, admin, "/projects", models.SubjectUser, users["alice"].ID, models.PermissionRead, models.PermissionDelete)
+	grant(t, admin, "/projects/secret", models.SubjectUser, users["bob"].ID, models.PermissionRead, models.PermissionDelete)
+
+	// Grants are unions, so alice inherits delete inside /projects/secret too
+	if err := fs.ForUser(users["bob"]).DeleteFile("/projects", true); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected bob to be denied deleting the parent, got %v", err)
+	}
+	if err := fs.ForUser(users["alice"]).DeleteFile("/projects", true); err != nil {
+		t.Errorf("Expected alice to delete the tree, got %v", err)
+	}
+
+	acl, err := admin.GetDirectoryACL("/")
+	if err != nil {
+		t.Fatalf("Failed to load ACL: %v", err)
+	}
+	if len(acl.Entries) != 0 {
+		t.Errorf("Expected no entries left on the root, got %d", len(acl.Entries))
+	}
+}
+
+func TestAccessControl_PoliciesLoadOnlyTheirEntries(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	for _, dir := range [][2]string{{"a", "/"}, {"b", "/a"}, {"a_b", "/"}, {"x", "/a_b"}, {"c", "/"}} {
+		if _, err := fs.CreateDirectory(dir[0], dir[1]); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for _, dir := range []string{"/a", "/a/b", "/a_b/x", "/c"} {
+		grant(t, fs, dir, models.SubjectUser, users["alice"].ID, models.PermissionRead)
+	}
+
+	loaded := func(policy *accessPolicy) []string {
+		var paths []string
+		for p := range policy.entries {
+			paths = append(paths, p)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+
+	policy, err := fs.access.policyFor(users["alice"], "/a/b/notes.txt", "/c")
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	if got, want := loaded(policy), []string{"/a", "/a/b", "/c"}; !slices.Equal(got, want) {
+		t.Errorf("Expected the entries of the ancestors %v, got %v", want, got)
+	}
+
+	policy, err = fs.access.treePolicyFor(users["alice"], "/a")
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	if got, want := loaded(policy), []string{"/a", "/a/b"}; !slices.Equal(got, want) {
+		t.Errorf("Expected the entries of the tree %v, got %v", want, got)
+	}
+
+	policy, err = fs.access.treePolicyFor(users["alice"], "/")
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	if got := loaded(policy); len(got) != 4 {
+		t.Errorf("Expected every entry below the root, got %v", got)
+	}
+}
+
+func TestAccessControl_RenameKeepsEntries(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	if _, err := admin.CreateDirectory("old", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	grant(t, admin, "/old", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+
+	if err := admin.RenameFile("/old", "new"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+
+	acl, err := admin.GetDirectoryACL("/new")
+	if err != nil {
+		t.Fatalf("Failed to load ACL: %v", err)
+	}
+	if len(acl.Entries) != 1 || acl.Entries[0].SubjectID != users["alice"].ID {
+		t.Errorf("Expected the entry to follow the directory, got %+v", acl.Entries)
+	}
+	if _, err := fs.ForUser(users["bob"]).GetDirectoryListing("/new"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected the renamed directory to stay protected, got %v", err)
+	}
+}
+
+func TestAccessControl_SharingNeedsSharePermission(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+
+	if _, err := admin.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	grant(t, admin, "/docs", models.SubjectUser, users["alice"].ID, models.PermissionRead, models.PermissionShare)
+
+	alice := fs.ForUser(users["alice"])
+	req := &models.SetACLEntryRequest{
+		Path:        "/docs",
+		SubjectType: models.SubjectUser,
+		SubjectID:   users["bob"].ID,
+		Permissions: []string{models.PermissionWrite},
+	}
+	if _, err := alice.SetACLEntry(req); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected granting a permission alice lacks to be denied, got %v", err)
+	}
+
+	req.Permissions = []string{models.PermissionRead}
+	if _, err := alice.SetACLEntry(req); err != nil {
+		t.Errorf("Expected alice to share read access, got %v", err)
+	}
+
+	if _, err := fs.ForUser(users["bob"]).SetACLEntry(req); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected bob to be denied without share, got %v", err)
+	}
+
+	req.Permissions = []string{"execute"}
+	if _, err := admin.SetACLEntry(req); !errors.Is(err, ErrInvalidACLEntry) {
+		t.Errorf("Expected ErrInvalidACLEntry for an unknown permission, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// APIKeyTokenPrefix marks API key tokens so they can be told apart from session tokens
+const APIKeyTokenPrefix = "clk_"
+
+const (
+	maxAPIKeyNameLength = 100
+	// Last-used timestamps are only written once per interval to keep authentication cheap
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrInvalidAPIKey     = errors.New("invalid or expired API key")
+	ErrInvalidAPIKeyName = errors.New("API key name must be 1-100 characters")
+	ErrInvalidScope      = errors.New("scopes must be one or more of read, write, delete and admin")
+	ErrScopeNotGranted   = errors.New("API key lacks the required scope")
+	ErrPathNotAllowed    = errors.New("path is outside the prefix this API key is restricted to")
+)
+
+var validScopes = []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete, models.ScopeAdmin}
+
+// CreateAPIKey issues a key for user. The returned token is shown once and cannot be recovered.
+func (s *AuthService) CreateAPIKey(user *models.User, req *models.CreateAPIKeyRequest) (string, *models.APIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return "", nil, ErrInvalidAPIKeyName
+	}
+
+	if len(req.Scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(validScopes, scope) {
+			return "", nil, ErrInvalidScope
+		}
+		if scope == models.ScopeAdmin && !user.IsAdmin {
+			return "", nil, ErrScopeNotGranted
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresInDays < 0 {
+		return "", nil, errors.New("expires_in_days cannot be negative")
+	}
+
+	secret, err := randomToken(sessionTokenBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	token := APIKeyTokenPrefix + secret
+
+	key := &models.APIKey{
+		UserID:      user.ID,
+		Name:        name,
+		TokenHash:   hashToken(token),
+		TokenPrefix: token[:len(APIKeyTokenPrefix)+8],
+		Scopes:      scopes,
+		PathPrefix:  normalizePathPrefix(req.PathPrefix),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.users.CreateAPIKey(key); err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return token, key, nil
+}
+
+// ListAPIKeys returns the keys of a user, or of every user when userID is 0
+func (s *AuthService) ListAPIKeys(userID int64) ([]*models.APIKey, error) {
+	return s.users.ListAPIKeys(userID)
+}
+
+// RevokeAPIKey deletes a key. Users can revoke their own keys and admins any key.
+func (s *AuthService) RevokeAPIKey(user *models.User, id int64) error {
+	key, err := s.users.GetAPIKeyByID(id)
+	if err == sql.ErrNoRows || (err == nil && key.UserID != user.ID && !user.IsAdmin) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.DeleteAPIKey(id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns an unexpired key and its owner, and records that it was used
+func (s *AuthService) AuthenticateAPIKey(token string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(token, APIKeyTokenPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, user, err := s.users.GetAPIKeyUser(hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.users.TouchAPIKey(key.ID, now); err == nil {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, user, nil
+}
+
+// HasScope reports whether key grants scope. The admin scope grants every scope.
+func HasScope(key *models.APIKey, scope string) bool {
+	return slices.Contains(key.Scopes, scope) || slices.Contains(key.Scopes, models.ScopeAdmin)
+}
+
+// CheckScope returns ErrScopeNotGranted when the request was authenticated with an API key lacking scope
+func CheckScope(ctx context.Context, scope string) error {
+	if key := APIKeyFromContext(ctx); key != nil && !HasScope(key, scope) {
+		return ErrScopeNotGranted
+	}
+	return nil
+}
+
+// CheckPathAccess returns ErrPathNotAllowed when the request was authenticated with an API key
+// restricted to a path prefix that does not contain every one of paths
+func CheckPathAccess(ctx context.Context, paths ...string) error {
+	key := APIKeyFromContext(ctx)
+	if key == nil || key.PathPrefix == "" || key.PathPrefix == "/" {
+		return nil
+	}
+
+	for _, p := range paths {
+		p = normalizePathPrefix(p)
+		if p != key.PathPrefix && !strings.HasPrefix(p, key.PathPrefix+"/") {
+			return ErrPathNotAllowed
+		}
+	}
+	return nil
+}
+
+// normalizePathPrefix cleans a virtual path so prefixes compare reliably. An empty prefix stays empty.
+func normalizePathPrefix(p string) string {
+	if strings.TrimSpace(p) == "" {
+		return ""
+	}
+	return path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+}
+
+type apiKeyContextKey struct{}
+
+// ContextWithAPIKey returns a copy of ctx carrying the API key a request was made with
+func ContextWithAPIKey(ctx context.Context, key *models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key of a request, or nil for requests made with a session
+func APIKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*models.APIKey)
+	return key
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestAuthService_APIKeyLifecycle(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	user, err := auth.CreateUser("ci-bot", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	token, key, err := auth.CreateAPIKey(user, &models.CreateAPIKeyRequest{
+		Name:          "pipeline",
+		Scopes:        []string{models.ScopeRead, models.ScopeWrite, models.ScopeRead},
+		PathPrefix:    "artifacts/",
+		ExpiresInDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(token, APIKeyTokenPrefix) || !strings.HasPrefix(token, key.TokenPrefix) {
+		t.Errorf("Unexpected token %q for prefix %q", token, key.TokenPrefix)
+	}
+	if key.TokenHash == token {
+		t.Error("Expected only a hash of the token to be stored")
+	}
+	if len(key.Scopes) != 2 || key.PathPrefix != "/artifacts" || key.ExpiresAt == nil {
+		t.Errorf("Unexpected key: %+v", key)
+	}
+
+	authenticated, owner, err := auth.AuthenticateAPIKey(token)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if owner.ID != user.ID || authenticated.ID != key.ID {
+		t.Errorf("Expected key %d of user %d, got key %d of user %d", key.ID, user.ID, authenticated.ID, owner.ID)
+	}
+
+	keys, err := auth.ListAPIKeys(user.ID)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Fatalf("Expected one key with a last-used time, got %+v", keys)
+	}
+
+	if err := auth.RevokeAPIKey(user, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if _, _, err := auth.AuthenticateAPIKey(token); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey after revocation, got %v", err)
+	}
+}
+
+func TestAuthService_CreateAPIKeyValidation(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	user, err := auth.CreateUser("ci-bot", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     models.CreateAPIKeyRequest
+		wantErr error
+	}{
+		{"missing name", models.CreateAPIKeyRequest{Scopes: []string{models.ScopeRead}}, ErrInvalidAPIKeyName},
+		{"no scopes", models.CreateAPIKeyRequest{Name: "key"}, ErrInvalidScope},
+		{"unknown scope", models.CreateAPIKeyRequest{Name: "key", Scopes: []string{"root"}}, ErrInvalidScope},
+		{"admin scope for non-admin", models.CreateAPIKeyRequest{Name: "key", Scopes: []string{models.ScopeAdmin}}, ErrScopeNotGranted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := auth.CreateAPIKey(user, &tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthService_RevokeOtherUsersKey(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	owner, _ := auth.CreateUser("owner", "correct horse", false)
+	other, _ := auth.CreateUser("other", "correct horse", false)
+	admin, _ := auth.CreateUser("root", "correct horse", true)
+
+	_, key, err := auth.CreateAPIKey(owner, &models.CreateAPIKeyRequest{Name: "key", Scopes: []string{models.ScopeRead}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	if err := auth.RevokeAPIKey(other, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Expected other users not to see the key, got %v", err)
+	}
+	if err := auth.RevokeAPIKey(admin, key.ID); err != nil {
+		t.Errorf("Expected admins to revoke any key, got %v", err)
+	}
+}
+
+func TestAuthService_ExpiredAPIKey(t *testing.T) {
+	auth, db := setupAuthServiceWithDB(t, time.Hour)
+
+	user, _ := auth.CreateUser("ci-bot", "correct horse", false)
+	token, key, err := auth.CreateAPIKey(user, &models.CreateAPIKeyRequest{Name: "key", Scopes: []string{models.ScopeRead}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	if _, err := db.Exec("UPDATE api_keys SET expires_at = ? WHERE id = ?",
+		time.Now().UTC().Add(-time.Minute), key.ID); err != nil {
+		t.Fatalf("Failed to expire key: %v", err)
+	}
+
+	if _, _, err := auth.AuthenticateAPIKey(token); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey for an expired key, got %v", err)
+	}
+}
+
+func TestCheckPathAccess(t *testing.T) {
+	if err := CheckPathAccess(context.Background(), "/anything"); err != nil {
+		t.Errorf("Expected requests without an API key to pass, got %v", err)
+	}
+
+	ctx := ContextWithAPIKey(context.Background(), &models.APIKey{PathPrefix: "/builds"})
+
+	allowed := []string{"/builds", "/builds/", "builds/42/app.tar.gz", "/builds/42/../43"}
+	for _, p := range allowed {
+		if err := CheckPathAccess(ctx, p); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", p, err)
+		}
+	}
+
+	denied := []string{"/", "", "/builds-old", "/builds/../secrets", "/other"}
+	for _, p := range denied {
+		if err := CheckPathAccess(ctx, p); !errors.Is(err, ErrPathNotAllowed) {
+			t.Errorf("Expected %q to be denied, got %v", p, err)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	key := &models.APIKey{Scopes: []string{models.ScopeRead}}
+	if !HasScope(key, models.ScopeRead) || HasScope(key, models.ScopeWrite) {
+		t.Error("Expected only the read scope to be granted")
+	}
+
+	admin := &models.APIKey{Scopes: []string{models.ScopeAdmin}}
+	if !HasScope(admin, models.ScopeDelete) {
+		t.Error("Expected the admin scope to grant every scope")
+	}
+}
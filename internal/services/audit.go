@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditService keeps the append-only log of the operations that changed files or their settings
+type AuditService struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends entry to the audit log. A failure to record is logged through logger
+// rather than returned, so it never fails the operation being recorded.
+func (a *AuditService) Record(entry *models.AuditEntry, logger *slog.Logger) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if err := a.repo.Append(entry); err != nil {
+		logger.Error("Failed to record audit entry", "action", entry.Action, "path", entry.Path, "error", err)
+	}
+}
+
+// Query returns the entries matching filter, newest first. At most maxAuditLimit entries
+// are returned at once, defaultAuditLimit when the filter sets no limit.
+func (a *AuditService) Query(filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	normalized := *filter
+	if normalized.Limit < 0 || normalized.Offset < 0 {
+		return nil, ErrInvalidAuditFilter
+	}
+	if !normalized.From.IsZero() && !normalized.To.IsZero() && normalized.To.Before(normalized.From) {
+		return nil, ErrInvalidAuditFilter
+	}
+	if normalized.Limit == 0 {
+		normalized.Limit = defaultAuditLimit
+	}
+	normalized.Limit = min(normalized.Limit, maxAuditLimit)
+	if normalized.PathPrefix != "" {
+		normalized.PathPrefix = path.Clean("/" + strings.TrimPrefix(normalized.PathPrefix, "/"))
+	}
+
+	entries, err := a.repo.Query(&normalized)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*models.AuditEntry{}
+	}
+	return entries, nil
+}
+
+// SetAudit makes the service and its views record every mutation in the audit log
+func (s *FileService) SetAudit(audit *AuditService) {
+	s.audit = audit
+}
+
+// Audit returns the audit log, or nil when none is configured
+func (s *FileService) Audit() *AuditService {
+	return s.audit
+}
+
+// WithClientIP returns a view that records ip as the client address of the operations it audits
+func (s *FileService) WithClientIP(ip string) *FileService {
+	view := *s
+	view.clientIP = ip
+	return &view
+}
+
+// WithAuditActor returns a view that records user as the actor of the operations it audits.
+// Views without a user, such as those of OwnedBy, use it to name who they act for.
+func (s *FileService) WithAuditActor(user *models.User) *FileService {
+	view := *s
+	view.auditActor = user
+	return &view
+}
+
+// recordAudit records an operation of the view in the audit log. Paths are storage paths.
+func (s *FileService) recordAudit(action, filePath, targetPath string, size int64, err error) {
+	s.recordAuditEntry(&models.AuditEntry{Action: action, Path: filePath, TargetPath: targetPath, Size: size}, err)
+}
+
+// recordAuditEntry completes entry with the actor and result and records it
+func (s *FileService) recordAuditEntry(entry *models.AuditEntry, err error) {
+	if s.audit == nil {
+		return
+	}
+
+	entry.ActorID = s.owner
+	entry.ClientIP = s.clientIP
+	entry.Result = models.AuditSuccess
+	actor := s.user
+	if actor == nil {
+		actor = s.auditActor
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.Actor = actor.Username
+	}
+	if err != nil {
+		entry.Result = models.AuditFailure
+		entry.Error = err.Error()
+	}
+	s.audit.Record(entry, s.log())
+}
+
+// auditPath returns the storage path a client path names, or the client path as given
+// when it is invalid, so rejected operations are recorded too
+func (s *FileService) auditPath(clientPath string) string {
+	if s.audit == nil {
+		return clientPath
+	}
+	if storagePath, err := s.pathValidator.ValidateAndNormalizePath(clientPath); err == nil {
+		return storagePath
+	}
+	return clientPath
+}
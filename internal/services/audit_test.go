@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+func setupAuditFileService(t *testing.T) *FileService {
+	service := setupRealFileService(t)
+	service.SetAudit(NewAuditService(repository.NewAuditRepository(service.repo.DB())))
+	return service
+}
+
+func TestAudit_RecordsMutations(t *testing.T) {
+	fs := setupAuditFileService(t)
+	view := fs.WithClientIP("192.0.2.7")
+
+	if _, err := view.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := view.SaveFile("plan.txt", "/docs", []byte("plan")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := view.RenameFile("/docs/plan.txt", "final.txt"); err != nil {
+		t.Fatalf("Failed to rename file: %v", err)
+	}
+	if err := view.DeleteFile("/missing.txt"); err == nil {
+		t.Fatal("Expected deleting a missing file to fail")
+	}
+	if err := view.DeleteFile("/docs", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+
+	entries, err := fs.Audit().Query(&models.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	expected := []struct{ action, path, target, result string }{
+		{models.AuditDelete, "/docs", "", models.AuditSuccess},
+		{models.AuditDelete, "/missing.txt", "", models.AuditFailure},
+		{models.AuditRename, "/docs/plan.txt", "/docs/final.txt", models.AuditSuccess},
+		{models.AuditUpload, "/docs/plan.txt", "", models.AuditSuccess},
+		{models.AuditCreateDirectory, "/docs", "", models.AuditSuccess},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), entries)
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Action != want.action || got.Path != want.path || got.TargetPath != want.target || got.Result != want.result {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, want, got)
+		}
+		if got.ClientIP != "192.0.2.7" {
+			t.Errorf("Entry %d: expected the client address, got %q", i, got.ClientIP)
+		}
+	}
+	if entries[0].Size != 4 {
+		t.Errorf("Expected the size of the deleted directory, got %d", entries[0].Size)
+	}
+	if entries[1].Error == "" {
+		t.Error("Expected the failure to record its error")
+	}
+}
+
+func TestAudit_QueryFilters(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	fs.SetAudit(NewAuditService(repository.NewAuditRepository(fs.repo.DB())))
+	admin := fs.ForUser(users["admin"])
+	alice := fs.ForUser(users["alice"])
+
+	if _, err := admin.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	grant(t, admin, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead, models.PermissionWrite)
+	if err := alice.SaveFile("notes.txt", "/team", []byte("notes")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := alice.DeleteFile("/team/missing.txt"); err == nil {
+		t.Fatal("Expected deleting a missing file to fail")
+	}
+
+	query := func(filter *models.AuditFilter) []*models.AuditEntry {
+		t.Helper()
+		entries, err := fs.Audit().Query(filter)
+		if err != nil {
+			t.Fatalf("Failed to query audit log: %v", err)
+		}
+		return entries
+	}
+
+	byAlice := query(&models.AuditFilter{ActorID: users["alice"].ID})
+	if len(byAlice) != 2 || byAlice[0].Result != models.AuditFailure || byAlice[1].Actor != "alice" {
+		t.Errorf("Expected the upload and failed delete of alice, got %+v", byAlice)
+	}
+	if acl := query(&models.AuditFilter{Action: models.AuditSetACL}); len(acl) != 1 || acl[0].Details == "" {
+		t.Errorf("Expected the ACL change with its subject, got %+v", acl)
+	}
+	if team := query(&models.AuditFilter{PathPrefix: "/team"}); len(team) != 4 {
+		t.Errorf("Expected 4 entries below /team, got %+v", team)
+	}
+	if future := query(&models.AuditFilter{From: time.Now().Add(time.Hour)}); len(future) != 0 {
+		t.Errorf("Expected no entries in the future, got %+v", future)
+	}
+	if page := query(&models.AuditFilter{Limit: 1, Offset: 1}); len(page) != 1 || page[0].ID != byAlice[1].ID {
+		t.Errorf("Expected the second newest entry, got %+v", page)
+	}
+
+	if _, err := fs.Audit().Query(&models.AuditFilter{Limit: -1}); err != ErrInvalidAuditFilter {
+		t.Errorf("Expected ErrInvalidAuditFilter, got %v", err)
+	}
+}
+
+func TestAudit_LogIsAppendOnly(t *testing.T) {
+	fs := setupAuditFileService(t)
+
+	if _, err := fs.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := fs.repo.DB().Exec("UPDATE audit_log SET actor = 'someone else'"); err == nil {
+		t.Error("Expected updates of the audit log to be refused")
+	}
+	if _, err := fs.repo.DB().Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("Expected deletes from the audit log to be refused")
+	}
+
+	entries, _ := fs.Audit().Query(&models.AuditFilter{})
+	if len(entries) != 1 || entries[0].Actor != "" {
+		t.Errorf("Expected the entry to be unchanged, got %+v", entries)
+	}
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/security"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidSession     = errors.New("invalid or expired session")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("username is already taken")
+	ErrInvalidUsername    = errors.New("username must be 3-64 letters, digits, dots, dashes or underscores")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters long")
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 1024
+	sessionTokenBytes = 32
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,64}$`)
+
+// AuthService manages user accounts and the sessions and API keys they authenticate with
+type AuthService struct {
+	users      *repository.UserRepository
+	sessionTTL time.Duration
+
+	// dummyHash is verified against when a username does not exist, so that
+	// failed logins take the same time whether or not the user exists
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+func NewAuthService(users *repository.UserRepository, sessionTTL time.Duration) *AuthService {
+	return &AuthService{
+		users:      users,
+		sessionTTL: sessionTTL,
+	}
+}
+
+// CreateUser validates the credentials and stores a new user with a hashed password
+func (s *AuthService) CreateUser(username, password string, isAdmin bool) (*models.User, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
+	hash, err := security.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:     username,
+		PasswordHash: hash,
+		IsAdmin:      isAdmin,
+	}
+	if err := s.users.CreateUser(user); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// EnsureAdmin creates an admin account when no user exists yet. When password is empty a
+// random one is generated and returned so it can be shown to the operator once.
+func (s *AuthService) EnsureAdmin(username, password string) (generatedPassword string, err error) {
+	count, err := s.users.CountUsers()
+	if err != nil {
+		return "", fmt.Errorf("failed to count users: %w", err)
+	}
+	if count > 0 {
+		return "", nil
+	}
+
+	if password == "" {
+		password, err = randomToken(18)
+		if err != nil {
+			return "", err
+		}
+		generatedPassword = password
+	}
+
+	if _, err := s.CreateUser(username, password, true); err != nil {
+		return "", fmt.Errorf("failed to create admin user: %w", err)
+	}
+	return generatedPassword, nil
+}
+
+// ChangePassword replaces the password of a user after checking the current one, and signs
+// out every other session of the user. The session of currentToken, the token the change was
+// made with, stays signed in.
+func (s *AuthService) ChangePassword(userID int64, currentToken, currentPassword, newPassword string) error {
+	user, err := s.users.GetUserByID(userID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := security.VerifyPassword(currentPassword, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hash, err := security.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.users.UpdatePassword(userID, hash, hashToken(currentToken))
+}
+
+func (s *AuthService) ListUsers() ([]*models.User, error) {
+	return s.users.ListUsers()
+}
+
+func (s *AuthService) DeleteUser(id int64) error {
+	if err := s.users.DeleteUser(id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Login checks the credentials and starts a session. The returned token is only known
+// to the client; the database keeps its hash.
+func (s *AuthService) Login(username, password string) (string, *models.Session, *models.User, error) {
+	user, err := s.users.GetUserByUsername(username)
+	if err == sql.ErrNoRows {
+		security.VerifyPassword(password, s.getDummyHash())
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	ok, err := security.VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if !ok {
+		return "", nil, nil, ErrInvalidCredentials
+	}
+
+	token, err := randomToken(sessionTokenBytes)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &models.Session{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL),
+	}
+	if err := s.users.CreateSession(session); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// Sign-ins are rare enough to double as the cleanup of expired sessions
+	s.users.DeleteExpiredSessions(now)
+
+	return token, session, user, nil
+}
+
+// Authenticate returns the user a session token belongs to
+func (s *AuthService) Authenticate(token string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidSession
+	}
+
+	_, user, err := s.users.GetSessionUser(hashToken(token), time.Now())
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Logout ends the session of token
+func (s *AuthService) Logout(token string) error {
+	return s.users.DeleteSession(hashToken(token))
+}
+
+func (s *AuthService) getDummyHash() string {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = security.HashPassword("cloudlet-dummy-password")
+	})
+	return s.dummyHash
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type userContextKey struct{}
+
+// ContextWithUser returns a copy of ctx carrying the authenticated user
+func ContextWithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user of a request, or nil when authentication is disabled
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userContextKey{}).(*models.User)
+	return user
+}
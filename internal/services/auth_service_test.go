@@ -0,0 +1,211 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+func setupAuthService(t *testing.T, sessionTTL time.Duration) *AuthService {
+	auth, _ := setupAuthServiceWithDB(t, sessionTTL)
+	return auth
+}
+
+// setupAuthServiceWithDB also returns the database so tests can adjust stored rows
+func setupAuthServiceWithDB(t *testing.T, sessionTTL time.Duration) (*AuthService, *sql.DB) {
+	tempDir := t.TempDir()
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return NewAuthService(repository.NewUserRepository(repo.DB()), sessionTTL), repo.DB()
+}
+
+func TestAuthService_LoginAuthenticateLogout(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	if _, err := auth.CreateUser("alice", "correct horse", false); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	token, session, user, err := auth.Login("ALICE", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if token == "" || session.TokenHash == token {
+		t.Error("Expected a token that is stored only as a hash")
+	}
+	if user.Username != "alice" {
+		t.Errorf("Expected user alice, got %s", user.Username)
+	}
+
+	authenticated, err := auth.Authenticate(token)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if authenticated.ID != user.ID {
+		t.Errorf("Expected user %d, got %d", user.ID, authenticated.ID)
+	}
+
+	if err := auth.Logout(token); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := auth.Authenticate(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession after logout, got %v", err)
+	}
+}
+
+func TestAuthService_InvalidCredentials(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	if _, err := auth.CreateUser("alice", "correct horse", false); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if _, _, _, err := auth.Login("alice", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+	if _, _, _, err := auth.Login("bob", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for an unknown user, got %v", err)
+	}
+	if _, err := auth.Authenticate("not-a-token"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession for an unknown token, got %v", err)
+	}
+}
+
+func TestAuthService_ExpiredSession(t *testing.T) {
+	auth := setupAuthService(t, -time.Minute)
+
+	if _, err := auth.CreateUser("alice", "correct horse", false); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	token, _, _, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if _, err := auth.Authenticate(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected ErrInvalidSession for an expired session, got %v", err)
+	}
+}
+
+func TestAuthService_CreateUserValidation(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	if _, err := auth.CreateUser("a", "correct horse", false); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("Expected ErrInvalidUsername, got %v", err)
+	}
+	if _, err := auth.CreateUser("alice", "short", false); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := auth.CreateUser("alice", "correct horse", false); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := auth.CreateUser("Alice", "another password", false); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for a username differing only in case, got %v", err)
+	}
+}
+
+func TestAuthService_EnsureAdmin(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	generated, err := auth.EnsureAdmin("admin", "")
+	if err != nil {
+		t.Fatalf("EnsureAdmin failed: %v", err)
+	}
+	if generated == "" {
+		t.Fatal("Expected a generated password")
+	}
+
+	_, _, user, err := auth.Login("admin", generated)
+	if err != nil {
+		t.Fatalf("Login with generated password failed: %v", err)
+	}
+	if !user.IsAdmin {
+		t.Error("Expected the bootstrap user to be an admin")
+	}
+
+	again, err := auth.EnsureAdmin("admin", "")
+	if err != nil {
+		t.Fatalf("Second EnsureAdmin failed: %v", err)
+	}
+	if again != "" {
+		t.Error("Expected no admin to be created once users exist")
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	user, err := auth.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	current, _, _, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	other, _, _, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if err := auth.ChangePassword(user.ID, current, "wrong password", "battery staple"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := auth.ChangePassword(user.ID, current, "correct horse", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := auth.Authenticate(other); err != nil {
+		t.Fatalf("Expected sessions to be kept while the password is unchanged, got %v", err)
+	}
+	if err := auth.ChangePassword(user.ID, current, "correct horse", "battery staple"); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+
+	if _, err := auth.Authenticate(current); err != nil {
+		t.Errorf("Expected the session the password was changed from to stay signed in, got %v", err)
+	}
+	if _, err := auth.Authenticate(other); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected the other session to be signed out, got %v", err)
+	}
+
+	if _, _, _, err := auth.Login("alice", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to be rejected, got %v", err)
+	}
+	if _, _, _, err := auth.Login("alice", "battery staple"); err != nil {
+		t.Errorf("Login with new password failed: %v", err)
+	}
+}
+
+func TestAuthService_DeleteUser(t *testing.T) {
+	auth := setupAuthService(t, time.Hour)
+
+	user, err := auth.CreateUser("alice", "correct horse", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	token, _, _, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if err := auth.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := auth.Authenticate(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("Expected sessions of a deleted user to be invalid, got %v", err)
+	}
+	if err := auth.DeleteUser(user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
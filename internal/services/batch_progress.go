@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// Batch upload states reported in models.BatchUploadProgress.Status
+const (
+	BatchStatusProcessing = "processing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusFailed     = "failed"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// batchRetention is how long finished batches stay queryable so clients can read the final state
+const batchRetention = 10 * time.Minute
+
+var (
+	ErrBatchNotFound      = errors.New("batch not found")
+	ErrBatchAlreadyExists = errors.New("batch already exists")
+	ErrBatchNotActive     = errors.New("batch is not in progress")
+)
+
+// BatchProgressRegistry keeps the progress of running and recently finished batch uploads in memory
+type BatchProgressRegistry struct {
+	mu      sync.Mutex
+	batches map[string]*batchState
+}
+
+type batchState struct {
+	progress      models.BatchUploadProgress
+	ownerID       int64
+	totalSize     int64
+	processedSize int64
+	startTime     time.Time
+	finishedAt    time.Time
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// BatchTracker reports the progress of a single batch. A nil tracker ignores all updates,
+// so upload paths without progress tracking can share the same code.
+type BatchTracker struct {
+	registry   *BatchProgressRegistry
+	batchID    string
+	ctx        context.Context
+	onFileDone func(result models.FileUploadResult)
+
+	// indexOffset maps file indices of a sub-batch back to the whole batch
+	indexOffset int
+}
+
+// NewBatchProgressRegistry creates an empty registry
+func NewBatchProgressRegistry() *BatchProgressRegistry {
+	return &BatchProgressRegistry{
+		batches: make(map[string]*batchState),
+	}
+}
+
+// NewBatchTracker creates a tracker that is not part of any registry. It is used to
+// observe per-file results of uploads that cannot be queried or cancelled.
+func NewBatchTracker() *BatchTracker {
+	return &BatchTracker{ctx: context.Background()}
+}
+
+// Register starts tracking a batch uploaded by ownerID and returns the tracker used to
+// report its progress
+func (r *BatchProgressRegistry) Register(batchID string, ownerID int64, totalFiles int, totalSize int64) (*BatchTracker, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evictFinished()
+
+	if _, exists := r.batches[batchID]; exists {
+		return nil, ErrBatchAlreadyExists
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+
+	r.batches[batchID] = &batchState{
+		progress: models.BatchUploadProgress{
+			BatchID:    batchID,
+			TotalFiles: totalFiles,
+			StartTime:  now.UnixMilli(),
+			Status:     BatchStatusProcessing,
+		},
+		ownerID:   ownerID,
+		totalSize: totalSize,
+		startTime: now,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	return &BatchTracker{registry: r, batchID: batchID, ctx: ctx}, nil
+}
+
+// Get returns a snapshot of a batch's progress with the percentage and ETA filled in
+func (r *BatchProgressRegistry) Get(batchID string) (*models.BatchUploadProgress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, exists := r.batches[batchID]
+	if !exists {
+		return nil, ErrBatchNotFound
+	}
+
+	progress := state.progress
+	progress.PercentComplete = state.percentComplete()
+	progress.EstimatedTimeLeft = state.estimatedTimeLeft()
+	return &progress, nil
+}
+
+// Owner returns the user who uploads a batch, 0 for batches uploaded without one
+func (r *BatchProgressRegistry) Owner(batchID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, exists := r.batches[batchID]
+	if !exists {
+		return 0, ErrBatchNotFound
+	}
+	return state.ownerID, nil
+}
+
+// Cancel asks a running batch to stop. Files already being written finish first,
+// the remaining ones are skipped by the upload loop.
+func (r *BatchProgressRegistry) Cancel(batchID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, exists := r.batches[batchID]
+	if !exists {
+		return ErrBatchNotFound
+	}
+	if state.progress.Status != BatchStatusProcessing {
+		return ErrBatchNotActive
+	}
+
+	state.cancel()
+	return nil
+}
+
+func (r *BatchProgressRegistry) update(batchID string, fn func(state *batchState)) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if state, exists := r.batches[batchID]; exists {
+		fn(state)
+	}
+}
+
+// evictFinished drops finished batches older than batchRetention. Callers must hold r.mu.
+func (r *BatchProgressRegistry) evictFinished() {
+	cutoff := time.Now().Add(-batchRetention)
+	for id, state := range r.batches {
+		if !state.finishedAt.IsZero() && state.finishedAt.Before(cutoff) {
+			delete(r.batches, id)
+		}
+	}
+}
+
+func (s *batchState) percentComplete() float64 {
+	if s.progress.Status == BatchStatusCompleted {
+		return 100
+	}
+	if s.totalSize > 0 {
+		return float64(s.processedSize) / float64(s.totalSize) * 100
+	}
+	if s.progress.TotalFiles > 0 {
+		return float64(s.progress.ProcessedFiles) / float64(s.progress.TotalFiles) * 100
+	}
+	return 0
+}
+
+// estimatedTimeLeft extrapolates the remaining time in milliseconds from the throughput so far
+func (s *batchState) estimatedTimeLeft() int64 {
+	if s.progress.Status != BatchStatusProcessing {
+		return 0
+	}
+
+	elapsed := time.Since(s.startTime)
+	switch {
+	case s.totalSize > 0 && s.processedSize > 0:
+		remaining := s.totalSize - s.processedSize
+		return int64(float64(elapsed.Milliseconds()) * float64(remaining) / float64(s.processedSize))
+	case s.progress.ProcessedFiles > 0:
+		remaining := s.progress.TotalFiles - s.progress.ProcessedFiles
+		return elapsed.Milliseconds() * int64(remaining) / int64(s.progress.ProcessedFiles)
+	default:
+		return 0
+	}
+}
+
+// ID returns the batch ID, or an empty string for a nil tracker
+func (t *BatchTracker) ID() string {
+	if t == nil {
+		return ""
+	}
+	return t.batchID
+}
+
+// Cancelled reports whether cancellation of the batch was requested
+func (t *BatchTracker) Cancelled() bool {
+	return t != nil && t.ctx.Err() != nil
+}
+
+// StartFile records the file currently being processed
+func (t *BatchTracker) StartFile(filename string) {
+	if t == nil {
+		return
+	}
+	t.registry.update(t.batchID, func(state *batchState) {
+		state.progress.CurrentFile = filename
+	})
+}
+
+// OnFileDone registers a callback invoked with the result of every processed file.
+// It may be called from several upload workers at once.
+func (t *BatchTracker) OnFileDone(fn func(result models.FileUploadResult)) {
+	if t != nil {
+		t.onFileDone = fn
+	}
+}
+
+// SetIndexOffset sets the position of the next sub-batch within the whole batch,
+// so results passed to OnFileDone carry their index in the original request
+func (t *BatchTracker) SetIndexOffset(offset int) {
+	if t != nil {
+		t.indexOffset = offset
+	}
+}
+
+// FileDone records the outcome of a processed file
+func (t *BatchTracker) FileDone(result models.FileUploadResult) {
+	if t == nil {
+		return
+	}
+	if t.onFileDone != nil {
+		result.Index += t.indexOffset
+		t.onFileDone(result)
+	}
+	t.registry.update(t.batchID, func(state *batchState) {
+		state.progress.ProcessedFiles++
+		state.processedSize += result.Size
+		if result.Success {
+			state.progress.SuccessfulFiles++
+		} else {
+			state.progress.FailedFiles++
+		}
+	})
+}
+
+// FilesRolledBack moves files that were stored and then removed again from the successful to the failed count
+func (t *BatchTracker) FilesRolledBack(count int) {
+	if t == nil || count == 0 {
+		return
+	}
+	t.registry.update(t.batchID, func(state *batchState) {
+		state.progress.SuccessfulFiles -= count
+		state.progress.FailedFiles += count
+	})
+}
+
+// Finish marks the batch with its final status and releases its cancellation context
+func (t *BatchTracker) Finish(status string) {
+	if t == nil {
+		return
+	}
+	t.registry.update(t.batchID, func(state *batchState) {
+		state.progress.Status = status
+		state.progress.CurrentFile = ""
+		state.finishedAt = time.Now()
+		state.cancel()
+	})
+}
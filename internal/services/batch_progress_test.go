@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// buildFileHeaders parses an in-memory multipart form so tests get real, openable file headers
+func buildFileHeaders(t *testing.T, files map[string]string) []*multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("Failed to parse form: %v", err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+
+	return form.File["files"]
+}
+
+func setupBatchUploadService(t *testing.T, cleanupOnFailure bool) (*MultipleUploadService, *FileService) {
+	fileService := setupRealFileService(t)
+
+	cfg := &config.Config{}
+	cfg.Server.MaxFileSize = 1024 * 1024
+	cfg.Server.Upload.MaxFilesPerRequest = 10
+	cfg.Server.Upload.MaxTotalSizePerRequest = 10 * 1024 * 1024
+	cfg.Server.Upload.StreamingThreshold = 1024 * 1024
+	cfg.Server.Upload.CleanupOnFailure = cleanupOnFailure
+
+	return NewMultipleUploadService(fileService, cfg, t.TempDir()), fileService
+}
+
+func TestBatchProgressRegistry_Tracking(t *testing.T) {
+	registry := NewBatchProgressRegistry()
+
+	tracker, err := registry.Register("batch-1", 0, 4, 400)
+	if err != nil {
+		t.Fatalf("Failed to register batch: %v", err)
+	}
+	if _, err := registry.Register("batch-1", 0, 1, 1); err != ErrBatchAlreadyExists {
+		t.Errorf("Expected ErrBatchAlreadyExists, got %v", err)
+	}
+
+	tracker.StartFile("a.txt")
+	tracker.FileDone(models.FileUploadResult{Filename: "a.txt", Size: 100, Success: true})
+	tracker.StartFile("b.txt")
+	tracker.FileDone(models.FileUploadResult{Filename: "b.txt", Size: 100})
+
+	progress, err := registry.Get("batch-1")
+	if err != nil {
+		t.Fatalf("Failed to get progress: %v", err)
+	}
+	if progress.ProcessedFiles != 2 || progress.SuccessfulFiles != 1 || progress.FailedFiles != 1 {
+		t.Errorf("Unexpected counts: %+v", progress)
+	}
+	if progress.PercentComplete != 50 {
+		t.Errorf("Expected 50%% complete, got %f", progress.PercentComplete)
+	}
+	if progress.CurrentFile != "b.txt" || progress.Status != BatchStatusProcessing {
+		t.Errorf("Unexpected state: %+v", progress)
+	}
+	if progress.StartTime == 0 || progress.EstimatedTimeLeft < 0 {
+		t.Errorf("Unexpected timing: %+v", progress)
+	}
+
+	tracker.Finish(BatchStatusCompleted)
+
+	progress, _ = registry.Get("batch-1")
+	if progress.PercentComplete != 100 || progress.EstimatedTimeLeft != 0 || progress.CurrentFile != "" {
+		t.Errorf("Unexpected finished state: %+v", progress)
+	}
+
+	if err := registry.Cancel("batch-1"); err != ErrBatchNotActive {
+		t.Errorf("Expected ErrBatchNotActive, got %v", err)
+	}
+	if _, err := registry.Get("missing"); err != ErrBatchNotFound {
+		t.Errorf("Expected ErrBatchNotFound, got %v", err)
+	}
+}
+
+func TestMultipleUploadService_CancelledBatch(t *testing.T) {
+	service, fileService := setupBatchUploadService(t, false)
+	files := buildFileHeaders(t, map[string]string{"one.txt": "1", "two.txt": "2"})
+
+	tracker, err := service.RegisterBatch("batch-cancel", files)
+	if err != nil {
+		t.Fatalf("Failed to register batch: %v", err)
+	}
+	if err := service.CancelBatchUpload("batch-cancel"); err != nil {
+		t.Fatalf("Failed to cancel batch: %v", err)
+	}
+
+	response := service.UploadMultipleFilesTracked(files, "/", tracker)
+
+	if response.SuccessfulFiles != 0 {
+		t.Errorf("Expected no files to be uploaded, got %d", response.SuccessfulFiles)
+	}
+	for _, result := range response.Files {
+		if result.Error != "Batch cancelled" {
+			t.Errorf("Expected %s to be cancelled, got error %q", result.Filename, result.Error)
+		}
+	}
+
+	listing, err := fileService.GetDirectoryListing("/")
+	if err != nil {
+		t.Fatalf("Failed to list root: %v", err)
+	}
+	if len(listing.Files) != 0 {
+		t.Errorf("Expected no stored files, got %d", len(listing.Files))
+	}
+}
+
+func TestMultipleUploadService_RollbackUploadedFiles(t *testing.T) {
+	service, fileService := setupBatchUploadService(t, true)
+	files := buildFileHeaders(t, map[string]string{"first.txt": "data", "second.txt": "more data"})
+
+	response := service.UploadMultipleFiles(files, "/")
+	if response.SuccessfulFiles != 2 {
+		t.Fatalf("Expected 2 uploaded files, got %d: %s", response.SuccessfulFiles, response.Message)
+	}
+
+	if rolledBack := service.RollbackUploadedFiles(response.Files); rolledBack != 2 {
+		t.Errorf("Expected 2 files rolled back, got %d", rolledBack)
+	}
+
+	for _, result := range response.Files {
+		if result.Success {
+			t.Errorf("Expected %s to be marked as failed", result.Filename)
+		}
+		if _, err := fileService.GetFileInfo("/" + result.Filename); err != ErrFileNotFound {
+			t.Errorf("Expected %s to be removed, got %v", result.Filename, err)
+		}
+	}
+}
+
+func TestMultipleUploadService_FullRollbackRestoresReplacedFiles(t *testing.T) {
+	service, fileService := setupBatchUploadService(t, true)
+	if err := fileService.SaveFile("notes.txt", "/", []byte("original")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	// The same name twice: the second replacement finds the file changed and fails the batch
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, content := range []string{"first", "second"} {
+		part, _ := writer.CreateFormFile("files", "notes.txt")
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("Failed to parse form: %v", err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+
+	response := service.UploadMultipleFiles(form.File["files"], "/")
+	if response.Success {
+		t.Fatalf("Expected the batch to fail, got %+v", response)
+	}
+	data, _, err := fileService.GetFileData("/notes.txt")
+	if err != nil || string(data) != "original" {
+		t.Errorf("Expected the original content back, got %q, %v", data, err)
+	}
+	if versions, _ := fileService.ListVersions("/notes.txt"); len(versions) != 0 {
+		t.Errorf("Expected the versions of the batch to be removed, got %+v", versions)
+	}
+
+	// A batch that succeeds keeps the replaced content as a version, until it is rolled back
+	response = service.UploadMultipleFiles(buildFileHeaders(t, map[string]string{"notes.txt": "replaced"}), "/")
+	if !response.Success || !response.Files[0].Replaced {
+		t.Fatalf("Expected the file to be replaced, got %+v", response)
+	}
+	if versions, _ := fileService.ListVersions("/notes.txt"); len(versions) != 1 {
+		t.Errorf("Expected the original content as a version, got %+v", versions)
+	}
+
+	if rolledBack := service.RollbackUploadedFiles(response.Files); rolledBack != 1 {
+		t.Fatalf("Expected 1 file rolled back, got %d: %+v", rolledBack, response.Files)
+	}
+	data, _, err = fileService.GetFileData("/notes.txt")
+	if err != nil || string(data) != "original" {
+		t.Errorf("Expected the original content back, got %q, %v", data, err)
+	}
+	if versions, _ := fileService.ListVersions("/notes.txt"); len(versions) != 0 {
+		t.Errorf("Expected no versions left, got %+v", versions)
+	}
+}
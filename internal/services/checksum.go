@@ -0,0 +1,44 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/storage"
+)
+
+var (
+	// ErrChecksumMismatch is returned when uploaded data does not match the expected checksum
+	ErrChecksumMismatch = storage.ErrChecksumMismatch
+	ErrInvalidChecksum  = errors.New("checksum must be a hex encoded SHA-256")
+)
+
+// NormalizeChecksum validates an expected SHA-256 given as hex, optionally prefixed with
+// "sha256:", and returns it in lower case. An empty checksum means nothing is expected.
+func NormalizeChecksum(checksum string) (string, error) {
+	checksum = strings.TrimSpace(checksum)
+	if checksum == "" {
+		return "", nil
+	}
+
+	if prefix, value, found := strings.Cut(checksum, ":"); found {
+		if !strings.EqualFold(prefix, "sha256") && !strings.EqualFold(prefix, "sha-256") {
+			return "", ErrInvalidChecksum
+		}
+		checksum = value
+	}
+
+	decoded, err := hex.DecodeString(checksum)
+	if err != nil || len(decoded) != 32 {
+		return "", ErrInvalidChecksum
+	}
+	return strings.ToLower(checksum), nil
+}
+
+// ChecksumBytes returns the hex SHA-256 of data
+func ChecksumBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
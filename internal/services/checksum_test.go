@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// sha256 of "hello world"
+const helloWorldSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+func TestFileService_SaveFileWithChecksum(t *testing.T) {
+	service := setupRealFileService(t)
+
+	saved, err := service.SaveFileWithChecksum("hello.txt", "/", []byte("hello world"), "")
+	if err != nil {
+		t.Fatalf("SaveFileWithChecksum failed: %v", err)
+	}
+	if saved.Checksum != helloWorldSHA256 {
+		t.Errorf("Expected checksum %s, got %s", helloWorldSHA256, saved.Checksum)
+	}
+
+	info, err := service.GetFileInfo("/hello.txt")
+	if err != nil {
+		t.Fatalf("GetFileInfo failed: %v", err)
+	}
+	if info.Checksum != helloWorldSHA256 {
+		t.Errorf("Expected stored checksum %s, got %s", helloWorldSHA256, info.Checksum)
+	}
+
+	// Expected checksums are accepted in upper case and with an algorithm prefix
+	if _, err := service.SaveFileWithChecksum("upper.txt", "/", []byte("hello world"), "sha256:"+strings.ToUpper(helloWorldSHA256)); err != nil {
+		t.Errorf("Matching checksum rejected: %v", err)
+	}
+}
+
+func TestFileService_SaveFileStreamWithChecksum(t *testing.T) {
+	service := setupRealFileService(t)
+
+	saved, err := service.SaveFileStreamWithChecksum("stream.txt", "/", strings.NewReader("hello world"), 11, helloWorldSHA256)
+	if err != nil {
+		t.Fatalf("SaveFileStreamWithChecksum failed: %v", err)
+	}
+	if saved.Checksum != helloWorldSHA256 {
+		t.Errorf("Expected checksum %s, got %s", helloWorldSHA256, saved.Checksum)
+	}
+
+	info, err := service.GetFileInfo("/stream.txt")
+	if err != nil {
+		t.Fatalf("GetFileInfo failed: %v", err)
+	}
+	if info.Checksum != helloWorldSHA256 {
+		t.Errorf("Expected stored checksum %s, got %s", helloWorldSHA256, info.Checksum)
+	}
+}
+
+func TestFileService_ChecksumMismatch(t *testing.T) {
+	service := setupRealFileService(t)
+	wrong := strings.Repeat("0", 64)
+
+	_, err := service.SaveFileWithChecksum("data.txt", "/", []byte("hello world"), wrong)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	_, err = service.SaveFileStreamWithChecksum("stream.txt", "/", strings.NewReader("hello world"), 11, wrong)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	// Rejected uploads leave neither a record nor a file behind
+	for _, path := range []string{"/data.txt", "/stream.txt"} {
+		if _, err := service.GetFileInfo(path); err == nil {
+			t.Errorf("Expected no record for %s", path)
+		}
+		if _, err := os.Stat(service.storage.GetPhysicalPath(path)); !os.IsNotExist(err) {
+			t.Errorf("Expected no stored file for %s, got %v", path, err)
+		}
+	}
+
+	if _, err := service.SaveFileWithChecksum("bad.txt", "/", []byte("x"), "not-a-checksum"); !errors.Is(err, ErrInvalidChecksum) {
+		t.Errorf("Expected ErrInvalidChecksum, got %v", err)
+	}
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/security"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadSessionExpired  = errors.New("upload session expired")
+	ErrChunkOutOfRange       = errors.New("chunk index out of range")
+	ErrChunkOffsetMismatch   = errors.New("chunk offset does not match chunk index")
+	ErrChunkSizeMismatch     = errors.New("chunk size does not match expected size")
+	ErrUploadIncomplete      = errors.New("upload is missing chunks")
+)
+
+const (
+	sessionMetadataFile = "session.json"
+	chunkFilePrefix     = "chunk-"
+	minChunkSize        = 64 * 1024
+)
+
+// ChunkedUploadService implements resumable uploads. Each session is a directory
+// in the storage staging area holding its metadata and one file per received chunk,
+// so the set of received chunks survives restarts and can be queried at any time.
+type ChunkedUploadService struct {
+	fileService *FileService
+	cfg         *config.Config
+	stagingRoot string
+
+	// Per-session locks serialise completion against concurrent chunk writes
+	sessionLocks sync.Map
+}
+
+// NewChunkedUploadService creates a new chunked upload service
+func NewChunkedUploadService(fileService *FileService, cfg *config.Config) *ChunkedUploadService {
+	stagingRoot := fileService.storage.StagingPath("uploads")
+	os.MkdirAll(stagingRoot, 0755)
+
+	return &ChunkedUploadService{
+		fileService: fileService,
+		cfg:         cfg,
+		stagingRoot: stagingRoot,
+	}
+}
+
+// CreateSession validates the target and allocates a new upload session
+func (s *ChunkedUploadService) CreateSession(req *models.CreateUploadSessionRequest) (*models.UploadSession, error) {
+	return s.CreateSessionFor(s.fileService, req)
+}
+
+// CreateSessionFor is CreateSession with the target directory resolved by files, a view
+// returned by FileService.ForUser, so the upload lands in the home directory of its user
+// and is owned by it
+func (s *ChunkedUploadService) CreateSessionFor(files *FileService, req *models.CreateUploadSessionRequest) (*models.UploadSession, error) {
+	if err := security.IsValidFilename(req.Filename); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	parentPath, err := files.ResolvePath(req.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	if req.TotalSize <= 0 {
+		return nil, errors.New("total size must be greater than zero")
+	}
+	if req.TotalSize > s.cfg.Server.MaxFileSize {
+		return nil, fmt.Errorf("file too large. Max size: %d bytes", s.cfg.Server.MaxFileSize)
+	}
+	if err := files.CheckQuota(req.Path, req.TotalSize, 1); err != nil {
+		return nil, err
+	}
+
+	checksum, err := NormalizeChecksum(req.Checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := req.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = s.cfg.Server.Upload.ChunkSize
+	}
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	// Opportunistically drop sessions nobody came back for
+	s.cleanupExpiredSessions()
+
+	now := time.Now()
+	session := &models.UploadSession{
+		ID:          uuid.New().String(),
+		Filename:    req.Filename,
+		Path:        parentPath,
+		TotalSize:   req.TotalSize,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((req.TotalSize + chunkSize - 1) / chunkSize),
+		Checksum:    checksum,
+		OwnerID:     files.Owner(),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.sessionTTL()),
+	}
+
+	sessionDir := s.sessionDir(session.ID)
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		os.RemoveAll(sessionDir)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(sessionDir, sessionMetadataFile), data, 0644); err != nil {
+		os.RemoveAll(sessionDir)
+		return nil, fmt.Errorf("failed to write session metadata: %w", err)
+	}
+
+	return s.withProgress(session)
+}
+
+// GetSession returns the session along with the chunks received so far
+func (s *ChunkedUploadService) GetSession(id string) (*models.UploadSession, error) {
+	session, err := s.loadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.withProgress(session)
+}
+
+// WriteChunk stores a single chunk. Offset is optional (-1 to skip the check) and,
+// when present, must match the byte position implied by the chunk index.
+// Re-sending a chunk overwrites the previous copy, which makes retries safe.
+func (s *ChunkedUploadService) WriteChunk(id string, index int, offset int64, reader io.Reader) (*models.UploadSession, error) {
+	session, err := s.loadSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= session.TotalChunks {
+		return nil, ErrChunkOutOfRange
+	}
+
+	start := int64(index) * session.ChunkSize
+	if offset >= 0 && offset != start {
+		return nil, ErrChunkOffsetMismatch
+	}
+
+	expected := session.ChunkSize
+	if remaining := session.TotalSize - start; remaining < expected {
+		expected = remaining
+	}
+
+	lock := s.sessionLock(id)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	chunkPath := s.chunkPath(id, index)
+	partPath := fmt.Sprintf("%s.%s.part", chunkPath, uuid.New().String())
+
+	part, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chunk file: %w", err)
+	}
+
+	// Read one byte past the expected size so oversized chunks are detected
+	written, err := io.Copy(part, io.LimitReader(reader, expected+1))
+	closeErr := part.Close()
+
+	if err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if closeErr != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to close chunk file: %w", closeErr)
+	}
+	if written != expected {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrChunkSizeMismatch, expected, written)
+	}
+
+	if err := os.Rename(partPath, chunkPath); err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to commit chunk: %w", err)
+	}
+
+	return s.withProgress(session)
+}
+
+// CompleteSession assembles the chunks in order and commits them through the
+// regular streaming save path, then discards the staged chunks
+func (s *ChunkedUploadService) CompleteSession(id string) (*models.UploadSession, error) {
+	session, err := s.loadSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.sessionLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, err = s.withProgress(session)
+	if err != nil {
+		return nil, err
+	}
+	if !session.Complete {
+		return session, fmt.Errorf("%w: %d of %d chunks received", ErrUploadIncomplete, len(session.ReceivedChunks), session.TotalChunks)
+	}
+
+	reader := &chunkSequenceReader{service: s, sessionID: id, total: session.TotalChunks}
+	defer reader.Close()
+
+	// A checksum mismatch keeps the session, so the client can still abort it explicitly
+	saved, err := s.fileService.OwnedBy(session.OwnerID).SaveFileStreamWithChecksum(session.Filename, session.Path, reader, session.TotalSize, session.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	session.Checksum = saved.Checksum
+
+	s.removeSession(id)
+	return session, nil
+}
+
+// AbortSession discards a session and all of its staged chunks
+func (s *ChunkedUploadService) AbortSession(id string) error {
+	if _, err := s.loadSession(id); err != nil && !errors.Is(err, ErrUploadSessionExpired) {
+		return err
+	}
+
+	lock := s.sessionLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.removeSession(id)
+	return nil
+}
+
+func (s *ChunkedUploadService) loadSession(id string) (*models.UploadSession, error) {
+	// Session IDs are used as directory names, so only accept well-formed UUIDs
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.sessionDir(id), sessionMetadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to read session metadata: %w", err)
+	}
+
+	session := &models.UploadSession{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("corrupt session metadata: %w", err)
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadSessionExpired
+	}
+
+	return session, nil
+}
+
+// withProgress fills in the received/missing chunk lists from the chunk files on disk
+func (s *ChunkedUploadService) withProgress(session *models.UploadSession) (*models.UploadSession, error) {
+	entries, err := os.ReadDir(s.sessionDir(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	received := make(map[int]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, chunkFilePrefix) || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(name, chunkFilePrefix))
+		if err != nil || index < 0 || index >= session.TotalChunks {
+			continue
+		}
+		received[index] = true
+	}
+
+	session.ReceivedChunks = make([]int, 0, len(received))
+	session.MissingChunks = make([]int, 0, session.TotalChunks-len(received))
+	session.BytesReceived = 0
+
+	for i := 0; i < session.TotalChunks; i++ {
+		if received[i] {
+			session.ReceivedChunks = append(session.ReceivedChunks, i)
+			session.BytesReceived += s.chunkLength(session, i)
+		} else {
+			session.MissingChunks = append(session.MissingChunks, i)
+		}
+	}
+	session.Complete = len(session.MissingChunks) == 0
+
+	return session, nil
+}
+
+func (s *ChunkedUploadService) chunkLength(session *models.UploadSession, index int) int64 {
+	start := int64(index) * session.ChunkSize
+	if remaining := session.TotalSize - start; remaining < session.ChunkSize {
+		return remaining
+	}
+	return session.ChunkSize
+}
+
+// cleanupExpiredSessions removes sessions whose TTL has elapsed
+func (s *ChunkedUploadService) cleanupExpiredSessions() {
+	entries, err := os.ReadDir(s.stagingRoot)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := s.loadSession(entry.Name()); err == ErrUploadSessionExpired {
+			s.removeSession(entry.Name())
+		}
+	}
+}
+
+func (s *ChunkedUploadService) removeSession(id string) {
+	os.RemoveAll(s.sessionDir(id))
+	s.sessionLocks.Delete(id)
+}
+
+func (s *ChunkedUploadService) sessionLock(id string) *sync.RWMutex {
+	lock, _ := s.sessionLocks.LoadOrStore(id, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+func (s *ChunkedUploadService) sessionTTL() time.Duration {
+	hours := s.cfg.Server.Upload.SessionTTLHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (s *ChunkedUploadService) sessionDir(id string) string {
+	return filepath.Join(s.stagingRoot, id)
+}
+
+func (s *ChunkedUploadService) chunkPath(id string, index int) string {
+	return filepath.Join(s.sessionDir(id), fmt.Sprintf("%s%06d", chunkFilePrefix, index))
+}
+
+// chunkSequenceReader reads the staged chunks back to back, opening one file at a time
+type chunkSequenceReader struct {
+	service   *ChunkedUploadService
+	sessionID string
+	total     int
+	index     int
+	current   *os.File
+}
+
+func (r *chunkSequenceReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.index >= r.total {
+				return 0, io.EOF
+			}
+			file, err := os.Open(r.service.chunkPath(r.sessionID, r.index))
+			if err != nil {
+				return 0, fmt.Errorf("failed to open chunk %d: %w", r.index, err)
+			}
+			r.current = file
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			r.index++
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkSequenceReader) Close() error {
+	if r.current != nil {
+		err := r.current.Close()
+		r.current = nil
+		return err
+	}
+	return nil
+}
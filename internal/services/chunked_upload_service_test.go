@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func setupChunkedUploadService(t *testing.T) (*ChunkedUploadService, *FileService) {
+	fileService := setupRealFileService(t)
+
+	cfg := &config.Config{}
+	cfg.Server.MaxFileSize = 10 * 1024 * 1024
+	cfg.Server.Upload.ChunkSize = minChunkSize
+	cfg.Server.Upload.SessionTTLHours = 1
+
+	return NewChunkedUploadService(fileService, cfg), fileService
+}
+
+func TestChunkedUploadService_ResumableUpload(t *testing.T) {
+	service, fileService := setupChunkedUploadService(t)
+
+	content := bytes.Repeat([]byte("0123456789"), minChunkSize/10*2+500)
+	session, err := service.CreateSession(&models.CreateUploadSessionRequest{
+		Filename:  "large.bin",
+		Path:      "/",
+		TotalSize: int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if session.TotalChunks != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", session.TotalChunks)
+	}
+	if len(session.MissingChunks) != 3 {
+		t.Errorf("Expected all chunks missing, got %v", session.MissingChunks)
+	}
+
+	chunk := func(i int) []byte {
+		start := i * minChunkSize
+		end := start + minChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		return content[start:end]
+	}
+
+	// Upload chunks out of order, leaving one missing
+	if _, err := service.WriteChunk(session.ID, 2, -1, bytes.NewReader(chunk(2))); err != nil {
+		t.Fatalf("WriteChunk 2 failed: %v", err)
+	}
+	if _, err := service.WriteChunk(session.ID, 0, 0, bytes.NewReader(chunk(0))); err != nil {
+		t.Fatalf("WriteChunk 0 failed: %v", err)
+	}
+
+	status, err := service.GetSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if len(status.MissingChunks) != 1 || status.MissingChunks[0] != 1 {
+		t.Errorf("Expected chunk 1 missing, got %v", status.MissingChunks)
+	}
+
+	if _, err := service.CompleteSession(session.ID); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("Expected ErrUploadIncomplete, got %v", err)
+	}
+
+	if _, err := service.WriteChunk(session.ID, 1, int64(minChunkSize), bytes.NewReader(chunk(1))); err != nil {
+		t.Fatalf("WriteChunk 1 failed: %v", err)
+	}
+
+	if _, err := service.CompleteSession(session.ID); err != nil {
+		t.Fatalf("CompleteSession failed: %v", err)
+	}
+
+	file, info, err := fileService.OpenFileForRead("/large.bin")
+	if err != nil {
+		t.Fatalf("Failed to open assembled file: %v", err)
+	}
+	defer file.Close()
+
+	data, _ := io.ReadAll(file)
+	if !bytes.Equal(data, content) {
+		t.Error("Assembled file does not match uploaded content")
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), info.Size)
+	}
+
+	if _, err := service.GetSession(session.ID); !errors.Is(err, ErrUploadSessionNotFound) {
+		t.Errorf("Expected session to be removed after completion, got %v", err)
+	}
+	if _, err := os.Stat(service.sessionDir(session.ID)); !os.IsNotExist(err) {
+		t.Error("Expected staged chunks to be removed after completion")
+	}
+}
+
+func TestChunkedUploadService_ChunkValidation(t *testing.T) {
+	service, _ := setupChunkedUploadService(t)
+
+	session, err := service.CreateSession(&models.CreateUploadSessionRequest{
+		Filename:  "file.bin",
+		TotalSize: int64(minChunkSize + 10),
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if _, err := service.WriteChunk(session.ID, 5, -1, strings.NewReader("x")); !errors.Is(err, ErrChunkOutOfRange) {
+		t.Errorf("Expected ErrChunkOutOfRange, got %v", err)
+	}
+	if _, err := service.WriteChunk(session.ID, 1, 0, strings.NewReader("0123456789")); !errors.Is(err, ErrChunkOffsetMismatch) {
+		t.Errorf("Expected ErrChunkOffsetMismatch, got %v", err)
+	}
+	if _, err := service.WriteChunk(session.ID, 1, -1, strings.NewReader("too long for the last chunk")); !errors.Is(err, ErrChunkSizeMismatch) {
+		t.Errorf("Expected ErrChunkSizeMismatch for oversized chunk, got %v", err)
+	}
+	if _, err := service.WriteChunk(session.ID, 1, -1, strings.NewReader("short")); !errors.Is(err, ErrChunkSizeMismatch) {
+		t.Errorf("Expected ErrChunkSizeMismatch for short chunk, got %v", err)
+	}
+	if _, err := service.WriteChunk("../../etc", 0, -1, strings.NewReader("x")); !errors.Is(err, ErrUploadSessionNotFound) {
+		t.Errorf("Expected ErrUploadSessionNotFound for malformed id, got %v", err)
+	}
+}
+
+func TestChunkedUploadService_CreateSessionValidation(t *testing.T) {
+	service, _ := setupChunkedUploadService(t)
+
+	tests := []struct {
+		name string
+		req  models.CreateUploadSessionRequest
+	}{
+		{"invalid filename", models.CreateUploadSessionRequest{Filename: "a/b.txt", TotalSize: 10}},
+		{"path traversal", models.CreateUploadSessionRequest{Filename: "a.txt", Path: "/../etc", TotalSize: 10}},
+		{"zero size", models.CreateUploadSessionRequest{Filename: "a.txt", TotalSize: 0}},
+		{"too large", models.CreateUploadSessionRequest{Filename: "a.txt", TotalSize: 11 * 1024 * 1024}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CreateSession(&tt.req); err == nil {
+				t.Error("Expected CreateSession to fail")
+			}
+		})
+	}
+}
+
+func TestChunkedUploadService_AbortSession(t *testing.T) {
+	service, _ := setupChunkedUploadService(t)
+
+	session, err := service.CreateSession(&models.CreateUploadSessionRequest{Filename: "a.txt", TotalSize: 10})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if err := service.AbortSession(session.ID); err != nil {
+		t.Fatalf("AbortSession failed: %v", err)
+	}
+	if _, err := service.GetSession(session.ID); !errors.Is(err, ErrUploadSessionNotFound) {
+		t.Errorf("Expected session to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/storage"
+)
+
+// EnableDeduplication stores the content of new files once in the content-addressed
+// blob store. Files saved before it was enabled keep their verbatim copies.
+func (s *FileService) EnableDeduplication() {
+	s.deduplicate = true
+}
+
+// saveBlobFile stores the content of a new file in the blob store and records the
+// file with a reference to it. Identical content is only kept once.
+func (s *FileService) saveBlobFile(file *models.FileInfo, reader io.Reader, expectedChecksum string) error {
+	staged, err := s.storage.StageBlob(reader, expectedChecksum)
+	if err != nil {
+		return err
+	}
+	defer staged.Discard()
+
+	s.blobMu.RLock()
+	defer s.blobMu.RUnlock()
+
+	if err := s.storage.CommitBlob(staged); err != nil {
+		return err
+	}
+
+	file.Checksum = staged.Checksum
+	file.BlobRef = staged.Checksum
+	return s.repo.InsertFile(file)
+}
+
+// commitBlob writes content straight into the blob store. Callers must hold blobMu
+// until the file referencing the blob has been recorded.
+func (s *FileService) commitBlob(reader io.Reader, expectedChecksum string) error {
+	staged, err := s.storage.StageBlob(reader, expectedChecksum)
+	if err != nil {
+		return err
+	}
+	defer staged.Discard()
+
+	return s.storage.CommitBlob(staged)
+}
+
+// archiveVerbatimCopy copies the verbatim content stored at filePath into the blob store
+// and returns the checksum of the blob. Callers hold blobMu like for commitBlob.
+func (s *FileService) archiveVerbatimCopy(filePath string) (string, error) {
+	content, err := s.storage.OpenFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	staged, err := s.storage.StageBlob(content, "")
+	if err != nil {
+		return "", err
+	}
+	defer staged.Discard()
+
+	if err := s.storage.CommitBlob(staged); err != nil {
+		return "", err
+	}
+	return staged.Checksum, nil
+}
+
+// openStoredFile opens the content of a file, wherever it is stored
+func (s *FileService) openStoredFile(info *models.FileInfo) (storage.File, error) {
+	if info.BlobRef != "" {
+		return s.storage.OpenBlob(info.BlobRef)
+	}
+	return s.storage.OpenFile(info.Path)
+}
+
+// readStoredFile reads the content of a file, wherever it is stored
+func (s *FileService) readStoredFile(info *models.FileInfo) ([]byte, error) {
+	if info.BlobRef != "" {
+		return s.storage.ReadBlob(info.BlobRef)
+	}
+	return s.storage.ReadFile(info.Path)
+}
+
+// CollectGarbage removes blobs that no file references anymore, as well as blobs
+// committed by uploads that failed before their file was recorded
+func (s *FileService) CollectGarbage() (*models.GarbageCollectionResult, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	result := &models.GarbageCollectionResult{}
+
+	// Versions and trash items past their retention release their blobs first, so those are collected in this run
+	if _, err := s.PruneVersions(); err != nil {
+		return nil, fmt.Errorf("failed to prune versions: %w", err)
+	}
+	if _, err := s.PurgeExpiredTrash(); err != nil {
+		return nil, fmt.Errorf("failed to purge expired trash: %w", err)
+	}
+
+	unreferenced, err := s.repo.GetUnreferencedBlobs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unreferenced blobs: %w", err)
+	}
+
+	for _, checksum := range unreferenced {
+		deleted, err := s.repo.DeleteUnreferencedBlob(checksum)
+		if err != nil {
+			return result, fmt.Errorf("failed to delete blob record %s: %w", checksum, err)
+		}
+		if !deleted {
+			continue
+		}
+
+		freed, err := s.storage.DeleteBlob(checksum)
+		if err != nil {
+			return result, fmt.Errorf("failed to delete blob %s: %w", checksum, err)
+		}
+		result.RemovedBlobs++
+		result.FreedBytes += freed
+	}
+
+	stored, err := s.storage.ListBlobs()
+	if err != nil {
+		return result, fmt.Errorf("failed to list stored blobs: %w", err)
+	}
+
+	for _, checksum := range stored {
+		exists, err := s.repo.BlobExists(checksum)
+		if err != nil {
+			return result, err
+		}
+		if exists {
+			continue
+		}
+
+		freed, err := s.storage.DeleteBlob(checksum)
+		if err != nil {
+			return result, fmt.Errorf("failed to delete orphaned blob %s: %w", checksum, err)
+		}
+		result.RemovedBlobs++
+		result.FreedBytes += freed
+	}
+
+	return result, nil
+}
+
+// GetDeduplicationStats reports how much space the blob store saves
+func (s *FileService) GetDeduplicationStats() (*models.DeduplicationStats, error) {
+	blobs, storedSize, logicalSize, err := s.repo.GetBlobStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DeduplicationStats{
+		Enabled:     s.deduplicate,
+		Blobs:       blobs,
+		StoredBytes: storedSize,
+		LogicalSize: logicalSize,
+		SavedBytes:  logicalSize - storedSize,
+	}, nil
+}
+
+// StartGarbageCollector runs CollectGarbage every interval until the returned stop function is called
+func (s *FileService) StartGarbageCollector(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				result, err := s.CollectGarbage()
+				if err != nil {
+					s.log().Error("Blob garbage collection failed", "error", err)
+					continue
+				}
+				if result.RemovedBlobs > 0 {
+					s.log().Info("Blob garbage collection finished", "removed_blobs", result.RemovedBlobs, "freed_bytes", result.FreedBytes)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func setupDeduplicatingFileService(t *testing.T) *FileService {
+	service := setupRealFileService(t)
+	service.EnableDeduplication()
+	return service
+}
+
+func countStoredBlobs(t *testing.T, service *FileService) int {
+	t.Helper()
+	blobs, err := service.storage.ListBlobs()
+	if err != nil {
+		t.Fatalf("ListBlobs failed: %v", err)
+	}
+	return len(blobs)
+}
+
+func TestDeduplication_IdenticalContentStoredOnce(t *testing.T) {
+	service := setupDeduplicatingFileService(t)
+	content := []byte(strings.Repeat("artifact", 1024))
+
+	if _, err := service.CreateDirectory("builds", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if err := service.SaveFile("app.bin", "/", content); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if err := service.SaveFileStream("app.bin", "/builds", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("SaveFileStream failed: %v", err)
+	}
+
+	if got := countStoredBlobs(t, service); got != 1 {
+		t.Fatalf("Expected 1 stored blob, got %d", got)
+	}
+	if _, err := os.Stat(service.storage.GetPhysicalPath("/app.bin")); !os.IsNotExist(err) {
+		t.Errorf("Expected no verbatim copy at the logical path, got %v", err)
+	}
+
+	for _, path := range []string{"/app.bin", "/builds/app.bin"} {
+		data, info, err := service.GetFileData(path)
+		if err != nil {
+			t.Fatalf("GetFileData(%s) failed: %v", path, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("Content of %s does not match", path)
+		}
+		if info.BlobRef == "" || info.BlobRef != info.Checksum {
+			t.Errorf("Expected %s to reference its blob, got %q", path, info.BlobRef)
+		}
+	}
+
+	stats, err := service.GetDeduplicationStats()
+	if err != nil {
+		t.Fatalf("GetDeduplicationStats failed: %v", err)
+	}
+	if stats.Blobs != 1 || stats.SavedBytes != int64(len(content)) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestDeduplication_MoveRenameAndArchive(t *testing.T) {
+	service := setupDeduplicatingFileService(t)
+
+	if _, err := service.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if err := service.SaveFile("notes.txt", "/", []byte("hello")); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if err := service.RenameFile("/notes.txt", "readme.txt"); err != nil {
+		t.Fatalf("RenameFile failed: %v", err)
+	}
+	if err := service.MoveFile("/readme.txt", "/docs"); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+
+	file, _, err := service.OpenFileForRead("/docs/readme.txt")
+	if err != nil {
+		t.Fatalf("OpenFileForRead failed: %v", err)
+	}
+	file.Close()
+
+	var archive bytes.Buffer
+	if err := service.WriteDirectoryArchive("/docs", ArchiveFormatZip, &archive); err != nil {
+		t.Fatalf("WriteDirectoryArchive failed: %v", err)
+	}
+}
+
+func TestDeduplication_GarbageCollection(t *testing.T) {
+	service := setupDeduplicatingFileService(t)
+	content := []byte("shared dataset")
+
+	if _, err := service.CreateDirectory("a", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if err := service.SaveFile("data.csv", "/", content); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if err := service.SaveFile("data.csv", "/a", content); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	// One reference is left, so the blob survives
+	if err := service.DeleteFile("/data.csv"); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	result, err := service.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if result.RemovedBlobs != 0 {
+		t.Fatalf("Expected referenced blob to be kept, removed %d", result.RemovedBlobs)
+	}
+	if _, _, err := service.GetFileData("/a/data.csv"); err != nil {
+		t.Fatalf("Remaining copy unreadable: %v", err)
+	}
+
+	// Deleting the directory drops the last reference
+	if err := service.DeleteFile("/a", true); err != nil {
+		t.Fatalf("DeleteFile recursive failed: %v", err)
+	}
+	result, err = service.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if result.RemovedBlobs != 1 || result.FreedBytes != int64(len(content)) {
+		t.Errorf("Expected the blob to be collected, got %+v", result)
+	}
+	if got := countStoredBlobs(t, service); got != 0 {
+		t.Errorf("Expected no stored blobs, got %d", got)
+	}
+}
+
+func TestDeduplication_CollectsOrphanedBlobs(t *testing.T) {
+	service := setupDeduplicatingFileService(t)
+
+	if err := service.SaveFile("taken.txt", "/", []byte("first")); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	// A blob committed by an upload that never recorded its file, as after a crash
+	if err := service.commitBlob(bytes.NewReader([]byte("second")), ""); err != nil {
+		t.Fatalf("commitBlob failed: %v", err)
+	}
+	if got := countStoredBlobs(t, service); got != 2 {
+		t.Fatalf("Expected 2 stored blobs before collection, got %d", got)
+	}
+
+	result, err := service.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if result.RemovedBlobs != 1 {
+		t.Errorf("Expected the orphaned blob to be removed, got %+v", result)
+	}
+
+	data, _, err := service.GetFileData("/taken.txt")
+	if err != nil || string(data) != "first" {
+		t.Errorf("Expected original content to survive, got %q, %v", data, err)
+	}
+}
+
+func TestDeduplication_BlobDirectoryIsOutOfReach(t *testing.T) {
+	service := setupDeduplicatingFileService(t)
+	content := []byte("kept once")
+	if err := service.SaveFile("a.txt", "/", content); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if _, err := service.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+
+	if _, err := service.CreateDirectory(".cloudlet-blobs", "/"); err == nil {
+		t.Error("Expected creating a directory named like the blob store to fail")
+	}
+	if err := service.SaveFile(".Cloudlet-Tmp", "/", []byte("x")); err == nil {
+		t.Error("Expected saving a file named like the staging directory to fail")
+	}
+	if err := service.RenameFile("/docs", ".cloudlet-blobs"); err == nil {
+		t.Error("Expected renaming to the blob store name to fail")
+	}
+	if err := service.MoveFile("/docs", "/.cloudlet-blobs"); err == nil {
+		t.Error("Expected moving to the blob store path to fail")
+	}
+	if err := service.DeleteFilePermanently("/.cloudlet-blobs", false); err == nil {
+		t.Error("Expected deleting the blob store to fail")
+	}
+	if _, err := service.GetDirectoryListing("/.cloudlet-blobs"); err == nil {
+		t.Error("Expected listing the blob store to fail")
+	}
+
+	data, _, err := service.GetFileData("/a.txt")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("Expected the deduplicated file to survive, got %q, %v", data, err)
+	}
+}
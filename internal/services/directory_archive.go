@@ -0,0 +1,245 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// Supported archive formats for directory downloads
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+var ErrUnsupportedArchiveFormat = errors.New("unsupported archive format")
+
+// ParseArchiveFormat normalizes a user supplied archive format, defaulting to zip
+func ParseArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "zip":
+		return ArchiveFormatZip, nil
+	case "tar.gz", "tgz", "targz":
+		return ArchiveFormatTarGz, nil
+	default:
+		return "", ErrUnsupportedArchiveFormat
+	}
+}
+
+// ArchiveExtension returns the file extension used for an archive format
+func ArchiveExtension(format string) string {
+	if format == ArchiveFormatTarGz {
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+// ArchiveContentType returns the MIME type used for an archive format
+func ArchiveContentType(format string) string {
+	if format == ArchiveFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// GetFileInfo returns the metadata for a single file or directory
+func (s *FileService) GetFileInfo(path string) (*models.FileInfo, error) {
+	fileInfo, err := s.getFileInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientFile(fileInfo), nil
+}
+
+// getFileInfo is GetFileInfo keeping the storage paths
+func (s *FileService) getFileInfo(path string) (*models.FileInfo, error) {
+	validatedPath, err := s.pathValidator.ValidateAndNormalizePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	fileInfo, err := s.repo.GetFileByPath(validatedPath)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+
+	if err := s.authorize(models.PermissionRead, fileInfo.Path); err != nil {
+		return nil, err
+	}
+
+	return fileInfo, nil
+}
+
+// WriteDirectoryArchive streams the contents of a directory to w as an archive.
+// Entries are read one at a time from storage so the archive is never held in memory.
+func (s *FileService) WriteDirectoryArchive(path, format string, w io.Writer) error {
+	dir, err := s.getFileInfo(path)
+	if err != nil {
+		return err
+	}
+
+	if !dir.IsDirectory {
+		return errors.New("path is not a directory")
+	}
+
+	all, err := s.repo.GetFilesUnderPath(dir.Path)
+	if err != nil {
+		return fmt.Errorf("failed to list directory contents: %w", err)
+	}
+
+	// Entries the caller may not read are left out of the archive
+	readable, err := s.readableFilter(dir.Path)
+	if err != nil {
+		return err
+	}
+	entries := make([]*models.FileInfo, 0, len(all))
+	for _, entry := range all {
+		if readable(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	switch format {
+	case ArchiveFormatZip:
+		return s.writeZipArchive(dir, entries, w)
+	case ArchiveFormatTarGz:
+		return s.writeTarGzArchive(dir, entries, w)
+	default:
+		return ErrUnsupportedArchiveFormat
+	}
+}
+
+func (s *FileService) writeZipArchive(dir *models.FileInfo, entries []*models.FileInfo, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	if _, err := zw.CreateHeader(&zip.FileHeader{Name: dir.Name + "/", Modified: dir.UpdatedAt}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := s.archiveEntryName(dir, entry)
+
+		if entry.IsDirectory {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: entry.UpdatedAt}); err != nil {
+				return fmt.Errorf("failed to add directory %s: %w", entry.Path, err)
+			}
+			continue
+		}
+
+		header := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: entry.UpdatedAt,
+		}
+		header.SetMode(0644)
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to add file %s: %w", entry.Path, err)
+		}
+
+		if err := s.copyStoredFile(entry, fw); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (s *FileService) writeTarGzArchive(dir *models.FileInfo, entries []*models.FileInfo, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	rootHeader := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir.Name + "/",
+		Mode:     0755,
+		ModTime:  dir.UpdatedAt,
+	}
+	if err := tw.WriteHeader(rootHeader); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := s.archiveEntryName(dir, entry)
+
+		if entry.IsDirectory {
+			header := &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name + "/",
+				Mode:     0755,
+				ModTime:  entry.UpdatedAt,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to add directory %s: %w", entry.Path, err)
+			}
+			continue
+		}
+
+		if err := s.writeTarFile(tw, name, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeTarFile adds a single file to a tar archive. The header size is taken
+// from the file on disk because tar requires it to match the bytes written exactly.
+func (s *FileService) writeTarFile(tw *tar.Writer, name string, entry *models.FileInfo) error {
+	file, err := s.openStoredFile(entry)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", entry.Path, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", entry.Path, err)
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     stat.Size(),
+		Mode:     0644,
+		ModTime:  entry.UpdatedAt,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add file %s: %w", entry.Path, err)
+	}
+
+	if _, err := io.CopyN(tw, file, stat.Size()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry.Path, err)
+	}
+
+	return nil
+}
+
+func (s *FileService) copyStoredFile(entry *models.FileInfo, w io.Writer) error {
+	file, err := s.openStoredFile(entry)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", entry.Path, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry.Path, err)
+	}
+
+	return nil
+}
+
+// archiveEntryName returns the path of an entry inside the archive, rooted at the directory name
+func (s *FileService) archiveEntryName(dir, entry *models.FileInfo) string {
+	return dir.Name + strings.TrimPrefix(entry.Path, dir.Path)
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+// setupRealFileService creates a FileService backed by a temporary SQLite database and storage directory
+func setupRealFileService(t *testing.T) *FileService {
+	tempDir := t.TempDir()
+	storagePath := filepath.Join(tempDir, "storage")
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	storage := NewStorageService(storagePath)
+	t.Cleanup(func() { storage.Close() })
+
+	return NewFileService(repo, storage, storagePath)
+}
+
+func setupArchiveFileService(t *testing.T) *FileService {
+	service := setupRealFileService(t)
+
+	if _, err := service.CreateDirectory("project", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := service.CreateDirectory("src", "/project"); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	if err := service.SaveFile("readme.md", "/project", []byte("# Project")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := service.SaveFile("main.go", "/project/src", []byte("package main")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	return service
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"", ArchiveFormatZip, false},
+		{"zip", ArchiveFormatZip, false},
+		{"ZIP", ArchiveFormatZip, false},
+		{"tar.gz", ArchiveFormatTarGz, false},
+		{"tgz", ArchiveFormatTarGz, false},
+		{"rar", "", true},
+	}
+
+	for _, tt := range tests {
+		format, err := ParseArchiveFormat(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseArchiveFormat(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if format != tt.expected {
+			t.Errorf("ParseArchiveFormat(%q) = %q, expected %q", tt.input, format, tt.expected)
+		}
+	}
+}
+
+func TestFileService_WriteDirectoryArchive_Zip(t *testing.T) {
+	service := setupArchiveFileService(t)
+
+	var buf bytes.Buffer
+	if err := service.WriteDirectoryArchive("/project", ArchiveFormatZip, &buf); err != nil {
+		t.Fatalf("WriteDirectoryArchive failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			contents[f.Name] = ""
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(data)
+	}
+
+	expected := map[string]string{
+		"project/":            "",
+		"project/readme.md":   "# Project",
+		"project/src/":        "",
+		"project/src/main.go": "package main",
+	}
+	for name, data := range expected {
+		got, ok := contents[name]
+		if !ok {
+			t.Errorf("Missing entry %s in zip (have %v)", name, sortedKeys(contents))
+			continue
+		}
+		if got != data {
+			t.Errorf("Entry %s: expected %q, got %q", name, data, got)
+		}
+	}
+}
+
+func TestFileService_WriteDirectoryArchive_TarGz(t *testing.T) {
+	service := setupArchiveFileService(t)
+
+	var buf bytes.Buffer
+	if err := service.WriteDirectoryArchive("/project/src", ArchiveFormatTarGz, &buf); err != nil {
+		t.Fatalf("WriteDirectoryArchive failed: %v", err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	tr := tar.NewReader(gr)
+
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		names = append(names, header.Name)
+
+		if header.Name == "src/main.go" {
+			data, _ := io.ReadAll(tr)
+			if string(data) != "package main" {
+				t.Errorf("Unexpected content for main.go: %q", data)
+			}
+		}
+	}
+
+	if len(names) != 2 || names[0] != "src/" || names[1] != "src/main.go" {
+		t.Errorf("Unexpected tar entries: %v", names)
+	}
+}
+
+func TestFileService_WriteDirectoryArchive_NotDirectory(t *testing.T) {
+	service := setupArchiveFileService(t)
+
+	var buf bytes.Buffer
+	if err := service.WriteDirectoryArchive("/project/readme.md", ArchiveFormatZip, &buf); err == nil {
+		t.Error("Expected error when archiving a regular file")
+	}
+
+	if err := service.WriteDirectoryArchive("/missing", ArchiveFormatZip, &buf); err != ErrFileNotFound {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/tracing"
+)
+
+// SetAccessControl makes views returned by ForUser enforce directory ACLs
+func (s *FileService) SetAccessControl(access *AccessControlService) {
+	s.access = access
+}
+
+// AccessControl returns the service evaluating directory ACLs, or nil when none is configured
+func (s *FileService) AccessControl() *AccessControlService {
+	return s.access
+}
+
+// ForUser returns a view of the service that acts on behalf of user, checks every
+// operation against the directory ACLs and confines the user to its home directory
+// when those are enabled. Files saved through the view are owned by user and count
+// against its quota. A nil user returns the unrestricted service.
+func (s *FileService) ForUser(user *models.User) *FileService {
+	if user == nil {
+		return s
+	}
+
+	view := *s
+	view.user = user
+	view.owner = user.ID
+	view.confine()
+	return &view
+}
+
+// unrestricted returns a view without ACL checks or home directory for work that was already authorized
+func (s *FileService) unrestricted() *FileService {
+	if s.user == nil && s.pathValidator.Root() == "/" {
+		return s
+	}
+
+	view := *s
+	view.user = nil
+	view.pathValidator = s.pathValidator.WithRoot("/")
+	return &view
+}
+
+// CheckAccess returns ErrAccessDenied unless the user of the view holds permission on every one
+// of paths. Uploads that are assembled in the background use it before accepting data.
+func (s *FileService) CheckAccess(permission string, paths ...string) error {
+	if s.user == nil || s.access == nil {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(paths))
+	for _, p := range paths {
+		validated, err := s.pathValidator.ValidateAndNormalizePath(p)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, validated)
+	}
+	return s.access.Check(s.user, permission, normalized...)
+}
+
+// authorize is CheckAccess for paths that were already normalized
+func (s *FileService) authorize(permission string, paths ...string) error {
+	if s.user == nil || s.access == nil {
+		return nil
+	}
+
+	_, span := tracing.Start(s.context(), "FileService.Authorize", tracing.String("permission", permission))
+	defer span.End()
+
+	err := s.access.Check(s.user, permission, paths...)
+	span.RecordError(err)
+	return err
+}
+
+// authorizeTree checks permission on a path and on every directory below it with entries of its own
+func (s *FileService) authorizeTree(permission, path string) error {
+	if s.user == nil || s.access == nil || s.user.IsAdmin {
+		return nil
+	}
+
+	policy, err := s.access.treePolicyFor(s.user, path)
+	if err != nil {
+		return err
+	}
+	if !policy.allowsTree(path, permission) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// readsEverything reports whether the view may read every entry without checking ACLs
+func (s *FileService) readsEverything() bool {
+	return s.user == nil || s.access == nil || s.user.IsAdmin
+}
+
+// readableFilter returns a predicate telling which entries at or below root the user of the
+// view may read
+func (s *FileService) readableFilter(root string) (func(*models.FileInfo) bool, error) {
+	if s.readsEverything() {
+		return func(*models.FileInfo) bool { return true }, nil
+	}
+
+	policy, err := s.access.treePolicyFor(s.user, root)
+	if err != nil {
+		return nil, err
+	}
+	return func(file *models.FileInfo) bool {
+		return policy.allows(file.Path, models.PermissionRead)
+	}, nil
+}
+
+// GetDirectoryACL returns the ACL of a directory. It needs the share permission there.
+func (s *FileService) GetDirectoryACL(path string) (*models.DirectoryACL, error) {
+	dirPath, err := s.aclDirectory(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(models.PermissionShare, dirPath); err != nil {
+		return nil, err
+	}
+
+	acl, err := s.access.GetDirectoryACL(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientACL(acl), nil
+}
+
+// SetACLEntry grants a user or group permissions on a directory
+func (s *FileService) SetACLEntry(req *models.SetACLEntryRequest) (*models.ACLEntry, error) {
+	entry, err := s.setACLEntry(req)
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditSetACL,
+		Path:    s.auditPath(req.Path),
+		Details: aclAuditDetails(req.SubjectType, req.SubjectID, req.Permissions),
+	}, err)
+	return entry, err
+}
+
+func (s *FileService) setACLEntry(req *models.SetACLEntryRequest) (*models.ACLEntry, error) {
+	dirPath, err := s.aclDirectory(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := *req
+	normalized.Path = dirPath
+	entry, err := s.access.SetEntry(s.user, &normalized)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientACLEntry(entry), nil
+}
+
+// DeleteACLEntry removes an ACL entry
+func (s *FileService) DeleteACLEntry(id int64) error {
+	audited := &models.AuditEntry{Action: models.AuditDeleteACL, Details: fmt.Sprintf("entry %d", id)}
+	if s.audit != nil && s.access != nil {
+		if entry, err := s.access.GetEntry(id); err == nil {
+			audited.Path = entry.Path
+			audited.Details = aclAuditDetails(entry.SubjectType, entry.SubjectID, entry.Permissions)
+		}
+	}
+
+	err := s.deleteACLEntry(id)
+	s.recordAuditEntry(audited, err)
+	return err
+}
+
+func (s *FileService) deleteACLEntry(id int64) error {
+	if s.access == nil {
+		return ErrACLEntryNotFound
+	}
+
+	// Entries outside the home directory of the view do not exist for its user
+	if s.pathValidator.Root() != "/" {
+		entry, err := s.access.GetEntry(id)
+		if err != nil {
+			return err
+		}
+		if _, inside := s.pathValidator.ToVirtual(entry.Path); !inside {
+			return ErrACLEntryNotFound
+		}
+	}
+	return s.access.DeleteEntry(s.user, id)
+}
+
+// aclDirectory validates that path names the root or an existing directory
+func (s *FileService) aclDirectory(path string) (string, error) {
+	if s.access == nil {
+		return "", ErrAccessDenied
+	}
+
+	dirPath, err := s.pathValidator.ValidateAndNormalizePath(path)
+	if err != nil {
+		return "", err
+	}
+	if dirPath == "/" {
+		return dirPath, nil
+	}
+
+	info, err := s.repo.GetFileByPath(dirPath)
+	if err != nil {
+		return "", ErrFileNotFound
+	}
+	if !info.IsDirectory {
+		return "", ErrInvalidACLEntry
+	}
+	return dirPath, nil
+}
+
+func aclAuditDetails(subjectType string, subjectID int64, permissions []string) string {
+	return fmt.Sprintf("%s %d: %s", subjectType, subjectID, strings.Join(permissions, ","))
+}
@@ -1,16 +1,23 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-
+	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/anddsdev/cloudlet/internal/models"
 	"github.com/anddsdev/cloudlet/internal/repository"
 	"github.com/anddsdev/cloudlet/internal/security"
+	"github.com/anddsdev/cloudlet/internal/storage"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 	"github.com/anddsdev/cloudlet/internal/transaction"
 )
 
@@ -18,6 +25,47 @@ type FileService struct {
 	repo          *repository.FileRepository
 	storage       *StorageService
 	pathValidator *security.PathValidator
+
+	// deduplicate stores file contents once in the blob store, keyed by checksum
+	deduplicate bool
+	// blobMu keeps garbage collection from running between committing a blob
+	// and recording the file that references it. It is shared with the views of ForUser.
+	blobMu *sync.RWMutex
+
+	// access enforces directory ACLs for user. Without a user every path is accessible.
+	access *AccessControlService
+	user   *models.User
+
+	// homesPath holds the home directories users are confined to, empty when disabled.
+	// homesReady remembers which of them are known to exist.
+	homesPath  string
+	homesReady *sync.Map
+
+	// quotas limits what owner can store. New files are attributed to owner, 0 for nobody.
+	quotas *QuotaService
+	owner  int64
+
+	// shares manages the public links to files and directories
+	shares *ShareService
+
+	// versionsKeep and versionsMaxAge limit the previous contents kept for each file, 0 for no limit
+	versionsKeep   int
+	versionsMaxAge time.Duration
+
+	// trash keeps deleted files restorable for trashRetention, 0 for until they are purged
+	trash          bool
+	trashRetention time.Duration
+
+	// audit records the mutations of the view, with clientIP as the address they came from
+	audit      *AuditService
+	auditActor *models.User
+	clientIP   string
+
+	// logger logs the events of the view, tagged with the request it serves if any
+	logger *slog.Logger
+
+	// ctx carries the span the operations of the view are traced under
+	ctx context.Context
 }
 
 func NewFileService(repo *repository.FileRepository, storage *StorageService, storagePath string) *FileService {
@@ -25,26 +73,99 @@ func NewFileService(repo *repository.FileRepository, storage *StorageService, st
 		repo:          repo,
 		storage:       storage,
 		pathValidator: security.NewPathValidator(storagePath),
+		blobMu:        &sync.RWMutex{},
+	}
+}
+
+// WithLogger returns a view that logs through logger, usually one tagged with a request ID
+func (s *FileService) WithLogger(logger *slog.Logger) *FileService {
+	view := *s
+	view.logger = logger
+	return &view
+}
+
+// log returns the logger of the view, the default logger unless one was set
+func (s *FileService) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// WithContext returns a view tracing its operations, with the storage and database work
+// they do, as children of the span in ctx, usually the span of a request
+func (s *FileService) WithContext(ctx context.Context) *FileService {
+	view := *s
+	view.ctx = ctx
+	if s.repo != nil {
+		view.repo = s.repo.WithContext(ctx)
+	}
+	if s.storage != nil {
+		view.storage = s.storage.WithContext(ctx)
+	}
+	return &view
+}
+
+// context returns the context of the view, the background context unless one was set
+func (s *FileService) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
 	}
+	return s.ctx
 }
 
-func (s *FileService) GetDirectoryListing(path string) (*models.DirectoryListing, error) {
+// startSpan starts a span for operation under the span of the view. It returns a view
+// tracing the work of the operation under the new span.
+func (s *FileService) startSpan(operation string, attrs ...tracing.Attribute) (*FileService, *tracing.Span) {
+	ctx, span := tracing.Start(s.context(), "FileService."+operation, attrs...)
+	if span == nil {
+		return s, nil
+	}
+	return s.WithContext(ctx), span
+}
+
+// GetDirectoryListing lists a directory with the tags of its entries. Given tags, only
+// the entries carrying all of them are listed.
+func (s *FileService) GetDirectoryListing(path string, tags ...string) (_ *models.DirectoryListing, err error) {
+	s, span := s.startSpan("GetDirectoryListing", tracing.String("file.path", path))
+	defer func() { span.RecordError(err); span.End() }()
+
+	wanted, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
 	validatedPath, err := s.pathValidator.ValidateAndNormalizePath(path)
 	if err != nil {
 		return nil, fmt.Errorf("invalid path: %w", err)
 	}
 	path = validatedPath
 
+	if err := s.authorize(models.PermissionRead, path); err != nil {
+		return nil, err
+	}
+
 	files, err := s.repo.GetFilesByPath(path)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.attachTags(files); err != nil {
+		return nil, err
+	}
+
+	readable, err := s.readableFilter(path)
+	if err != nil {
+		return nil, err
+	}
 
 	var directories []*models.FileInfo
 	var regularFiles []*models.FileInfo
 	var totalSize int64
 
 	for _, file := range files {
+		if !readable(file) || !hasTags(file, wanted) {
+			continue
+		}
 		if file.IsDirectory {
 			directories = append(directories, file)
 		} else {
@@ -53,6 +174,14 @@ func (s *FileService) GetDirectoryListing(path string) (*models.DirectoryListing
 		}
 	}
 
+	quotas, err := s.applicableQuotas(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listings show the paths as seen by the client, relative to its home directory
+	path = s.clientPath(path)
+
 	breadcrumbs := s.generateBreadcrumbs(path)
 
 	parentPath := s.getParentPath(path)
@@ -60,16 +189,27 @@ func (s *FileService) GetDirectoryListing(path string) (*models.DirectoryListing
 	return &models.DirectoryListing{
 		Path:        path,
 		ParentPath:  parentPath,
-		Files:       regularFiles,
-		Directories: directories,
+		Files:       s.clientFiles(regularFiles),
+		Directories: s.clientFiles(directories),
 		TotalFiles:  len(regularFiles),
 		TotalDirs:   len(directories),
 		TotalSize:   totalSize,
 		Breadcrumbs: breadcrumbs,
+		Quotas:      quotas,
 	}, nil
 }
 
 func (s *FileService) CreateDirectory(name, parentPath string) (*models.FileInfo, error) {
+	s, span := s.startSpan("CreateDirectory", tracing.String("file.path", s.buildPath(parentPath, name)))
+	defer span.End()
+
+	dir, err := s.createDirectory(name, parentPath)
+	span.RecordError(err)
+	s.recordAudit(models.AuditCreateDirectory, s.auditPath(s.buildPath(parentPath, name)), "", 0, err)
+	return dir, err
+}
+
+func (s *FileService) createDirectory(name, parentPath string) (*models.FileInfo, error) {
 	// Validate filename
 	if err := security.IsValidFilename(name); err != nil {
 		return nil, fmt.Errorf("invalid directory name: %w", err)
@@ -82,6 +222,10 @@ func (s *FileService) CreateDirectory(name, parentPath string) (*models.FileInfo
 	}
 	parentPath = validatedParentPath
 
+	if err := s.authorize(models.PermissionWrite, parentPath); err != nil {
+		return nil, err
+	}
+
 	if !s.isValidName(name) {
 		return nil, errors.New("invalid directory name")
 	}
@@ -98,25 +242,48 @@ func (s *FileService) CreateDirectory(name, parentPath string) (*models.FileInfo
 		return nil, err
 	}
 
-	return dir, nil
+	return s.clientFile(dir), nil
 }
 
 func (s *FileService) SaveFile(filename, parentPath string, data []byte) error {
+	_, err := s.SaveFileWithChecksum(filename, parentPath, data, "")
+	return err
+}
+
+// SaveFileWithChecksum saves a file and records its SHA-256. When expectedChecksum is set
+// the upload is rejected with ErrChecksumMismatch unless the data matches it.
+func (s *FileService) SaveFileWithChecksum(filename, parentPath string, data []byte, expectedChecksum string) (*models.FileInfo, error) {
+	s, span := s.startSpan("SaveFile",
+		tracing.String("file.path", s.buildPath(parentPath, filename)), tracing.Int("file.size", len(data)))
+	defer span.End()
+
+	saved, err := s.saveFileWithChecksum(filename, parentPath, data, expectedChecksum)
+	span.RecordError(err)
+	s.recordAudit(models.AuditUpload, s.auditPath(s.buildPath(parentPath, filename)), "", int64(len(data)), err)
+	return saved, err
+}
+
+func (s *FileService) saveFileWithChecksum(filename, parentPath string, data []byte, expectedChecksum string) (*models.FileInfo, error) {
 	// Validate filename
 	if err := security.IsValidFilename(filename); err != nil {
-		return fmt.Errorf("invalid filename: %w", err)
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	expectedChecksum, err := NormalizeChecksum(expectedChecksum)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate and normalize parent path
 	validatedParentPath, err := s.pathValidator.ValidateAndNormalizePath(parentPath)
 	if err != nil {
-		return fmt.Errorf("invalid parent path: %w", err)
+		return nil, fmt.Errorf("invalid parent path: %w", err)
 	}
 	parentPath = validatedParentPath
 	fullPath := s.buildPath(parentPath, filename)
 
-	if err := s.storage.SaveFile(fullPath, data); err != nil {
-		return err
+	if err := s.authorize(models.PermissionWrite, parentPath); err != nil {
+		return nil, err
 	}
 
 	file := &models.FileInfo{
@@ -126,29 +293,78 @@ func (s *FileService) SaveFile(filename, parentPath string, data []byte) error {
 		MimeType:    s.detectMimeType(filename),
 		IsDirectory: false,
 		ParentPath:  parentPath,
+		OwnerID:     s.owner,
 	}
 
-	return s.repo.InsertFile(file)
+	// Saving to an existing path keeps its content as a version
+	if existing, err := s.repo.GetFileByPath(fullPath); err == nil {
+		if err := s.overwriteFile(existing, file, bytes.NewReader(data), expectedChecksum); err != nil {
+			return nil, err
+		}
+		return s.clientFile(file), nil
+	}
+
+	if err := s.checkQuota(parentPath, int64(len(data)), 1); err != nil {
+		return nil, err
+	}
+
+	if s.deduplicate {
+		err = s.saveBlobFile(file, bytes.NewReader(data), expectedChecksum)
+	} else {
+		file.Checksum, err = s.storage.SaveFileWithChecksum(fullPath, data, expectedChecksum)
+		if err == nil {
+			err = s.repo.InsertFile(file)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.clientFile(file), nil
 }
 
 // SaveFileStream saves a file from an io.Reader using streaming to prevent memory leaks
 func (s *FileService) SaveFileStream(filename, parentPath string, reader io.Reader, size int64) error {
+	_, err := s.SaveFileStreamWithChecksum(filename, parentPath, reader, size, "")
+	return err
+}
+
+// SaveFileStreamWithChecksum streams a file to storage, hashing it on the way, and records
+// its SHA-256. When expectedChecksum is set the file is only committed if the data matches it.
+func (s *FileService) SaveFileStreamWithChecksum(filename, parentPath string, reader io.Reader, size int64, expectedChecksum string) (*models.FileInfo, error) {
+	s, span := s.startSpan("SaveFileStream",
+		tracing.String("file.path", s.buildPath(parentPath, filename)), tracing.Int64("file.size", size))
+	defer span.End()
+
+	saved, err := s.saveFileStreamWithChecksum(filename, parentPath, reader, size, expectedChecksum)
+	span.RecordError(err)
+	if saved != nil {
+		size = saved.Size
+	}
+	s.recordAudit(models.AuditUpload, s.auditPath(s.buildPath(parentPath, filename)), "", size, err)
+	return saved, err
+}
+
+func (s *FileService) saveFileStreamWithChecksum(filename, parentPath string, reader io.Reader, size int64, expectedChecksum string) (*models.FileInfo, error) {
 	// Validate filename
 	if err := security.IsValidFilename(filename); err != nil {
-		return fmt.Errorf("invalid filename: %w", err)
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	expectedChecksum, err := NormalizeChecksum(expectedChecksum)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate and normalize parent path
 	validatedParentPath, err := s.pathValidator.ValidateAndNormalizePath(parentPath)
 	if err != nil {
-		return fmt.Errorf("invalid parent path: %w", err)
+		return nil, fmt.Errorf("invalid parent path: %w", err)
 	}
 	parentPath = validatedParentPath
 	fullPath := s.buildPath(parentPath, filename)
 
-	// Save file using streaming operations
-	if err := s.storage.SaveFileStream(fullPath, reader); err != nil {
-		return err
+	if err := s.authorize(models.PermissionWrite, parentPath); err != nil {
+		return nil, err
 	}
 
 	// Create file metadata
@@ -159,12 +375,41 @@ func (s *FileService) SaveFileStream(filename, parentPath string, reader io.Read
 		MimeType:    s.detectMimeType(filename),
 		IsDirectory: false,
 		ParentPath:  parentPath,
+		OwnerID:     s.owner,
+	}
+
+	// Saving to an existing path keeps its content as a version
+	if existing, err := s.repo.GetFileByPath(fullPath); err == nil {
+		if err := s.overwriteFile(existing, file, reader, expectedChecksum); err != nil {
+			return nil, err
+		}
+		return s.clientFile(file), nil
+	}
+
+	// The declared size is checked, so uploads over quota are rejected before they are stored
+	if err := s.checkQuota(parentPath, max(size, 0), 1); err != nil {
+		return nil, err
 	}
 
-	return s.repo.InsertFile(file)
+	// Save file using streaming operations
+	if s.deduplicate {
+		err = s.saveBlobFile(file, reader, expectedChecksum)
+	} else {
+		file.Checksum, err = s.storage.SaveFileStreamWithChecksum(fullPath, reader, expectedChecksum)
+		if err == nil {
+			err = s.repo.InsertFile(file)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.clientFile(file), nil
 }
 
-func (s *FileService) GetFileData(path string) ([]byte, *models.FileInfo, error) {
+func (s *FileService) GetFileData(path string) (_ []byte, _ *models.FileInfo, err error) {
+	s, span := s.startSpan("GetFileData", tracing.String("file.path", path))
+	defer func() { span.RecordError(err); span.End() }()
+
 	// Validate and normalize path
 	validatedPath, err := s.pathValidator.ValidateAndNormalizePath(path)
 	if err != nil {
@@ -172,26 +417,65 @@ func (s *FileService) GetFileData(path string) ([]byte, *models.FileInfo, error)
 	}
 	path = validatedPath
 
+	if err := s.authorize(models.PermissionRead, path); err != nil {
+		return nil, nil, err
+	}
+
 	fileInfo, err := s.repo.GetFileByPath(path)
 	if err != nil {
 		return nil, nil, ErrFileNotFound
 	}
 
-	// Only allow download of files, not directories
-	// TODO: implement directory download (zip?)
+	// Directories are downloaded as archives through WriteDirectoryArchive
 	if fileInfo.IsDirectory {
 		return nil, nil, errors.New("cannot download directory")
 	}
 
-	data, err := s.storage.ReadFile(path)
+	data, err := s.readStoredFile(fileInfo)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return data, fileInfo, nil
+	return data, s.clientFile(fileInfo), nil
+}
+
+// OpenFileForRead opens a stored file for streaming along with its metadata.
+// The caller is responsible for closing the returned file.
+func (s *FileService) OpenFileForRead(path string) (_ storage.File, _ *models.FileInfo, err error) {
+	s, span := s.startSpan("OpenFileForRead", tracing.String("file.path", path))
+	defer func() { span.RecordError(err); span.End() }()
+
+	fileInfo, err := s.getFileInfo(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fileInfo.IsDirectory {
+		return nil, nil, errors.New("cannot download directory")
+	}
+
+	file, err := s.openStoredFile(fileInfo)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrFileNotFound
+		}
+		return nil, nil, err
+	}
+
+	return file, s.clientFile(fileInfo), nil
 }
 
 func (s *FileService) RenameFile(path, newName string) error {
+	s, span := s.startSpan("RenameFile", tracing.String("file.path", path))
+	defer span.End()
+
+	err := s.renameFile(path, newName)
+	span.RecordError(err)
+	s.recordAudit(models.AuditRename, s.auditPath(path), s.auditPath(s.buildPath(s.getParentPath(path), newName)), 0, err)
+	return err
+}
+
+func (s *FileService) renameFile(path, newName string) error {
 	// Validate new filename
 	if err := security.IsValidFilename(newName); err != nil {
 		return fmt.Errorf("invalid new name: %w", err)
@@ -204,28 +488,39 @@ func (s *FileService) RenameFile(path, newName string) error {
 	}
 	path = validatedPath
 
+	if s.isHomeDirectory(path) {
+		return ErrAccessDenied
+	}
+
 	fileInfo, err := s.repo.GetFileByPath(path)
 	if err != nil {
 		return ErrFileNotFound
 	}
 
+	// Renaming changes both the entry and the directory listing it
+	if err := s.authorize(models.PermissionWrite, path, fileInfo.ParentPath); err != nil {
+		return err
+	}
+
 	newPath := s.buildPath(fileInfo.ParentPath, newName)
 
 	// Create transaction manager for atomic operations
-	tm := transaction.NewTransactionManager()
-
-	// First operation: Rename physical file
-	storageOperation := transaction.NewFileOperation(
-		fmt.Sprintf("Rename file from %s to %s", path, newPath),
-		func() error {
-			return s.storage.MoveFile(path, newPath)
-		},
-		func() error {
-			// Rollback: revert rename physically
-			return s.storage.MoveFile(newPath, path)
-		},
-	)
-	tm.AddOperation(storageOperation)
+	tm := transaction.NewTransactionManager().WithLogger(s.log())
+
+	// First operation: Rename physical file. Blob backed files only exist in the database.
+	if fileInfo.BlobRef == "" {
+		storageOperation := transaction.NewFileOperation(
+			fmt.Sprintf("Rename file from %s to %s", path, newPath),
+			func() error {
+				return s.storage.MoveFile(path, newPath)
+			},
+			func() error {
+				// Rollback: revert rename physically
+				return s.storage.MoveFile(newPath, path)
+			},
+		)
+		tm.AddOperation(storageOperation)
+	}
 
 	// Second operation: Update database
 	dbOperation := transaction.NewDatabaseOperation(
@@ -249,6 +544,16 @@ func (s *FileService) RenameFile(path, newName string) error {
 }
 
 func (s *FileService) MoveFile(sourcePath, destinationPath string) error {
+	s, span := s.startSpan("MoveFile", tracing.String("file.path", sourcePath))
+	defer span.End()
+
+	err := s.moveFile(sourcePath, destinationPath)
+	span.RecordError(err)
+	s.recordAudit(models.AuditMove, s.auditPath(sourcePath), s.auditPath(s.buildPath(destinationPath, filepath.Base(sourcePath))), 0, err)
+	return err
+}
+
+func (s *FileService) moveFile(sourcePath, destinationPath string) error {
 	// Validate and normalize source path
 	validatedSourcePath, err := s.pathValidator.ValidateAndNormalizePath(sourcePath)
 	if err != nil {
@@ -263,28 +568,45 @@ func (s *FileService) MoveFile(sourcePath, destinationPath string) error {
 	}
 	destinationPath = validatedDestinationPath
 
+	if s.isHomeDirectory(sourcePath) {
+		return ErrAccessDenied
+	}
+
 	sourceInfo, err := s.repo.GetFileByPath(sourcePath)
 	if err != nil {
 		return ErrFileNotFound
 	}
 
+	// A move removes the entry from its source and adds it to the destination
+	if err := s.authorize(models.PermissionDelete, sourcePath); err != nil {
+		return err
+	}
+	if err := s.authorize(models.PermissionWrite, destinationPath); err != nil {
+		return err
+	}
+	if err := s.checkMoveQuota(sourcePath, destinationPath); err != nil {
+		return err
+	}
+
 	newPath := s.buildPath(destinationPath, sourceInfo.Name)
 
 	// Create transaction manager for atomic operations
-	tm := transaction.NewTransactionManager()
-
-	// First operation: Move file physically
-	storageOperation := transaction.NewFileOperation(
-		fmt.Sprintf("Move file from %s to %s", sourcePath, newPath),
-		func() error {
-			return s.storage.MoveFile(sourcePath, newPath)
-		},
-		func() error {
-			// Rollback: revert move physically
-			return s.storage.MoveFile(newPath, sourcePath)
-		},
-	)
-	tm.AddOperation(storageOperation)
+	tm := transaction.NewTransactionManager().WithLogger(s.log())
+
+	// First operation: Move file physically. Blob backed files only exist in the database.
+	if sourceInfo.BlobRef == "" {
+		storageOperation := transaction.NewFileOperation(
+			fmt.Sprintf("Move file from %s to %s", sourcePath, newPath),
+			func() error {
+				return s.storage.MoveFile(sourcePath, newPath)
+			},
+			func() error {
+				// Rollback: revert move physically
+				return s.storage.MoveFile(newPath, sourcePath)
+			},
+		)
+		tm.AddOperation(storageOperation)
+	}
 
 	// Second operation: Update database
 	dbOperation := transaction.NewDatabaseOperation(
@@ -307,7 +629,41 @@ func (s *FileService) MoveFile(sourcePath, destinationPath string) error {
 	return nil
 }
 
+// DeleteFile moves a file or directory to the trash when it is enabled, and removes it otherwise
 func (s *FileService) DeleteFile(path string, recursive ...bool) error {
+	return s.auditedDelete(path, len(recursive) > 0 && recursive[0], !s.trash)
+}
+
+// DeleteFilePermanently removes a file or directory without keeping it in the trash
+func (s *FileService) DeleteFilePermanently(path string, recursive bool) error {
+	return s.auditedDelete(path, recursive, true)
+}
+
+// auditedDelete deletes like deleteFile and records the deletion with the size of what was deleted
+func (s *FileService) auditedDelete(path string, recursive, permanent bool) error {
+	s, span := s.startSpan("DeleteFile", tracing.String("file.path", path), tracing.Bool("permanent", permanent))
+	defer span.End()
+
+	storagePath := s.auditPath(path)
+	var size int64
+	if s.audit != nil {
+		if info, err := s.repo.GetFileByPath(storagePath); err == nil {
+			size = info.Size + info.TotalSize
+		}
+	}
+
+	err := s.deleteFile(path, recursive, permanent)
+	span.RecordError(err)
+
+	action := models.AuditDelete
+	if !permanent {
+		action = models.AuditTrash
+	}
+	s.recordAudit(action, storagePath, "", size, err)
+	return err
+}
+
+func (s *FileService) deleteFile(path string, isRecursive, permanent bool) error {
 	// Validate and normalize path
 	validatedPath, err := s.pathValidator.ValidateAndNormalizePath(path)
 	if err != nil {
@@ -315,14 +671,21 @@ func (s *FileService) DeleteFile(path string, recursive ...bool) error {
 	}
 	path = validatedPath
 
+	if s.isHomeDirectory(path) {
+		return ErrAccessDenied
+	}
+
 	// Get file info for rollback purposes
 	fileInfo, err := s.repo.GetFileByPath(path)
 	if err != nil {
 		return ErrFileNotFound
 	}
 
-	// Check if this is a directory and if recursive deletion is requested
-	isRecursive := len(recursive) > 0 && recursive[0]
+	if !isRecursive || !fileInfo.IsDirectory {
+		if err := s.authorize(models.PermissionDelete, path); err != nil {
+			return err
+		}
+	}
 	
 	if fileInfo.IsDirectory && !isRecursive {
 		// Check if directory has children
@@ -336,16 +699,31 @@ func (s *FileService) DeleteFile(path string, recursive ...bool) error {
 		}
 	}
 
-	// If it's a directory and recursive is true, delete all children first
+	// Permission on a directory deleted recursively is checked once for the whole tree
 	if fileInfo.IsDirectory && isRecursive {
-		if err := s.deleteDirectoryRecursive(path); err != nil {
+		if err := s.authorizeTree(models.PermissionDelete, path); err != nil {
+			return err
+		}
+	}
+
+	if !permanent {
+		if err := s.moveToTrash(fileInfo); err != nil {
+			return fmt.Errorf("failed to move to trash: %w", err)
+		}
+		return nil
+	}
+
+	// If it's a directory and recursive is true, delete all children first. The
+	// children are removed unrestricted, the tree was authorized above.
+	if fileInfo.IsDirectory && isRecursive {
+		if err := s.unrestricted().deleteDirectoryRecursive(path); err != nil {
 			return fmt.Errorf("failed to delete directory recursively: %w", err)
 		}
 		return nil
 	}
 
 	// Create transaction manager for atomic operations
-	tm := transaction.NewTransactionManager()
+	tm := transaction.NewTransactionManager().WithLogger(s.log())
 
 	// First operation: Delete from database
 	dbOperation := transaction.NewDatabaseOperation(
@@ -360,20 +738,23 @@ func (s *FileService) DeleteFile(path string, recursive ...bool) error {
 	)
 	tm.AddOperation(dbOperation)
 
-	// Second operation: Delete physical file
-	storageOperation := transaction.NewFileOperation(
-		fmt.Sprintf("Delete physical file: %s", path),
-		func() error {
-			return s.storage.DeleteFile(path)
-		},
-		func() error {
-			// Rollback: This is complex for file restoration
-			// In practice, we'd need to have backed up the file content
-			// For now, we'll log the inconsistency
-			return fmt.Errorf("cannot restore deleted file %s - manual intervention required", path)
-		},
-	)
-	tm.AddOperation(storageOperation)
+	// Second operation: Delete physical file. The blob of a blob backed file is released
+	// with its record and removed by garbage collection once nothing else references it.
+	if fileInfo.BlobRef == "" {
+		storageOperation := transaction.NewFileOperation(
+			fmt.Sprintf("Delete physical file: %s", path),
+			func() error {
+				return s.storage.DeleteFile(path)
+			},
+			func() error {
+				// Rollback: This is complex for file restoration
+				// In practice, we'd need to have backed up the file content
+				// For now, we'll log the inconsistency
+				return fmt.Errorf("cannot restore deleted file %s - manual intervention required", path)
+			},
+		)
+		tm.AddOperation(storageOperation)
+	}
 
 	// Execute all operations with automatic rollback on failure
 	if err := tm.Execute(); err != nil {
@@ -399,14 +780,14 @@ func (s *FileService) deleteDirectoryRecursive(path string) error {
 			}
 		} else {
 			// Delete file
-			if err := s.DeleteFile(child.Path, false); err != nil {
+			if err := s.deleteFile(child.Path, false, true); err != nil {
 				return fmt.Errorf("failed to delete file %s: %w", child.Path, err)
 			}
 		}
 	}
 
 	// Finally, delete the directory itself
-	if err := s.DeleteFile(path, false); err != nil {
+	if err := s.deleteFile(path, false, true); err != nil {
 		return fmt.Errorf("failed to delete directory %s: %w", path, err)
 	}
 
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/storage"
+)
+
+var (
+	ErrVersionNotFound = errors.New("version not found")
+	ErrPathIsDirectory = errors.New("a directory with that name already exists")
+)
+
+// SetVersionRetention limits the versions kept for each file to the keep newest and to
+// those younger than maxAge. Zero values disable either limit.
+func (s *FileService) SetVersionRetention(keep int, maxAge time.Duration) {
+	s.versionsKeep = keep
+	s.versionsMaxAge = maxAge
+}
+
+// ListVersions returns the previous contents of a file, newest first
+func (s *FileService) ListVersions(filePath string) ([]*models.FileVersion, error) {
+	file, err := s.getFileInfo(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDirectory {
+		return nil, ErrPathIsDirectory
+	}
+
+	versions, err := s.repo.ListVersions(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	for i, version := range versions {
+		versions[i] = s.clientVersion(version)
+	}
+	if versions == nil {
+		versions = []*models.FileVersion{}
+	}
+	return versions, nil
+}
+
+// OpenVersionForRead opens a previous content of a file for streaming. The caller is
+// responsible for closing the returned file.
+func (s *FileService) OpenVersionForRead(filePath string, number int64) (storage.File, *models.FileVersion, error) {
+	version, err := s.getVersion(filePath, number)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := s.storage.OpenBlob(version.BlobRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, s.clientVersion(version), nil
+}
+
+// RestoreVersion makes a previous content the current content of a file again. The
+// content it replaces is kept as a new version, so a restore can be undone.
+func (s *FileService) RestoreVersion(filePath string, number int64) (*models.FileInfo, error) {
+	restored, err := s.restoreVersion(filePath, number)
+	entry := &models.AuditEntry{
+		Action:  models.AuditRestoreVersion,
+		Path:    s.auditPath(filePath),
+		Details: fmt.Sprintf("version %d", number),
+	}
+	if restored != nil {
+		entry.Size = restored.Size
+	}
+	s.recordAuditEntry(entry, err)
+	return restored, err
+}
+
+func (s *FileService) restoreVersion(filePath string, number int64) (*models.FileInfo, error) {
+	version, err := s.getVersion(filePath, number)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.GetFileByPath(version.Path)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+
+	if err := s.authorize(models.PermissionWrite, existing.ParentPath); err != nil {
+		return nil, err
+	}
+	if err := s.checkOverwriteQuota(existing, version.Size); err != nil {
+		return nil, err
+	}
+
+	file := *existing
+	file.Size = version.Size
+	file.Checksum = version.Checksum
+	file.BlobRef = version.BlobRef
+	file.MimeType = version.MimeType
+	file.OwnerID = s.owner
+
+	s.blobMu.RLock()
+	defer s.blobMu.RUnlock()
+
+	if err := s.replaceContent(existing, &file); err != nil {
+		return nil, err
+	}
+	return s.clientFile(&file), nil
+}
+
+// PruneVersions applies the retention limits to the versions of every file
+func (s *FileService) PruneVersions() (int64, error) {
+	return s.repo.PruneVersions("", s.versionsKeep, s.versionCutoff())
+}
+
+func (s *FileService) getVersion(filePath string, number int64) (*models.FileVersion, error) {
+	file, err := s.getFileInfo(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.repo.GetVersion(file.Path, number)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionNotFound
+	}
+	return version, err
+}
+
+// overwriteFile stores the content read from reader as the new content of existing,
+// keeping the content it replaces as a version. file holds the metadata of the new content.
+// Overwritten files and their versions live in the blob store, whether deduplication is
+// enabled or not, so versions can share content with each other.
+func (s *FileService) overwriteFile(existing, file *models.FileInfo, reader io.Reader, expectedChecksum string) error {
+	if existing.IsDirectory {
+		return ErrPathIsDirectory
+	}
+	if err := s.checkOverwriteQuota(existing, file.Size); err != nil {
+		return err
+	}
+
+	staged, err := s.storage.StageBlob(reader, expectedChecksum)
+	if err != nil {
+		return err
+	}
+	defer staged.Discard()
+
+	s.blobMu.RLock()
+	defer s.blobMu.RUnlock()
+
+	if err := s.storage.CommitBlob(staged); err != nil {
+		return err
+	}
+
+	file.ID = existing.ID
+	file.Size = staged.Size
+	file.Checksum = staged.Checksum
+	file.BlobRef = staged.Checksum
+	return s.replaceContent(existing, file)
+}
+
+// replaceContent records file, whose blob is already stored, as the new content of existing.
+// A verbatim copy of the previous content is moved to the blob store first. Callers hold
+// blobMu for reading.
+func (s *FileService) replaceContent(existing, file *models.FileInfo) error {
+	if _, err := s.recordReplacement(existing, file); err != nil {
+		return err
+	}
+	s.pruneVersions(existing.Path)
+	return nil
+}
+
+// recordReplacement is replaceContent without applying the retention limits, so the
+// replacement can still be reverted. It returns the version keeping the previous content.
+func (s *FileService) recordReplacement(existing, file *models.FileInfo) (*models.FileVersion, error) {
+	archived := existing.BlobRef
+	if archived == "" {
+		var err error
+		if archived, err = s.archiveVerbatimCopy(existing.Path); err != nil {
+			return nil, fmt.Errorf("failed to keep previous content: %w", err)
+		}
+	}
+
+	version, err := s.repo.ReplaceFile(existing, file, archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record new version: %w", err)
+	}
+
+	// The verbatim copy is now kept in the blob store
+	if existing.BlobRef == "" {
+		if err := s.storage.DeleteFile(existing.Path); err != nil {
+			s.log().Error("Failed to remove replaced copy", "path", existing.Path, "error", err)
+		}
+	}
+	return version, nil
+}
+
+// revertReplacement makes the newest version of the file at filePath its content again and
+// removes the version, undoing the upload that replaced the content
+func (s *FileService) revertReplacement(filePath string) error {
+	err := s.revertNewestVersion(filePath)
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditRestoreVersion,
+		Path:    filePath,
+		Details: "batch rolled back",
+	}, err)
+	return err
+}
+
+func (s *FileService) revertNewestVersion(filePath string) error {
+	file, err := s.repo.GetFileByPath(filePath)
+	if err != nil {
+		return ErrFileNotFound
+	}
+	versions, err := s.repo.ListVersions(file.Path)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrVersionNotFound
+	}
+
+	version := versions[0]
+	previous := &models.FileInfo{
+		Path:      file.Path,
+		Size:      version.Size,
+		MimeType:  version.MimeType,
+		Checksum:  version.Checksum,
+		OwnerID:   version.AuthorID,
+		UpdatedAt: version.ModifiedAt,
+	}
+	return s.repo.RevertReplace(previous, file, version)
+}
+
+// pruneVersions applies the retention limits to the versions of filePath
+func (s *FileService) pruneVersions(filePath string) {
+	if _, err := s.repo.PruneVersions(filePath, s.versionsKeep, s.versionCutoff()); err != nil {
+		s.log().Error("Failed to prune versions", "path", filePath, "error", err)
+	}
+}
+
+// checkOverwriteQuota checks that the quotas leave room for replacing existing with size
+// bytes. When the file changes owner its new owner is charged for all of it, so directory
+// quotas are then checked against the whole file instead of the difference.
+func (s *FileService) checkOverwriteQuota(existing *models.FileInfo, size int64) error {
+	bytes, files := max(size, 0)-existing.Size, int64(0)
+	if existing.OwnerID != s.owner {
+		bytes, files = max(size, 0), 1
+	}
+	return s.checkQuota(path.Dir(existing.Path), bytes, files)
+}
+
+func (s *FileService) versionCutoff() time.Time {
+	if s.versionsMaxAge <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-s.versionsMaxAge)
+}
+
+func (s *FileService) clientVersion(version *models.FileVersion) *models.FileVersion {
+	if s.pathValidator.Root() == "/" {
+		return version
+	}
+
+	mapped := *version
+	mapped.Path = s.clientPath(version.Path)
+	return &mapped
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func readVersion(t *testing.T, fs *FileService, path string, number int64) string {
+	t.Helper()
+	file, _, err := fs.OpenVersionForRead(path, number)
+	if err != nil {
+		t.Fatalf("Failed to open version %d: %v", number, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Failed to read version %d: %v", number, err)
+	}
+	return string(data)
+}
+
+func TestVersions_OverwriteKeepsPreviousContent(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	if err := fs.SaveFile("notes.txt", "/", []byte("first")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := fs.SaveFileStream("notes.txt", "/", bytes.NewReader([]byte("second")), 6); err != nil {
+		t.Fatalf("Failed to overwrite file: %v", err)
+	}
+	if err := fs.SaveFile("notes.txt", "/", []byte("third!")); err != nil {
+		t.Fatalf("Failed to overwrite file: %v", err)
+	}
+
+	data, info, err := fs.GetFileData("/notes.txt")
+	if err != nil || string(data) != "third!" {
+		t.Fatalf("Expected the latest content, got %q, %v", data, err)
+	}
+	if info.Checksum != ChecksumBytes([]byte("third!")) || info.Size != 6 {
+		t.Errorf("Expected the metadata of the latest content, got %+v", info)
+	}
+
+	versions, err := fs.ListVersions("/notes.txt")
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+		t.Fatalf("Expected versions 2 and 1, got %+v", versions)
+	}
+	if versions[1].Size != 5 || versions[1].Checksum != ChecksumBytes([]byte("first")) {
+		t.Errorf("Unexpected first version: %+v", versions[1])
+	}
+	if got := readVersion(t, fs, "/notes.txt", 1); got != "first" {
+		t.Errorf("Expected the first content, got %q", got)
+	}
+
+	// Restoring keeps the replaced content as another version
+	if _, err := fs.RestoreVersion("/notes.txt", 1); err != nil {
+		t.Fatalf("Failed to restore version: %v", err)
+	}
+	if data, _, _ := fs.GetFileData("/notes.txt"); string(data) != "first" {
+		t.Errorf("Expected the restored content, got %q", data)
+	}
+	if got := readVersion(t, fs, "/notes.txt", 3); got != "third!" {
+		t.Errorf("Expected the replaced content as version 3, got %q", got)
+	}
+	if _, err := fs.RestoreVersion("/notes.txt", 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestVersions_FollowMovesAndDeletes(t *testing.T) {
+	fs := setupRealFileService(t)
+	if _, err := fs.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, content := range []string{"v1", "v2"} {
+		if err := fs.SaveFile("a.txt", "/docs", []byte(content)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	if err := fs.RenameFile("/docs", "archive"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if got := readVersion(t, fs, "/archive/a.txt", 1); got != "v1" {
+		t.Errorf("Expected the version to follow the rename, got %q", got)
+	}
+
+	if err := fs.DeleteFile("/archive", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+	result, err := fs.CollectGarbage()
+	if err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+	if result.RemovedBlobs != 2 {
+		t.Errorf("Expected the blobs of both contents to be collected, got %d", result.RemovedBlobs)
+	}
+}
+
+func TestVersions_Retention(t *testing.T) {
+	fs := setupRealFileService(t)
+	fs.SetVersionRetention(2, 0)
+
+	for _, content := range []string{"1", "2", "3", "4"} {
+		if err := fs.SaveFile("log.txt", "/", []byte(content)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+	versions, _ := fs.ListVersions("/log.txt")
+	if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 2 {
+		t.Fatalf("Expected only versions 3 and 2 to be kept, got %+v", versions)
+	}
+
+	// Versions replaced longer ago than the maximum age are removed by garbage collection
+	fs.SetVersionRetention(0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := fs.CollectGarbage(); err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+	if versions, _ := fs.ListVersions("/log.txt"); len(versions) != 0 {
+		t.Errorf("Expected expired versions to be removed, got %d", len(versions))
+	}
+	if data, _, _ := fs.GetFileData("/log.txt"); string(data) != "4" {
+		t.Errorf("Expected the current content to survive, got %q", data)
+	}
+}
+
+func TestVersions_OverwriteChecksQuotaAndOwner(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	setQuota(t, fs, models.SetQuotaRequest{SubjectType: models.QuotaSubjectUser, UserID: users["alice"].ID, MaxBytes: 10, MaxFiles: 1})
+
+	alice := fs.ForUser(users["alice"])
+	if err := alice.SaveFile("a.txt", "/", []byte("12345678")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	// Only the difference counts, and the file limit is not hit again
+	if err := alice.SaveFile("a.txt", "/", []byte("1234567890")); err != nil {
+		t.Fatalf("Expected the overwrite to fit the quota, got %v", err)
+	}
+	if err := alice.SaveFile("a.txt", "/", []byte("12345678901")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	usage, err := alice.GetQuotaUsage("/")
+	if err != nil {
+		t.Fatalf("Failed to load usage: %v", err)
+	}
+	if usage.UsedBytes != 10 || usage.UsedFiles != 1 {
+		t.Errorf("Expected versions not to count, got %d bytes in %d files", usage.UsedBytes, usage.UsedFiles)
+	}
+
+	versions, _ := alice.ListVersions("/a.txt")
+	if len(versions) != 1 || versions[0].AuthorID != users["alice"].ID {
+		t.Errorf("Expected one version written by alice, got %+v", versions)
+	}
+
+	if _, err := fs.CreateDirectory("dir", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fs.SaveFile("dir", "/", []byte("x")); !errors.Is(err, ErrPathIsDirectory) {
+		t.Errorf("Expected ErrPathIsDirectory, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/storage"
+)
+
+// Version is the release of the server, set when building with
+// -ldflags "-X github.com/anddsdev/cloudlet/internal/services.Version=v1.2.0".
+// Builds without it report the module version recorded by the Go toolchain.
+var Version string
+
+// databaseCheckTimeout fails the database check of a locked database instead of
+// letting the probe hang
+const databaseCheckTimeout = 2 * time.Second
+
+// CheckReadiness checks that the database answers, that the storage root and the staging
+// area are writable and that at least minFreeBytes are left on the disk of the storage root
+func (s *FileService) CheckReadiness(ctx context.Context, minFreeBytes uint64) *models.ReadinessReport {
+	report := &models.ReadinessReport{
+		Status: models.HealthOK,
+		Checks: map[string]*models.HealthCheck{},
+		Build:  buildInfo(),
+	}
+
+	report.Checks["database"] = runCheck(func(*models.HealthCheck) error {
+		ctx, cancel := context.WithTimeout(ctx, databaseCheckTimeout)
+		defer cancel()
+
+		if err := s.repo.Ping(ctx); err != nil {
+			return err
+		}
+		version, err := s.repo.SchemaVersion(ctx)
+		report.SchemaVersion = version
+		return err
+	})
+	report.Checks["storage"] = runCheck(func(*models.HealthCheck) error {
+		return s.storage.CheckWritable()
+	})
+	report.Checks["staging"] = runCheck(func(*models.HealthCheck) error {
+		return s.storage.CheckStagingWritable()
+	})
+	report.Checks["disk"] = runCheck(func(check *models.HealthCheck) error {
+		free, err := s.storage.FreeSpace()
+		if errors.Is(err, storage.ErrFreeSpaceUnsupported) {
+			check.Status = models.HealthSkipped
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		check.Details = map[string]interface{}{"free_bytes": free, "min_free_bytes": minFreeBytes}
+		if free < minFreeBytes {
+			return fmt.Errorf("%d bytes free, below the minimum of %d", free, minFreeBytes)
+		}
+		return nil
+	})
+
+	for _, check := range report.Checks {
+		if check.Status == models.HealthFailed {
+			report.Status = models.HealthDegraded
+		}
+	}
+	return report
+}
+
+// runCheck times check and fails it with the error it returns. Checks that neither fail
+// nor set a status pass.
+func runCheck(check func(*models.HealthCheck) error) *models.HealthCheck {
+	result := &models.HealthCheck{}
+	start := time.Now()
+	err := check(result)
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+	switch {
+	case err != nil:
+		result.Status = models.HealthFailed
+		result.Error = healthError(err)
+	case result.Status == "":
+		result.Status = models.HealthOK
+	}
+	return result
+}
+
+// healthError describes err without the paths of filesystem errors, since readiness
+// reports are served to anyone who can reach the server
+func healthError(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op + ": " + pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// buildInfo describes the running binary from Version and the build settings recorded by Go
+var buildInfo = sync.OnceValue(func() models.BuildInfo {
+	build := models.BuildInfo{Version: Version, GoVersion: runtime.Version()}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		if build.Version == "" {
+			build.Version = "unknown"
+		}
+		return build
+	}
+
+	if build.Version == "" {
+		build.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.time":
+			build.CommitTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+})
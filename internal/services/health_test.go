@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestCheckReadiness_Healthy(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	report := fs.CheckReadiness(context.Background(), 0)
+	if report.Status != models.HealthOK {
+		t.Fatalf("Expected a ready server, got %+v", report.Checks)
+	}
+	for _, name := range []string{"database", "storage", "staging", "disk"} {
+		if check := report.Checks[name]; check == nil || check.Status != models.HealthOK {
+			t.Errorf("Expected check %s to pass, got %+v", name, check)
+		}
+	}
+	if report.SchemaVersion < 13 {
+		t.Errorf("Expected the schema version of the migrated database, got %d", report.SchemaVersion)
+	}
+	if report.Build.GoVersion == "" || report.Build.Version == "" {
+		t.Errorf("Expected build info, got %+v", report.Build)
+	}
+
+	entries, _ := os.ReadDir(fs.storage.StagingPath())
+	if len(entries) != 0 {
+		t.Errorf("Expected the probe files to be removed, found %d entries in the staging area", len(entries))
+	}
+}
+
+func TestCheckReadiness_DegradedWithDetails(t *testing.T) {
+	fs := setupRealFileService(t)
+	if err := os.RemoveAll(fs.storage.StagingPath()); err != nil {
+		t.Fatalf("Failed to remove the staging area: %v", err)
+	}
+
+	report := fs.CheckReadiness(context.Background(), math.MaxUint64)
+	if report.Status != models.HealthDegraded {
+		t.Fatalf("Expected a degraded server, got %s", report.Status)
+	}
+
+	staging := report.Checks["staging"]
+	if staging.Status != models.HealthFailed || staging.Error == "" {
+		t.Errorf("Expected the staging check to fail, got %+v", staging)
+	}
+	if strings.Contains(staging.Error, fs.storage.StagingPath()) {
+		t.Errorf("Expected the error to leave out the storage path, got %q", staging.Error)
+	}
+	disk := report.Checks["disk"]
+	if disk.Status != models.HealthFailed || disk.Details["min_free_bytes"] != uint64(math.MaxUint64) {
+		t.Errorf("Expected the disk check to fail with its threshold, got %+v", disk)
+	}
+	if report.Checks["database"].Status != models.HealthOK || report.Checks["storage"].Status != models.HealthOK {
+		t.Errorf("Expected the other checks to pass, got %+v", report.Checks)
+	}
+}
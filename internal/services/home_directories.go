@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+// EnableHomeDirectories gives every user who is not an admin a private directory below
+// homesPath. Views returned by ForUser map "/" to that directory and cannot reach
+// anything outside it. Admins keep seeing the whole tree.
+func (s *FileService) EnableHomeDirectories(homesPath string) error {
+	validated, err := s.pathValidator.ValidateAndNormalizePath(homesPath)
+	if err != nil {
+		return fmt.Errorf("invalid home directories path: %w", err)
+	}
+	if validated == "/" {
+		return fmt.Errorf("home directories cannot be placed at the root")
+	}
+
+	s.homesPath = validated
+	s.homesReady = &sync.Map{}
+	return nil
+}
+
+// HomeDirectory returns the storage path of the home directory of user, or "/" when
+// the user is not confined to one. Homes are named after user IDs rather than usernames,
+// which are freed when a user is deleted, so a new user taking the name of a deleted one
+// does not inherit the files left in their home.
+func (s *FileService) HomeDirectory(user *models.User) string {
+	if s.homesPath == "" || user == nil || user.IsAdmin {
+		return "/"
+	}
+	return s.homesPath + "/" + strconv.FormatInt(user.ID, 10)
+}
+
+// ResolvePath returns the storage path a client path names for the user of the view.
+// Uploads that finish in the background are handed resolved paths.
+func (s *FileService) ResolvePath(clientPath string) (string, error) {
+	return s.pathValidator.ValidateAndNormalizePath(clientPath)
+}
+
+// confine switches the view to the home directory of its user, creating it on first use
+func (s *FileService) confine() {
+	home := s.HomeDirectory(s.user)
+	if home == "/" {
+		return
+	}
+
+	if _, ready := s.homesReady.Load(home); !ready {
+		if err := s.unrestricted().ensureDirectory(home); err != nil {
+			s.log().Error("Failed to create home directory", "path", home, "error", err)
+		} else {
+			s.homesReady.Store(home, true)
+		}
+	}
+	s.pathValidator = s.pathValidator.WithRoot(home)
+}
+
+// ensureDirectory creates dirPath and any missing parents
+func (s *FileService) ensureDirectory(dirPath string) error {
+	if dirPath == "/" {
+		return nil
+	}
+	if info, err := s.repo.GetFileByPath(dirPath); err == nil {
+		if !info.IsDirectory {
+			return fmt.Errorf("%s is not a directory", dirPath)
+		}
+		return nil
+	}
+
+	parent := path.Dir(dirPath)
+	if err := s.ensureDirectory(parent); err != nil {
+		return err
+	}
+
+	if _, err := s.CreateDirectory(path.Base(dirPath), parent); err != nil {
+		// Another request may have created it in the meantime
+		if _, lookupErr := s.repo.GetFileByPath(dirPath); lookupErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// clientPath maps a storage path to the path the client of the view sees. Paths outside
+// the home directory map to "".
+func (s *FileService) clientPath(storagePath string) string {
+	mapped, _ := s.pathValidator.ToVirtual(storagePath)
+	return mapped
+}
+
+// clientFile returns info with its paths as seen by the client of the view
+func (s *FileService) clientFile(info *models.FileInfo) *models.FileInfo {
+	if info == nil || s.pathValidator.Root() == "/" {
+		return info
+	}
+
+	mapped := *info
+	mapped.Path = s.clientPath(info.Path)
+	mapped.ParentPath = s.clientPath(info.ParentPath)
+	return &mapped
+}
+
+func (s *FileService) clientFiles(files []*models.FileInfo) []*models.FileInfo {
+	if s.pathValidator.Root() == "/" {
+		return files
+	}
+
+	mapped := make([]*models.FileInfo, len(files))
+	for i, file := range files {
+		mapped[i] = s.clientFile(file)
+	}
+	return mapped
+}
+
+// clientACL maps the paths of an ACL, leaving out inherited entries set above the home directory
+func (s *FileService) clientACL(acl *models.DirectoryACL) *models.DirectoryACL {
+	if s.pathValidator.Root() == "/" {
+		return acl
+	}
+
+	mapped := &models.DirectoryACL{
+		Path:      s.clientPath(acl.Path),
+		Entries:   []*models.ACLEntry{},
+		Inherited: []*models.ACLEntry{},
+	}
+	for _, entry := range acl.Entries {
+		mapped.Entries = append(mapped.Entries, s.clientACLEntry(entry))
+	}
+	for _, entry := range acl.Inherited {
+		if _, inside := s.pathValidator.ToVirtual(entry.Path); inside {
+			mapped.Inherited = append(mapped.Inherited, s.clientACLEntry(entry))
+		}
+	}
+	return mapped
+}
+
+func (s *FileService) clientACLEntry(entry *models.ACLEntry) *models.ACLEntry {
+	if s.pathValidator.Root() == "/" {
+		return entry
+	}
+
+	mapped := *entry
+	mapped.Path = s.clientPath(entry.Path)
+	return &mapped
+}
+
+// isHomeDirectory reports whether storagePath is the home root of the view, which cannot be renamed, moved or deleted
+func (s *FileService) isHomeDirectory(storagePath string) bool {
+	root := s.pathValidator.Root()
+	return root != "/" && strings.TrimSuffix(storagePath, "/") == root
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+)
+
+func setupHomeDirectories(t *testing.T) (*FileService, *AuthService) {
+	fs, auth, _ := setupAccessControl(t)
+	if err := fs.EnableHomeDirectories("/home"); err != nil {
+		t.Fatalf("Failed to enable home directories: %v", err)
+	}
+	return fs, auth
+}
+
+func TestHomeDirectories_RootMapsToHome(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, err := auth.users.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+
+	view := fs.ForUser(alice)
+	if _, err := view.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := view.SaveFile("notes.txt", "/docs", []byte("hello")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	listing, err := view.GetDirectoryListing("/docs")
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if listing.Path != "/docs" || listing.ParentPath != "/" {
+		t.Errorf("Expected client paths, got %q with parent %q", listing.Path, listing.ParentPath)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].Path != "/docs/notes.txt" || listing.Files[0].ParentPath != "/docs" {
+		t.Errorf("Expected /docs/notes.txt in the listing, got %+v", listing.Files)
+	}
+	if len(listing.Breadcrumbs) != 2 || listing.Breadcrumbs[1].Path != "/docs" {
+		t.Errorf("Unexpected breadcrumbs: %+v", listing.Breadcrumbs)
+	}
+
+	// The file is stored in the home directory of alice
+	home := fmt.Sprintf("/home/%d", alice.ID)
+	if fs.HomeDirectory(alice) != home {
+		t.Errorf("Expected the home directory of alice at %s, got %s", home, fs.HomeDirectory(alice))
+	}
+	if _, err := fs.GetFileInfo(home + "/docs/notes.txt"); err != nil {
+		t.Errorf("Expected the file below %s, got %v", home, err)
+	}
+}
+
+func TestHomeDirectories_TenantsAreIsolated(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, _ := auth.users.GetUserByUsername("alice")
+	bob, _ := auth.users.GetUserByUsername("bob")
+
+	aliceView := fs.ForUser(alice)
+	if err := aliceView.SaveFile("secret.txt", "/", []byte("mine")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	bobView := fs.ForUser(bob)
+	if err := bobView.SaveFile("upload.txt", "/", []byte("bob")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	listing, err := bobView.GetDirectoryListing("/")
+	if err != nil {
+		t.Fatalf("Failed to list home: %v", err)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].Name != "upload.txt" {
+		t.Errorf("Expected bob to only see his own file, got %d files", len(listing.Files))
+	}
+
+	aliceHome := fs.HomeDirectory(alice)
+	aliceID := path.Base(aliceHome)
+	for _, crafted := range []string{aliceHome + "/secret.txt", "/../" + aliceID + "/secret.txt", "../.." + aliceHome + "/secret.txt"} {
+		if _, _, err := bobView.GetFileData(crafted); err == nil {
+			t.Errorf("Expected %q to stay out of reach", crafted)
+		}
+	}
+
+	// A crafted destination cannot place a file in another home either
+	for _, destination := range []string{aliceHome, "/../" + aliceID, "/.."} {
+		if err := bobView.MoveFile("/upload.txt", destination); err == nil {
+			t.Errorf("Expected move to %q to fail", destination)
+		}
+	}
+	if _, err := fs.GetFileInfo(aliceHome + "/upload.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected nothing to reach the home of alice, got %v", err)
+	}
+}
+
+func TestHomeDirectories_HomeCannotBeRemoved(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, _ := auth.users.GetUserByUsername("alice")
+	view := fs.ForUser(alice)
+
+	if err := view.DeleteFile("/", true); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected deleting the home directory to be denied, got %v", err)
+	}
+	if err := view.RenameFile("/", "elsewhere"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected renaming the home directory to be denied, got %v", err)
+	}
+}
+
+func TestHomeDirectories_AdminsSeeEverything(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, _ := auth.users.GetUserByUsername("alice")
+	admin, _ := auth.users.GetUserByUsername("admin")
+
+	if err := fs.ForUser(alice).SaveFile("a.txt", "/", []byte("a")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	home := fs.HomeDirectory(alice)
+	listing, err := fs.ForUser(admin).GetDirectoryListing(home)
+	if err != nil {
+		t.Fatalf("Failed to list home as admin: %v", err)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].Path != home+"/a.txt" {
+		t.Errorf("Expected the admin to see the storage paths, got %+v", listing.Files)
+	}
+}
+
+func TestHomeDirectories_ReusedUsernameGetsNewHome(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, _ := auth.users.GetUserByUsername("alice")
+
+	if err := fs.ForUser(alice).SaveFile("secret.txt", "/", []byte("mine")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := auth.DeleteUser(alice.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	newcomer, err := auth.CreateUser("alice", "another password", false)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if fs.HomeDirectory(newcomer) == fs.HomeDirectory(alice) {
+		t.Fatalf("Expected a new home directory, got the one of the deleted user")
+	}
+
+	listing, err := fs.ForUser(newcomer).GetDirectoryListing("/")
+	if err != nil {
+		t.Fatalf("Failed to list home: %v", err)
+	}
+	if len(listing.Files) != 0 {
+		t.Errorf("Expected the new user to start with an empty home, got %d files", len(listing.Files))
+	}
+}
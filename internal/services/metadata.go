@@ -0,0 +1,385 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+var (
+	ErrInvalidTag       = errors.New("invalid tag")
+	ErrInvalidMetadata  = errors.New("invalid metadata")
+	ErrMetadataNotFound = errors.New("metadata entry not found")
+)
+
+const (
+	maxTagLength           = 64
+	maxTagsPerFile         = 50
+	maxBulkTagPaths        = 1000
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 1024
+	maxMetadataPerRequest  = 100
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// GetMetadata returns the tags and metadata entries of a file or directory
+func (s *FileService) GetMetadata(filePath string) (*models.FileMetadata, error) {
+	file, err := s.getFileInfo(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.repo.GetTags([]int64{file.ID})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetMetadata(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		entry.Value = decodeMetadataValue(entry.Type, entry.Value.(string))
+	}
+
+	metadata := &models.FileMetadata{
+		Path:     s.clientPath(file.Path),
+		Tags:     tags[file.ID],
+		Metadata: entries,
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = []string{}
+	}
+	if metadata.Metadata == nil {
+		metadata.Metadata = []*models.MetadataEntry{}
+	}
+	return metadata, nil
+}
+
+// SetTags replaces the tags of a file or directory. Tags are trimmed and compared
+// regardless of case. It needs the write permission on the path.
+func (s *FileService) SetTags(filePath string, tags []string) ([]string, error) {
+	normalized, err := s.setTags(filePath, tags)
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditSetTags,
+		Path:    s.auditPath(filePath),
+		Details: strings.Join(normalized, ", "),
+	}, err)
+	return normalized, err
+}
+
+func (s *FileService) setTags(filePath string, tags []string) ([]string, error) {
+	normalized, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized) > maxTagsPerFile {
+		return nil, fmt.Errorf("%w: at most %d tags per file", ErrInvalidTag, maxTagsPerFile)
+	}
+
+	file, err := s.metadataTarget(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetTags(file.ID, normalized); err != nil {
+		return nil, fmt.Errorf("failed to save tags: %w", err)
+	}
+	return normalized, nil
+}
+
+// UpdateTags adds and removes tags on several files and directories at once. Nothing is
+// changed unless the user of the view may write every path. It returns how many files
+// and directories were updated.
+func (s *FileService) UpdateTags(req *models.BulkTagRequest) (int, error) {
+	add, err := normalizeTags(req.Add)
+	if err != nil {
+		return 0, err
+	}
+	remove, err := normalizeTags(req.Remove)
+	if err != nil {
+		return 0, err
+	}
+	if len(req.Paths) == 0 || len(req.Paths) > maxBulkTagPaths || len(add)+len(remove) == 0 {
+		return 0, fmt.Errorf("%w: between 1 and %d paths and at least one tag are required", ErrInvalidTag, maxBulkTagPaths)
+	}
+
+	details := bulkTagAuditDetails(add, remove)
+	files := make([]*models.FileInfo, 0, len(req.Paths))
+	ids := make([]int64, 0, len(req.Paths))
+	for _, filePath := range req.Paths {
+		file, err := s.metadataTarget(filePath)
+		if err != nil {
+			s.recordAuditEntry(&models.AuditEntry{Action: models.AuditSetTags, Path: s.auditPath(filePath), Details: details}, err)
+			return 0, err
+		}
+		files = append(files, file)
+		ids = append(ids, file.ID)
+	}
+
+	current, err := s.repo.GetTags(ids)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		if count := len(applyTagChanges(current[file.ID], add, remove)); count > maxTagsPerFile {
+			return 0, fmt.Errorf("%w: %s would have more than %d tags", ErrInvalidTag, s.clientPath(file.Path), maxTagsPerFile)
+		}
+	}
+
+	err = s.repo.UpdateTags(ids, add, remove)
+	for _, file := range files {
+		s.recordAuditEntry(&models.AuditEntry{Action: models.AuditSetTags, Path: file.Path, Details: details}, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to save tags: %w", err)
+	}
+	return len(files), nil
+}
+
+// ListTags returns the tags used on the files and directories the user of the view can
+// read, with how many carry each
+func (s *FileService) ListTags() ([]*models.TagCount, error) {
+	readable, err := s.readableFilter(s.pathValidator.Root())
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := s.repo.GetTaggedPathsUnder(s.pathValidator.Root())
+	if err != nil {
+		return nil, err
+	}
+
+	counts := []*models.TagCount{}
+	for tag, paths := range tagged {
+		count := 0
+		for _, filePath := range paths {
+			if readable(&models.FileInfo{Path: filePath}) {
+				count++
+			}
+		}
+		if count > 0 {
+			counts = append(counts, &models.TagCount{Tag: tag, Count: count})
+		}
+	}
+	slices.SortFunc(counts, func(a, b *models.TagCount) int {
+		return strings.Compare(strings.ToLower(a.Tag), strings.ToLower(b.Tag))
+	})
+	return counts, nil
+}
+
+// SetMetadata sets metadata entries on a file or directory, replacing the entries with
+// the same keys. It needs the write permission on the path.
+func (s *FileService) SetMetadata(filePath string, entries []*models.MetadataEntry) ([]*models.MetadataEntry, error) {
+	saved, err := s.setMetadata(filePath, entries)
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != nil {
+			keys = append(keys, entry.Key)
+		}
+	}
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditSetMetadata,
+		Path:    s.auditPath(filePath),
+		Details: strings.Join(keys, ", "),
+	}, err)
+	return saved, err
+}
+
+func (s *FileService) setMetadata(filePath string, entries []*models.MetadataEntry) ([]*models.MetadataEntry, error) {
+	if len(entries) == 0 || len(entries) > maxMetadataPerRequest {
+		return nil, fmt.Errorf("%w: between 1 and %d entries are required", ErrInvalidMetadata, maxMetadataPerRequest)
+	}
+
+	stored := make([]*models.MetadataEntry, len(entries))
+	for i, entry := range entries {
+		if entry == nil {
+			return nil, ErrInvalidMetadata
+		}
+		if !metadataKeyPattern.MatchString(entry.Key) || len(entry.Key) > maxMetadataKeyLength {
+			return nil, fmt.Errorf("%w: key %q must start with a letter and hold only letters, digits, '_', '.' and '-'", ErrInvalidMetadata, entry.Key)
+		}
+		value, err := encodeMetadataValue(entry.Type, entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidMetadata, entry.Key, err)
+		}
+		stored[i] = &models.MetadataEntry{Key: entry.Key, Type: entry.Type, Value: value}
+	}
+
+	file, err := s.metadataTarget(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetMetadata(file.ID, stored); err != nil {
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	for _, entry := range stored {
+		entry.Value = decodeMetadataValue(entry.Type, entry.Value.(string))
+	}
+	return stored, nil
+}
+
+// DeleteMetadata removes the metadata entry with key from a file or directory
+func (s *FileService) DeleteMetadata(filePath, key string) error {
+	err := s.deleteMetadata(filePath, key)
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditDeleteMetadata,
+		Path:    s.auditPath(filePath),
+		Details: key,
+	}, err)
+	return err
+}
+
+func (s *FileService) deleteMetadata(filePath, key string) error {
+	file, err := s.metadataTarget(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteMetadata(file.ID, key); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrMetadataNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// metadataTarget returns the file or directory at a client path once the user of the
+// view may change what is attached to it
+func (s *FileService) metadataTarget(filePath string) (*models.FileInfo, error) {
+	validated, err := s.pathValidator.ValidateAndNormalizePath(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	file, err := s.repo.GetFileByPath(validated)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	if err := s.authorize(models.PermissionWrite, file.Path); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// attachTags sets the tags of files
+func (s *FileService) attachTags(files []*models.FileInfo) error {
+	ids := make([]int64, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	tags, err := s.repo.GetTags(ids)
+	if err != nil {
+		return fmt.Errorf("failed to load tags: %w", err)
+	}
+	for _, file := range files {
+		file.Tags = tags[file.ID]
+	}
+	return nil
+}
+
+// hasTags reports whether file carries every tag, regardless of case
+func hasTags(file *models.FileInfo, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.ContainsFunc(file.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTags trims tags, collapses their inner whitespace and drops duplicates
+// regardless of case. Tags cannot hold commas, which separate them in query strings.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.Contains(tag, ",") ||
+			strings.ContainsFunc(tag, unicode.IsControl) {
+			return nil, fmt.Errorf("%w: %q must hold 1 to %d characters and no commas", ErrInvalidTag, tag, maxTagLength)
+		}
+		if !slices.ContainsFunc(normalized, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// applyTagChanges returns tags with add added and remove removed, regardless of case
+func applyTagChanges(tags, add, remove []string) []string {
+	result := slices.DeleteFunc(slices.Clone(tags), func(t string) bool {
+		return slices.ContainsFunc(remove, func(r string) bool { return strings.EqualFold(t, r) })
+	})
+	for _, tag := range add {
+		if !slices.ContainsFunc(result, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func bulkTagAuditDetails(add, remove []string) string {
+	var changes []string
+	for _, tag := range add {
+		changes = append(changes, "+"+tag)
+	}
+	for _, tag := range remove {
+		changes = append(changes, "-"+tag)
+	}
+	return strings.Join(changes, ", ")
+}
+
+// encodeMetadataValue checks that value, as decoded from JSON, has the given type and
+// returns its stored form. Dates are stored as RFC 3339 times in UTC or as YYYY-MM-DD.
+func encodeMetadataValue(valueType string, value any) (string, error) {
+	switch valueType {
+	case models.MetadataString:
+		if v, ok := value.(string); ok && utf8.RuneCountInString(v) <= maxMetadataValueLength {
+			return v, nil
+		}
+		return "", fmt.Errorf("expected a string of at most %d characters", maxMetadataValueLength)
+	case models.MetadataNumber:
+		if v, ok := value.(float64); ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+		return "", errors.New("expected a number")
+	case models.MetadataBoolean:
+		if v, ok := value.(bool); ok {
+			return strconv.FormatBool(v), nil
+		}
+		return "", errors.New("expected true or false")
+	case models.MetadataDate:
+		if v, ok := value.(string); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t.UTC().Format(time.RFC3339), nil
+			}
+			if _, err := time.Parse(time.DateOnly, v); err == nil {
+				return v, nil
+			}
+		}
+		return "", errors.New("expected an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	return "", fmt.Errorf("unknown type %q", valueType)
+}
+
+// decodeMetadataValue returns the typed value of a stored metadata value
+func decodeMetadataValue(valueType, stored string) any {
+	switch valueType {
+	case models.MetadataNumber:
+		if v, err := strconv.ParseFloat(stored, 64); err == nil {
+			return v
+		}
+	case models.MetadataBoolean:
+		return stored == "true"
+	}
+	return stored
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestMetadata_TagsFollowFilesAndFilterListings(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	if _, err := fs.CreateDirectory("deliverables", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"logo.svg", "brief.pdf", "invoice.pdf"} {
+		if err := fs.SaveFile(name, "/deliverables", []byte(name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	tags, err := fs.SetTags("/deliverables/logo.svg", []string{" Client:Acme ", "final", "client:acme"})
+	if err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+	if !slices.Equal(tags, []string{"Client:Acme", "final"}) {
+		t.Errorf("Expected trimmed tags without duplicates, got %v", tags)
+	}
+	updated, err := fs.UpdateTags(&models.BulkTagRequest{
+		Paths:  []string{"/deliverables/brief.pdf", "/deliverables/logo.svg"},
+		Add:    []string{"client:acme", "in review"},
+		Remove: []string{"FINAL"},
+	})
+	if err != nil || updated != 2 {
+		t.Fatalf("Expected 2 files updated, got %d, %v", updated, err)
+	}
+
+	listing, err := fs.GetDirectoryListing("/deliverables", "CLIENT:ACME", "in review")
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(listing.Files) != 2 || listing.Files[0].Name != "brief.pdf" {
+		t.Fatalf("Expected the two tagged files, got %+v", listing.Files)
+	}
+	if !slices.Equal(listing.Files[1].Tags, []string{"Client:Acme", "in review"}) {
+		t.Errorf("Expected the tags of logo.svg in the listing, got %v", listing.Files[1].Tags)
+	}
+
+	// Tags stay with renamed and moved files and go away with deleted ones
+	if err := fs.RenameFile("/deliverables/logo.svg", "logo-v2.svg"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if metadata, err := fs.GetMetadata("/deliverables/logo-v2.svg"); err != nil || len(metadata.Tags) != 2 {
+		t.Errorf("Expected the tags to follow the rename, got %+v, %v", metadata, err)
+	}
+	if err := fs.DeleteFile("/deliverables/brief.pdf"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := fs.SaveFile("brief.pdf", "/deliverables", []byte("new brief")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if metadata, _ := fs.GetMetadata("/deliverables/brief.pdf"); len(metadata.Tags) != 0 {
+		t.Errorf("Expected a new file without tags, got %v", metadata.Tags)
+	}
+
+	results, err := fs.Search(&models.SearchFilter{Tags: []string{"client:acme"}}, 0, 0)
+	if err != nil || len(results.Results) != 1 || results.Results[0].Name != "logo-v2.svg" {
+		t.Errorf("Expected to find the tagged file by tag alone, got %+v, %v", results, err)
+	}
+	tagCounts, err := fs.ListTags()
+	if err != nil || len(tagCounts) != 2 || tagCounts[0].Tag != "Client:Acme" || tagCounts[0].Count != 1 {
+		t.Errorf("Unexpected tag counts: %+v, %v", tagCounts, err)
+	}
+
+	for _, invalid := range [][]string{{""}, {"a,b"}, {string(make([]byte, maxTagLength+1))}} {
+		if _, err := fs.SetTags("/deliverables/invoice.pdf", invalid); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("Expected ErrInvalidTag for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestMetadata_TypedValues(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	if err := fs.SaveFile("contract.pdf", "/", []byte("contract")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	entries, err := fs.SetMetadata("/contract.pdf", []*models.MetadataEntry{
+		{Key: "client", Type: models.MetadataString, Value: "Acme"},
+		{Key: "amount", Type: models.MetadataNumber, Value: 1250.5},
+		{Key: "signed", Type: models.MetadataBoolean, Value: true},
+		{Key: "due", Type: models.MetadataDate, Value: "2025-03-01T10:00:00+01:00"},
+	})
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("Failed to set metadata: %+v, %v", entries, err)
+	}
+
+	// Setting a key again replaces its entry
+	if _, err := fs.SetMetadata("/contract.pdf", []*models.MetadataEntry{
+		{Key: "signed", Type: models.MetadataBoolean, Value: false},
+	}); err != nil {
+		t.Fatalf("Failed to replace metadata: %v", err)
+	}
+
+	metadata, err := fs.GetMetadata("/contract.pdf")
+	if err != nil {
+		t.Fatalf("Failed to get metadata: %v", err)
+	}
+	values := make(map[string]any)
+	for _, entry := range metadata.Metadata {
+		values[entry.Key] = entry.Value
+	}
+	expected := map[string]any{"amount": 1250.5, "client": "Acme", "due": "2025-03-01T09:00:00Z", "signed": false}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, values[key])
+		}
+	}
+	if len(metadata.Metadata) != 4 || metadata.Metadata[0].Key != "amount" {
+		t.Errorf("Expected 4 entries ordered by key, got %+v", metadata.Metadata)
+	}
+
+	invalid := []*models.MetadataEntry{
+		{Key: "amount", Type: models.MetadataNumber, Value: "a lot"},
+		{Key: "due", Type: models.MetadataDate, Value: "next week"},
+		{Key: "1st", Type: models.MetadataString, Value: "x"},
+		{Key: "color", Type: "colour", Value: "red"},
+	}
+	for _, entry := range invalid {
+		if _, err := fs.SetMetadata("/contract.pdf", []*models.MetadataEntry{entry}); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("Expected ErrInvalidMetadata for %+v, got %v", entry, err)
+		}
+	}
+
+	if err := fs.DeleteMetadata("/contract.pdf", "client"); err != nil {
+		t.Fatalf("Failed to delete metadata: %v", err)
+	}
+	if err := fs.DeleteMetadata("/contract.pdf", "client"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("Expected ErrMetadataNotFound, got %v", err)
+	}
+}
+
+func TestMetadata_ChangesNeedWriteAccess(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+	alice := fs.ForUser(users["alice"])
+
+	for _, dir := range []string{"open", "locked"} {
+		if _, err := admin.CreateDirectory(dir, "/"); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	grant(t, admin, "/locked", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+
+	if _, err := alice.SetTags("/locked", []string{"mine"}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+	_, err := alice.UpdateTags(&models.BulkTagRequest{Paths: []string{"/open", "/locked"}, Add: []string{"mine"}})
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied for the bulk update, got %v", err)
+	}
+	if metadata, _ := alice.GetMetadata("/open"); len(metadata.Tags) != 0 {
+		t.Errorf("Expected a denied bulk update to change nothing, got %v", metadata.Tags)
+	}
+	if _, err := alice.GetMetadata("/locked"); err != nil {
+		t.Errorf("Expected read access to be enough to see metadata, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"github.com/anddsdev/cloudlet/internal/metrics"
+)
+
+// RegisterMetrics adds gauges to registry that read the storage usage and the file locks
+// of the service when scraped
+func (s *FileService) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("cloudlet_storage_bytes", "Total size of the stored files.", func() (float64, error) {
+		size, _, err := s.repo.GetStorageTotals()
+		return float64(size), err
+	})
+	registry.NewGaugeFunc("cloudlet_storage_files", "Number of stored files, directories excluded.", func() (float64, error) {
+		_, count, err := s.repo.GetStorageTotals()
+		return float64(count), err
+	})
+	registry.NewGaugeFunc("cloudlet_active_file_locks", "Files locked by atomic file operations in progress.", func() (float64, error) {
+		activeLocks, _ := s.storage.GetStats()["active_locks"].(int)
+		return float64(activeLocks), nil
+	})
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bytes"
 	"fmt"
 	"mime/multipart"
 	"sync"
@@ -16,6 +17,7 @@ type MultipleUploadService struct {
 	fileService *FileService
 	validator   *MultipleUploadValidator
 	cfg         *config.Config
+	batches     *BatchProgressRegistry
 }
 
 // NewMultipleUploadService creates a new multiple upload service
@@ -24,11 +26,26 @@ func NewMultipleUploadService(fileService *FileService, cfg *config.Config, stor
 		fileService: fileService,
 		validator:   NewMultipleUploadValidator(cfg, storagePath),
 		cfg:         cfg,
+		batches:     NewBatchProgressRegistry(),
 	}
 }
 
+// WithFileService returns a copy of the service that saves through files, a view returned by
+// FileService.OwnedBy, sharing its batch registry with s
+func (s *MultipleUploadService) WithFileService(files *FileService) *MultipleUploadService {
+	scoped := *s
+	scoped.fileService = files
+	return &scoped
+}
+
 // UploadMultipleFiles implements hybrid strategy: validate all first, then process sequentially with atomic transactions
 func (s *MultipleUploadService) UploadMultipleFiles(files []*multipart.FileHeader, targetPath string) *models.MultipleUploadResponse {
+	return s.UploadMultipleFilesTracked(files, targetPath, nil)
+}
+
+// UploadMultipleFilesTracked works like UploadMultipleFiles but reports per-file progress
+// to tracker and skips the files that have not started once the batch is cancelled
+func (s *MultipleUploadService) UploadMultipleFilesTracked(files []*multipart.FileHeader, targetPath string, tracker *BatchTracker) *models.MultipleUploadResponse {
 	startTime := time.Now()
 	
 	response := &models.MultipleUploadResponse{
@@ -46,9 +63,20 @@ func (s *MultipleUploadService) UploadMultipleFiles(files []*multipart.FileHeade
 	validation := s.validator.ValidateMultipleUpload(files, targetPath)
 	response.TotalSize = validation.TotalSize
 
-	if !validation.Valid {
+	// The whole batch has to fit in the quotas before any file is stored
+	var quotaErr error
+	if validation.Valid {
+		quotaErr = s.fileService.CheckQuota(targetPath, validation.TotalSize, int64(len(files)))
+	}
+
+	if !validation.Valid || quotaErr != nil {
 		response.Success = false
 		response.Message = s.validator.GenerateUploadSummary(validation)
+		failure := "Validation failed"
+		if quotaErr != nil {
+			response.Message = quotaErr.Error()
+			failure = quotaErr.Error()
+		}
 		response.ProcessingTimeMs = time.Since(startTime).Milliseconds()
 		
 		// Create failed results for all files
@@ -59,10 +87,11 @@ func (s *MultipleUploadService) UploadMultipleFiles(files []*multipart.FileHeade
 				Size:         file.Size,
 				Path:         targetPath,
 				Success:      false,
-				Error:        "Validation failed",
+				Error:        failure,
 				Index:        i,
 			}
 			response.Files = append(response.Files, result)
+			tracker.FileDone(result)
 		}
 		response.FailedFiles = len(files)
 		return response
@@ -70,20 +99,25 @@ func (s *MultipleUploadService) UploadMultipleFiles(files []*multipart.FileHeade
 
 	// Phase 2: Sequential processing with transaction management
 	if s.cfg.Server.Upload.CleanupOnFailure {
-		return s.processWithFullRollback(files, targetPath, response, startTime)
+		return s.processWithFullRollback(files, targetPath, response, startTime, tracker)
 	} else {
-		return s.processWithBestEffort(files, targetPath, response, startTime)
+		return s.processWithBestEffort(files, targetPath, response, startTime, tracker)
 	}
 }
 
 // processWithFullRollback processes files with complete rollback on any failure
-func (s *MultipleUploadService) processWithFullRollback(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time) *models.MultipleUploadResponse {
+func (s *MultipleUploadService) processWithFullRollback(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time, tracker *BatchTracker) *models.MultipleUploadResponse {
 	// Create transaction manager for the entire batch
-	tm := transaction.NewTransactionManager()
+	tm := transaction.NewTransactionManager().WithLogger(s.fileService.log())
 	uploadedFiles := make([]string, 0, len(files))
 
 	// Process each file and add to transaction
 	for i, file := range files {
+		if tracker.Cancelled() {
+			break
+		}
+		tracker.StartFile(file.Filename)
+
 		fileResult := s.processFileWithTransaction(file, targetPath, i, tm, &uploadedFiles)
 		response.Files = append(response.Files, fileResult)
 		
@@ -92,8 +126,27 @@ func (s *MultipleUploadService) processWithFullRollback(files []*multipart.FileH
 		}
 	}
 
-	// Execute all operations atomically
-	if err := tm.Execute(); err != nil {
+	// Nothing has been written yet, so a cancelled batch is dropped as a whole
+	if tracker.Cancelled() {
+		response.Success = false
+		response.Message = "Batch upload cancelled"
+		response.FailedFiles = len(files)
+		response.ProcessedSize = 0
+		response.Files = make([]models.FileUploadResult, 0, len(files))
+		for i, file := range files {
+			response.Files = append(response.Files, CancelledFileResult(file, targetPath, i))
+		}
+		response.ProcessingTimeMs = time.Since(startTime).Milliseconds()
+		return response
+	}
+
+	// Execute all operations atomically. Blobs committed by the transaction must
+	// not be garbage collected before the records referencing them exist.
+	s.fileService.blobMu.RLock()
+	err := tm.Execute()
+	s.fileService.blobMu.RUnlock()
+
+	if err != nil {
 		response.Success = false
 		response.Message = fmt.Sprintf("Batch upload failed: %v", err)
 		response.FailedFiles = len(files)
@@ -102,8 +155,16 @@ func (s *MultipleUploadService) processWithFullRollback(files []*multipart.FileH
 		for i := range response.Files {
 			response.Files[i].Success = false
 			response.Files[i].Error = "Batch rollback: " + err.Error()
+			tracker.FileDone(response.Files[i])
 		}
 	} else {
+		// Versions are only pruned once the batch can no longer be rolled back to them
+		for _, uploaded := range uploadedFiles {
+			s.fileService.pruneVersions(uploaded)
+		}
+		for _, fileResult := range response.Files {
+			tracker.FileDone(fileResult)
+		}
 		response.Success = true
 		response.SuccessfulFiles = len(files)
 		response.Message = fmt.Sprintf("Successfully uploaded %d files", len(files))
@@ -114,7 +175,7 @@ func (s *MultipleUploadService) processWithFullRollback(files []*multipart.FileH
 }
 
 // processWithBestEffort processes files individually, allowing partial success
-func (s *MultipleUploadService) processWithBestEffort(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time) *models.MultipleUploadResponse {
+func (s *MultipleUploadService) processWithBestEffort(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time, tracker *BatchTracker) *models.MultipleUploadResponse {
 	// Determine processing strategy based on file sizes
 	largeFiles := 0
 	for _, file := range files {
@@ -125,16 +186,16 @@ func (s *MultipleUploadService) processWithBestEffort(files []*multipart.FileHea
 
 	// Use concurrent processing for many small files, sequential for large files
 	if largeFiles == 0 && len(files) > 5 && s.cfg.Server.Upload.MaxConcurrentUploads > 1 {
-		return s.processConcurrently(files, targetPath, response, startTime)
+		return s.processConcurrently(files, targetPath, response, startTime, tracker)
 	} else {
-		return s.processSequentially(files, targetPath, response, startTime)
+		return s.processSequentially(files, targetPath, response, startTime, tracker)
 	}
 }
 
 // processSequentially processes files one by one
-func (s *MultipleUploadService) processSequentially(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time) *models.MultipleUploadResponse {
+func (s *MultipleUploadService) processSequentially(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time, tracker *BatchTracker) *models.MultipleUploadResponse {
 	for i, file := range files {
-		result := s.processIndividualFile(file, targetPath, i)
+		result := s.processTrackedFile(file, targetPath, i, tracker)
 		response.Files = append(response.Files, result)
 		
 		if result.Success {
@@ -159,7 +220,7 @@ func (s *MultipleUploadService) processSequentially(files []*multipart.FileHeade
 }
 
 // processConcurrently processes files using worker pool pattern
-func (s *MultipleUploadService) processConcurrently(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time) *models.MultipleUploadResponse {
+func (s *MultipleUploadService) processConcurrently(files []*multipart.FileHeader, targetPath string, response *models.MultipleUploadResponse, startTime time.Time, tracker *BatchTracker) *models.MultipleUploadResponse {
 	maxWorkers := s.cfg.Server.Upload.MaxConcurrentUploads
 	if maxWorkers <= 0 {
 		maxWorkers = 3 // Default
@@ -173,7 +234,7 @@ func (s *MultipleUploadService) processConcurrently(files []*multipart.FileHeade
 	var wg sync.WaitGroup
 	for w := 0; w < maxWorkers; w++ {
 		wg.Add(1)
-		go s.uploadWorker(&wg, fileJobs, results, targetPath)
+		go s.uploadWorker(&wg, fileJobs, results, targetPath, tracker)
 	}
 
 	// Send jobs
@@ -223,15 +284,40 @@ type fileJob struct {
 }
 
 // uploadWorker processes file upload jobs
-func (s *MultipleUploadService) uploadWorker(wg *sync.WaitGroup, jobs <-chan fileJob, results chan<- models.FileUploadResult, targetPath string) {
+func (s *MultipleUploadService) uploadWorker(wg *sync.WaitGroup, jobs <-chan fileJob, results chan<- models.FileUploadResult, targetPath string, tracker *BatchTracker) {
 	defer wg.Done()
 	
 	for job := range jobs {
-		result := s.processIndividualFile(job.file, targetPath, job.index)
+		result := s.processTrackedFile(job.file, targetPath, job.index, tracker)
 		results <- result
 	}
 }
 
+// processTrackedFile uploads a single file unless the batch was cancelled, reporting the outcome to tracker
+func (s *MultipleUploadService) processTrackedFile(file *multipart.FileHeader, targetPath string, index int, tracker *BatchTracker) models.FileUploadResult {
+	if tracker.Cancelled() {
+		return CancelledFileResult(file, targetPath, index)
+	}
+
+	tracker.StartFile(file.Filename)
+	result := s.processIndividualFile(file, targetPath, index)
+	tracker.FileDone(result)
+	return result
+}
+
+// CancelledFileResult builds the result reported for a file skipped because its batch was cancelled
+func CancelledFileResult(file *multipart.FileHeader, targetPath string, index int) models.FileUploadResult {
+	return models.FileUploadResult{
+		Filename:     file.Filename,
+		OriginalName: file.Filename,
+		Size:         file.Size,
+		Path:         targetPath,
+		Success:      false,
+		Error:        "Batch cancelled",
+		Index:        index,
+	}
+}
+
 // processIndividualFile processes a single file upload
 func (s *MultipleUploadService) processIndividualFile(file *multipart.FileHeader, targetPath string, index int) models.FileUploadResult {
 	result := models.FileUploadResult{
@@ -252,9 +338,10 @@ func (s *MultipleUploadService) processIndividualFile(file *multipart.FileHeader
 	defer f.Close()
 
 	// Determine upload method based on file size
+	var saved *models.FileInfo
 	if file.Size > s.cfg.Server.Upload.StreamingThreshold {
 		// Use streaming for large files
-		err = s.fileService.SaveFileStream(file.Filename, targetPath, f, file.Size)
+		saved, err = s.fileService.SaveFileStreamWithChecksum(file.Filename, targetPath, f, file.Size, "")
 	} else {
 		// Use traditional upload for small files
 		data := make([]byte, file.Size)
@@ -264,7 +351,7 @@ func (s *MultipleUploadService) processIndividualFile(file *multipart.FileHeader
 			return result
 		}
 		
-		err = s.fileService.SaveFile(file.Filename, targetPath, data)
+		saved, err = s.fileService.SaveFileWithChecksum(file.Filename, targetPath, data, "")
 	}
 
 	if err != nil {
@@ -274,6 +361,7 @@ func (s *MultipleUploadService) processIndividualFile(file *multipart.FileHeader
 
 	// Success
 	result.Success = true
+	result.Checksum = saved.Checksum
 	result.MimeType = s.fileService.detectMimeType(file.Filename)
 	return result
 }
@@ -297,7 +385,23 @@ func (s *MultipleUploadService) processFileWithTransaction(file *multipart.FileH
 	}
 
 	fullPath := s.fileService.buildPath(validatedPath, file.Filename)
-	
+
+	if err := s.fileService.authorize(models.PermissionWrite, validatedPath); err != nil {
+		result.Error = fmt.Sprintf("Upload failed: %v", err)
+		return result
+	}
+
+	// Overwriting keeps the previous content as a version, which the rollback makes the
+	// content of the file again
+	existing, err := s.fileService.repo.GetFileByPath(fullPath)
+	if err != nil {
+		existing = nil
+	} else if existing.IsDirectory {
+		result.Error = fmt.Sprintf("Upload failed: %v", ErrPathIsDirectory)
+		return result
+	}
+
+
 	// Open file
 	f, err := file.Open()
 	if err != nil {
@@ -314,36 +418,73 @@ func (s *MultipleUploadService) processFileWithTransaction(file *multipart.FileH
 		return result
 	}
 
+	// The data is already in memory, so the checksum is known before anything is written
+	result.Checksum = ChecksumBytes(data)
+
+	// Overwritten files live in the blob store, as overwriteFile stores them
+	var blobRef string
+	if s.fileService.deduplicate || existing != nil {
+		blobRef = result.Checksum
+	}
+
 	// Add file operation to transaction
 	fileOperation := transaction.NewFileOperation(
 		fmt.Sprintf("Upload file %s", file.Filename),
 		func() error {
-			return s.fileService.storage.SaveFile(fullPath, data)
+			if blobRef != "" {
+				return s.fileService.commitBlob(bytes.NewReader(data), blobRef)
+			}
+			_, err := s.fileService.storage.SaveFileWithChecksum(fullPath, data, result.Checksum)
+			return err
 		},
 		func() error {
-			// Rollback: delete the file
+			// Rollback: delete the file. Blobs are shared, so they are left to garbage collection.
+			if blobRef != "" {
+				return nil
+			}
 			return s.fileService.storage.DeleteFile(fullPath)
 		},
 	)
 	tm.AddOperation(fileOperation)
 
+	fileInfo := &models.FileInfo{
+		Name:        file.Filename,
+		Path:        fullPath,
+		Size:        file.Size,
+		MimeType:    s.fileService.detectMimeType(file.Filename),
+		IsDirectory: false,
+		ParentPath:  validatedPath,
+		Checksum:    result.Checksum,
+		BlobRef:     blobRef,
+		OwnerID:     s.fileService.owner,
+	}
+	if existing != nil {
+		tm.AddOperation(s.replaceOperation(existing, fileInfo))
+		*uploadedFiles = append(*uploadedFiles, fullPath)
+		result.Success = true
+		result.Replaced = true
+		result.MimeType = fileInfo.MimeType
+		return result
+	}
+
 	// Add database operation to transaction
 	dbOperation := transaction.NewDatabaseOperation(
 		fmt.Sprintf("Insert file record %s", file.Filename),
 		func() error {
-			fileInfo := &models.FileInfo{
-				Name:        file.Filename,
-				Path:        fullPath,
-				Size:        file.Size,
-				MimeType:    s.fileService.detectMimeType(file.Filename),
-				IsDirectory: false,
-				ParentPath:  validatedPath,
-			}
-			return s.fileService.repo.InsertFile(fileInfo)
+			err := s.fileService.repo.InsertFile(fileInfo)
+			s.fileService.recordAudit(models.AuditUpload, fullPath, "", file.Size, err)
+			return err
 		},
 		func() error {
 			// Rollback: delete from database
-			return s.fileService.repo.DeleteFile(fullPath)
+			err := s.fileService.repo.DeleteFile(fullPath)
+			s.fileService.recordAuditEntry(&models.AuditEntry{
+				Action:  models.AuditDelete,
+				Path:    fullPath,
+				Size:    file.Size,
+				Details: "batch rolled back",
+			}, err)
+			return err
 		},
 	)
 	tm.AddOperation(dbOperation)
@@ -357,15 +498,84 @@ func (s *MultipleUploadService) processFileWithTransaction(file *multipart.FileH
 	return result
 }
 
-// GetUploadProgress returns progress for batch uploads (placeholder for future implementation)
+// replaceOperation records file as the new content of existing, keeping the previous
+// content as a version. Its rollback makes the previous content the content of the file again.
+func (s *MultipleUploadService) replaceOperation(existing, file *models.FileInfo) transaction.Operation {
+	var version *models.FileVersion
+	return transaction.NewDatabaseOperation(
+		fmt.Sprintf("Replace file record %s", file.Name),
+		func() error {
+			var err error
+			version, err = s.fileService.recordReplacement(existing, file)
+			s.fileService.recordAudit(models.AuditUpload, file.Path, "", file.Size, err)
+			return err
+		},
+		func() error {
+			err := s.fileService.repo.RevertReplace(existing, file, version)
+			s.fileService.recordAuditEntry(&models.AuditEntry{
+				Action:  models.AuditRestoreVersion,
+				Path:    file.Path,
+				Size:    existing.Size,
+				Details: "batch rolled back",
+			}, err)
+			return err
+		},
+	)
+}
+
+// RegisterBatch starts progress tracking for a batch upload of the given files, owned by
+// the owner of the file service of the view
+func (s *MultipleUploadService) RegisterBatch(batchID string, files []*multipart.FileHeader) (*BatchTracker, error) {
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+	}
+	return s.batches.Register(batchID, s.fileService.Owner(), len(files), totalSize)
+}
+
+// BatchOwner returns the user who uploads a running or recently finished batch
+func (s *MultipleUploadService) BatchOwner(batchID string) (int64, error) {
+	return s.batches.Owner(batchID)
+}
+
+// GetUploadProgress returns progress for a running or recently finished batch upload
 func (s *MultipleUploadService) GetUploadProgress(batchID string) (*models.BatchUploadProgress, error) {
-	// This would be implemented with a progress tracking system
-	// using Redis, in-memory cache, or database
-	return nil, fmt.Errorf("progress tracking not implemented yet")
+	return s.batches.Get(batchID)
 }
 
-// CancelBatchUpload cancels an ongoing batch upload (placeholder for future implementation)
+// CancelBatchUpload requests cancellation of a running batch upload
 func (s *MultipleUploadService) CancelBatchUpload(batchID string) error {
-	// This would be implemented with a cancellation system
-	return fmt.Errorf("batch cancellation not implemented yet")
-}
\ No newline at end of file
+	return s.batches.Cancel(batchID)
+}
+
+// RollbackUploadedFiles deletes the successfully stored files in results and marks them
+// as failed. It returns the number of files removed.
+func (s *MultipleUploadService) RollbackUploadedFiles(results []models.FileUploadResult) int {
+	rolledBack := 0
+	for i := range results {
+		if !results[i].Success {
+			continue
+		}
+
+		parentPath, err := s.fileService.pathValidator.ValidateAndNormalizePath(results[i].Path)
+		if err != nil {
+			continue
+		}
+
+		filePath := s.fileService.buildPath(parentPath, results[i].Filename)
+		if results[i].Replaced {
+			err = s.fileService.revertReplacement(filePath)
+		} else {
+			err = s.fileService.DeleteFilePermanently(filePath, false)
+		}
+		if err != nil {
+			results[i].Error = fmt.Sprintf("Rollback failed: %v", err)
+			continue
+		}
+
+		results[i].Success = false
+		results[i].Error = "Rolled back after batch cancellation"
+		rolledBack++
+	}
+	return rolledBack
+}
@@ -110,17 +110,6 @@ func (v *MultipleUploadValidator) ValidateMultipleUpload(files []*multipart.File
 	return result
 }
 
-// ValidateUploadRate checks if upload rate limits are respected
-func (v *MultipleUploadValidator) ValidateUploadRate(clientIP string, fileCount int) error {
-	// In a real implementation, this would check against a rate limiter
-	// For now, we'll do a simple check against the configured limit
-	if fileCount > v.cfg.Server.Upload.RateLimitPerMinute {
-		return fmt.Errorf("rate limit exceeded: %d files exceeds limit of %d per minute", 
-			fileCount, v.cfg.Server.Upload.RateLimitPerMinute)
-	}
-	return nil
-}
-
 // isDangerousFile checks if a file has a dangerous extension or pattern
 func (v *MultipleUploadValidator) isDangerousFile(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/tracing"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrInvalidQuota  = errors.New("quotas need a user or directory subject and limits that are not negative")
+	ErrQuotaNotFound = errors.New("quota not found")
+)
+
+// QuotaService manages user and directory quotas and checks new files against them.
+//
+// A user quota limits the files a user owns wherever they are stored. A directory quota
+// limits the files stored below a directory, whoever owns them. Every quota that applies
+// has to allow a new file.
+type QuotaService struct {
+	quotas *repository.QuotaRepository
+}
+
+func NewQuotaService(quotas *repository.QuotaRepository) *QuotaService {
+	return &QuotaService{quotas: quotas}
+}
+
+// SetQuota creates or replaces the quota of a user or directory. Directory paths are
+// expected to be validated storage paths.
+func (q *QuotaService) SetQuota(req *models.SetQuotaRequest) (*models.Quota, error) {
+	if req.MaxBytes < 0 || req.MaxFiles < 0 {
+		return nil, ErrInvalidQuota
+	}
+
+	quota := &models.Quota{
+		SubjectType: req.SubjectType,
+		MaxBytes:    req.MaxBytes,
+		MaxFiles:    req.MaxFiles,
+	}
+	switch req.SubjectType {
+	case models.QuotaSubjectUser:
+		exists, err := q.quotas.UserExists(req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrUserNotFound
+		}
+		quota.UserID = req.UserID
+	case models.QuotaSubjectDirectory:
+		if req.Path == "" {
+			return nil, ErrInvalidQuota
+		}
+		quota.Path = req.Path
+	default:
+		return nil, ErrInvalidQuota
+	}
+
+	if err := q.quotas.SetQuota(quota); err != nil {
+		return nil, fmt.Errorf("failed to save quota: %w", err)
+	}
+	return withRemaining(quota), nil
+}
+
+func (q *QuotaService) ListQuotas() ([]*models.Quota, error) {
+	quotas, err := q.quotas.ListQuotas()
+	if err != nil {
+		return nil, err
+	}
+	for _, quota := range quotas {
+		withRemaining(quota)
+	}
+	return quotas, nil
+}
+
+func (q *QuotaService) GetQuota(id int64) (*models.Quota, error) {
+	quota, err := q.quotas.GetQuota(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuotaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return withRemaining(quota), nil
+}
+
+func (q *QuotaService) DeleteQuota(id int64) error {
+	if err := q.quotas.DeleteQuota(id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrQuotaNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// QuotasFor returns the quota of a user and the directory quotas that limit what can be
+// stored in dirPath
+func (q *QuotaService) QuotasFor(dirPath string, userID int64) ([]*models.Quota, error) {
+	quotas, err := q.quotas.QuotasFor(dirPath, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quotas: %w", err)
+	}
+	for _, quota := range quotas {
+		withRemaining(quota)
+	}
+	return quotas, nil
+}
+
+// Check returns ErrQuotaExceeded unless bytes and files more can be stored in dirPath on
+// behalf of the user
+func (q *QuotaService) Check(dirPath string, userID, bytes, files int64) error {
+	quotas, err := q.QuotasFor(dirPath, userID)
+	if err != nil {
+		return err
+	}
+	return checkQuotas(quotas, nil, bytes, files)
+}
+
+// CheckMove returns ErrQuotaExceeded unless the directory quotas of destinationPath leave
+// room for the files moved from sourcePath. Quotas above both paths are not affected.
+func (q *QuotaService) CheckMove(sourcePath, destinationPath string, bytes, files int64) error {
+	destination, err := q.QuotasFor(destinationPath, 0)
+	if err != nil {
+		return err
+	}
+	source, err := q.QuotasFor(path.Dir(sourcePath), 0)
+	if err != nil {
+		return err
+	}
+
+	unaffected := make(map[int64]bool, len(source))
+	for _, quota := range source {
+		unaffected[quota.ID] = true
+	}
+	return checkQuotas(destination, unaffected, bytes, files)
+}
+
+// UserUsage returns the size and number of the files a user owns
+func (q *QuotaService) UserUsage(userID int64) (int64, int64, error) {
+	return q.quotas.GetUserUsage(userID)
+}
+
+func checkQuotas(quotas []*models.Quota, skip map[int64]bool, bytes, files int64) error {
+	for _, quota := range quotas {
+		if skip[quota.ID] {
+			continue
+		}
+		if quota.MaxBytes > 0 && quota.UsedBytes+bytes > quota.MaxBytes {
+			return fmt.Errorf("%w: %d of %d bytes left", ErrQuotaExceeded, *quota.RemainingBytes, quota.MaxBytes)
+		}
+		if quota.MaxFiles > 0 && quota.UsedFiles+files > quota.MaxFiles {
+			return fmt.Errorf("%w: %d of %d files left", ErrQuotaExceeded, *quota.RemainingFiles, quota.MaxFiles)
+		}
+	}
+	return nil
+}
+
+// withRemaining fills in what is left of the limits a quota sets
+func withRemaining(quota *models.Quota) *models.Quota {
+	if quota.MaxBytes > 0 {
+		remaining := max(quota.MaxBytes-quota.UsedBytes, 0)
+		quota.RemainingBytes = &remaining
+	}
+	if quota.MaxFiles > 0 {
+		remaining := max(quota.MaxFiles-quota.UsedFiles, 0)
+		quota.RemainingFiles = &remaining
+	}
+	return quota
+}
+
+// SetQuotas makes the service track and enforce quotas
+func (s *FileService) SetQuotas(quotas *QuotaService) {
+	s.quotas = quotas
+}
+
+// Quotas returns the service managing quotas, or nil when none is configured
+func (s *FileService) Quotas() *QuotaService {
+	return s.quotas
+}
+
+// OwnedBy returns a view without ACL checks or home directory that attributes the files it
+// saves to ownerID. Uploads that finish in the background use it with resolved paths.
+func (s *FileService) OwnedBy(ownerID int64) *FileService {
+	view := *s.unrestricted()
+	view.owner = ownerID
+	return &view
+}
+
+// Owner returns the user the files saved through the view are attributed to, 0 for none
+func (s *FileService) Owner() int64 {
+	return s.owner
+}
+
+// CheckQuota returns ErrQuotaExceeded unless bytes and files more can be stored in
+// dirPath by the owner of the view. Uploads assembled in the background use it before
+// accepting data.
+func (s *FileService) CheckQuota(dirPath string, bytes, files int64) error {
+	if s.quotas == nil {
+		return nil
+	}
+
+	validated, err := s.pathValidator.ValidateAndNormalizePath(dirPath)
+	if err != nil {
+		return err
+	}
+	return s.quotas.Check(validated, s.owner, bytes, files)
+}
+
+// checkQuota is CheckQuota for a validated storage path
+func (s *FileService) checkQuota(dirPath string, bytes, files int64) error {
+	if s.quotas == nil {
+		return nil
+	}
+
+	_, span := tracing.Start(s.context(), "FileService.CheckQuota", tracing.String("file.path", dirPath))
+	defer span.End()
+
+	err := s.quotas.Check(dirPath, s.owner, bytes, files)
+	span.RecordError(err)
+	return err
+}
+
+// checkMoveQuota checks the directory quotas of destinationPath against the files below sourcePath
+func (s *FileService) checkMoveQuota(sourcePath, destinationPath string) error {
+	if s.quotas == nil {
+		return nil
+	}
+
+	size, count, err := s.repo.GetUsageUnder(sourcePath)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return s.quotas.CheckMove(sourcePath, destinationPath, size, count)
+}
+
+// SetQuota sets the quota of a user or of the root or an existing directory
+func (s *FileService) SetQuota(req *models.SetQuotaRequest) (*models.Quota, error) {
+	quota, err := s.setQuota(req)
+	entry := &models.AuditEntry{Action: models.AuditSetQuota}
+	if req.SubjectType == models.QuotaSubjectDirectory {
+		entry.Path = s.auditPath(req.Path)
+	}
+	if quota != nil {
+		entry.Details = quotaAuditDetails(quota)
+	}
+	s.recordAuditEntry(entry, err)
+	return quota, err
+}
+
+func (s *FileService) setQuota(req *models.SetQuotaRequest) (*models.Quota, error) {
+	if s.quotas == nil {
+		return nil, ErrInvalidQuota
+	}
+
+	normalized := *req
+	if req.SubjectType == models.QuotaSubjectDirectory {
+		dirPath, err := s.pathValidator.ValidateAndNormalizePath(req.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuota, err)
+		}
+		if dirPath != "/" {
+			info, err := s.repo.GetFileByPath(dirPath)
+			if err != nil {
+				return nil, ErrFileNotFound
+			}
+			if !info.IsDirectory {
+				return nil, ErrInvalidQuota
+			}
+		}
+		normalized.Path = dirPath
+	} else {
+		normalized.Path = ""
+	}
+
+	quota, err := s.quotas.SetQuota(&normalized)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientQuota(quota), nil
+}
+
+// DeleteQuota removes a quota
+func (s *FileService) DeleteQuota(id int64) error {
+	if s.quotas == nil {
+		return ErrQuotaNotFound
+	}
+
+	entry := &models.AuditEntry{Action: models.AuditDeleteQuota, Details: fmt.Sprintf("quota %d", id)}
+	if quota, err := s.quotas.GetQuota(id); err == nil {
+		entry.Path = quota.Path
+		entry.Details = quotaAuditDetails(quota)
+	}
+
+	err := s.quotas.DeleteQuota(id)
+	s.recordAuditEntry(entry, err)
+	return err
+}
+
+// GetQuotaUsage returns the storage used by the owner of the view and the quotas that limit
+// what it can store in dirPath
+func (s *FileService) GetQuotaUsage(dirPath string) (*models.QuotaUsage, error) {
+	validated, err := s.pathValidator.ValidateAndNormalizePath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.QuotaUsage{Quotas: []*models.Quota{}}
+	if s.quotas == nil {
+		return usage, nil
+	}
+
+	if s.owner != 0 {
+		usage.UsedBytes, usage.UsedFiles, err = s.quotas.UserUsage(s.owner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usage.Quotas, err = s.applicableQuotas(validated)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// applicableQuotas returns the quotas that limit new files in dirPath as seen by the
+// client of the view, leaving out directory quotas set above its home directory
+func (s *FileService) applicableQuotas(dirPath string) ([]*models.Quota, error) {
+	if s.quotas == nil {
+		return nil, nil
+	}
+
+	quotas, err := s.quotas.QuotasFor(dirPath, s.owner)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []*models.Quota{}
+	for _, quota := range quotas {
+		if quota.SubjectType == models.QuotaSubjectDirectory {
+			if _, inside := s.pathValidator.ToVirtual(quota.Path); !inside {
+				continue
+			}
+		}
+		visible = append(visible, s.clientQuota(quota))
+	}
+	return visible, nil
+}
+
+func (s *FileService) clientQuota(quota *models.Quota) *models.Quota {
+	if quota.Path == "" || s.pathValidator.Root() == "/" {
+		return quota
+	}
+
+	mapped := *quota
+	mapped.Path = s.clientPath(quota.Path)
+	return &mapped
+}
+
+func quotaAuditDetails(quota *models.Quota) string {
+	subject := quota.SubjectType
+	if quota.SubjectType == models.QuotaSubjectUser {
+		subject = fmt.Sprintf("user %d", quota.UserID)
+	}
+	return fmt.Sprintf("%s: %d bytes, %d files", subject, quota.MaxBytes, quota.MaxFiles)
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func setQuota(t *testing.T, fs *FileService, req models.SetQuotaRequest) *models.Quota {
+	t.Helper()
+	quota, err := fs.SetQuota(&req)
+	if err != nil {
+		t.Fatalf("Failed to set quota: %v", err)
+	}
+	return quota
+}
+
+func TestQuota_UserLimitRejectsUploads(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	setQuota(t, fs, models.SetQuotaRequest{SubjectType: models.QuotaSubjectUser, UserID: users["alice"].ID, MaxBytes: 10})
+
+	alice := fs.ForUser(users["alice"])
+	if err := alice.SaveFile("a.txt", "/", []byte("123456")); err != nil {
+		t.Fatalf("Failed to save file within quota: %v", err)
+	}
+
+	err := alice.SaveFileStream("b.txt", "/", bytes.NewReader([]byte("123456")), 6)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := fs.storage.GetFileInfo("/b.txt"); err == nil {
+		t.Error("Expected the rejected upload to never reach storage")
+	}
+
+	// Other users are not limited by the quota of alice
+	if err := fs.ForUser(users["bob"]).SaveFile("b.txt", "/", []byte("123456")); err != nil {
+		t.Errorf("Expected bob to upload, got %v", err)
+	}
+
+	if err := alice.DeleteFile("/a.txt"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	usage, err := alice.GetQuotaUsage("/")
+	if err != nil {
+		t.Fatalf("Failed to load usage: %v", err)
+	}
+	if usage.UsedBytes != 0 || len(usage.Quotas) != 1 || usage.Quotas[0].UsedBytes != 0 {
+		t.Fatalf("Expected deleting to release the usage, got %+v", usage)
+	}
+	if remaining := usage.Quotas[0].RemainingBytes; remaining == nil || *remaining != 10 {
+		t.Errorf("Expected 10 bytes remaining, got %v", remaining)
+	}
+}
+
+func TestQuota_DirectoryUsageFollowsMovesAndDeletes(t *testing.T) {
+	fs, _, _ := setupAccessControl(t)
+
+	for _, dir := range [][2]string{{"team", "/"}, {"drafts", "/team"}, {"incoming", "/"}} {
+		if _, err := fs.CreateDirectory(dir[0], dir[1]); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := fs.SaveFile("existing.txt", "/team/drafts", []byte("x")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	// Usage of files stored before the quota was set is counted
+	quota := setQuota(t, fs, models.SetQuotaRequest{SubjectType: models.QuotaSubjectDirectory, Path: "/team", MaxFiles: 2})
+	if quota.UsedFiles != 1 {
+		t.Fatalf("Expected the existing file to be counted, got %d", quota.UsedFiles)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := fs.SaveFile(name, "/incoming", []byte("data")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+	if err := fs.MoveFile("/incoming", "/team"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected moving two files into a directory with room for one to fail, got %v", err)
+	}
+	if err := fs.MoveFile("/incoming/a.txt", "/team/drafts"); err != nil {
+		t.Fatalf("Failed to move file: %v", err)
+	}
+
+	// Moving within the quota directory and renaming it leave the usage unchanged
+	if err := fs.MoveFile("/team/drafts/a.txt", "/team"); err != nil {
+		t.Fatalf("Failed to move file: %v", err)
+	}
+	if err := fs.RenameFile("/team", "crew"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+
+	listing, err := fs.GetDirectoryListing("/crew")
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(listing.Quotas) != 1 || listing.Quotas[0].Path != "/crew" {
+		t.Fatalf("Expected the quota to follow the directory, got %+v", listing.Quotas)
+	}
+	if got := listing.Quotas[0]; got.UsedFiles != 2 || got.UsedBytes != 5 || *got.RemainingFiles != 0 {
+		t.Errorf("Expected 2 files and 5 bytes used with none left, got %+v", got)
+	}
+
+	if err := fs.DeleteFile("/crew/drafts", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+	listing, _ = fs.GetDirectoryListing("/crew")
+	if got := listing.Quotas[0]; got.UsedFiles != 1 || got.UsedBytes != 4 {
+		t.Errorf("Expected the deleted subtree to be released, got %+v", got)
+	}
+}
+
+func TestQuota_HomeDirectoryUsers(t *testing.T) {
+	fs, auth := setupHomeDirectories(t)
+	alice, _ := auth.users.GetUserByUsername("alice")
+	view := fs.ForUser(alice)
+
+	setQuota(t, fs, models.SetQuotaRequest{SubjectType: models.QuotaSubjectDirectory, Path: "/home", MaxBytes: 100})
+	setQuota(t, fs, models.SetQuotaRequest{SubjectType: models.QuotaSubjectUser, UserID: alice.ID, MaxFiles: 1})
+	if err := view.SaveFile("one.txt", "/", []byte("1")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := view.CheckQuota("/", 1, 1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the file limit to be reached, got %v", err)
+	}
+
+	// Quotas set above the home directory are enforced but not listed
+	usage, err := view.GetQuotaUsage("/")
+	if err != nil {
+		t.Fatalf("Failed to load usage: %v", err)
+	}
+	if usage.UsedFiles != 1 || len(usage.Quotas) != 1 || usage.Quotas[0].SubjectType != models.QuotaSubjectUser {
+		t.Errorf("Expected only the user quota, got %+v", usage)
+	}
+}
+
+func TestQuota_Validation(t *testing.T) {
+	fs, _, _ := setupAccessControl(t)
+
+	invalid := []models.SetQuotaRequest{
+		{SubjectType: "group", UserID: 1, MaxBytes: 1},
+		{SubjectType: models.QuotaSubjectUser, UserID: 1, MaxBytes: -1},
+	}
+	for _, req := range invalid {
+		if _, err := fs.SetQuota(&req); !errors.Is(err, ErrInvalidQuota) {
+			t.Errorf("Expected ErrInvalidQuota for %+v, got %v", req, err)
+		}
+	}
+	if _, err := fs.SetQuota(&models.SetQuotaRequest{SubjectType: models.QuotaSubjectUser, UserID: 999}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := fs.SetQuota(&models.SetQuotaRequest{SubjectType: models.QuotaSubjectDirectory, Path: "/missing"}); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
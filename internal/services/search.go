@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+
+	// searchBatchSize is how many matches are read at once while skipping those the user cannot read
+	searchBatchSize = 200
+)
+
+// Search returns a page of the files and directories below filter.Scope whose name or
+// path matches the query, best matches first, each with its tags and the breadcrumbs of
+// the directory holding it. The query may be empty when tags are given. Entries the user
+// of the view cannot read are left out before paging.
+func (s *FileService) Search(filter *models.SearchFilter, limit, offset int) (*models.SearchResults, error) {
+	tags, err := normalizeTags(filter.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+	if (strings.TrimSpace(filter.Query) == "" && len(tags) == 0) || limit < 0 || offset < 0 {
+		return nil, ErrInvalidSearch
+	}
+	if (filter.MinSize != nil && *filter.MinSize < 0) || (filter.MaxSize != nil && *filter.MaxSize < 0) {
+		return nil, ErrInvalidSearch
+	}
+	if filter.MinSize != nil && filter.MaxSize != nil && *filter.MaxSize < *filter.MinSize {
+		return nil, ErrInvalidSearch
+	}
+	if !filter.ModifiedAfter.IsZero() && !filter.ModifiedBefore.IsZero() && filter.ModifiedBefore.Before(filter.ModifiedAfter) {
+		return nil, ErrInvalidSearch
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	normalized := *filter
+	normalized.Tags = tags
+	if normalized.Scope == "" {
+		normalized.Scope = "/"
+	}
+	scope, err := s.pathValidator.ValidateAndNormalizePath(normalized.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+	normalized.Scope = scope
+
+	readable, err := s.readableFilter(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &models.SearchResults{
+		Query:   filter.Query,
+		Results: []*models.SearchResult{},
+		Limit:   limit,
+		Offset:  offset,
+	}
+
+	// When every match is readable the page can be read directly, otherwise matches are
+	// read from the start and the readable ones counted until the page is full
+	batchOffset, skipped := 0, 0
+	if s.readsEverything() {
+		batchOffset, skipped = offset, offset
+	}
+	for {
+		files, err := s.repo.SearchFiles(&normalized, searchBatchSize, batchOffset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search: %w", err)
+		}
+
+		for _, file := range files {
+			if !readable(file) {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if len(results.Results) == limit {
+				results.HasMore = true
+				return results, s.attachResultTags(results)
+			}
+			results.Results = append(results.Results, &models.SearchResult{
+				FileInfo:    s.clientFile(file),
+				Breadcrumbs: s.generateBreadcrumbs(s.clientPath(file.ParentPath)),
+			})
+		}
+
+		if len(files) < searchBatchSize {
+			return results, s.attachResultTags(results)
+		}
+		batchOffset += len(files)
+	}
+}
+
+func (s *FileService) attachResultTags(results *models.SearchResults) error {
+	files := make([]*models.FileInfo, len(results.Results))
+	for i, result := range results.Results {
+		files[i] = result.FileInfo
+	}
+	return s.attachTags(files)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func searchPaths(t *testing.T, fs *FileService, filter *models.SearchFilter) []string {
+	t.Helper()
+	results, err := fs.Search(filter, 0, 0)
+	if err != nil {
+		t.Fatalf("Search for %q failed: %v", filter.Query, err)
+	}
+	paths := make([]string, len(results.Results))
+	for i, result := range results.Results {
+		paths[i] = result.Path
+	}
+	return paths
+}
+
+func TestSearch_MatchesNamesAndPaths(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	if _, err := fs.CreateDirectory("reports", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := fs.CreateDirectory("2024", "/reports"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	files := map[string]string{
+		"/reports/2024": "quarterly-report.pdf",
+		"/reports":      "summary.txt",
+		"/":             "photo.jpg",
+	}
+	for dir, name := range files {
+		if err := fs.SaveFile(name, dir, []byte("content of "+name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	paths := searchPaths(t, fs, &models.SearchFilter{Query: "quarter"})
+	if len(paths) != 1 || paths[0] != "/reports/2024/quarterly-report.pdf" {
+		t.Errorf("Expected the quarterly report, got %v", paths)
+	}
+
+	// Files below a matching directory match too, after those matching by name
+	paths = searchPaths(t, fs, &models.SearchFilter{Query: "report"})
+	if len(paths) != 4 || paths[0] == "/reports/summary.txt" {
+		t.Errorf("Expected the name matches first among 4 results, got %v", paths)
+	}
+
+	results, err := fs.Search(&models.SearchFilter{Query: "summ"}, 0, 0)
+	if err != nil || len(results.Results) != 1 {
+		t.Fatalf("Expected one result, got %+v, %v", results, err)
+	}
+	crumbs := results.Results[0].Breadcrumbs
+	if len(crumbs) != 2 || crumbs[1].Path != "/reports" {
+		t.Errorf("Expected breadcrumbs to the parent directory, got %+v", crumbs)
+	}
+
+	// Renames are searchable right away
+	if err := fs.RenameFile("/photo.jpg", "holiday.jpg"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "photo"}); len(paths) != 0 {
+		t.Errorf("Expected the old name to be gone, got %v", paths)
+	}
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "holi"}); len(paths) != 1 {
+		t.Errorf("Expected the new name to be found, got %v", paths)
+	}
+
+	if _, err := fs.Search(&models.SearchFilter{Query: "  "}, 0, 0); !errors.Is(err, ErrInvalidSearch) {
+		t.Errorf("Expected ErrInvalidSearch for an empty query, got %v", err)
+	}
+}
+
+func TestSearch_Filters(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	if _, err := fs.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for dir, name := range map[string]string{"/docs": "notes.txt", "/": "notes.png"} {
+		if err := fs.SaveFile(name, dir, []byte(name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+	if err := fs.SaveFile("notes-long.txt", "/", make([]byte, 1024)); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "notes", Scope: "/docs"}); len(paths) != 1 || paths[0] != "/docs/notes.txt" {
+		t.Errorf("Expected only the file below /docs, got %v", paths)
+	}
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "notes", MimeType: "image/"}); len(paths) != 1 || paths[0] != "/notes.png" {
+		t.Errorf("Expected only the image, got %v", paths)
+	}
+	minSize, maxSize := int64(100), int64(2048)
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "notes", MinSize: &minSize, MaxSize: &maxSize}); len(paths) != 1 || paths[0] != "/notes-long.txt" {
+		t.Errorf("Expected only the large file, got %v", paths)
+	}
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "notes", ModifiedAfter: time.Now().Add(time.Hour)}); len(paths) != 0 {
+		t.Errorf("Expected nothing modified in the future, got %v", paths)
+	}
+	if paths := searchPaths(t, fs, &models.SearchFilter{Query: "notes", ModifiedAfter: time.Now().Add(-time.Hour)}); len(paths) != 3 {
+		t.Errorf("Expected every file modified in the last hour, got %v", paths)
+	}
+
+	if _, err := fs.Search(&models.SearchFilter{Query: "notes", MinSize: &maxSize, MaxSize: &minSize}, 0, 0); !errors.Is(err, ErrInvalidSearch) {
+		t.Errorf("Expected ErrInvalidSearch for an empty size range, got %v", err)
+	}
+}
+
+func TestSearch_SkipsUnreadableEntriesBeforePaging(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	admin := fs.ForUser(users["admin"])
+	alice := fs.ForUser(users["alice"])
+
+	for _, dir := range []string{"private", "team"} {
+		if _, err := admin.CreateDirectory(dir, "/"); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		for _, name := range []string{"plan-a.txt", "plan-b.txt", "plan-c.txt"} {
+			if err := admin.SaveFile(name, "/"+dir, []byte(name)); err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+		}
+	}
+	grant(t, admin, "/private", models.SubjectUser, users["bob"].ID, models.PermissionRead)
+
+	page, err := alice.Search(&models.SearchFilter{Query: "plan"}, 2, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(page.Results) != 2 || !page.HasMore {
+		t.Fatalf("Expected a full first page, got %+v", page)
+	}
+	page, err = alice.Search(&models.SearchFilter{Query: "plan"}, 2, 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(page.Results) != 1 || page.HasMore || page.Results[0].Path != "/team/plan-c.txt" {
+		t.Errorf("Expected the last readable file, got %+v", page)
+	}
+
+	if paths := searchPaths(t, admin, &models.SearchFilter{Query: "plan"}); len(paths) != 6 {
+		t.Errorf("Expected the admin to find every file, got %v", paths)
+	}
+}
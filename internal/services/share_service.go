@@ -0,0 +1,262 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/security"
+)
+
+// Share tokens are shown abbreviated to this many characters in listings
+const shareTokenPrefixLength = 8
+
+var (
+	ErrShareNotFound         = errors.New("share not found")
+	ErrInvalidShare          = errors.New("shares need an existing path other than the root, a read or upload mode and limits that are not negative")
+	ErrShareExpired          = errors.New("share link has expired or reached its download limit")
+	ErrSharePasswordRequired = errors.New("share link requires a valid password")
+)
+
+// ShareService manages public links to files and directories. Links are used without
+// an account by anyone who knows their token, optionally with a password.
+type ShareService struct {
+	shares *repository.ShareRepository
+}
+
+func NewShareService(shares *repository.ShareRepository) *ShareService {
+	return &ShareService{shares: shares}
+}
+
+// Open returns the share a token belongs to, unless it has expired, reached its download
+// limit or is protected by a password other than password
+func (s *ShareService) Open(token, password string) (*models.Share, error) {
+	share, err := s.shares.GetShareByToken(hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if share.ExpiresAt != nil && !time.Now().UTC().Before(*share.ExpiresAt) {
+		return nil, ErrShareExpired
+	}
+	if share.MaxDownloads > 0 && share.DownloadCount >= share.MaxDownloads {
+		return nil, ErrShareExpired
+	}
+
+	if share.PasswordHash != "" {
+		if password == "" {
+			return nil, ErrSharePasswordRequired
+		}
+		valid, err := security.VerifyPassword(password, share.PasswordHash)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return nil, ErrSharePasswordRequired
+		}
+	}
+	return share, nil
+}
+
+// RecordDownload counts a download of share, returning ErrShareExpired once its limit is reached
+func (s *ShareService) RecordDownload(share *models.Share) error {
+	counted, err := s.shares.RecordDownload(share.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record download: %w", err)
+	}
+	if !counted {
+		return ErrShareExpired
+	}
+	share.DownloadCount++
+	return nil
+}
+
+// SetShares enables share links for the service
+func (s *FileService) SetShares(shares *ShareService) {
+	s.shares = shares
+}
+
+// Shares returns the service managing share links, or nil when none is configured
+func (s *FileService) Shares() *ShareService {
+	return s.shares
+}
+
+// CreateShare creates a link to a file or directory. It needs the share permission on the
+// path, and the write permission too for links that accept uploads. The returned token is
+// shown once and cannot be recovered.
+func (s *FileService) CreateShare(req *models.CreateShareRequest) (string, *models.Share, error) {
+	token, share, err := s.createShare(req)
+	entry := &models.AuditEntry{Action: models.AuditCreateShare, Path: s.auditPath(req.Path)}
+	if share != nil {
+		entry.Details = shareAuditDetails(share)
+	}
+	s.recordAuditEntry(entry, err)
+	return token, share, err
+}
+
+func (s *FileService) createShare(req *models.CreateShareRequest) (string, *models.Share, error) {
+	if s.shares == nil {
+		return "", nil, ErrInvalidShare
+	}
+	if req.MaxDownloads < 0 || req.ExpiresInHours < 0 {
+		return "", nil, ErrInvalidShare
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = models.ShareModeRead
+	}
+	if mode != models.ShareModeRead && mode != models.ShareModeUpload {
+		return "", nil, ErrInvalidShare
+	}
+
+	sharedPath, err := s.pathValidator.ValidateAndNormalizePath(req.Path)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	if sharedPath == "/" {
+		return "", nil, ErrInvalidShare
+	}
+	info, err := s.repo.GetFileByPath(sharedPath)
+	if err != nil {
+		return "", nil, ErrFileNotFound
+	}
+
+	if err := s.authorize(models.PermissionShare, sharedPath); err != nil {
+		return "", nil, err
+	}
+	if mode == models.ShareModeUpload {
+		if !info.IsDirectory {
+			return "", nil, fmt.Errorf("%w: only directories accept uploads", ErrInvalidShare)
+		}
+		if err := s.authorize(models.PermissionWrite, sharedPath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	token, err := randomToken(sessionTokenBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	share := &models.Share{
+		TokenHash:    hashToken(token),
+		TokenPrefix:  token[:shareTokenPrefixLength],
+		Path:         sharedPath,
+		CreatedBy:    s.owner,
+		Mode:         mode,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.Password != "" {
+		share.PasswordHash, err = security.HashPassword(req.Password)
+		if err != nil {
+			return "", nil, err
+		}
+		share.HasPassword = true
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		share.ExpiresAt = &expiresAt
+	}
+
+	if err := s.shares.shares.CreateShare(share); err != nil {
+		return "", nil, fmt.Errorf("failed to create share: %w", err)
+	}
+	return token, s.clientShare(share), nil
+}
+
+// ListShares returns the shares created by the user of the view. Admins, and the service
+// itself when authentication is disabled, can list every share with all.
+func (s *FileService) ListShares(all bool) ([]*models.Share, error) {
+	if s.shares == nil {
+		return []*models.Share{}, nil
+	}
+
+	createdBy := s.owner
+	if all && (s.user == nil || s.user.IsAdmin) {
+		createdBy = 0
+	}
+	shares, err := s.shares.shares.ListShares(createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []*models.Share{}
+	for _, share := range shares {
+		if _, inside := s.pathValidator.ToVirtual(share.Path); inside {
+			visible = append(visible, s.clientShare(share))
+		}
+	}
+	return visible, nil
+}
+
+// RevokeShare deletes a share. Users can revoke the shares they created and admins any share.
+func (s *FileService) RevokeShare(id int64) error {
+	share, err := s.revokeShare(id)
+	entry := &models.AuditEntry{Action: models.AuditRevokeShare, Details: fmt.Sprintf("share %d", id)}
+	if share != nil {
+		entry.Path = share.Path
+		entry.Details = shareAuditDetails(share)
+	}
+	s.recordAuditEntry(entry, err)
+	return err
+}
+
+// revokeShare deletes a share and returns it, with its storage path, once it was found
+func (s *FileService) revokeShare(id int64) (*models.Share, error) {
+	if s.shares == nil {
+		return nil, ErrShareNotFound
+	}
+
+	share, err := s.shares.shares.GetShare(id)
+	if err == sql.ErrNoRows || (err == nil && s.user != nil && !s.user.IsAdmin && share.CreatedBy != s.user.ID) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.shares.shares.DeleteShare(id); err != nil {
+		if err == sql.ErrNoRows {
+			return share, ErrShareNotFound
+		}
+		return share, err
+	}
+	return share, nil
+}
+
+func shareAuditDetails(share *models.Share) string {
+	return fmt.Sprintf("share %d (%s)", share.ID, share.Mode)
+}
+
+// ForShare returns a view serving the shared file or directory, together with its info as
+// seen through the view. Directory shares are the root of their view, so nothing outside
+// them can be reached. Files uploaded through the view are owned by the creator of the share.
+func (s *FileService) ForShare(share *models.Share) (*FileService, *models.FileInfo, error) {
+	info, err := s.repo.GetFileByPath(share.Path)
+	if err != nil {
+		return nil, nil, ErrFileNotFound
+	}
+
+	view := s.OwnedBy(share.CreatedBy)
+	if info.IsDirectory {
+		view.pathValidator = view.pathValidator.WithRoot(share.Path)
+	}
+	return view, view.clientFile(info), nil
+}
+
+func (s *FileService) clientShare(share *models.Share) *models.Share {
+	if s.pathValidator.Root() == "/" {
+		return share
+	}
+
+	mapped := *share
+	mapped.Path = s.clientPath(share.Path)
+	return &mapped
+}
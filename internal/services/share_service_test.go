@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func TestShare_DirectoryShareIsConfined(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	for _, dir := range [][2]string{{"public", "/"}, {"private", "/"}} {
+		if _, err := fs.CreateDirectory(dir[0], dir[1]); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := fs.SaveFile("a.txt", "/public", []byte("shared")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := fs.SaveFile("secret.txt", "/private", []byte("secret")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	admin := fs.ForUser(users["admin"])
+	token, share, err := admin.CreateShare(&models.CreateShareRequest{Path: "/public", Mode: models.ShareModeUpload})
+	if err != nil {
+		t.Fatalf("Failed to create share: %v", err)
+	}
+	if share.CreatedBy != users["admin"].ID || share.TokenPrefix != token[:shareTokenPrefixLength] {
+		t.Errorf("Unexpected share: %+v", share)
+	}
+
+	opened, err := fs.Shares().Open(token, "")
+	if err != nil {
+		t.Fatalf("Failed to open share: %v", err)
+	}
+	view, info, err := fs.ForShare(opened)
+	if err != nil {
+		t.Fatalf("Failed to resolve share: %v", err)
+	}
+	if !info.IsDirectory || info.Path != "/" {
+		t.Errorf("Expected the shared directory as root, got %+v", info)
+	}
+
+	if _, _, err := view.GetFileData("/a.txt"); err != nil {
+		t.Errorf("Expected the shared file to be readable, got %v", err)
+	}
+	for _, crafted := range []string{"/../private/secret.txt", "/private/secret.txt"} {
+		if _, _, err := view.GetFileData(crafted); err == nil {
+			t.Errorf("Expected %q to stay out of reach", crafted)
+		}
+	}
+
+	// Uploads are attributed to the creator of the share and follow the directory when it moves
+	if err := view.SaveFile("upload.txt", "/", []byte("new")); err != nil {
+		t.Fatalf("Failed to upload through share: %v", err)
+	}
+	if err := fs.RenameFile("/public", "published"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	uploaded, err := fs.GetFileInfo("/published/upload.txt")
+	if err != nil || uploaded.OwnerID != users["admin"].ID {
+		t.Fatalf("Expected the upload to be owned by the admin, got %+v, %v", uploaded, err)
+	}
+	if _, err := fs.Shares().Open(token, ""); err != nil {
+		t.Errorf("Expected the share to survive the rename, got %v", err)
+	}
+
+	if err := fs.DeleteFile("/published", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+	if _, err := fs.Shares().Open(token, ""); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected deleting the directory to revoke the share, got %v", err)
+	}
+}
+
+func TestShare_PasswordAndDownloadLimit(t *testing.T) {
+	fs, _, _ := setupAccessControl(t)
+	if err := fs.SaveFile("report.pdf", "/", []byte("pdf")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	token, _, err := fs.CreateShare(&models.CreateShareRequest{Path: "/report.pdf", Password: "hunter2", MaxDownloads: 1})
+	if err != nil {
+		t.Fatalf("Failed to create share: %v", err)
+	}
+
+	for _, password := range []string{"", "wrong"} {
+		if _, err := fs.Shares().Open(token, password); !errors.Is(err, ErrSharePasswordRequired) {
+			t.Errorf("Expected ErrSharePasswordRequired for %q, got %v", password, err)
+		}
+	}
+
+	share, err := fs.Shares().Open(token, "hunter2")
+	if err != nil {
+		t.Fatalf("Failed to open share: %v", err)
+	}
+	if err := fs.Shares().RecordDownload(share); err != nil {
+		t.Fatalf("Failed to record download: %v", err)
+	}
+	if err := fs.Shares().RecordDownload(share); !errors.Is(err, ErrShareExpired) {
+		t.Errorf("Expected the second download to exceed the limit, got %v", err)
+	}
+	if _, err := fs.Shares().Open(token, "hunter2"); !errors.Is(err, ErrShareExpired) {
+		t.Errorf("Expected the exhausted share to be expired, got %v", err)
+	}
+	if _, err := fs.Shares().Open("unknown", ""); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected ErrShareNotFound, got %v", err)
+	}
+}
+
+func TestShare_CreationNeedsSharePermission(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	if _, err := fs.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fs.SaveFile("notes.txt", "/team", []byte("notes")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	alice := fs.ForUser(users["alice"])
+	grant(t, fs, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+	if _, _, err := alice.CreateShare(&models.CreateShareRequest{Path: "/team"}); !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("Expected ErrAccessDenied without the share permission, got %v", err)
+	}
+
+	grant(t, fs, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead, models.PermissionShare)
+	if _, _, err := alice.CreateShare(&models.CreateShareRequest{Path: "/team/notes.txt", Mode: models.ShareModeUpload}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Expected files to reject upload mode, got %v", err)
+	}
+	_, share, err := alice.CreateShare(&models.CreateShareRequest{Path: "/team/notes.txt"})
+	if err != nil {
+		t.Fatalf("Failed to create share: %v", err)
+	}
+
+	// Only the creator and admins see and revoke the share
+	bob := fs.ForUser(users["bob"])
+	if shares, _ := bob.ListShares(true); len(shares) != 0 {
+		t.Errorf("Expected bob to see no shares, got %d", len(shares))
+	}
+	if err := bob.RevokeShare(share.ID); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected bob to be unable to revoke the share, got %v", err)
+	}
+	if shares, _ := fs.ForUser(users["admin"]).ListShares(true); len(shares) != 1 {
+		t.Errorf("Expected the admin to see every share, got %d", len(shares))
+	}
+	if err := alice.RevokeShare(share.ID); err != nil {
+		t.Errorf("Failed to revoke share: %v", err)
+	}
+}
@@ -1,126 +1,294 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 
-	"github.com/anddsdev/cloudlet/internal/security"
+	"github.com/anddsdev/cloudlet/config"
 	"github.com/anddsdev/cloudlet/internal/storage"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 )
 
+// StorageService stores file contents in a StorageBackend. The local base path always
+// holds the staging area for uploads, whichever backend keeps the files themselves.
 type StorageService struct {
-	basePath      string
-	pathValidator *security.PathValidator
-	atomicOps     *storage.AtomicFileOperations
+	basePath  string
+	backend   storage.StorageBackend
+	atomicOps *storage.AtomicFileOperations
+	blobs     *storage.BlobStore
+
+	// ctx carries the span the operations of the view are traced under
+	ctx context.Context
 }
 
+// NewStorageService creates a storage service that keeps files below basePath
 func NewStorageService(basePath string) *StorageService {
 	os.MkdirAll(basePath, 0755)
 
+	atomicOps := storage.NewAtomicFileOperations(basePath)
+	return newStorageService(basePath, storage.NewLocalBackend(basePath, atomicOps), atomicOps)
+}
+
+// NewStorageServiceWithBackend creates a storage service that keeps files in backend
+// and stages uploads below basePath
+func NewStorageServiceWithBackend(basePath string, backend storage.StorageBackend) *StorageService {
+	os.MkdirAll(basePath, 0755)
+
+	return newStorageService(basePath, backend, storage.NewAtomicFileOperations(basePath))
+}
+
+// NewStorageServiceFromConfig creates a storage service for the configured backend
+func NewStorageServiceFromConfig(cfg *config.Config) (*StorageService, error) {
+	storageCfg := cfg.Server.Storage
+
+	switch storageCfg.Backend {
+	case "", storage.BackendLocal:
+		return NewStorageService(storageCfg.Path), nil
+	case storage.BackendS3:
+		s3Cfg := storageCfg.S3
+		backend, err := storage.NewS3Backend(storage.S3Options{
+			Endpoint:        s3Cfg.Endpoint,
+			Region:          s3Cfg.Region,
+			Bucket:          s3Cfg.Bucket,
+			AccessKeyID:     s3Cfg.AccessKeyID,
+			SecretAccessKey: s3Cfg.SecretAccessKey,
+			Prefix:          s3Cfg.Prefix,
+			UsePathStyle:    s3Cfg.UsePathStyle,
+			StagingDir:      filepath.Join(storageCfg.Path, ".cloudlet-tmp"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewStorageServiceWithBackend(storageCfg.Path, backend), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", storageCfg.Backend)
+	}
+}
+
+func newStorageService(basePath string, backend storage.StorageBackend, atomicOps *storage.AtomicFileOperations) *StorageService {
 	return &StorageService{
-		basePath:      basePath,
-		pathValidator: security.NewPathValidator(basePath),
-		atomicOps:     storage.NewAtomicFileOperations(basePath),
+		basePath:  basePath,
+		backend:   backend,
+		atomicOps: atomicOps,
+		blobs:     storage.NewBlobStore(backend, atomicOps.TempDir()),
 	}
 }
 
-func (s *StorageService) CreateDirectory(relativePath string) error {
-	fullPath, err := s.getSecureFullPath(relativePath)
-	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
+// WithContext returns a view tracing its operations as children of the span in ctx
+func (s *StorageService) WithContext(ctx context.Context) *StorageService {
+	view := *s
+	view.ctx = ctx
+	return &view
+}
+
+// startSpan starts a span for operation under the span of the view
+func (s *StorageService) startSpan(operation string, attrs ...tracing.Attribute) (context.Context, *tracing.Span) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return os.MkdirAll(fullPath, 0755)
+	attrs = append(attrs, tracing.String("storage.backend", s.backendName()))
+	return tracing.Start(ctx, "StorageService."+operation, attrs...)
+}
+
+func (s *StorageService) CreateDirectory(relativePath string) error {
+	_, span := s.startSpan("CreateDirectory", tracing.String("file.path", relativePath))
+	defer span.End()
+
+	err := s.backend.MakeDir(relativePath)
+	span.RecordError(err)
+	return err
 }
 
 func (s *StorageService) SaveFile(relativePath string, data []byte) error {
-	fullPath, err := s.getSecureFullPath(relativePath)
-	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
-	}
+	_, err := s.SaveFileWithChecksum(relativePath, data, "")
+	return err
+}
 
-	return s.atomicOps.AtomicWriteFile(fullPath, data, 0644)
+// SaveFileWithChecksum saves data atomically and returns its hex SHA-256. Nothing is
+// written when expectedChecksum is set and does not match the data.
+func (s *StorageService) SaveFileWithChecksum(relativePath string, data []byte, expectedChecksum string) (string, error) {
+	ctx, span := s.startSpan("SaveFile", tracing.String("file.path", relativePath))
+	defer span.End()
+
+	var checksum string
+	var err error
+	if saver, ok := s.backend.(storage.ContextSaver); ok {
+		checksum, err = saver.SaveContext(ctx, relativePath, data, expectedChecksum)
+	} else {
+		checksum, err = s.backend.Save(relativePath, data, expectedChecksum)
+	}
+	span.RecordError(err)
+	return checksum, err
 }
 
 func (s *StorageService) ReadFile(relativePath string) ([]byte, error) {
-	fullPath, err := s.getSecureFullPath(relativePath)
+	file, err := s.backend.Open(relativePath)
 	if err != nil {
-		return nil, fmt.Errorf("invalid path: %w", err)
+		return nil, err
 	}
+	defer file.Close()
 
-	return s.atomicOps.SafeReadFile(fullPath)
+	return io.ReadAll(file)
 }
 
 func (s *StorageService) GetFileInfo(relativePath string) (fs.FileInfo, error) {
-	fullPath, err := s.getSecureFullPath(relativePath)
-	if err != nil {
-		return nil, fmt.Errorf("invalid path: %w", err)
-	}
-	return os.Stat(fullPath)
+	return s.backend.Stat(relativePath)
 }
 
 func (s *StorageService) MoveFile(oldPath, newPath string) error {
-	fullOldPath, err := s.getSecureFullPath(oldPath)
-	if err != nil {
-		return fmt.Errorf("invalid old path: %w", err)
-	}
-
-	fullNewPath, err := s.getSecureFullPath(newPath)
-	if err != nil {
-		return fmt.Errorf("invalid new path: %w", err)
-	}
+	_, span := s.startSpan("MoveFile", tracing.String("file.path", oldPath), tracing.String("file.new_path", newPath))
+	defer span.End()
 
-	return s.atomicOps.AtomicMoveFile(fullOldPath, fullNewPath)
+	err := s.backend.Move(oldPath, newPath)
+	span.RecordError(err)
+	return err
 }
 
 func (s *StorageService) DeleteFile(relativePath string) error {
-	fullPath, err := s.getSecureFullPath(relativePath)
-	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
-	}
+	_, span := s.startSpan("DeleteFile", tracing.String("file.path", relativePath))
+	defer span.End()
 
-	return s.atomicOps.AtomicDeleteFile(fullPath)
+	err := s.backend.Delete(relativePath)
+	span.RecordError(err)
+	return err
 }
 
 // SaveFileStream saves data from an io.Reader atomically (for large files)
 func (s *StorageService) SaveFileStream(relativePath string, reader io.Reader) error {
-	fullPath, err := s.getSecureFullPath(relativePath)
-	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
-	}
+	_, err := s.SaveFileStreamWithChecksum(relativePath, reader, "")
+	return err
+}
+
+// SaveFileStreamWithChecksum saves data from an io.Reader atomically and returns the hex SHA-256
+// computed while streaming. The file is not committed when expectedChecksum does not match.
+func (s *StorageService) SaveFileStreamWithChecksum(relativePath string, reader io.Reader, expectedChecksum string) (string, error) {
+	ctx, span := s.startSpan("SaveFileStream", tracing.String("file.path", relativePath))
+	defer span.End()
 
-	return s.atomicOps.AtomicWriteFileStream(fullPath, reader, 0644)
+	var checksum string
+	var err error
+	if saver, ok := s.backend.(storage.ContextSaver); ok {
+		checksum, err = saver.SaveStreamContext(ctx, relativePath, reader, expectedChecksum)
+	} else {
+		checksum, err = s.backend.SaveStream(relativePath, reader, expectedChecksum)
+	}
+	span.RecordError(err)
+	return checksum, err
 }
 
 // OpenFile opens a file for reading safely
-func (s *StorageService) OpenFile(relativePath string) (*os.File, error) {
-	fullPath, err := s.getSecureFullPath(relativePath)
+func (s *StorageService) OpenFile(relativePath string) (storage.File, error) {
+	return s.backend.Open(relativePath)
+}
+
+// StageBlob streams data into the staging area for the content-addressed blob store
+func (s *StorageService) StageBlob(reader io.Reader, expectedChecksum string) (*storage.StagedBlob, error) {
+	_, span := s.startSpan("StageBlob")
+	defer span.End()
+
+	staged, err := s.blobs.Stage(reader, expectedChecksum)
+	span.RecordError(err)
+	return staged, err
+}
+
+// CommitBlob stores a staged blob, or drops it if identical content is already stored
+func (s *StorageService) CommitBlob(staged *storage.StagedBlob) error {
+	_, span := s.startSpan("CommitBlob", tracing.String("blob.checksum", staged.Checksum))
+	defer span.End()
+
+	err := s.blobs.Commit(staged)
+	span.RecordError(err)
+	return err
+}
+
+// OpenBlob opens a stored blob for reading
+func (s *StorageService) OpenBlob(checksum string) (storage.File, error) {
+	return s.blobs.Open(checksum)
+}
+
+// ReadBlob returns the content of a stored blob
+func (s *StorageService) ReadBlob(checksum string) ([]byte, error) {
+	return s.blobs.Read(checksum)
+}
+
+// DeleteBlob removes a stored blob and returns the number of bytes freed
+func (s *StorageService) DeleteBlob(checksum string) (int64, error) {
+	return s.blobs.Delete(checksum)
+}
+
+// ListBlobs returns the keys of all stored blobs
+func (s *StorageService) ListBlobs() ([]string, error) {
+	return s.blobs.List()
+}
+
+// StagingPath returns a path inside the temporary staging area managed by the atomic operations
+func (s *StorageService) StagingPath(elem ...string) string {
+	return filepath.Join(append([]string{s.atomicOps.TempDir()}, elem...)...)
+}
+
+// CheckWritable writes and removes a probe file in the local storage root
+func (s *StorageService) CheckWritable() error {
+	return probeWritable(s.basePath)
+}
+
+// CheckStagingWritable writes and removes a probe file in the staging area of uploads
+func (s *StorageService) CheckStagingWritable() error {
+	return probeWritable(s.atomicOps.TempDir())
+}
+
+func probeWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".health-*.tmp")
 	if err != nil {
-		return nil, fmt.Errorf("invalid path: %w", err)
+		return err
 	}
 
-	return s.atomicOps.SafeOpenFile(fullPath)
+	_, err = file.WriteString("ok")
+	closeErr := file.Close()
+	removeErr := os.Remove(file.Name())
+	return errors.Join(err, closeErr, removeErr)
+}
+
+// FreeSpace returns the bytes available on the filesystem holding the local storage root
+func (s *StorageService) FreeSpace() (uint64, error) {
+	return storage.FreeSpace(s.basePath)
 }
 
 // GetStats returns statistics about storage operations
 func (s *StorageService) GetStats() map[string]interface{} {
 	stats := s.atomicOps.GetStats()
 	stats["base_path"] = s.basePath
+	stats["backend"] = s.backendName()
 	return stats
 }
 
 // Close shuts down the storage service and cleans up resources
 func (s *StorageService) Close() error {
+	if s.backend != nil {
+		if err := s.backend.Close(); err != nil {
+			return err
+		}
+	}
 	if s.atomicOps != nil {
 		return s.atomicOps.Close()
 	}
 	return nil
 }
 
-// GetPhysicalPath returns the physical file system path for a given relative path
+// GetPhysicalPath returns the physical file system path for a given relative path.
+// Files kept by a remote backend have none, so the base path is returned for them.
 func (s *StorageService) GetPhysicalPath(relativePath string) string {
-	fullPath, err := s.getSecureFullPath(relativePath)
+	local, ok := s.backend.(*storage.LocalBackend)
+	if !ok {
+		return s.basePath
+	}
+
+	fullPath, err := local.FullPath(relativePath)
 	if err != nil {
 		// Return a safe fallback path if validation fails
 		return s.basePath
@@ -128,7 +296,13 @@ func (s *StorageService) GetPhysicalPath(relativePath string) string {
 	return fullPath
 }
 
-// getSecureFullPath validates and returns the full path safely
-func (s *StorageService) getSecureFullPath(relativePath string) (string, error) {
-	return s.pathValidator.ValidateAndGetFullPath(relativePath)
+func (s *StorageService) backendName() string {
+	switch s.backend.(type) {
+	case *storage.LocalBackend:
+		return storage.BackendLocal
+	case *storage.S3Backend:
+		return storage.BackendS3
+	default:
+		return fmt.Sprintf("%T", s.backend)
+	}
 }
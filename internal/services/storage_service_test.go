@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/repository"
+	"github.com/anddsdev/cloudlet/internal/storage"
+	"github.com/anddsdev/cloudlet/internal/storage/s3test"
+)
+
+// setupS3FileService creates a FileService that keeps files in an S3 stand-in
+func setupS3FileService(t *testing.T) (*FileService, *s3test.Server) {
+	server := s3test.NewServer(t, "cloudlet", "minio")
+	tempDir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Server.Storage.Path = filepath.Join(tempDir, "staging")
+	cfg.Server.Storage.Backend = storage.BackendS3
+	cfg.Server.Storage.S3.Endpoint = server.URL
+	cfg.Server.Storage.S3.Bucket = "cloudlet"
+	cfg.Server.Storage.S3.AccessKeyID = "minio"
+	cfg.Server.Storage.S3.SecretAccessKey = "minio-secret"
+	cfg.Server.Storage.S3.UsePathStyle = true
+
+	storageService, err := NewStorageServiceFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewStorageServiceFromConfig failed: %v", err)
+	}
+	t.Cleanup(func() { storageService.Close() })
+
+	repo, err := repository.NewFileRepository(filepath.Join(tempDir, "test.db"), 5)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return NewFileService(repo, storageService, cfg.Server.Storage.Path), server
+}
+
+func TestNewStorageServiceFromConfig_UnknownBackend(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Storage.Path = t.TempDir()
+	cfg.Server.Storage.Backend = "tape"
+
+	if _, err := NewStorageServiceFromConfig(cfg); err == nil {
+		t.Fatal("Expected an unknown backend to be rejected")
+	}
+}
+
+func TestFileService_S3Backend(t *testing.T) {
+	service, server := setupS3FileService(t)
+	content := []byte("stored in a bucket")
+
+	if _, err := service.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if err := service.SaveFile("a.txt", "/docs", content); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if err := service.SaveFileStream("b.txt", "/docs", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("SaveFileStream failed: %v", err)
+	}
+
+	file, info, err := service.OpenFileForRead("/docs/a.txt")
+	if err != nil {
+		t.Fatalf("OpenFileForRead failed: %v", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("Read %q, %v", data, err)
+	}
+	if info.Checksum != ChecksumBytes(content) {
+		t.Errorf("Expected checksum %s, got %s", ChecksumBytes(content), info.Checksum)
+	}
+
+	if err := service.RenameFile("/docs/a.txt", "renamed.txt"); err != nil {
+		t.Fatalf("RenameFile failed: %v", err)
+	}
+	if _, err := service.CreateDirectory("archive", "/"); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if err := service.MoveFile("/docs", "/archive"); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if got, want := server.Keys(), []string{"archive/docs/b.txt", "archive/docs/renamed.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected objects %v, got %v", want, got)
+	}
+
+	if err := service.DeleteFile("/archive/docs", true); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("Expected every object to be deleted, have %v", keys)
+	}
+}
+
+func TestFileService_S3BackendEmptyDirectories(t *testing.T) {
+	service, server := setupS3FileService(t)
+
+	for _, name := range []string{"empty", "archive"} {
+		if _, err := service.CreateDirectory(name, "/"); err != nil {
+			t.Fatalf("CreateDirectory(%s) failed: %v", name, err)
+		}
+	}
+	if err := service.RenameFile("/empty", "renamed"); err != nil {
+		t.Fatalf("RenameFile of an empty directory failed: %v", err)
+	}
+	if err := service.MoveFile("/renamed", "/archive"); err != nil {
+		t.Fatalf("MoveFile of an empty directory failed: %v", err)
+	}
+
+	info, err := service.GetFileInfo("/archive/renamed")
+	if err != nil || !info.IsDirectory {
+		t.Fatalf("Expected the directory at its new path, got %+v, %v", info, err)
+	}
+	if err := service.SaveFile("a.txt", "/archive/renamed", []byte("filled")); err != nil {
+		t.Fatalf("SaveFile into the moved directory failed: %v", err)
+	}
+	if got, want := server.Keys(), []string{"archive/renamed/a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected objects %v, got %v", want, got)
+	}
+}
+
+func TestFileService_S3BackendDeduplication(t *testing.T) {
+	service, server := setupS3FileService(t)
+	service.EnableDeduplication()
+	content := []byte("same bytes twice")
+
+	for _, name := range []string{"one.bin", "two.bin"} {
+		if err := service.SaveFile(name, "/", content); err != nil {
+			t.Fatalf("SaveFile(%s) failed: %v", name, err)
+		}
+	}
+	if keys := server.Keys(); len(keys) != 1 {
+		t.Fatalf("Expected a single blob object, have %v", keys)
+	}
+
+	data, _, err := service.GetFileData("/two.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("GetFileData returned %q, %v", data, err)
+	}
+
+	for _, path := range []string{"/one.bin", "/two.bin"} {
+		if err := service.DeleteFile(path); err != nil {
+			t.Fatalf("DeleteFile(%s) failed: %v", path, err)
+		}
+	}
+	result, err := service.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if result.RemovedBlobs != 1 || len(server.Keys()) != 0 {
+		t.Errorf("Expected the blob to be collected, removed %d, have %v", result.RemovedBlobs, server.Keys())
+	}
+}
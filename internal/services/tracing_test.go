@@ -0,0 +1,65 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/tracing"
+)
+
+func TestTracing_SaveIsTracedDownToStorageAndDatabase(t *testing.T) {
+	fs := setupRealFileService(t)
+
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("cloudlet", 1, tracing.NewWriterExporter(&buf))
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(nil)
+
+	ctx, request := tracing.Start(context.Background(), "POST /api/v1/upload")
+	if err := fs.WithContext(ctx).SaveFile("report.txt", "/", []byte("quarterly numbers")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	request.End()
+	tracer.Shutdown(context.Background())
+
+	var export struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					Name         string `json:"name"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+		t.Fatalf("Failed to decode exported spans: %v\n%s", err, buf.String())
+	}
+
+	parents := map[string]string{}
+	names := map[string]string{}
+	for _, span := range export.ResourceSpans[0].ScopeSpans[0].Spans {
+		names[span.SpanID] = span.Name
+		parents[span.Name] = span.ParentSpanID
+	}
+	for child, parent := range map[string]string{
+		"FileService.SaveFile":           "POST /api/v1/upload",
+		"FileRepository.GetFileByPath":   "FileService.SaveFile",
+		"StorageService.SaveFile":        "FileService.SaveFile",
+		"AtomicFileOperations.WriteTemp": "StorageService.SaveFile",
+		"AtomicFileOperations.Rename":    "StorageService.SaveFile",
+		"FileRepository.InsertFile":      "FileService.SaveFile",
+	} {
+		parentID, ok := parents[child]
+		if !ok {
+			t.Errorf("Expected a %s span, got %v", child, names)
+			continue
+		}
+		if names[parentID] != parent {
+			t.Errorf("Expected %s to be a child of %s, got %q", child, parent, names[parentID])
+		}
+	}
+}
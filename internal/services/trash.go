@@ -0,0 +1,262 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+	"github.com/anddsdev/cloudlet/internal/repository"
+)
+
+var (
+	ErrTrashItemNotFound = errors.New("trash item not found")
+	ErrRestoreConflict   = errors.New("a file or directory already exists at the original path")
+)
+
+// EnableTrash makes DeleteFile move files and directories to the trash, from where they
+// can be restored. Items deleted longer than retention ago are purged by garbage
+// collection, a retention of 0 keeps them until they are purged by hand.
+func (s *FileService) EnableTrash(retention time.Duration) {
+	s.trash = true
+	s.trashRetention = retention
+}
+
+// TrashEnabled reports whether deleted files are kept in the trash
+func (s *FileService) TrashEnabled() bool {
+	return s.trash
+}
+
+// ListTrash returns the trash items the user of the view deleted, or every item for admins
+// and views without a user, newest first
+func (s *FileService) ListTrash() ([]*models.TrashItem, error) {
+	var userID int64
+	if s.user != nil && !s.user.IsAdmin {
+		userID = s.user.ID
+	}
+
+	items, err := s.repo.ListTrash(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []*models.TrashItem{}
+	for _, item := range items {
+		if _, inside := s.pathValidator.ToVirtual(item.Path); inside {
+			visible = append(visible, s.clientTrashItem(item))
+		}
+	}
+	return visible, nil
+}
+
+// GetTrashItem returns a trash item the user of the view deleted, any item for admins
+func (s *FileService) GetTrashItem(id int64) (*models.TrashItem, error) {
+	item, err := s.getTrashItem(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientTrashItem(item), nil
+}
+
+// RestoreFromTrash puts a trash item back at its original path, recreating the parent
+// directories that no longer exist. It needs the write permission on the parent.
+func (s *FileService) RestoreFromTrash(id int64) (*models.FileInfo, error) {
+	item, err := s.getTrashItem(id)
+	if err != nil {
+		s.recordAuditEntry(&models.AuditEntry{Action: models.AuditRestore, Details: trashAuditDetails(id)}, err)
+		return nil, err
+	}
+
+	restored, err := s.restoreFromTrash(item)
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditRestore,
+		Path:    item.Path,
+		Size:    item.Size,
+		Details: trashAuditDetails(id),
+	}, err)
+	return restored, err
+}
+
+func (s *FileService) restoreFromTrash(item *models.TrashItem) (*models.FileInfo, error) {
+
+	parent := path.Dir(item.Path)
+	if err := s.authorize(models.PermissionWrite, parent); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetFileByPath(item.Path); err == nil {
+		return nil, ErrRestoreConflict
+	}
+	if err := s.checkQuota(parent, item.Size, item.FileCount); err != nil {
+		return nil, err
+	}
+
+	entries, err := s.repo.GetTrashEntries(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unrestricted().ensureDirectory(parent); err != nil {
+		return nil, fmt.Errorf("failed to recreate parent directory: %w", err)
+	}
+
+	if err := s.repo.RestoreFromTrash(item.ID, entries); err != nil {
+		switch err {
+		case repository.ErrPathExists:
+			return nil, ErrRestoreConflict
+		case sql.ErrNoRows:
+			return nil, ErrTrashItemNotFound
+		}
+		return nil, err
+	}
+
+	// Restored files are read from the blob store, only directories need to exist again
+	for _, entry := range entries {
+		if entry.IsDirectory {
+			if err := s.storage.CreateDirectory(entry.Path); err != nil {
+				s.log().Error("Failed to recreate restored directory", "path", entry.Path, "error", err)
+			}
+		}
+	}
+
+	restored, err := s.repo.GetFileByPath(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	return s.clientFile(restored), nil
+}
+
+// PurgeTrashItem deletes a trash item for good
+func (s *FileService) PurgeTrashItem(id int64) error {
+	item, err := s.getTrashItem(id)
+	if err != nil {
+		s.recordAuditEntry(&models.AuditEntry{Action: models.AuditPurge, Details: trashAuditDetails(id)}, err)
+		return err
+	}
+
+	err = s.repo.PurgeTrashItem(item.ID)
+	if err == sql.ErrNoRows {
+		err = ErrTrashItemNotFound
+	}
+	s.recordTrashPurge(item, item.Path, err)
+	return err
+}
+
+// EmptyTrash deletes for good every trash item ListTrash returns and reports how many there were
+func (s *FileService) EmptyTrash() (int64, error) {
+	items, err := s.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, item := range items {
+		if err := s.repo.PurgeTrashItem(item.ID); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			s.recordTrashPurge(item, s.auditPath(item.Path), err)
+			return purged, err
+		}
+		s.recordTrashPurge(item, s.auditPath(item.Path), nil)
+		purged++
+	}
+	return purged, nil
+}
+
+// recordTrashPurge records the purge of a trash item that was deleted from storagePath
+func (s *FileService) recordTrashPurge(item *models.TrashItem, storagePath string, err error) {
+	s.recordAuditEntry(&models.AuditEntry{
+		Action:  models.AuditPurge,
+		Path:    storagePath,
+		Size:    item.Size,
+		Details: trashAuditDetails(item.ID),
+	}, err)
+}
+
+func trashAuditDetails(id int64) string {
+	return fmt.Sprintf("trash item %d", id)
+}
+
+// PurgeExpiredTrash deletes the trash items older than the retention period
+func (s *FileService) PurgeExpiredTrash() (int64, error) {
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+	return s.repo.PurgeTrashBefore(time.Now().Add(-s.trashRetention))
+}
+
+// moveToTrash removes file, and everything below it when it is a directory, into the
+// trash. Contents stored verbatim are copied into the blob store first, so the trash
+// only ever references blobs.
+func (s *FileService) moveToTrash(file *models.FileInfo) error {
+	entries := []*models.FileInfo{file}
+	if file.IsDirectory {
+		below, err := s.repo.GetFilesUnderPath(file.Path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, below...)
+	}
+
+	s.blobMu.RLock()
+	defer s.blobMu.RUnlock()
+
+	archived := make(map[int64]string)
+	for _, entry := range entries {
+		if entry.IsDirectory || entry.BlobRef != "" {
+			continue
+		}
+		ref, err := s.archiveVerbatimCopy(entry.Path)
+		if err != nil {
+			return fmt.Errorf("failed to move %s to the trash: %w", entry.Path, err)
+		}
+		archived[entry.ID] = ref
+	}
+
+	if _, err := s.repo.MoveToTrash(entries, archived, s.owner); err != nil {
+		return err
+	}
+
+	// The verbatim copies are kept in the blob store now. Children go before their parents.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.BlobRef != "" {
+			continue
+		}
+		if err := s.storage.DeleteFile(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.log().Error("Failed to remove trashed copy", "path", entry.Path, "error", err)
+		}
+	}
+	return nil
+}
+
+// getTrashItem returns a trash item the user of the view may restore or purge
+func (s *FileService) getTrashItem(id int64) (*models.TrashItem, error) {
+	item, err := s.repo.GetTrashItem(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTrashItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.user != nil && !s.user.IsAdmin && item.DeletedBy != s.user.ID {
+		return nil, ErrTrashItemNotFound
+	}
+	if _, inside := s.pathValidator.ToVirtual(item.Path); !inside {
+		return nil, ErrTrashItemNotFound
+	}
+	return item, nil
+}
+
+func (s *FileService) clientTrashItem(item *models.TrashItem) *models.TrashItem {
+	mapped := *item
+	mapped.Path = s.clientPath(item.Path)
+	if s.trashRetention > 0 {
+		expiresAt := item.DeletedAt.Add(s.trashRetention)
+		mapped.ExpiresAt = &expiresAt
+	}
+	return &mapped
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func setupTrashFileService(t *testing.T) *FileService {
+	service := setupRealFileService(t)
+	service.EnableTrash(24 * time.Hour)
+	return service
+}
+
+func TestTrash_DeleteAndRestoreDirectory(t *testing.T) {
+	fs := setupTrashFileService(t)
+
+	if _, err := fs.CreateDirectory("docs", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := fs.CreateDirectory("drafts", "/docs"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fs.SaveFile("plan.txt", "/docs", []byte("plan")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := fs.SaveFile("idea.txt", "/docs/drafts", []byte("an idea")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	if err := fs.DeleteFile("/docs", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+	if _, err := fs.GetFileInfo("/docs/plan.txt"); err != ErrFileNotFound {
+		t.Fatalf("Expected the directory to be gone, got %v", err)
+	}
+	if _, err := os.Stat(fs.storage.GetPhysicalPath("/docs")); !os.IsNotExist(err) {
+		t.Errorf("Expected no verbatim copies left, got %v", err)
+	}
+
+	items, err := fs.ListTrash()
+	if err != nil {
+		t.Fatalf("Failed to list trash: %v", err)
+	}
+	if len(items) != 1 || items[0].Path != "/docs" || !items[0].IsDirectory {
+		t.Fatalf("Expected /docs in the trash, got %+v", items)
+	}
+	if items[0].FileCount != 2 || items[0].Size != 11 || items[0].ExpiresAt == nil {
+		t.Errorf("Unexpected trash item: %+v", items[0])
+	}
+
+	restored, err := fs.RestoreFromTrash(items[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if restored.Path != "/docs" || !restored.IsDirectory {
+		t.Errorf("Unexpected restored item: %+v", restored)
+	}
+	data, _, err := fs.GetFileData("/docs/drafts/idea.txt")
+	if err != nil || string(data) != "an idea" {
+		t.Errorf("Expected the restored content, got %q, %v", data, err)
+	}
+	if items, _ := fs.ListTrash(); len(items) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", items)
+	}
+
+	// Restored directories accept new uploads again
+	if err := fs.SaveFile("notes.txt", "/docs/drafts", []byte("notes")); err != nil {
+		t.Errorf("Failed to save into restored directory: %v", err)
+	}
+}
+
+func TestTrash_RestoreRecreatesParentsAndDetectsConflicts(t *testing.T) {
+	fs := setupTrashFileService(t)
+
+	if _, err := fs.CreateDirectory("a", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := fs.CreateDirectory("b", "/a"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fs.SaveFile("file.txt", "/a/b", []byte("kept")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	if err := fs.DeleteFile("/a/b/file.txt"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := fs.DeleteFilePermanently("/a", true); err != nil {
+		t.Fatalf("Failed to delete parent: %v", err)
+	}
+
+	items, _ := fs.ListTrash()
+	if len(items) != 1 {
+		t.Fatalf("Expected only the file in the trash, got %+v", items)
+	}
+	if _, err := fs.RestoreFromTrash(items[0].ID); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if info, err := fs.GetFileInfo("/a/b"); err != nil || !info.IsDirectory {
+		t.Fatalf("Expected the parents to be recreated, got %v", err)
+	}
+	data, _, err := fs.GetFileData("/a/b/file.txt")
+	if err != nil || string(data) != "kept" {
+		t.Errorf("Expected the restored content, got %q, %v", data, err)
+	}
+
+	// Once the path is taken again the item stays in the trash
+	if err := fs.DeleteFile("/a/b/file.txt"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := fs.SaveFile("file.txt", "/a/b", []byte("new")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	items, _ = fs.ListTrash()
+	if _, err := fs.RestoreFromTrash(items[0].ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("Expected ErrRestoreConflict, got %v", err)
+	}
+	if _, err := fs.GetTrashItem(items[0].ID); err != nil {
+		t.Errorf("Expected the item to stay in the trash, got %v", err)
+	}
+}
+
+func TestTrash_PurgeReleasesBlobs(t *testing.T) {
+	fs := setupTrashFileService(t)
+
+	// The previous version of manual.txt goes to the trash with it
+	if err := fs.SaveFile("manual.txt", "/", []byte("draft")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	for _, name := range []string{"old.txt", "new.txt", "manual.txt"} {
+		if err := fs.SaveFile(name, "/", []byte("content of "+name)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if err := fs.DeleteFile("/" + name); err != nil {
+			t.Fatalf("Failed to delete file: %v", err)
+		}
+	}
+	if got := countStoredBlobs(t, fs); got != 4 {
+		t.Fatalf("Expected 4 trashed blobs, got %d", got)
+	}
+
+	if _, err := fs.repo.DB().Exec("UPDATE trash_items SET deleted_at = ? WHERE path = '/old.txt'",
+		time.Now().Add(-48*time.Hour).UTC()); err != nil {
+		t.Fatalf("Failed to age trash item: %v", err)
+	}
+
+	result, err := fs.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if result.RemovedBlobs != 1 {
+		t.Errorf("Expected the expired item to be collected, got %+v", result)
+	}
+
+	items, _ := fs.ListTrash()
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items left, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Path == "/manual.txt" {
+			if err := fs.PurgeTrashItem(item.ID); err != nil {
+				t.Fatalf("Failed to purge: %v", err)
+			}
+		}
+	}
+	if err := fs.PurgeTrashItem(items[0].ID + 100); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("Expected ErrTrashItemNotFound, got %v", err)
+	}
+
+	purged, err := fs.EmptyTrash()
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected 1 item emptied, got %d, %v", purged, err)
+	}
+	if _, err := fs.CollectGarbage(); err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if got := countStoredBlobs(t, fs); got != 0 {
+		t.Errorf("Expected every blob to be collected, got %d", got)
+	}
+}
+
+func TestTrash_ItemsBelongToWhoDeletedThem(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	fs.EnableTrash(0)
+	admin := fs.ForUser(users["admin"])
+	alice := fs.ForUser(users["alice"])
+	bob := fs.ForUser(users["bob"])
+
+	if _, err := admin.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := alice.SaveFile("draft.txt", "/team", []byte("draft")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := alice.DeleteFile("/team/draft.txt"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+
+	items, _ := alice.ListTrash()
+	if len(items) != 1 || items[0].DeletedBy != users["alice"].ID || items[0].ExpiresAt != nil {
+		t.Fatalf("Expected alice to see her item, got %+v", items)
+	}
+	if items, _ := bob.ListTrash(); len(items) != 0 {
+		t.Errorf("Expected bob to see nothing, got %+v", items)
+	}
+	if items, _ := admin.ListTrash(); len(items) != 1 {
+		t.Errorf("Expected the admin to see every item, got %+v", items)
+	}
+	if _, err := bob.RestoreFromTrash(items[0].ID); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("Expected ErrTrashItemNotFound for bob, got %v", err)
+	}
+
+	// Restoring needs write access where the item goes back
+	grant(t, admin, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+	if _, err := alice.RestoreFromTrash(items[0].ID); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+	if _, err := admin.RestoreFromTrash(items[0].ID); err != nil {
+		t.Errorf("Failed to restore as admin: %v", err)
+	}
+}
+
+func TestTrash_RestoreKeepsACLVersionsAndMetadata(t *testing.T) {
+	fs, _, users := setupAccessControl(t)
+	fs.EnableTrash(0)
+	admin := fs.ForUser(users["admin"])
+
+	if _, err := admin.CreateDirectory("team", "/"); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := admin.SaveFile("plan.txt", "/team", []byte("first")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if err := admin.SaveFile("plan.txt", "/team", []byte("second")); err != nil {
+		t.Fatalf("Failed to overwrite file: %v", err)
+	}
+	grant(t, admin, "/team", models.SubjectUser, users["alice"].ID, models.PermissionRead)
+	if _, err := admin.SetTags("/team/plan.txt", []string{"roadmap"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+	if _, err := admin.SetMetadata("/team/plan.txt", []*models.MetadataEntry{
+		{Key: "owner", Type: models.MetadataString, Value: "alice"},
+	}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+
+	if err := admin.DeleteFile("/team", true); err != nil {
+		t.Fatalf("Failed to delete directory: %v", err)
+	}
+	items, _ := admin.ListTrash()
+	if len(items) != 1 {
+		t.Fatalf("Expected the directory in the trash, got %+v", items)
+	}
+	if _, err := admin.RestoreFromTrash(items[0].ID); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	if _, _, err := fs.ForUser(users["alice"]).GetFileData("/team/plan.txt"); err != nil {
+		t.Errorf("Expected alice to keep read access, got %v", err)
+	}
+	if _, _, err := fs.ForUser(users["bob"]).GetFileData("/team/plan.txt"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected the restored directory to stay protected from bob, got %v", err)
+	}
+
+	versions, err := admin.ListVersions("/team/plan.txt")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Expected the previous version back, got %+v, %v", versions, err)
+	}
+	if got := readVersion(t, admin, "/team/plan.txt", versions[0].Version); got != "first" {
+		t.Errorf("Expected the content of the previous version, got %q", got)
+	}
+
+	metadata, err := admin.GetMetadata("/team/plan.txt")
+	if err != nil {
+		t.Fatalf("Failed to get metadata: %v", err)
+	}
+	if len(metadata.Tags) != 1 || metadata.Tags[0] != "roadmap" || len(metadata.Metadata) != 1 || metadata.Metadata[0].Value != "alice" {
+		t.Errorf("Expected the tags and metadata back, got %+v", metadata)
+	}
+}
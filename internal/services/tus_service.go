@@ -0,0 +1,437 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/config"
+	"github.com/anddsdev/cloudlet/internal/security"
+	"github.com/google/uuid"
+)
+
+// TusVersion is the tus protocol version implemented by TusService
+const TusVersion = "1.0.0"
+
+// TusExtensions lists the tus protocol extensions supported by TusService
+var TusExtensions = []string{"creation", "termination", "checksum"}
+
+// TusChecksumAlgorithms lists the algorithms accepted in Upload-Checksum headers
+var TusChecksumAlgorithms = []string{"sha1", "sha256", "md5"}
+
+var (
+	ErrTusUploadNotFound     = errors.New("upload not found")
+	ErrTusOffsetMismatch     = errors.New("upload offset does not match")
+	ErrTusUploadTooLarge     = errors.New("upload exceeds maximum size")
+	ErrTusUploadLocked       = errors.New("upload is locked by another request")
+	ErrTusChecksumMismatch   = errors.New("checksum mismatch")
+	ErrTusUnsupportedAlgo    = errors.New("unsupported checksum algorithm")
+	ErrTusInvalidChecksum    = errors.New("invalid Upload-Checksum header")
+	ErrTusInvalidMetadata    = errors.New("invalid Upload-Metadata header")
+	ErrTusUploadAlreadyFinal = errors.New("upload already completed")
+)
+
+// TusUpload holds the server-side state of a tus upload
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Filename  string            `json:"filename"`
+	Path      string            `json:"path"`
+	Metadata  map[string]string `json:"metadata"`
+	Completed bool              `json:"completed"`
+	OwnerID   int64             `json:"ownerId,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// TusService implements the tus 1.0 resumable upload protocol on top of the
+// storage staging area. Finished uploads are committed through FileService,
+// so they end up in the same repository and storage as every other upload.
+type TusService struct {
+	fileService *FileService
+	cfg         *config.Config
+	stagingRoot string
+	uploadLocks sync.Map
+}
+
+// NewTusService creates a new tus service
+func NewTusService(fileService *FileService, cfg *config.Config) *TusService {
+	stagingRoot := fileService.storage.StagingPath("tus")
+	os.MkdirAll(stagingRoot, 0755)
+
+	return &TusService{
+		fileService: fileService,
+		cfg:         cfg,
+		stagingRoot: stagingRoot,
+	}
+}
+
+// MaxSize returns the largest upload accepted, advertised as Tus-Max-Size
+func (s *TusService) MaxSize() int64 {
+	return s.cfg.Server.MaxFileSize
+}
+
+// CreateUpload registers a new upload of the given length. The filename is taken
+// from the "filename" (or "name") metadata key and the target directory from "path".
+func (s *TusService) CreateUpload(length int64, rawMetadata string) (*TusUpload, error) {
+	return s.CreateUploadFor(s.fileService, length, rawMetadata)
+}
+
+// CreateUploadFor is CreateUpload with the target directory resolved by files, a view
+// returned by FileService.ForUser, so the upload lands in the home directory of its user
+// and is owned by it
+func (s *TusService) CreateUploadFor(files *FileService, length int64, rawMetadata string) (*TusUpload, error) {
+	if length < 0 {
+		return nil, errors.New("invalid Upload-Length")
+	}
+	if length > s.MaxSize() {
+		return nil, ErrTusUploadTooLarge
+	}
+
+	metadata, err := ParseTusMetadata(rawMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	if err := security.IsValidFilename(filename); err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+
+	targetPath := metadata["path"]
+	if targetPath == "" {
+		targetPath = "/"
+	}
+	parentPath, err := files.ResolvePath(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	if err := files.CheckQuota(targetPath, length, 1); err != nil {
+		return nil, err
+	}
+
+	s.cleanupExpiredUploads()
+
+	now := time.Now()
+	upload := &TusUpload{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Filename:  filename,
+		Path:      parentPath,
+		Metadata:  metadata,
+		OwnerID:   files.Owner(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.uploadTTL()),
+	}
+
+	if err := os.MkdirAll(s.uploadDir(upload.ID), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	dataFile, err := os.OpenFile(s.dataPath(upload.ID), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		os.RemoveAll(s.uploadDir(upload.ID))
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	dataFile.Close()
+
+	if err := s.saveUpload(upload); err != nil {
+		os.RemoveAll(s.uploadDir(upload.ID))
+		return nil, err
+	}
+
+	// Zero-length uploads are complete as soon as they are created
+	if length == 0 {
+		if err := s.finalize(upload); err != nil {
+			return upload, err
+		}
+	}
+
+	return upload, nil
+}
+
+// GetUpload returns the current state of an upload
+func (s *TusService) GetUpload(id string) (*TusUpload, error) {
+	return s.loadUpload(id)
+}
+
+// WriteChunk appends data at the given offset. When checksumHeader is set the
+// appended bytes are verified and discarded on mismatch. Once the final byte
+// arrives the upload is committed to storage.
+func (s *TusService) WriteChunk(id string, offset int64, checksumHeader string, reader io.Reader) (*TusUpload, error) {
+	lock := s.uploadLock(id)
+	if !lock.TryLock() {
+		return nil, ErrTusUploadLocked
+	}
+	defer lock.Unlock()
+
+	upload, err := s.loadUpload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Completed {
+		return nil, ErrTusUploadAlreadyFinal
+	}
+	if offset != upload.Offset {
+		return upload, ErrTusOffsetMismatch
+	}
+
+	var hasher hash.Hash
+	var expectedSum []byte
+	if checksumHeader != "" {
+		hasher, expectedSum, err = parseTusChecksum(checksumHeader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dataFile, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+
+	if _, err := dataFile.Seek(upload.Offset, io.SeekStart); err != nil {
+		dataFile.Close()
+		return nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	// Never accept more bytes than the declared length
+	source := io.LimitReader(reader, upload.Length-upload.Offset)
+	if hasher != nil {
+		source = io.TeeReader(source, hasher)
+	}
+
+	written, copyErr := io.Copy(dataFile, source)
+
+	if hasher != nil && copyErr == nil && string(hasher.Sum(nil)) != string(expectedSum) {
+		dataFile.Truncate(upload.Offset)
+		dataFile.Close()
+		return upload, ErrTusChecksumMismatch
+	}
+
+	if hasher != nil && copyErr != nil {
+		// A partial chunk cannot be verified, so drop it entirely
+		dataFile.Truncate(upload.Offset)
+		dataFile.Close()
+		return upload, fmt.Errorf("failed to write upload data: %w", copyErr)
+	}
+
+	if err := dataFile.Close(); err != nil {
+		return upload, fmt.Errorf("failed to close upload file: %w", err)
+	}
+
+	// Without a checksum, keep whatever arrived so the client can resume from there
+	upload.Offset += written
+	if err := s.saveUpload(upload); err != nil {
+		return upload, err
+	}
+
+	if copyErr != nil {
+		return upload, fmt.Errorf("failed to write upload data: %w", copyErr)
+	}
+
+	if upload.Offset == upload.Length {
+		if err := s.finalize(upload); err != nil {
+			return upload, err
+		}
+	}
+
+	return upload, nil
+}
+
+// TerminateUpload discards an upload and any data received for it
+func (s *TusService) TerminateUpload(id string) error {
+	if _, err := s.loadUpload(id); err != nil {
+		return err
+	}
+
+	lock := s.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	os.RemoveAll(s.uploadDir(id))
+	s.uploadLocks.Delete(id)
+	return nil
+}
+
+// finalize commits the staged data through FileService and keeps only the
+// upload record, so HEAD requests after completion still report the final offset
+func (s *TusService) finalize(upload *TusUpload) error {
+	dataFile, err := os.Open(s.dataPath(upload.ID))
+	if err != nil {
+		return fmt.Errorf("failed to open upload file: %w", err)
+	}
+
+	err = s.fileService.OwnedBy(upload.OwnerID).SaveFileStream(upload.Filename, upload.Path, dataFile, upload.Length)
+	dataFile.Close()
+	if err != nil {
+		return err
+	}
+
+	upload.Completed = true
+	if err := s.saveUpload(upload); err != nil {
+		return err
+	}
+
+	os.Remove(s.dataPath(upload.ID))
+	return nil
+}
+
+func (s *TusService) loadUpload(id string) (*TusUpload, error) {
+	// IDs become directory names, so only accept the UUIDs we generate
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrTusUploadNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTusUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload info: %w", err)
+	}
+
+	upload := &TusUpload{}
+	if err := json.Unmarshal(data, upload); err != nil {
+		return nil, fmt.Errorf("corrupt upload info: %w", err)
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrTusUploadNotFound
+	}
+
+	return upload, nil
+}
+
+// saveUpload writes the upload record through a temp file so readers never see a partial record
+func (s *TusService) saveUpload(upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	tempPath := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+	if err := os.Rename(tempPath, s.infoPath(upload.ID)); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+	return nil
+}
+
+func (s *TusService) cleanupExpiredUploads() {
+	entries, err := os.ReadDir(s.stagingRoot)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(s.infoPath(entry.Name()))
+		if err != nil {
+			continue
+		}
+		upload := &TusUpload{}
+		if json.Unmarshal(data, upload) != nil || now.After(upload.ExpiresAt) {
+			os.RemoveAll(s.uploadDir(entry.Name()))
+		}
+	}
+}
+
+func (s *TusService) uploadLock(id string) *sync.Mutex {
+	lock, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+func (s *TusService) uploadTTL() time.Duration {
+	hours := s.cfg.Server.Upload.SessionTTLHours
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (s *TusService) uploadDir(id string) string {
+	return filepath.Join(s.stagingRoot, id)
+}
+
+func (s *TusService) infoPath(id string) string {
+	return filepath.Join(s.uploadDir(id), "info.json")
+}
+
+func (s *TusService) dataPath(id string) string {
+	return filepath.Join(s.uploadDir(id), "data")
+}
+
+// ParseTusMetadata decodes an Upload-Metadata header: comma separated
+// "key base64value" pairs, where the value may be omitted
+func ParseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, ErrTusInvalidMetadata
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, ErrTusInvalidMetadata
+		}
+	}
+
+	return metadata, nil
+}
+
+// parseTusChecksum parses an Upload-Checksum header of the form "<algorithm> <base64 digest>"
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return nil, nil, ErrTusInvalidChecksum
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, ErrTusInvalidChecksum
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "sha1":
+		return sha1.New(), sum, nil
+	case "sha256":
+		return sha256.New(), sum, nil
+	case "md5":
+		return md5.New(), sum, nil
+	default:
+		return nil, nil, ErrTusUnsupportedAlgo
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+const (
+	// uploadEventBuffer is the number of events queued per subscriber before progress updates are dropped
+	uploadEventBuffer = 64
+
+	// uploadEventRetention is how long a finished stream can still be replayed to late subscribers
+	uploadEventRetention = 5 * time.Minute
+)
+
+// UploadEventBroker fans out upload progress events to Server-Sent Events subscribers.
+// Each stream keeps its latest progress event and every file and final event, so a
+// client that subscribes late, or reconnects, still sees the full outcome.
+type UploadEventBroker struct {
+	mu      sync.Mutex
+	streams map[string]*uploadEventStream
+}
+
+type uploadEventStream struct {
+	ownerID      int64
+	claimed      bool
+	subscribers  map[chan models.UploadEvent]struct{}
+	lastProgress *models.UploadEvent
+	history      []models.UploadEvent
+	nextID       int64
+	finishedAt   time.Time
+}
+
+// NewUploadEventBroker creates an empty broker
+func NewUploadEventBroker() *UploadEventBroker {
+	return &UploadEventBroker{
+		streams: make(map[string]*uploadEventStream),
+	}
+}
+
+// Claim makes ownerID the owner of the stream of an upload unless another user claimed it
+// first, and returns the owner. IDs are chosen by clients, so the stream belongs to whoever
+// subscribes to it or uploads with it first.
+func (b *UploadEventBroker) Claim(uploadID string, ownerID int64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(uploadID)
+	if !stream.claimed {
+		stream.ownerID = ownerID
+		stream.claimed = true
+	}
+	return stream.ownerID
+}
+
+// Subscribe returns a channel receiving the events of an upload, starting with a replay of
+// what was already published. The channel is closed after the final event has been delivered
+// or when unsubscribe is called.
+func (b *UploadEventBroker) Subscribe(uploadID string) (<-chan models.UploadEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(uploadID)
+	replay := stream.replay()
+
+	ch := make(chan models.UploadEvent, len(replay)+uploadEventBuffer)
+	for _, event := range replay {
+		ch <- event
+	}
+
+	if !stream.finishedAt.IsZero() {
+		close(ch)
+		return ch, func() {}
+	}
+
+	stream.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := stream.subscribers[ch]; ok {
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+		// Streams nobody published to are only kept alive by their subscribers
+		if len(stream.subscribers) == 0 && stream.nextID == 0 {
+			delete(b.streams, uploadID)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish sends an event to every subscriber of the upload. Complete and error events
+// end the stream. Progress events are dropped for subscribers that fall behind.
+func (b *UploadEventBroker) Publish(uploadID string, event models.UploadEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(uploadID)
+	if !stream.finishedAt.IsZero() {
+		return
+	}
+
+	stream.nextID++
+	event.ID = stream.nextID
+	event.UploadID = uploadID
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().UnixMilli()
+	}
+
+	if event.Type == models.UploadEventProgress {
+		stream.lastProgress = &event
+	} else {
+		stream.history = append(stream.history, event)
+	}
+
+	final := event.Type == models.UploadEventComplete || event.Type == models.UploadEventError
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A stalled client must not block the upload. Progress updates are
+			// superseded by later ones, other events are replayed on reconnect.
+		}
+		if final {
+			close(ch)
+			delete(stream.subscribers, ch)
+		}
+	}
+
+	if final {
+		stream.finishedAt = time.Now()
+	}
+}
+
+// stream returns the stream for an upload, creating it if needed. Callers must hold b.mu.
+func (b *UploadEventBroker) stream(uploadID string) *uploadEventStream {
+	stream, exists := b.streams[uploadID]
+	if !exists {
+		b.evictFinished()
+		stream = &uploadEventStream{
+			subscribers: make(map[chan models.UploadEvent]struct{}),
+		}
+		b.streams[uploadID] = stream
+	}
+	return stream
+}
+
+// evictFinished drops finished streams older than uploadEventRetention. Callers must hold b.mu.
+func (b *UploadEventBroker) evictFinished() {
+	cutoff := time.Now().Add(-uploadEventRetention)
+	for id, stream := range b.streams {
+		if !stream.finishedAt.IsZero() && stream.finishedAt.Before(cutoff) {
+			delete(b.streams, id)
+		}
+	}
+}
+
+// replay returns the published events in order, with only the latest progress update
+func (s *uploadEventStream) replay() []models.UploadEvent {
+	events := make([]models.UploadEvent, 0, len(s.history)+1)
+	progressAdded := s.lastProgress == nil
+
+	for _, event := range s.history {
+		if !progressAdded && s.lastProgress.ID < event.ID {
+			events = append(events, *s.lastProgress)
+			progressAdded = true
+		}
+		events = append(events, event)
+	}
+	if !progressAdded {
+		events = append(events, *s.lastProgress)
+	}
+
+	return events
+}
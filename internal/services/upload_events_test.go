@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/anddsdev/cloudlet/internal/models"
+)
+
+func drainUploadEvents(events <-chan models.UploadEvent) []models.UploadEvent {
+	var received []models.UploadEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	return received
+}
+
+func TestUploadEventBroker_LiveSubscriber(t *testing.T) {
+	broker := NewUploadEventBroker()
+
+	events, unsubscribe := broker.Subscribe("upload-1")
+	defer unsubscribe()
+
+	broker.Publish("upload-1", models.UploadEvent{Type: models.UploadEventProgress, BytesProcessed: 10})
+	broker.Publish("upload-1", models.UploadEvent{Type: models.UploadEventFile, Filename: "a.txt"})
+	broker.Publish("upload-1", models.UploadEvent{Type: models.UploadEventComplete})
+
+	received := drainUploadEvents(events)
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(received))
+	}
+	for i, event := range received {
+		if event.ID != int64(i+1) || event.UploadID != "upload-1" || event.Timestamp == 0 {
+			t.Errorf("Unexpected event %d: %+v", i, event)
+		}
+	}
+	if received[2].Type != models.UploadEventComplete {
+		t.Errorf("Expected stream to end with complete, got %s", received[2].Type)
+	}
+
+	// Nothing is accepted once the stream has finished
+	broker.Publish("upload-1", models.UploadEvent{Type: models.UploadEventProgress})
+	if replay := drainUploadEvents(mustSubscribe(broker, "upload-1")); len(replay) != 3 {
+		t.Errorf("Expected 3 replayed events, got %d", len(replay))
+	}
+}
+
+func TestUploadEventBroker_ReplayKeepsLatestProgress(t *testing.T) {
+	broker := NewUploadEventBroker()
+
+	broker.Publish("upload-2", models.UploadEvent{Type: models.UploadEventProgress, BytesProcessed: 1})
+	broker.Publish("upload-2", models.UploadEvent{Type: models.UploadEventFile, Filename: "a.txt"})
+	broker.Publish("upload-2", models.UploadEvent{Type: models.UploadEventProgress, BytesProcessed: 2})
+	broker.Publish("upload-2", models.UploadEvent{Type: models.UploadEventProgress, BytesProcessed: 3})
+
+	events, unsubscribe := broker.Subscribe("upload-2")
+	broker.Publish("upload-2", models.UploadEvent{Type: models.UploadEventError, Message: "boom"})
+	received := drainUploadEvents(events)
+	unsubscribe()
+
+	if len(received) != 3 {
+		t.Fatalf("Expected file, latest progress and error events, got %+v", received)
+	}
+	if received[0].Type != models.UploadEventFile {
+		t.Errorf("Expected file event first, got %s", received[0].Type)
+	}
+	if received[1].Type != models.UploadEventProgress || received[1].BytesProcessed != 3 {
+		t.Errorf("Expected latest progress event, got %+v", received[1])
+	}
+	if received[2].Type != models.UploadEventError || received[2].Message != "boom" {
+		t.Errorf("Expected error event, got %+v", received[2])
+	}
+}
+
+func mustSubscribe(broker *UploadEventBroker, uploadID string) <-chan models.UploadEvent {
+	events, _ := broker.Subscribe(uploadID)
+	return events
+}
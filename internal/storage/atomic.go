@@ -1,16 +1,26 @@
 package storage
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/anddsdev/cloudlet/internal/metrics"
+	"github.com/anddsdev/cloudlet/internal/tracing"
 	"github.com/google/uuid"
 )
 
+// ErrChecksumMismatch is returned when written data does not match the expected SHA-256
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
 // AtomicFileOperations provides thread-safe, atomic file operations
 type AtomicFileOperations struct {
 	// Mutex map for file-level locking
@@ -100,6 +110,12 @@ func (afo *AtomicFileOperations) generateUniqueTempPath(targetPath string) strin
 
 // AtomicWriteFile writes data to a file atomically
 func (afo *AtomicFileOperations) AtomicWriteFile(targetPath string, data []byte, perm os.FileMode) error {
+	return afo.AtomicWriteFileContext(context.Background(), targetPath, data, perm)
+}
+
+// AtomicWriteFileContext is AtomicWriteFile tracing the temporary file write and the rename
+// as children of the span in ctx
+func (afo *AtomicFileOperations) AtomicWriteFileContext(ctx context.Context, targetPath string, data []byte, perm os.FileMode) error {
 	// Get file-specific lock
 	lock := afo.getFileLock(targetPath)
 	lock.mu.Lock()
@@ -118,14 +134,18 @@ func (afo *AtomicFileOperations) AtomicWriteFile(targetPath string, data []byte,
 	}
 
 	// Write to temporary file
-	if err := os.WriteFile(tempPath, data, perm); err != nil {
+	_, span := tracing.Start(ctx, "AtomicFileOperations.WriteTemp", tracing.Int("file.size", len(data)))
+	err := os.WriteFile(tempPath, data, perm)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
 		// Cleanup temp file if write failed
 		os.Remove(tempPath)
 		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
 
 	// Atomically move temp file to target location
-	if err := os.Rename(tempPath, targetPath); err != nil {
+	if err := afo.renameTemp(ctx, tempPath, targetPath); err != nil {
 		// Cleanup temp file if rename failed
 		os.Remove(tempPath)
 		return fmt.Errorf("failed to move temporary file to target: %w", err)
@@ -134,8 +154,32 @@ func (afo *AtomicFileOperations) AtomicWriteFile(targetPath string, data []byte,
 	return nil
 }
 
+// renameTemp moves a written temporary file over its target
+func (afo *AtomicFileOperations) renameTemp(ctx context.Context, tempPath, targetPath string) error {
+	_, span := tracing.Start(ctx, "AtomicFileOperations.Rename")
+	defer span.End()
+
+	err := os.Rename(tempPath, targetPath)
+	span.RecordError(err)
+	return err
+}
+
 // AtomicWriteFileStream writes from an io.Reader to a file atomically
 func (afo *AtomicFileOperations) AtomicWriteFileStream(targetPath string, reader io.Reader, perm os.FileMode) error {
+	_, err := afo.AtomicWriteFileStreamChecksum(targetPath, reader, perm, "")
+	return err
+}
+
+// AtomicWriteFileStreamChecksum writes from an io.Reader to a file atomically and returns the
+// hex SHA-256 of the data, computed while it is copied. When expectedChecksum is set and does
+// not match, the temporary file is discarded and ErrChecksumMismatch is returned.
+func (afo *AtomicFileOperations) AtomicWriteFileStreamChecksum(targetPath string, reader io.Reader, perm os.FileMode, expectedChecksum string) (string, error) {
+	return afo.AtomicWriteFileStreamChecksumContext(context.Background(), targetPath, reader, perm, expectedChecksum)
+}
+
+// AtomicWriteFileStreamChecksumContext is AtomicWriteFileStreamChecksum tracing the temporary
+// file write and the rename as children of the span in ctx
+func (afo *AtomicFileOperations) AtomicWriteFileStreamChecksumContext(ctx context.Context, targetPath string, reader io.Reader, perm os.FileMode, expectedChecksum string) (string, error) {
 	// Get file-specific lock
 	lock := afo.getFileLock(targetPath)
 	lock.mu.Lock()
@@ -150,36 +194,47 @@ func (afo *AtomicFileOperations) AtomicWriteFileStream(targetPath string, reader
 	// Ensure target directory exists
 	targetDir := filepath.Dir(targetPath)
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
+		return "", fmt.Errorf("failed to create target directory: %w", err)
 	}
 
 	// Create temporary file
 	tempFile, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %w", err)
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
 	}
 
-	// Copy data from reader to temp file
-	_, err = io.Copy(tempFile, reader)
+	// Copy data from reader to temp file, hashing it on the way
+	_, span := tracing.Start(ctx, "AtomicFileOperations.WriteTemp")
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tempFile, hasher), reader)
 	closeErr := tempFile.Close()
+	span.SetAttributes(tracing.Int64("file.size", written))
+	span.RecordError(errors.Join(err, closeErr))
+	span.End()
 
 	if err != nil {
 		os.Remove(tempPath)
-		return fmt.Errorf("failed to write data to temporary file: %w", err)
+		return "", fmt.Errorf("failed to write data to temporary file: %w", err)
 	}
 
 	if closeErr != nil {
 		os.Remove(tempPath)
-		return fmt.Errorf("failed to close temporary file: %w", closeErr)
+		return "", fmt.Errorf("failed to close temporary file: %w", closeErr)
+	}
+
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, checksum)
 	}
 
 	// Atomically move temp file to target location
-	if err := os.Rename(tempPath, targetPath); err != nil {
+	if err := afo.renameTemp(ctx, tempPath, targetPath); err != nil {
 		os.Remove(tempPath)
-		return fmt.Errorf("failed to move temporary file to target: %w", err)
+		return "", fmt.Errorf("failed to move temporary file to target: %w", err)
 	}
 
-	return nil
+	return checksum, nil
 }
 
 // AtomicMoveFile moves a file atomically with proper locking
@@ -282,6 +337,11 @@ func (afo *AtomicFileOperations) SafeOpenFile(filePath string) (*os.File, error)
 	return file, err
 }
 
+// TempDir returns the directory used to stage temporary files
+func (afo *AtomicFileOperations) TempDir() string {
+	return afo.tempDir
+}
+
 // cleanupRoutine runs periodically to clean up orphaned temporary files
 func (afo *AtomicFileOperations) cleanupRoutine() {
 	for {
@@ -313,7 +373,9 @@ func (afo *AtomicFileOperations) cleanupOrphanedTempFiles() {
 			}
 
 			if info.ModTime().Before(cutoff) {
-				os.Remove(fullPath) // Best effort cleanup
+				if os.Remove(fullPath) == nil { // Best effort cleanup
+					metrics.OrphanedTempFilesRemoved.Inc()
+				}
 			}
 		}
 	}
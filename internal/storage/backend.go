@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// Storage backend drivers selectable in the configuration
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// StorageBackend stores file contents. Paths are slash separated and relative to the
+// storage root, in the same form as the paths recorded in the database.
+type StorageBackend interface {
+	// Save writes data to path, replacing existing content, and returns its hex SHA-256.
+	// Nothing is written when expectedChecksum is set and does not match.
+	Save(path string, data []byte, expectedChecksum string) (string, error)
+
+	// SaveStream writes everything read from reader to path like Save, hashing while streaming
+	SaveStream(path string, reader io.Reader, expectedChecksum string) (string, error)
+
+	// Open opens a stored file for reading. Missing files return an fs.ErrNotExist error.
+	Open(path string) (File, error)
+
+	// Stat describes a stored file or directory
+	Stat(path string) (fs.FileInfo, error)
+
+	// Move renames a file or a directory with everything below it
+	Move(oldPath, newPath string) error
+
+	// Delete removes a file or a directory with everything below it. Missing paths are not an error.
+	Delete(path string) error
+
+	// MakeDir creates a directory. Backends without real directories treat it as a no-op.
+	MakeDir(path string) error
+
+	// List returns the paths of all files below prefix
+	List(prefix string) ([]string, error)
+
+	// Close releases the resources held by the backend
+	Close() error
+}
+
+// File is an open stored file. It is seekable so downloads can serve Range requests.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// FileImporter is implemented by backends that can take over a local file without copying it
+type FileImporter interface {
+	// Import moves the local file at localPath to path
+	Import(localPath, path string) error
+}
+
+// ContextSaver is implemented by backends that trace the steps of their writes. SaveContext
+// and SaveStreamContext behave like Save and SaveStream, recording their steps as children
+// of the span in ctx.
+type ContextSaver interface {
+	SaveContext(ctx context.Context, path string, data []byte, expectedChecksum string) (string, error)
+	SaveStreamContext(ctx context.Context, path string, reader io.Reader, expectedChecksum string) (string, error)
+}
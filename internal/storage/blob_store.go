@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidBlobKey is returned for keys that are not a hex encoded SHA-256
+var ErrInvalidBlobKey = errors.New("invalid blob key")
+
+// blobRoot is the storage path below which blobs are kept
+const blobRoot = "/.cloudlet-blobs"
+
+// BlobStore keeps file contents once, addressed by their SHA-256. Blobs are written
+// in two steps: Stage streams the data into a local staging directory while hashing it,
+// and Commit hands it to the backend unless an identical blob is already stored.
+type BlobStore struct {
+	backend    StorageBackend
+	stagingDir string
+}
+
+// StagedBlob is data written to the staging directory and not yet committed
+type StagedBlob struct {
+	Checksum string
+	Size     int64
+	tempPath string
+}
+
+// NewBlobStore creates a blob store on backend that stages data in stagingDir
+func NewBlobStore(backend StorageBackend, stagingDir string) *BlobStore {
+	return &BlobStore{
+		backend:    backend,
+		stagingDir: stagingDir,
+	}
+}
+
+// Stage writes reader to a temporary file and hashes it. When expectedChecksum is set and
+// does not match, the data is discarded and ErrChecksumMismatch is returned.
+func (bs *BlobStore) Stage(reader io.Reader, expectedChecksum string) (*StagedBlob, error) {
+	// Named like the other staged files so abandoned ones are cleaned up with them
+	tempPath := filepath.Join(bs.stagingDir, fmt.Sprintf("blob.%d.%s.tmp", time.Now().Unix(), uuid.New().String()))
+
+	tempFile, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), reader)
+	closeErr := tempFile.Close()
+
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to write data to temporary file: %w", err)
+	}
+	if closeErr != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to close temporary file: %w", closeErr)
+	}
+
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, checksum)
+	}
+
+	return &StagedBlob{Checksum: checksum, Size: size, tempPath: tempPath}, nil
+}
+
+// Commit moves a staged blob into the store. If the content is already stored the
+// staged copy is dropped instead, which is what makes duplicate uploads free.
+// Concurrent commits of the same content are harmless since they write identical data.
+func (bs *BlobStore) Commit(staged *StagedBlob) error {
+	target := bs.blobPath(staged.Checksum)
+
+	if _, err := bs.backend.Stat(target); err == nil {
+		return staged.Discard()
+	} else if !os.IsNotExist(err) {
+		staged.Discard()
+		return fmt.Errorf("failed to check for existing blob: %w", err)
+	}
+
+	if importer, ok := bs.backend.(FileImporter); ok {
+		if err := importer.Import(staged.tempPath, target); err != nil {
+			staged.Discard()
+			return fmt.Errorf("failed to move blob into place: %w", err)
+		}
+		staged.tempPath = ""
+		return nil
+	}
+
+	file, err := os.Open(staged.tempPath)
+	if err != nil {
+		staged.Discard()
+		return err
+	}
+	_, err = bs.backend.SaveStream(target, file, staged.Checksum)
+	file.Close()
+	staged.Discard()
+	if err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// Discard removes a staged blob that was not committed. It is safe to call after Commit.
+func (staged *StagedBlob) Discard() error {
+	if staged.tempPath == "" {
+		return nil
+	}
+
+	err := os.Remove(staged.tempPath)
+	staged.tempPath = ""
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Open opens a stored blob for reading
+func (bs *BlobStore) Open(checksum string) (File, error) {
+	if !isBlobKey(checksum) {
+		return nil, ErrInvalidBlobKey
+	}
+	return bs.backend.Open(bs.blobPath(checksum))
+}
+
+// Read returns the content of a stored blob
+func (bs *BlobStore) Read(checksum string) ([]byte, error) {
+	file, err := bs.Open(checksum)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// Delete removes a blob and returns the number of bytes freed
+func (bs *BlobStore) Delete(checksum string) (int64, error) {
+	if !isBlobKey(checksum) {
+		return 0, ErrInvalidBlobKey
+	}
+
+	path := bs.blobPath(checksum)
+	info, err := bs.backend.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := bs.backend.Delete(path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// List returns the keys of all stored blobs
+func (bs *BlobStore) List() ([]string, error) {
+	paths, err := bs.backend.List(blobRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, path := range paths {
+		if name := filepath.Base(path); isBlobKey(name) {
+			keys = append(keys, name)
+		}
+	}
+	return keys, nil
+}
+
+// blobPath fans blobs out over subdirectories named after the first two hex digits
+func (bs *BlobStore) blobPath(checksum string) string {
+	checksum = strings.ToLower(checksum)
+	return blobRoot + "/" + checksum[:2] + "/" + checksum
+}
+
+func isBlobKey(key string) bool {
+	decoded, err := hex.DecodeString(key)
+	return err == nil && len(decoded) == sha256.Size
+}
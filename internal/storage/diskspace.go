@@ -0,0 +1,11 @@
+package storage
+
+import "errors"
+
+// ErrFreeSpaceUnsupported is returned by FreeSpace where free disk space cannot be measured
+var ErrFreeSpaceUnsupported = errors.New("free disk space cannot be measured on this platform")
+
+// FreeSpace returns the bytes available to the server on the filesystem holding path
+func FreeSpace(path string) (uint64, error) {
+	return freeSpace(path)
+}
@@ -0,0 +1,7 @@
+//go:build !unix && !windows
+
+package storage
+
+func freeSpace(path string) (uint64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/security"
+)
+
+// LocalBackend stores files in a directory tree on the local filesystem. Writes go
+// through AtomicFileOperations, so readers never observe partially written files.
+type LocalBackend struct {
+	basePath      string
+	pathValidator *security.PathValidator
+	atomicOps     *AtomicFileOperations
+}
+
+// NewLocalBackend creates a backend rooted at basePath that writes through atomicOps
+func NewLocalBackend(basePath string, atomicOps *AtomicFileOperations) *LocalBackend {
+	os.MkdirAll(basePath, 0755)
+
+	return &LocalBackend{
+		basePath:      basePath,
+		pathValidator: security.NewPathValidator(basePath).AllowingReservedNames(),
+		atomicOps:     atomicOps,
+	}
+}
+
+func (b *LocalBackend) Save(path string, data []byte, expectedChecksum string) (string, error) {
+	return b.SaveContext(context.Background(), path, data, expectedChecksum)
+}
+
+func (b *LocalBackend) SaveContext(ctx context.Context, path string, data []byte, expectedChecksum string) (string, error) {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, checksum)
+	}
+
+	if err := b.atomicOps.AtomicWriteFileContext(ctx, fullPath, data, 0644); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+func (b *LocalBackend) SaveStream(path string, reader io.Reader, expectedChecksum string) (string, error) {
+	return b.SaveStreamContext(context.Background(), path, reader, expectedChecksum)
+}
+
+func (b *LocalBackend) SaveStreamContext(ctx context.Context, path string, reader io.Reader, expectedChecksum string) (string, error) {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	return b.atomicOps.AtomicWriteFileStreamChecksumContext(ctx, fullPath, reader, 0644, expectedChecksum)
+}
+
+func (b *LocalBackend) Open(path string) (File, error) {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := b.atomicOps.SafeOpenFile(fullPath)
+	if err != nil {
+		// Avoid wrapping a nil *os.File in a non-nil File
+		return nil, err
+	}
+	return file, nil
+}
+
+func (b *LocalBackend) Stat(path string) (fs.FileInfo, error) {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(fullPath)
+}
+
+func (b *LocalBackend) Move(oldPath, newPath string) error {
+	fullOldPath, err := b.FullPath(oldPath)
+	if err != nil {
+		return fmt.Errorf("invalid old path: %w", err)
+	}
+
+	fullNewPath, err := b.FullPath(newPath)
+	if err != nil {
+		return fmt.Errorf("invalid new path: %w", err)
+	}
+
+	return b.atomicOps.AtomicMoveFile(fullOldPath, fullNewPath)
+}
+
+func (b *LocalBackend) Delete(path string) error {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return b.atomicOps.AtomicDeleteFile(fullPath)
+}
+
+func (b *LocalBackend) MakeDir(path string) error {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(fullPath, 0755)
+}
+
+func (b *LocalBackend) List(prefix string) ([]string, error) {
+	root, err := b.FullPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if fullPath == root && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.basePath, fullPath)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, "/"+filepath.ToSlash(rel))
+		return nil
+	})
+
+	return paths, err
+}
+
+// Import moves a staged file into place with a rename instead of copying it
+func (b *LocalBackend) Import(localPath, path string) error {
+	fullPath, err := b.FullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return b.atomicOps.AtomicMoveFile(localPath, fullPath)
+}
+
+// Close is a no-op; the atomic operations are owned by whoever created them
+func (b *LocalBackend) Close() error {
+	return nil
+}
+
+// FullPath validates path and returns its location on disk
+func (b *LocalBackend) FullPath(path string) (string, error) {
+	fullPath, err := b.pathValidator.ValidateAndGetFullPath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	return fullPath, nil
+}
@@ -0,0 +1,826 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// S3Options configures an S3Backend
+type S3Options struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Prefix is prepended to every object key, so several instances can share a bucket
+	Prefix string
+
+	// UsePathStyle addresses the bucket as endpoint/bucket instead of bucket.endpoint,
+	// which is what MinIO and most self-hosted servers expect
+	UsePathStyle bool
+
+	// StagingDir holds uploads while they are hashed, since S3 needs the length and
+	// checksum of an object before it is sent
+	StagingDir string
+
+	// PartSize is the size of the parts objects larger than it are uploaded and copied in,
+	// as S3 takes at most 5 GiB in a single PUT or copy. S3 needs parts of at least 5 MiB.
+	// It defaults to 64 MiB.
+	PartSize int64
+
+	// HTTPClient defaults to a client without timeout, so large transfers are not cut off
+	HTTPClient *http.Client
+}
+
+// S3Error is an error response returned by the S3 service
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+const (
+	defaultS3PartSize = 64 << 20
+	// maxS3Parts is the number of parts a multipart upload may have at most
+	maxS3Parts = 10000
+)
+
+// S3Backend stores files as objects in an S3-compatible bucket. Object keys are the
+// file paths without their leading slash; directories only exist implicitly as key prefixes.
+type S3Backend struct {
+	endpoint   *url.URL
+	bucket     string
+	prefix     string
+	pathStyle  bool
+	stagingDir string
+	partSize   int64
+	client     *http.Client
+	signer     *s3Signer
+}
+
+// NewS3Backend validates opts and creates a backend for the bucket. It does not contact the service.
+func NewS3Backend(opts S3Options) (*S3Backend, error) {
+	if opts.Endpoint == "" {
+		return nil, errors.New("s3 endpoint is required")
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if opts.StagingDir == "" {
+		return nil, errors.New("s3 staging directory is required")
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", opts.Endpoint)
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = defaultS3PartSize
+	}
+
+	if err := os.MkdirAll(opts.StagingDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	return &S3Backend{
+		endpoint:   endpoint,
+		bucket:     opts.Bucket,
+		prefix:     prefix,
+		pathStyle:  opts.UsePathStyle,
+		stagingDir: opts.StagingDir,
+		partSize:   partSize,
+		client:     client,
+		signer: &s3Signer{
+			accessKeyID:     opts.AccessKeyID,
+			secretAccessKey: opts.SecretAccessKey,
+			region:          region,
+		},
+	}, nil
+}
+
+func (b *S3Backend) Save(path string, data []byte, expectedChecksum string) (string, error) {
+	key, err := b.objectKey(path)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := hashHex(data)
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, checksum)
+	}
+
+	if err := b.putObject(key, bytes.NewReader(data), int64(len(data)), checksum); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+func (b *S3Backend) SaveStream(path string, reader io.Reader, expectedChecksum string) (string, error) {
+	key, err := b.objectKey(path)
+	if err != nil {
+		return "", err
+	}
+
+	tempPath := filepath.Join(b.stagingDir, fmt.Sprintf("s3.%d.%s.tmp", time.Now().Unix(), uuid.New().String()))
+	tempFile, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath)
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to write data to temporary file: %w", err)
+	}
+
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, checksum)
+	}
+
+	if err := b.putObject(key, tempFile, size, checksum); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// Import uploads a local file and removes it afterwards
+func (b *S3Backend) Import(localPath, path string) error {
+	key, err := b.objectKey(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return err
+	}
+
+	if err := b.putObject(key, file, size, hex.EncodeToString(hasher.Sum(nil))); err != nil {
+		return err
+	}
+
+	file.Close()
+	return os.Remove(localPath)
+}
+
+// Open returns a reader that fetches the object lazily with ranged GET requests, so
+// seeking to serve a Range request does not download the skipped part
+func (b *S3Backend) Open(path string) (File, error) {
+	info, err := b.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+	}
+
+	key, _ := b.objectKey(path)
+	return &s3Object{backend: b, key: key, info: info.(*s3FileInfo)}, nil
+}
+
+func (b *S3Backend) Stat(path string) (fs.FileInfo, error) {
+	key, err := b.objectKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := pathBase(path)
+	if key == b.prefix {
+		return &s3FileInfo{name: name, dir: true}, nil
+	}
+
+	resp, err := b.do(http.MethodHead, key, nil, nil, nil, -1, emptyPayloadHash)
+	if err == nil {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &s3FileInfo{name: name, size: resp.ContentLength, modTime: modTime}, nil
+	}
+	if !isS3NotFound(err) {
+		return nil, err
+	}
+
+	// There is no object, but there may be objects below it
+	keys, err := b.listKeys(key+"/", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return &s3FileInfo{name: name, dir: true}, nil
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+}
+
+func (b *S3Backend) Move(oldPath, newPath string) error {
+	oldKey, err := b.objectKey(oldPath)
+	if err != nil {
+		return fmt.Errorf("invalid old path: %w", err)
+	}
+	newKey, err := b.objectKey(newPath)
+	if err != nil {
+		return fmt.Errorf("invalid new path: %w", err)
+	}
+
+	// Directories only exist through the objects below them, so an empty directory looks
+	// like a missing path and moving it leaves nothing to do
+	info, err := b.Stat(oldPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := b.copyObject(oldKey, newKey, info.Size()); err != nil {
+			return err
+		}
+		if err := b.deleteObject(oldKey); err != nil {
+			b.deleteObject(newKey)
+			return err
+		}
+		return nil
+	}
+
+	// S3 has no rename, so a directory is moved object by object. A move failing part way
+	// is undone, so the directory ends up either moved or where it was.
+	objects, err := b.listObjects(oldKey+"/", 0)
+	if err != nil {
+		return err
+	}
+	target := func(key string) string {
+		return newKey + strings.TrimPrefix(key, oldKey)
+	}
+	for i, object := range objects {
+		if err := b.copyObject(object.key, target(object.key), object.size); err != nil {
+			b.undoMove(objects[:i], 0, target)
+			return err
+		}
+	}
+	for i, object := range objects {
+		if err := b.deleteObject(object.key); err != nil {
+			b.undoMove(objects, i, target)
+			return err
+		}
+	}
+	return nil
+}
+
+// undoMove puts back the objects of a directory move that failed after they were copied to
+// target and the first deleted of them were deleted: those are copied back, then the
+// copies are deleted. Copies that cannot be copied back are kept, so nothing is lost.
+func (b *S3Backend) undoMove(objects []objectSummary, deleted int, target func(string) string) {
+	for i, object := range objects {
+		if i < deleted {
+			if err := b.copyObject(target(object.key), object.key, object.size); err != nil {
+				continue
+			}
+		}
+		b.deleteObject(target(object.key))
+	}
+}
+
+func (b *S3Backend) Delete(path string) error {
+	key, err := b.objectKey(path)
+	if err != nil {
+		return err
+	}
+
+	dirPrefix := key + "/"
+	if key == b.prefix {
+		dirPrefix = b.prefix
+	} else if err := b.deleteObject(key); err != nil {
+		return err
+	}
+
+	keys, err := b.listKeys(dirPrefix, 0)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := b.deleteObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MakeDir is a no-op because S3 directories only exist as prefixes of the objects below them
+func (b *S3Backend) MakeDir(path string) error {
+	_, err := b.objectKey(path)
+	return err
+}
+
+func (b *S3Backend) List(prefix string) ([]string, error) {
+	key, err := b.objectKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key != b.prefix {
+		key += "/"
+	}
+
+	keys, err := b.listKeys(key, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = "/" + strings.TrimPrefix(key, b.prefix)
+	}
+	return paths, nil
+}
+
+// Close drops idle connections to the service
+func (b *S3Backend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// objectKey converts a storage path into an object key
+func (b *S3Backend) objectKey(p string) (string, error) {
+	if p == "" || strings.ContainsAny(p, "\x00\r\n") {
+		return "", fmt.Errorf("invalid path: %q", p)
+	}
+
+	p = strings.ReplaceAll(p, "\\", "/")
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid path: %q", p)
+		}
+	}
+
+	return b.prefix + strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// putObject uploads the size bytes of body whose SHA-256 is payloadHash, in parts when
+// they are more than the part size
+func (b *S3Backend) putObject(key string, body io.ReaderAt, size int64, payloadHash string) error {
+	if size > b.partSize {
+		if err := b.multipartUpload(key, body, size); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		return nil
+	}
+
+	resp, err := b.do(http.MethodPut, key, nil, nil, io.NewSectionReader(body, 0, size), size, payloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// copyObject copies the object at sourceKey, of size bytes, in parts when they are more
+// than the part size
+func (b *S3Backend) copyObject(sourceKey, targetKey string, size int64) error {
+	if size > b.partSize {
+		if err := b.multipartCopy(sourceKey, targetKey, size); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", sourceKey, targetKey, err)
+		}
+		return nil
+	}
+
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", b.copySource(sourceKey))
+
+	resp, err := b.do(http.MethodPut, targetKey, nil, header, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", sourceKey, targetKey, err)
+	}
+	defer resp.Body.Close()
+
+	// A copy can fail after the 200 status has been sent, in which case the body holds the error
+	if _, err := readS3Result(resp); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", sourceKey, targetKey, err)
+	}
+	return nil
+}
+
+func (b *S3Backend) copySource(key string) string {
+	return "/" + b.bucket + "/" + s3Escape(key, false)
+}
+
+// multipartUpload uploads the size bytes of body part by part
+func (b *S3Backend) multipartUpload(key string, body io.ReaderAt, size int64) error {
+	return b.multipart(key, size, func(query url.Values, offset, length int64) (string, error) {
+		part := io.NewSectionReader(body, offset, length)
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, part); err != nil {
+			return "", err
+		}
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+
+		resp, err := b.do(http.MethodPut, key, query, nil, part, length, hex.EncodeToString(hasher.Sum(nil)))
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.Header.Get("ETag"), nil
+	})
+}
+
+// multipartCopy copies the size bytes of the object at sourceKey range by range
+func (b *S3Backend) multipartCopy(sourceKey, targetKey string, size int64) error {
+	return b.multipart(targetKey, size, func(query url.Values, offset, length int64) (string, error) {
+		header := http.Header{}
+		header.Set("X-Amz-Copy-Source", b.copySource(sourceKey))
+		header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+		resp, err := b.do(http.MethodPut, targetKey, query, header, nil, 0, emptyPayloadHash)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := readS3Result(resp)
+		if err != nil {
+			return "", err
+		}
+		var result struct {
+			ETag string `xml:"ETag"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return "", fmt.Errorf("failed to decode copied part: %w", err)
+		}
+		return result.ETag, nil
+	})
+}
+
+// completedPart is a part of a multipart upload as CompleteMultipartUpload lists it
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipart writes the size bytes of the object at key as a multipart upload. sendPart
+// sends the part of length bytes at offset as the upload part identified by query and
+// returns its ETag. A failed upload is aborted, so its parts are not kept in the bucket.
+func (b *S3Backend) multipart(key string, size int64, sendPart func(query url.Values, offset, length int64) (string, error)) error {
+	resp, err := b.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, -1, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	if initiated.UploadID == "" {
+		return errors.New("failed to start multipart upload: no upload ID returned")
+	}
+
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+	if err := b.sendParts(key, upload, size, sendPart); err != nil {
+		if resp, abortErr := b.do(http.MethodDelete, key, upload, nil, nil, -1, emptyPayloadHash); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *S3Backend) sendParts(key string, upload url.Values, size int64, sendPart func(query url.Values, offset, length int64) (string, error)) error {
+	partSize := max(b.partSize, (size+maxS3Parts-1)/maxS3Parts)
+
+	var parts []completedPart
+	for offset := int64(0); offset < size; offset += partSize {
+		number := len(parts) + 1
+		query := url.Values{"uploadId": upload["uploadId"], "partNumber": {strconv.Itoa(number)}}
+		etag, err := sendPart(query, offset, min(partSize, size-offset))
+		if err != nil {
+			return fmt.Errorf("failed to send part %d: %w", number, err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.do(http.MethodPost, key, upload, nil, bytes.NewReader(body), int64(len(body)), hashHex(body))
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Like a copy, completing can fail after the 200 status has been sent
+	if _, err := readS3Result(resp); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// readS3Result reads the body of a response whose 200 status does not mean success,
+// returning the error it holds instead when there is one
+func readS3Result(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if s3Err := parseS3Error(resp.StatusCode, body); s3Err.Code != "" {
+		return nil, s3Err
+	}
+	return body, nil
+}
+
+func (b *S3Backend) deleteObject(key string) error {
+	resp, err := b.do(http.MethodDelete, key, nil, nil, nil, -1, emptyPayloadHash)
+	if err != nil && !isS3NotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// objectSummary is an object as a listing describes it
+type objectSummary struct {
+	key  string
+	size int64
+}
+
+// listKeys returns the keys of the objects starting with prefix, at most limit of them when limit > 0
+func (b *S3Backend) listKeys(prefix string, limit int) ([]string, error) {
+	objects, err := b.listObjects(prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.key
+	}
+	return keys, nil
+}
+
+// listObjects returns the objects whose key starts with prefix, at most limit of them when limit > 0
+func (b *S3Backend) listObjects(prefix string, limit int) ([]objectSummary, error) {
+	var objects []objectSummary
+	continuation := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if limit > 0 {
+			query.Set("max-keys", strconv.Itoa(limit))
+		}
+		if continuation != "" {
+			query.Set("continuation-token", continuation)
+		}
+
+		resp, err := b.do(http.MethodGet, "", query, nil, nil, -1, emptyPayloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode listing of %s: %w", prefix, err)
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, objectSummary{key: object.Key, size: object.Size})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		continuation = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key, or for the bucket itself when key is empty.
+// size is the body length, or -1 when there is no body. Error statuses are returned as *S3Error.
+func (b *S3Backend) do(method, key string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u := *b.endpoint
+	rawPath := strings.TrimSuffix(u.EscapedPath(), "/")
+	decodedPath := strings.TrimSuffix(u.Path, "/")
+	if b.pathStyle {
+		rawPath += "/" + s3Escape(b.bucket, true)
+		decodedPath += "/" + b.bucket
+	} else {
+		u.Host = b.bucket + "." + u.Host
+	}
+	if key != "" || !b.pathStyle {
+		rawPath += "/" + s3Escape(key, false)
+		decodedPath += "/" + key
+	}
+	u.Path, u.RawPath = decodedPath, rawPath
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	b.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, parseS3Error(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+func parseS3Error(statusCode int, body []byte) *S3Error {
+	s3Err := &S3Error{StatusCode: statusCode}
+	if len(body) > 0 {
+		xml.Unmarshal(body, s3Err)
+	}
+	return s3Err
+}
+
+func isS3NotFound(err error) bool {
+	var s3Err *S3Error
+	return errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound
+}
+
+func pathBase(p string) string {
+	base := path.Base("/" + strings.ReplaceAll(p, "\\", "/"))
+	if base == "/" {
+		return ""
+	}
+	return base
+}
+
+// s3FileInfo describes an object, or a prefix acting as a directory
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *s3FileInfo) Name() string       { return fi.name }
+func (fi *s3FileInfo) Size() int64        { return fi.size }
+func (fi *s3FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *s3FileInfo) IsDir() bool        { return fi.dir }
+func (fi *s3FileInfo) Sys() any           { return nil }
+
+func (fi *s3FileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// s3Object reads an object from the current offset onwards, issuing a new ranged GET after each seek
+type s3Object struct {
+	backend *S3Backend
+	key     string
+	info    *s3FileInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", o.offset))
+
+		resp, err := o.backend.do(http.MethodGet, o.key, nil, header, nil, -1, emptyPayloadHash)
+		if err != nil {
+			return 0, err
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if err == io.EOF && o.offset < o.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = o.offset + offset
+	case io.SeekEnd:
+		target = o.info.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = target
+	return target, nil
+}
+
+func (o *s3Object) Stat() (fs.FileInfo, error) {
+	return o.info, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
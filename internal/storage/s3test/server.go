@@ -0,0 +1,426 @@
+// Package s3test provides an in-memory stand-in for an S3-compatible service such as
+// MinIO, implementing just enough of the API for the S3 storage backend to be tested.
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server serves a single bucket with path-style addressing
+type Server struct {
+	*httptest.Server
+
+	Bucket      string
+	AccessKeyID string
+
+	mu         sync.Mutex
+	objects    map[string]object
+	uploads    map[string]*multipartUpload
+	nextUpload int
+	completed  int
+	failCopies map[string]bool
+}
+
+// multipartUpload is a multipart upload that has not been completed or aborted yet
+type multipartUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+type object struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewServer starts a server for bucket that accepts requests signed with accessKeyID.
+// It is closed when the test finishes.
+func NewServer(t interface{ Cleanup(func()) }, bucket, accessKeyID string) *Server {
+	s := &Server{
+		Bucket:      bucket,
+		AccessKeyID: accessKeyID,
+		objects:     make(map[string]object),
+		uploads:     make(map[string]*multipartUpload),
+		failCopies:  make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Object returns the content stored under key
+func (s *Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+// Keys returns the stored keys in order
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MultipartUploads returns the number of multipart uploads completed and of those still pending
+func (s *Server) MultipartUploads() (completed, pending int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completed, len(s.uploads)
+}
+
+// FailCopiesTo makes copies to key, whole or in parts, fail with an internal error
+func (s *Server) FailCopiesTo(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failCopies[key] = true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") ||
+		r.Header.Get("X-Amz-Date") == "" {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Missing or invalid signature")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Unsupported bucket operation")
+	case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+		s.createMultipartUpload(w, key)
+	case r.URL.Query().Has("uploadId"):
+		s.serveMultipartUpload(w, r, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Unsupported object operation")
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	if r.ContentLength < 0 {
+		writeError(w, http.StatusLengthRequired, "MissingContentLength", "Content-Length is required")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided content SHA-256 does not match")
+		return
+	}
+
+	s.mu.Lock()
+	s.objects[key] = object{data: data, modTime: time.Now().UTC().Truncate(time.Second)}
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := s.copySource(w, r, key)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.objects[key] = object{data: data, modTime: time.Now().UTC().Truncate(time.Second)}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, `<CopyObjectResult><ETag>"copied"</ETag></CopyObjectResult>`)
+}
+
+// copySource returns the content a copy to key reads, the range of it a part copy asks for,
+// writing an error response when it cannot be read
+func (s *Server) copySource(w http.ResponseWriter, r *http.Request, key string) ([]byte, bool) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid copy source")
+		return nil, false
+	}
+	sourceBucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	s.mu.Lock()
+	obj, ok := s.objects[sourceKey]
+	fail := s.failCopies[key]
+	s.mu.Unlock()
+
+	if fail {
+		writeError(w, http.StatusInternalServerError, "InternalError", "We encountered an internal error")
+		return nil, false
+	}
+	if !ok || sourceBucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+		return nil, false
+	}
+
+	data := obj.data
+	if sourceRange := r.Header.Get("X-Amz-Copy-Source-Range"); sourceRange != "" {
+		var first, last int
+		if _, err := fmt.Sscanf(sourceRange, "bytes=%d-%d", &first, &last); err != nil || first > last || last >= len(data) {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid copy source range")
+			return nil, false
+		}
+		data = data[first : last+1]
+	}
+	return data, true
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, key string) {
+	s.mu.Lock()
+	s.nextUpload++
+	uploadID := strconv.Itoa(s.nextUpload)
+	s.uploads[uploadID] = &multipartUpload{key: key, parts: make(map[int][]byte)}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>",
+		s.Bucket, key, uploadID)
+}
+
+// serveMultipartUpload uploads or copies a part, completes or aborts a multipart upload
+func (s *Server) serveMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	s.mu.Lock()
+	upload, ok := s.uploads[uploadID]
+	s.mu.Unlock()
+	if !ok || upload.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.uploadPart(w, r, key, upload)
+	case http.MethodPost:
+		s.completeMultipartUpload(w, r, uploadID, upload)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.uploads, uploadID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Unsupported multipart upload operation")
+	}
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, key string, upload *multipartUpload) {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid part number")
+		return
+	}
+
+	var data []byte
+	copied := r.Header.Get("X-Amz-Copy-Source") != ""
+	if copied {
+		var ok bool
+		if data, ok = s.copySource(w, r, key); !ok {
+			return
+		}
+	} else {
+		if data, err = io.ReadAll(r.Body); err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided content SHA-256 does not match")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	upload.parts[number] = data
+	s.mu.Unlock()
+
+	etag := partETag(data)
+	if copied {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", etag)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, uploadID string, upload *multipartUpload) {
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []byte
+	for i, part := range request.Parts {
+		content, ok := upload.parts[part.PartNumber]
+		if part.PartNumber != i+1 || !ok || part.ETag != partETag(content) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+			return
+		}
+		data = append(data, content...)
+	}
+
+	s.objects[upload.key] = object{data: data, modTime: time.Now().UTC().Truncate(time.Second)}
+	delete(s.uploads, uploadID)
+	s.completed++
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>", upload.key)
+}
+
+func partETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	obj, ok := s.objects[key]
+	s.mu.Unlock()
+
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+		return
+	}
+
+	data := obj.data
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && r.Method == http.MethodGet {
+		start, err := parseOpenRange(rangeHeader)
+		if err != nil || start >= int64(len(data)) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+		data = data[start:]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// parseOpenRange parses the "bytes=N-" ranges the backend sends
+func parseOpenRange(header string) (int64, error) {
+	value, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || !strings.HasSuffix(value, "-") {
+		return 0, fmt.Errorf("unsupported range %q", header)
+	}
+	return strconv.ParseInt(strings.TrimSuffix(value, "-"), 10, 64)
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is supported")
+		return
+	}
+
+	prefix := query.Get("prefix")
+	maxKeys := 1000
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, _ = strconv.Atoi(value)
+	}
+	after := query.Get("continuation-token")
+
+	var matching []string
+	for _, key := range s.Keys() {
+		if strings.HasPrefix(key, prefix) && key > after {
+			matching = append(matching, key)
+		}
+	}
+
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Name                  string    `xml:"Name"`
+		Prefix                string    `xml:"Prefix"`
+		KeyCount              int       `xml:"KeyCount"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{Name: s.Bucket, Prefix: prefix}
+
+	if len(matching) > maxKeys {
+		matching = matching[:maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = matching[len(matching)-1]
+	}
+	for _, key := range matching {
+		data, _ := s.Object(key)
+		result.Contents = append(result.Contents, content{Key: key, Size: len(data)})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,455 @@
+// Package tracing records OpenTelemetry spans of the work done to serve each request and
+// exports them in the OTLP JSON encoding, either to an OTLP/HTTP collector or as lines
+// written to a file or stdout. Traces started by clients are continued from their W3C
+// traceparent headers.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxQueuedSpans is the number of ended spans waiting for export. Spans ended while
+	// the queue is full are dropped rather than slowing down requests.
+	maxQueuedSpans = 2048
+	maxBatchSize   = 512
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+)
+
+// TraceID identifies a trace, the spans recorded for one request across services
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is set. The all-zero ID is invalid.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within its trace
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is set. The all-zero ID is invalid.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is what identifies a span to its children, possibly in another process
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled spans are exported. Children follow the decision of their parent.
+	Sampled bool
+	// TraceState is the vendor data of the W3C tracestate header, passed on unchanged
+	TraceState string
+}
+
+// IsValid reports whether both IDs of sc are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind tells the operation a span records apart, with the values of the OTLP enum
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+)
+
+// Attribute describes a span. Values are strings, int64s or bools.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+func Int64(key string, value int64) Attribute { return Attribute{key, value} }
+
+func Int(key string, value int) Attribute { return Attribute{key, int64(value)} }
+
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// Span records an operation from Start until End. The nil *Span returned while tracing is
+// disabled ignores every call, so callers never need to check for it.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	kind    SpanKind
+	start   time.Time
+
+	mu         sync.Mutex
+	name       string
+	attributes []Attribute
+	err        error
+	end        time.Time
+}
+
+// SpanContext returns the IDs of s, or an invalid SpanContext for a nil span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetName renames s, for operations only known once the span has started
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttributes adds attrs to s, replacing the values of keys already set
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.attributes {
+			if s.attributes[i].Key == attr.Key {
+				s.attributes[i].Value = attr.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.attributes = append(s.attributes, attr)
+		}
+	}
+}
+
+// RecordError marks s as failed with err. A nil err is ignored, so the result of the
+// traced operation can be passed as is.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		s.err = err
+	}
+}
+
+// End completes s and queues it for export when sampled. Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// Tracer starts spans and exports the sampled ones in batches
+type Tracer struct {
+	serviceName string
+	// sampleBound is compared with the low bits of new trace IDs to sample a ratio of traces
+	sampleBound uint64
+	exporter    Exporter
+
+	queue    chan *Span
+	dropped  atomic.Int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewTracer returns a tracer exporting spans of serviceName through exporter. sampleRatio
+// is the fraction of new traces recorded, from 0 to 1; traces continued from a client keep
+// the sampling decision of the client.
+func NewTracer(serviceName string, sampleRatio float64, exporter Exporter) *Tracer {
+	var sampleBound uint64
+	switch {
+	case sampleRatio >= 1:
+		sampleBound = 1 << 63
+	case sampleRatio > 0:
+		sampleBound = uint64(sampleRatio * (1 << 63))
+	}
+
+	t := &Tracer{
+		serviceName: serviceName,
+		sampleBound: sampleBound,
+		exporter:    exporter,
+		queue:       make(chan *Span, maxQueuedSpans),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span named name as a child of the span in ctx, or of the remote parent
+// extracted from a request, and returns a context carrying it. Without a parent the span
+// starts a new trace. A nil tracer returns ctx unchanged and a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return t.start(ctx, name, KindInternal, attrs)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, attrs []Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     t,
+		kind:       kind,
+		start:      time.Now(),
+		name:       name,
+		attributes: attrs,
+	}
+
+	parent, ok := parentFromContext(ctx)
+	if ok {
+		span.context = SpanContext{
+			TraceID:    parent.TraceID,
+			Sampled:    parent.Sampled,
+			TraceState: parent.TraceState,
+		}
+		span.parent = parent.SpanID
+	} else {
+		binary.BigEndian.PutUint64(span.context.TraceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(span.context.TraceID[8:], rand.Uint64())
+		span.context.Sampled = binary.BigEndian.Uint64(span.context.TraceID[8:])>>1 < t.sampleBound
+	}
+	for !span.context.SpanID.IsValid() {
+		binary.BigEndian.PutUint64(span.context.SpanID[:], rand.Uint64())
+	}
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// run exports queued spans once a batch is full or every exportInterval, until Shutdown
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, maxBatchSize)
+	export := func() {
+		if dropped := t.dropped.Swap(0); dropped > 0 {
+			slog.Warn("Dropped spans, the export queue was full", "spans", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.ExportSpans(ctx, batch); err != nil {
+			slog.Warn("Failed to export spans", "spans", len(batch), "error", err)
+		}
+		batch = make([]*Span, 0, maxBatchSize)
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case <-t.stop:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+					if len(batch) >= maxBatchSize {
+						export()
+					}
+				default:
+					export()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the spans ended so far and closes the exporter. Spans ended afterwards
+// are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault makes t the tracer of Start and StartServer. Tracing is disabled until it is set.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the default tracer, see Tracer.Start
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return defaultTracer.Load().Start(ctx, name, attrs...)
+}
+
+// StartServer starts a span with the default tracer for a request received with header,
+// continuing the trace of the client when header carries a valid traceparent
+func StartServer(ctx context.Context, header http.Header, name string, attrs ...Attribute) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	if remote, ok := extract(header); ok {
+		ctx = context.WithValue(ctx, remoteKey, remote)
+	}
+	return t.start(ctx, name, KindServer, attrs)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// parentFromContext returns the span context new spans started with ctx descend from
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.context, true
+	}
+	remote, ok := ctx.Value(remoteKey).(SpanContext)
+	return remote, ok
+}
+
+// Headers of the W3C trace context
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const maxTraceStateLength = 512
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// extract reads the span context of the client from the W3C trace context headers
+func extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	var traceState string
+	for _, value := range header.Values(TracestateHeader) {
+		if traceState != "" {
+			traceState += ","
+		}
+		traceState += value
+	}
+	if len(traceState) <= maxTraceStateLength {
+		sc.TraceState = traceState
+	}
+	return sc, true
+}
+
+// ParseTraceparent parses a W3C traceparent header value, version-traceid-spanid-flags.
+// Versions after 00 are read as far as version 00 defines them.
+func ParseTraceparent(value string) (SpanContext, error) {
+	const length = 55 // 2 + 1 + 32 + 1 + 16 + 1 + 2
+
+	if len(value) < length || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	version, ok := decodeLowerHex(value[:2])
+	if !ok || version[0] == 0xff || version[0] == 0 && len(value) != length ||
+		len(value) > length && value[length] != '-' {
+		return SpanContext{}, errInvalidTraceparent
+	}
+
+	var sc SpanContext
+	traceID, ok := decodeLowerHex(value[3:35])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	spanID, ok := decodeLowerHex(value[36:52])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	flags, ok := decodeLowerHex(value[53:55])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&0x01 != 0
+
+	if !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// Traceparent formats sc as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// decodeLowerHex decodes s, rejecting the upper case digits the W3C format forbids
+func decodeLowerHex(s string) ([]byte, bool) {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
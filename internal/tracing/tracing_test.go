@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingExporter keeps the spans it is given
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with more fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"version 00 with more fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseTraceparent(%q) error = %v, want valid %v", tt.value, err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("parsed IDs %s %s", sc.TraceID, sc.SpanID)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTracer_SpansFormTrees(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer("test", 1, exporter)
+	SetDefault(tracer)
+	defer SetDefault(nil)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(TracestateHeader, "vendor=value")
+
+	ctx, server := StartServer(context.Background(), header, "GET /files")
+	_, child := Start(ctx, "FileService.GetFileData", String("file.path", "/a.txt"))
+	child.RecordError(errors.New("file not found"))
+	child.End()
+	server.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exporter.spans))
+	}
+
+	if got := server.SpanContext(); got.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || got.TraceState != "vendor=value" {
+		t.Errorf("server span did not continue the client trace: %+v", got)
+	}
+	if server.parent.String() != "00f067aa0ba902b7" || server.kind != KindServer {
+		t.Errorf("server span parent %s kind %d", server.parent, server.kind)
+	}
+	if child.SpanContext().TraceID != server.SpanContext().TraceID || child.parent != server.SpanContext().SpanID {
+		t.Errorf("child span is not a child of the server span")
+	}
+}
+
+func TestTracer_SamplingFollowsTheClient(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer("test", 1, exporter)
+	SetDefault(tracer)
+	defer SetDefault(nil)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, server := StartServer(context.Background(), header, "GET /files")
+	_, child := Start(ctx, "child")
+	child.End()
+	server.End()
+	tracer.Shutdown(context.Background())
+
+	if len(exporter.spans) != 0 {
+		t.Errorf("exported %d spans of a trace the client did not sample", len(exporter.spans))
+	}
+	if !child.SpanContext().IsValid() {
+		t.Errorf("unsampled spans still need IDs to pass the trace on")
+	}
+
+	never := NewTracer("test", 0, exporter)
+	_, span := never.Start(context.Background(), "root")
+	if span.SpanContext().Sampled {
+		t.Errorf("a sample ratio of 0 sampled a new trace")
+	}
+	never.Shutdown(context.Background())
+}
+
+func TestStart_DisabledTracingIsANoOp(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(ctx, "anything")
+	if got != ctx || span != nil {
+		t.Fatalf("Start without a default tracer returned a span")
+	}
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+}
+
+func TestWriterExporter_WritesOTLPJSON(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("cloudlet", 1, NewWriterExporter(&buf))
+	ctx, parent := tracer.Start(context.Background(), "parent", Int64("file.size", 42), Bool("cached", true))
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	tracer.Shutdown(context.Background())
+
+	var request otlpRequest
+	if err := json.Unmarshal(buf.Bytes(), &request); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "\n") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("expected one line per batch, got %q", buf.String())
+	}
+
+	resource := request.ResourceSpans[0]
+	if *resource.Resource.Attributes[0].Value.StringValue != "cloudlet" {
+		t.Errorf("service.name = %v", resource.Resource.Attributes)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID != "" {
+		t.Errorf("parent IDs not encoded: %+v", spans)
+	}
+	if *spans[1].Attributes[0].Value.IntValue != "42" || !*spans[1].Attributes[1].Value.BoolValue {
+		t.Errorf("attributes = %+v", spans[1].Attributes)
+	}
+}
+
+func TestOTLPExporter_PostsToCollector(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	exporter, err := NewOTLPExporter(collector.URL)
+	if err != nil {
+		t.Fatalf("NewOTLPExporter: %v", err)
+	}
+	tracer := NewTracer("cloudlet", 1, exporter)
+	_, span := tracer.Start(context.Background(), "upload")
+	span.End()
+	tracer.Shutdown(context.Background())
+
+	if path != "/v1/traces" || contentType != "application/json" {
+		t.Errorf("posted to %s as %s", path, contentType)
+	}
+	if !bytes.Contains(body, []byte(`"name":"upload"`)) {
+		t.Errorf("body = %s", body)
+	}
+
+	if _, err := NewOTLPExporter("localhost:4318"); err == nil {
+		t.Errorf("an endpoint without scheme should be rejected")
+	}
+}
@@ -2,7 +2,9 @@ package transaction
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+
+	"github.com/anddsdev/cloudlet/internal/metrics"
 )
 
 // Operation represents a reversible operation
@@ -16,6 +18,7 @@ type Operation interface {
 type TransactionManager struct {
 	operations []Operation
 	executed   []Operation
+	logger     *slog.Logger
 }
 
 // NewTransactionManager creates a new transaction manager
@@ -23,9 +26,16 @@ func NewTransactionManager() *TransactionManager {
 	return &TransactionManager{
 		operations: make([]Operation, 0),
 		executed:   make([]Operation, 0),
+		logger:     slog.Default(),
 	}
 }
 
+// WithLogger makes the transaction log its failures and rollbacks through logger
+func (tm *TransactionManager) WithLogger(logger *slog.Logger) *TransactionManager {
+	tm.logger = logger
+	return tm
+}
+
 // AddOperation adds an operation to the transaction
 func (tm *TransactionManager) AddOperation(op Operation) {
 	tm.operations = append(tm.operations, op)
@@ -35,9 +45,12 @@ func (tm *TransactionManager) AddOperation(op Operation) {
 func (tm *TransactionManager) Execute() error {
 	for i, op := range tm.operations {
 		if err := op.Execute(); err != nil {
+			tm.logger.Warn("Operation failed, rolling back", "operation", op.Description(), "step", i, "error", err)
+
 			// Rollback all previously executed operations
 			rollbackErr := tm.rollbackExecuted()
 			if rollbackErr != nil {
+				tm.logger.Error("Rollback failed", "operation", op.Description(), "error", rollbackErr)
 				return fmt.Errorf("operation %d failed: %w, rollback also failed: %v", i, err, rollbackErr)
 			}
 			return fmt.Errorf("operation %d failed: %w (rollback successful)", i, err)
@@ -49,6 +62,7 @@ func (tm *TransactionManager) Execute() error {
 
 // rollbackExecuted rolls back all executed operations in reverse order
 func (tm *TransactionManager) rollbackExecuted() error {
+	metrics.TransactionRollbacks.Inc()
 	var rollbackErrors []error
 	
 	// Rollback in reverse order
@@ -163,6 +177,7 @@ func (ca *CompensatingAction) Description() string {
 // RecoveryManager handles failed operations and attempts recovery
 type RecoveryManager struct {
 	failedOperations []FailedOperation
+	logger           *slog.Logger
 }
 
 // FailedOperation represents an operation that failed and needs recovery
@@ -178,9 +193,16 @@ type FailedOperation struct {
 func NewRecoveryManager() *RecoveryManager {
 	return &RecoveryManager{
 		failedOperations: make([]FailedOperation, 0),
+		logger:           slog.Default(),
 	}
 }
 
+// WithLogger makes the recovery manager log failures and recoveries through logger
+func (rm *RecoveryManager) WithLogger(logger *slog.Logger) *RecoveryManager {
+	rm.logger = logger
+	return rm
+}
+
 // RecordFailure records a failed operation for later recovery
 func (rm *RecoveryManager) RecordFailure(op Operation, err error, recoverable bool) {
 	failure := FailedOperation{
@@ -193,7 +215,7 @@ func (rm *RecoveryManager) RecordFailure(op Operation, err error, recoverable bo
 	rm.failedOperations = append(rm.failedOperations, failure)
 	
 	// Log the failure for audit purposes
-	log.Printf("Operation failed: %s - Error: %v - Recoverable: %t", op.Description(), err, recoverable)
+	rm.logger.Error("Operation failed", "operation", op.Description(), "error", err, "recoverable", recoverable)
 }
 
 // AttemptRecovery attempts to recover failed operations
@@ -214,7 +236,7 @@ func (rm *RecoveryManager) AttemptRecovery() error {
 		} else {
 			// Recovery successful, remove from failed operations
 			rm.failedOperations = append(rm.failedOperations[:i], rm.failedOperations[i+1:]...)
-			log.Printf("Recovery successful for: %s", failure.Operation.Description())
+			rm.logger.Info("Recovery successful", "operation", failure.Operation.Description())
 		}
 	}
 	
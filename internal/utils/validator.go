@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/anddsdev/cloudlet/internal/security"
 )
 
 var (
@@ -55,6 +57,11 @@ func IsValidFilename(filename string) bool {
 		return false
 	}
 
+	// Names of the directories cloudlet keeps in the storage tree
+	if security.IsReservedName(filename) {
+		return false
+	}
+
 	// Check if filename matches our allowed pattern
 	if !validFilenameRegex.MatchString(filename) {
 		return false
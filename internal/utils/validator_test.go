@@ -325,6 +325,11 @@ func TestIsValidFilename(t *testing.T) {
 			filename: ".file*.txt",
 			expected: false,
 		},
+		{
+			name:     "Reserved blob store name",
+			filename: ".cloudlet-blobs",
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {